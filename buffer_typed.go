@@ -0,0 +1,597 @@
+package go2opencl
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// Typed helpers for creating, reading, writing, filling and mapping buffers
+// of the OpenCL scalar types. Offsets are always given in bytes, lengths in
+// elements of the type. Transfers are checked against the size of the buffer.
+
+// Points the slice header at the mapped region, measured in elements of elemSize bytes.
+func (mb *MappedMemObject) sliceHeader(slicePtr unsafe.Pointer, elemSize int) {
+	sliceHeader := (*reflect.SliceHeader)(slicePtr)
+	sliceHeader.Cap = mb.size / elemSize
+	sliceHeader.Len = mb.size / elemSize
+	sliceHeader.Data = uintptr(mb.ptr)
+}
+
+// ////////////// int8 ////////////////
+func (ctx *Context) CreateEmptyBufferInt8(flags MemFlag, length int) (*MemObject, error) {
+	return ctx.CreateBufferUnsafe(flags, length, nil)
+}
+
+func (ctx *Context) CreateBufferInt8(flags MemFlag, data []int8) (*MemObject, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidBufferSize
+	}
+	return ctx.CreateBufferUnsafe(flags, len(data), unsafe.Pointer(&data[0]))
+}
+
+func (q *CommandQueue) EnqueueWriteBufferInt8(buffer *MemObject, blocking bool, offset int, data []int8, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueWriteBuffer(buffer, blocking, offset, len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+func (q *CommandQueue) EnqueueReadBufferInt8(buffer *MemObject, blocking bool, offset int, data []int8, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueReadBuffer(buffer, blocking, offset, len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+// Fills length elements starting at byte offset with value.
+func (q *CommandQueue) EnqueueFillBufferInt8(buffer *MemObject, value int8, offset, length int, eventWaitList []*Event) (*Event, error) {
+	return q.EnqueueFillBuffer(buffer, unsafe.Pointer(&value), 1, offset, length, eventWaitList)
+}
+
+// Maps length elements starting at byte offset. The mapped data is available through Int8Slice.
+func (q *CommandQueue) EnqueueMapBufferInt8(buffer *MemObject, blocking bool, flags MapFlag, offset, length int, eventWaitList []*Event) (*MappedMemObject, *Event, error) {
+	return q.EnqueueMapBuffer(buffer, blocking, flags, offset, length, eventWaitList)
+}
+
+func (mb *MappedMemObject) Int8Slice() []int8 {
+	var s []int8
+	mb.sliceHeader(unsafe.Pointer(&s), 1)
+	return s
+}
+
+// ////////////// uint8 ////////////////
+func (ctx *Context) CreateEmptyBufferUint8(flags MemFlag, length int) (*MemObject, error) {
+	return ctx.CreateBufferUnsafe(flags, length, nil)
+}
+
+func (ctx *Context) CreateBufferUint8(flags MemFlag, data []uint8) (*MemObject, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidBufferSize
+	}
+	return ctx.CreateBufferUnsafe(flags, len(data), unsafe.Pointer(&data[0]))
+}
+
+func (q *CommandQueue) EnqueueWriteBufferUint8(buffer *MemObject, blocking bool, offset int, data []uint8, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueWriteBuffer(buffer, blocking, offset, len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+func (q *CommandQueue) EnqueueReadBufferUint8(buffer *MemObject, blocking bool, offset int, data []uint8, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueReadBuffer(buffer, blocking, offset, len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+// Fills length elements starting at byte offset with value.
+func (q *CommandQueue) EnqueueFillBufferUint8(buffer *MemObject, value uint8, offset, length int, eventWaitList []*Event) (*Event, error) {
+	return q.EnqueueFillBuffer(buffer, unsafe.Pointer(&value), 1, offset, length, eventWaitList)
+}
+
+// Maps length elements starting at byte offset. The mapped data is available through Uint8Slice.
+func (q *CommandQueue) EnqueueMapBufferUint8(buffer *MemObject, blocking bool, flags MapFlag, offset, length int, eventWaitList []*Event) (*MappedMemObject, *Event, error) {
+	return q.EnqueueMapBuffer(buffer, blocking, flags, offset, length, eventWaitList)
+}
+
+func (mb *MappedMemObject) Uint8Slice() []uint8 {
+	var s []uint8
+	mb.sliceHeader(unsafe.Pointer(&s), 1)
+	return s
+}
+
+// ////////////// int16 ////////////////
+func (ctx *Context) CreateEmptyBufferInt16(flags MemFlag, length int) (*MemObject, error) {
+	return ctx.CreateBufferUnsafe(flags, 2*length, nil)
+}
+
+func (ctx *Context) CreateBufferInt16(flags MemFlag, data []int16) (*MemObject, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidBufferSize
+	}
+	return ctx.CreateBufferUnsafe(flags, 2*len(data), unsafe.Pointer(&data[0]))
+}
+
+func (q *CommandQueue) EnqueueWriteBufferInt16(buffer *MemObject, blocking bool, offset int, data []int16, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueWriteBuffer(buffer, blocking, offset, 2*len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+func (q *CommandQueue) EnqueueReadBufferInt16(buffer *MemObject, blocking bool, offset int, data []int16, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueReadBuffer(buffer, blocking, offset, 2*len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+// Fills length elements starting at byte offset with value. offset must be a multiple of 2.
+func (q *CommandQueue) EnqueueFillBufferInt16(buffer *MemObject, value int16, offset, length int, eventWaitList []*Event) (*Event, error) {
+	if offset%2 != 0 {
+		return nil, ErrInvalidValue
+	}
+	return q.EnqueueFillBuffer(buffer, unsafe.Pointer(&value), 2, offset, 2*length, eventWaitList)
+}
+
+// Maps length elements starting at byte offset. The mapped data is available through Int16Slice.
+func (q *CommandQueue) EnqueueMapBufferInt16(buffer *MemObject, blocking bool, flags MapFlag, offset, length int, eventWaitList []*Event) (*MappedMemObject, *Event, error) {
+	return q.EnqueueMapBuffer(buffer, blocking, flags, offset, 2*length, eventWaitList)
+}
+
+func (mb *MappedMemObject) Int16Slice() []int16 {
+	var s []int16
+	mb.sliceHeader(unsafe.Pointer(&s), 2)
+	return s
+}
+
+// ////////////// uint16 ////////////////
+func (ctx *Context) CreateEmptyBufferUint16(flags MemFlag, length int) (*MemObject, error) {
+	return ctx.CreateBufferUnsafe(flags, 2*length, nil)
+}
+
+func (ctx *Context) CreateBufferUint16(flags MemFlag, data []uint16) (*MemObject, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidBufferSize
+	}
+	return ctx.CreateBufferUnsafe(flags, 2*len(data), unsafe.Pointer(&data[0]))
+}
+
+func (q *CommandQueue) EnqueueWriteBufferUint16(buffer *MemObject, blocking bool, offset int, data []uint16, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueWriteBuffer(buffer, blocking, offset, 2*len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+func (q *CommandQueue) EnqueueReadBufferUint16(buffer *MemObject, blocking bool, offset int, data []uint16, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueReadBuffer(buffer, blocking, offset, 2*len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+// Fills length elements starting at byte offset with value. offset must be a multiple of 2.
+func (q *CommandQueue) EnqueueFillBufferUint16(buffer *MemObject, value uint16, offset, length int, eventWaitList []*Event) (*Event, error) {
+	if offset%2 != 0 {
+		return nil, ErrInvalidValue
+	}
+	return q.EnqueueFillBuffer(buffer, unsafe.Pointer(&value), 2, offset, 2*length, eventWaitList)
+}
+
+// Maps length elements starting at byte offset. The mapped data is available through Uint16Slice.
+func (q *CommandQueue) EnqueueMapBufferUint16(buffer *MemObject, blocking bool, flags MapFlag, offset, length int, eventWaitList []*Event) (*MappedMemObject, *Event, error) {
+	return q.EnqueueMapBuffer(buffer, blocking, flags, offset, 2*length, eventWaitList)
+}
+
+func (mb *MappedMemObject) Uint16Slice() []uint16 {
+	var s []uint16
+	mb.sliceHeader(unsafe.Pointer(&s), 2)
+	return s
+}
+
+// ////////////// half ////////////////
+func (ctx *Context) CreateEmptyBufferHalf(flags MemFlag, length int) (*MemObject, error) {
+	return ctx.CreateBufferUnsafe(flags, 2*length, nil)
+}
+
+func (ctx *Context) CreateBufferHalf(flags MemFlag, data []Half) (*MemObject, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidBufferSize
+	}
+	return ctx.CreateBufferUnsafe(flags, 2*len(data), unsafe.Pointer(&data[0]))
+}
+
+func (q *CommandQueue) EnqueueWriteBufferHalf(buffer *MemObject, blocking bool, offset int, data []Half, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueWriteBuffer(buffer, blocking, offset, 2*len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+func (q *CommandQueue) EnqueueReadBufferHalf(buffer *MemObject, blocking bool, offset int, data []Half, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueReadBuffer(buffer, blocking, offset, 2*len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+// Fills length elements starting at byte offset with value. offset must be a multiple of 2.
+func (q *CommandQueue) EnqueueFillBufferHalf(buffer *MemObject, value Half, offset, length int, eventWaitList []*Event) (*Event, error) {
+	if offset%2 != 0 {
+		return nil, ErrInvalidValue
+	}
+	return q.EnqueueFillBuffer(buffer, unsafe.Pointer(&value), 2, offset, 2*length, eventWaitList)
+}
+
+// Maps length elements starting at byte offset. The mapped data is available through HalfSlice.
+func (q *CommandQueue) EnqueueMapBufferHalf(buffer *MemObject, blocking bool, flags MapFlag, offset, length int, eventWaitList []*Event) (*MappedMemObject, *Event, error) {
+	return q.EnqueueMapBuffer(buffer, blocking, flags, offset, 2*length, eventWaitList)
+}
+
+func (mb *MappedMemObject) HalfSlice() []Half {
+	var s []Half
+	mb.sliceHeader(unsafe.Pointer(&s), 2)
+	return s
+}
+
+// ////////////// int32 ////////////////
+func (ctx *Context) CreateEmptyBufferInt32(flags MemFlag, length int) (*MemObject, error) {
+	return ctx.CreateBufferUnsafe(flags, 4*length, nil)
+}
+
+func (ctx *Context) CreateBufferInt32(flags MemFlag, data []int32) (*MemObject, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidBufferSize
+	}
+	return ctx.CreateBufferUnsafe(flags, 4*len(data), unsafe.Pointer(&data[0]))
+}
+
+func (q *CommandQueue) EnqueueWriteBufferInt32(buffer *MemObject, blocking bool, offset int, data []int32, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueWriteBuffer(buffer, blocking, offset, 4*len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+func (q *CommandQueue) EnqueueReadBufferInt32(buffer *MemObject, blocking bool, offset int, data []int32, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueReadBuffer(buffer, blocking, offset, 4*len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+// Fills length elements starting at byte offset with value. offset must be a multiple of 4.
+func (q *CommandQueue) EnqueueFillBufferInt32(buffer *MemObject, value int32, offset, length int, eventWaitList []*Event) (*Event, error) {
+	if offset%4 != 0 {
+		return nil, ErrInvalidValue
+	}
+	return q.EnqueueFillBuffer(buffer, unsafe.Pointer(&value), 4, offset, 4*length, eventWaitList)
+}
+
+// Maps length elements starting at byte offset. The mapped data is available through Int32Slice.
+func (q *CommandQueue) EnqueueMapBufferInt32(buffer *MemObject, blocking bool, flags MapFlag, offset, length int, eventWaitList []*Event) (*MappedMemObject, *Event, error) {
+	return q.EnqueueMapBuffer(buffer, blocking, flags, offset, 4*length, eventWaitList)
+}
+
+func (mb *MappedMemObject) Int32Slice() []int32 {
+	var s []int32
+	mb.sliceHeader(unsafe.Pointer(&s), 4)
+	return s
+}
+
+// ////////////// uint32 ////////////////
+func (ctx *Context) CreateEmptyBufferUint32(flags MemFlag, length int) (*MemObject, error) {
+	return ctx.CreateBufferUnsafe(flags, 4*length, nil)
+}
+
+func (ctx *Context) CreateBufferUint32(flags MemFlag, data []uint32) (*MemObject, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidBufferSize
+	}
+	return ctx.CreateBufferUnsafe(flags, 4*len(data), unsafe.Pointer(&data[0]))
+}
+
+func (q *CommandQueue) EnqueueWriteBufferUint32(buffer *MemObject, blocking bool, offset int, data []uint32, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueWriteBuffer(buffer, blocking, offset, 4*len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+func (q *CommandQueue) EnqueueReadBufferUint32(buffer *MemObject, blocking bool, offset int, data []uint32, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueReadBuffer(buffer, blocking, offset, 4*len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+// Fills length elements starting at byte offset with value. offset must be a multiple of 4.
+func (q *CommandQueue) EnqueueFillBufferUint32(buffer *MemObject, value uint32, offset, length int, eventWaitList []*Event) (*Event, error) {
+	if offset%4 != 0 {
+		return nil, ErrInvalidValue
+	}
+	return q.EnqueueFillBuffer(buffer, unsafe.Pointer(&value), 4, offset, 4*length, eventWaitList)
+}
+
+// Maps length elements starting at byte offset. The mapped data is available through Uint32Slice.
+func (q *CommandQueue) EnqueueMapBufferUint32(buffer *MemObject, blocking bool, flags MapFlag, offset, length int, eventWaitList []*Event) (*MappedMemObject, *Event, error) {
+	return q.EnqueueMapBuffer(buffer, blocking, flags, offset, 4*length, eventWaitList)
+}
+
+func (mb *MappedMemObject) Uint32Slice() []uint32 {
+	var s []uint32
+	mb.sliceHeader(unsafe.Pointer(&s), 4)
+	return s
+}
+
+// ////////////// int64 ////////////////
+func (ctx *Context) CreateEmptyBufferInt64(flags MemFlag, length int) (*MemObject, error) {
+	return ctx.CreateBufferUnsafe(flags, 8*length, nil)
+}
+
+func (ctx *Context) CreateBufferInt64(flags MemFlag, data []int64) (*MemObject, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidBufferSize
+	}
+	return ctx.CreateBufferUnsafe(flags, 8*len(data), unsafe.Pointer(&data[0]))
+}
+
+func (q *CommandQueue) EnqueueWriteBufferInt64(buffer *MemObject, blocking bool, offset int, data []int64, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueWriteBuffer(buffer, blocking, offset, 8*len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+func (q *CommandQueue) EnqueueReadBufferInt64(buffer *MemObject, blocking bool, offset int, data []int64, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueReadBuffer(buffer, blocking, offset, 8*len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+// Fills length elements starting at byte offset with value. offset must be a multiple of 8.
+func (q *CommandQueue) EnqueueFillBufferInt64(buffer *MemObject, value int64, offset, length int, eventWaitList []*Event) (*Event, error) {
+	if offset%8 != 0 {
+		return nil, ErrInvalidValue
+	}
+	return q.EnqueueFillBuffer(buffer, unsafe.Pointer(&value), 8, offset, 8*length, eventWaitList)
+}
+
+// Maps length elements starting at byte offset. The mapped data is available through Int64Slice.
+func (q *CommandQueue) EnqueueMapBufferInt64(buffer *MemObject, blocking bool, flags MapFlag, offset, length int, eventWaitList []*Event) (*MappedMemObject, *Event, error) {
+	return q.EnqueueMapBuffer(buffer, blocking, flags, offset, 8*length, eventWaitList)
+}
+
+func (mb *MappedMemObject) Int64Slice() []int64 {
+	var s []int64
+	mb.sliceHeader(unsafe.Pointer(&s), 8)
+	return s
+}
+
+// ////////////// uint64 ////////////////
+func (ctx *Context) CreateEmptyBufferUint64(flags MemFlag, length int) (*MemObject, error) {
+	return ctx.CreateBufferUnsafe(flags, 8*length, nil)
+}
+
+func (ctx *Context) CreateBufferUint64(flags MemFlag, data []uint64) (*MemObject, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidBufferSize
+	}
+	return ctx.CreateBufferUnsafe(flags, 8*len(data), unsafe.Pointer(&data[0]))
+}
+
+func (q *CommandQueue) EnqueueWriteBufferUint64(buffer *MemObject, blocking bool, offset int, data []uint64, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueWriteBuffer(buffer, blocking, offset, 8*len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+func (q *CommandQueue) EnqueueReadBufferUint64(buffer *MemObject, blocking bool, offset int, data []uint64, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueReadBuffer(buffer, blocking, offset, 8*len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+// Fills length elements starting at byte offset with value. offset must be a multiple of 8.
+func (q *CommandQueue) EnqueueFillBufferUint64(buffer *MemObject, value uint64, offset, length int, eventWaitList []*Event) (*Event, error) {
+	if offset%8 != 0 {
+		return nil, ErrInvalidValue
+	}
+	return q.EnqueueFillBuffer(buffer, unsafe.Pointer(&value), 8, offset, 8*length, eventWaitList)
+}
+
+// Maps length elements starting at byte offset. The mapped data is available through Uint64Slice.
+func (q *CommandQueue) EnqueueMapBufferUint64(buffer *MemObject, blocking bool, flags MapFlag, offset, length int, eventWaitList []*Event) (*MappedMemObject, *Event, error) {
+	return q.EnqueueMapBuffer(buffer, blocking, flags, offset, 8*length, eventWaitList)
+}
+
+func (mb *MappedMemObject) Uint64Slice() []uint64 {
+	var s []uint64
+	mb.sliceHeader(unsafe.Pointer(&s), 8)
+	return s
+}
+
+// ////////////// float32 ////////////////
+func (ctx *Context) CreateEmptyBufferFloat32(flags MemFlag, length int) (*MemObject, error) {
+	return ctx.CreateBufferUnsafe(flags, 4*length, nil)
+}
+
+func (ctx *Context) CreateBufferFloat32(flags MemFlag, data []float32) (*MemObject, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidBufferSize
+	}
+	return ctx.CreateBufferUnsafe(flags, 4*len(data), unsafe.Pointer(&data[0]))
+}
+
+func (q *CommandQueue) EnqueueWriteBufferFloat32(buffer *MemObject, blocking bool, offset int, data []float32, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueWriteBuffer(buffer, blocking, offset, 4*len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+func (q *CommandQueue) EnqueueReadBufferFloat32(buffer *MemObject, blocking bool, offset int, data []float32, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueReadBuffer(buffer, blocking, offset, 4*len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+// Fills length elements starting at byte offset with value. offset must be a multiple of 4.
+func (q *CommandQueue) EnqueueFillBufferFloat32(buffer *MemObject, value float32, offset, length int, eventWaitList []*Event) (*Event, error) {
+	if offset%4 != 0 {
+		return nil, ErrInvalidValue
+	}
+	return q.EnqueueFillBuffer(buffer, unsafe.Pointer(&value), 4, offset, 4*length, eventWaitList)
+}
+
+// Maps length elements starting at byte offset. The mapped data is available through Float32Slice.
+func (q *CommandQueue) EnqueueMapBufferFloat32(buffer *MemObject, blocking bool, flags MapFlag, offset, length int, eventWaitList []*Event) (*MappedMemObject, *Event, error) {
+	return q.EnqueueMapBuffer(buffer, blocking, flags, offset, 4*length, eventWaitList)
+}
+
+func (mb *MappedMemObject) Float32Slice() []float32 {
+	var s []float32
+	mb.sliceHeader(unsafe.Pointer(&s), 4)
+	return s
+}
+
+// ////////////// float64 ////////////////
+func (ctx *Context) CreateEmptyBufferFloat64(flags MemFlag, length int) (*MemObject, error) {
+	return ctx.CreateBufferUnsafe(flags, 8*length, nil)
+}
+
+func (ctx *Context) CreateBufferFloat64(flags MemFlag, data []float64) (*MemObject, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidBufferSize
+	}
+	return ctx.CreateBufferUnsafe(flags, 8*len(data), unsafe.Pointer(&data[0]))
+}
+
+func (q *CommandQueue) EnqueueWriteBufferFloat64(buffer *MemObject, blocking bool, offset int, data []float64, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueWriteBuffer(buffer, blocking, offset, 8*len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+func (q *CommandQueue) EnqueueReadBufferFloat64(buffer *MemObject, blocking bool, offset int, data []float64, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueReadBuffer(buffer, blocking, offset, 8*len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+// Fills length elements starting at byte offset with value. offset must be a multiple of 8.
+func (q *CommandQueue) EnqueueFillBufferFloat64(buffer *MemObject, value float64, offset, length int, eventWaitList []*Event) (*Event, error) {
+	if offset%8 != 0 {
+		return nil, ErrInvalidValue
+	}
+	return q.EnqueueFillBuffer(buffer, unsafe.Pointer(&value), 8, offset, 8*length, eventWaitList)
+}
+
+// Maps length elements starting at byte offset. The mapped data is available through Float64Slice.
+func (q *CommandQueue) EnqueueMapBufferFloat64(buffer *MemObject, blocking bool, flags MapFlag, offset, length int, eventWaitList []*Event) (*MappedMemObject, *Event, error) {
+	return q.EnqueueMapBuffer(buffer, blocking, flags, offset, 8*length, eventWaitList)
+}
+
+func (mb *MappedMemObject) Float64Slice() []float64 {
+	var s []float64
+	mb.sliceHeader(unsafe.Pointer(&s), 8)
+	return s
+}
+
+// ////////////// complex64 ////////////////
+func (ctx *Context) CreateEmptyBufferComplex64(flags MemFlag, length int) (*MemObject, error) {
+	return ctx.CreateBufferUnsafe(flags, 8*length, nil)
+}
+
+func (ctx *Context) CreateBufferComplex64(flags MemFlag, data []complex64) (*MemObject, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidBufferSize
+	}
+	return ctx.CreateBufferUnsafe(flags, 8*len(data), unsafe.Pointer(&data[0]))
+}
+
+func (q *CommandQueue) EnqueueWriteBufferComplex64(buffer *MemObject, blocking bool, offset int, data []complex64, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueWriteBuffer(buffer, blocking, offset, 8*len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+func (q *CommandQueue) EnqueueReadBufferComplex64(buffer *MemObject, blocking bool, offset int, data []complex64, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueReadBuffer(buffer, blocking, offset, 8*len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+// Fills length elements starting at byte offset with value. offset must be a multiple of 8.
+func (q *CommandQueue) EnqueueFillBufferComplex64(buffer *MemObject, value complex64, offset, length int, eventWaitList []*Event) (*Event, error) {
+	if offset%8 != 0 {
+		return nil, ErrInvalidValue
+	}
+	return q.EnqueueFillBuffer(buffer, unsafe.Pointer(&value), 8, offset, 8*length, eventWaitList)
+}
+
+// Maps length elements starting at byte offset. The mapped data is available through Complex64Slice.
+func (q *CommandQueue) EnqueueMapBufferComplex64(buffer *MemObject, blocking bool, flags MapFlag, offset, length int, eventWaitList []*Event) (*MappedMemObject, *Event, error) {
+	return q.EnqueueMapBuffer(buffer, blocking, flags, offset, 8*length, eventWaitList)
+}
+
+func (mb *MappedMemObject) Complex64Slice() []complex64 {
+	var s []complex64
+	mb.sliceHeader(unsafe.Pointer(&s), 8)
+	return s
+}
+
+// ////////////// complex128 ////////////////
+func (ctx *Context) CreateEmptyBufferComplex128(flags MemFlag, length int) (*MemObject, error) {
+	return ctx.CreateBufferUnsafe(flags, 16*length, nil)
+}
+
+func (ctx *Context) CreateBufferComplex128(flags MemFlag, data []complex128) (*MemObject, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidBufferSize
+	}
+	return ctx.CreateBufferUnsafe(flags, 16*len(data), unsafe.Pointer(&data[0]))
+}
+
+func (q *CommandQueue) EnqueueWriteBufferComplex128(buffer *MemObject, blocking bool, offset int, data []complex128, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueWriteBuffer(buffer, blocking, offset, 16*len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+func (q *CommandQueue) EnqueueReadBufferComplex128(buffer *MemObject, blocking bool, offset int, data []complex128, eventWaitList []*Event) (*Event, error) {
+	if len(data) == 0 {
+		return nil, buffer.checkRange(offset, 0)
+	}
+	return q.EnqueueReadBuffer(buffer, blocking, offset, 16*len(data), unsafe.Pointer(&data[0]), eventWaitList)
+}
+
+// Fills length elements starting at byte offset with value. offset must be a multiple of 16.
+func (q *CommandQueue) EnqueueFillBufferComplex128(buffer *MemObject, value complex128, offset, length int, eventWaitList []*Event) (*Event, error) {
+	if offset%16 != 0 {
+		return nil, ErrInvalidValue
+	}
+	return q.EnqueueFillBuffer(buffer, unsafe.Pointer(&value), 16, offset, 16*length, eventWaitList)
+}
+
+// Maps length elements starting at byte offset. The mapped data is available through Complex128Slice.
+func (q *CommandQueue) EnqueueMapBufferComplex128(buffer *MemObject, blocking bool, flags MapFlag, offset, length int, eventWaitList []*Event) (*MappedMemObject, *Event, error) {
+	return q.EnqueueMapBuffer(buffer, blocking, flags, offset, 16*length, eventWaitList)
+}
+
+func (mb *MappedMemObject) Complex128Slice() []complex128 {
+	var s []complex128
+	mb.sliceHeader(unsafe.Pointer(&s), 16)
+	return s
+}
@@ -0,0 +1,129 @@
+package go2opencl
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Parsing of the build logs of OpenCL compilers. The Clang based compilers
+// (Intel, AMD, POCL, Mesa) report diagnostics as
+//
+//	<source>:12:5: error: use of undeclared identifier 'x'
+//
+// and NVIDIA as
+//
+//	<kernel>(12): error: identifier "x" is undefined
+//
+// Lines of the log that are not diagnostics, such as the quoted source and
+// carets, are skipped.
+
+// ////////////// Abstract Types ////////////////
+// A diagnostic of a build log. Line and Column are those reported by the
+// compiler, for the concatenation of the sources of the program. When the
+// diagnostic is in those sources, Source is the index of the source string
+// passed to CreateProgramWithSource that contains it, and SourceLine and
+// SourceColumn the position in that string. Source is -1 otherwise, for
+// instance for diagnostics in headers. Column is 0 if not reported.
+type Diagnostic struct {
+	File     string
+	Line     int
+	Column   int
+	Severity string // "error", "warning", "note", "remark" or "fatal error"
+	Text     string
+
+	Source       int
+	SourceLine   int
+	SourceColumn int
+}
+
+// The build log of a device.
+type BuildLog struct {
+	Device      *Device
+	Log         string
+	Diagnostics []Diagnostic
+}
+
+// ////////////// Basic Functions ////////////////
+var (
+	clangDiagnostic  = regexp.MustCompile(`^(.*?):(\d+):(?:(\d+):)? (fatal error|error|warning|note|remark): (.*)$`)
+	nvidiaDiagnostic = regexp.MustCompile(`^(.*?)\((\d+)\): (error|warning|remark)(?: #[\w-]+)?: (.*)$`)
+	amdTempSource    = regexp.MustCompile(`^OCL\d+T\d+\.cl$`)
+)
+
+// Reports whether diagnostics in file refer to the sources of the program.
+// The compilers name them by a file whose base name is <source> (Clang),
+// <kernel> (NVIDIA), <program source> (Apple), <stdin> (POCL), input.cl
+// (Mesa), 1 (Intel), CompileSource (AMD ROCm, in a temporary directory such
+// as /tmp/comgr-XXXXXX/input) or OCL<n>T<n>.cl (older AMD drivers, in the
+// temporary directory).
+func isProgramSourceFile(file string) bool {
+	base := file[strings.LastIndexAny(file, `/\`)+1:]
+	switch base {
+	case "", "<source>", "<kernel>", "<program source>", "<stdin>", "input.cl", "1", "CompileSource":
+		return true
+	}
+	return amdTempSource.MatchString(base)
+}
+
+// Parses the diagnostics of log, and maps those in the program sources back
+// to the strings of sources. sources may be nil, in which case Source is -1.
+func ParseBuildLog(log string, sources []string) []Diagnostic {
+	var diags []Diagnostic
+	for _, line := range strings.Split(log, "\n") {
+		line = strings.TrimRight(line, "\r")
+		var d Diagnostic
+		if m := clangDiagnostic.FindStringSubmatch(line); m != nil {
+			d.File = m[1]
+			d.Line, _ = strconv.Atoi(m[2])
+			d.Column, _ = strconv.Atoi(m[3])
+			d.Severity = m[4]
+			d.Text = m[5]
+		} else if m := nvidiaDiagnostic.FindStringSubmatch(line); m != nil {
+			d.File = m[1]
+			d.Line, _ = strconv.Atoi(m[2])
+			d.Severity = m[3]
+			d.Text = m[4]
+		} else {
+			continue
+		}
+		d.Source = -1
+		if isProgramSourceFile(d.File) {
+			d.Source, d.SourceLine, d.SourceColumn = sourcePosition(sources, d.Line, d.Column)
+		}
+		diags = append(diags, d)
+	}
+	return diags
+}
+
+// Returns the index of the string of sources containing line of their
+// concatenation, and the position in that string. The strings are
+// concatenated as is, so a string not ending with a newline shares its last
+// line with the next string, whose columns on that line are shifted.
+func sourcePosition(sources []string, line, column int) (int, int, int) {
+	start, startColumn := 1, 1
+	found, foundLine, foundColumn := -1, 0, 0
+	for i, s := range sources {
+		if start > line {
+			break
+		}
+		if s == "" {
+			continue
+		}
+		if start == line && column != 0 && column < startColumn {
+			// On the shared line, before this string
+			break
+		}
+		found, foundLine, foundColumn = i, line-start+1, column
+		if start == line && column != 0 {
+			foundColumn = column - startColumn + 1
+		}
+		if n := strings.Count(s, "\n"); n > 0 {
+			start += n
+			startColumn = len(s) - strings.LastIndex(s, "\n")
+		} else {
+			startColumn += len(s)
+		}
+	}
+	return found, foundLine, foundColumn
+}
@@ -0,0 +1,150 @@
+package go2opencl
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Typed options for building, compiling and linking programs. The zero value
+// renders the options BuildProgram always passes, -cl-std=CL1.2 and
+// -cl-kernel-arg-info. Options render in a fixed order with the defines
+// sorted, so two BuildOptions are equivalent when they render the same
+// string, which Equal compares. BuildProgramWithOptions, CompileProgramWithOptions,
+// LinkProgramWithOptions and CreateProgramWithBinaryOptions reject options that
+// Validate rejects.
+
+// ////////////// Abstract Types ////////////////
+type BuildOptions struct {
+	Std              string            // OpenCL C version, such as "CL2.0" or "CL3.0". CL1.2 if empty.
+	NoKernelArgInfo  bool              // Omits -cl-kernel-arg-info.
+	Defines          map[string]string // -D name, or -D name=value if value is not empty.
+	IncludeDirs      []string          // -I dir, in order.
+	FastRelaxedMath  bool              // -cl-fast-relaxed-math
+	MadEnable        bool              // -cl-mad-enable
+	DenormsAreZero   bool              // -cl-denorms-are-zero
+	WarningsAsErrors bool              // -Werror
+	NoWarnings       bool              // -w
+	Extra            string            // Appended verbatim when building or compiling.
+	LinkExtra        string            // Appended verbatim when linking, such as -create-library.
+}
+
+// ////////////// Basic Functions ////////////////
+var (
+	buildOptionStd  = regexp.MustCompile(`^CL(?:\d\.\d|C\+\+(?:\d\.\d|\d{4})?)$`)
+	buildOptionName = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+)
+
+// Quotes s if the compiler would otherwise split it or interpret its quotes
+// and backslashes.
+func quoteBuildOption(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n\r\"'\\") {
+		return s
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// ////////////// Abstract Functions ////////////////
+// Returns an error wrapping ErrInvalidBuildOptions, the error of drivers
+// rejecting options, if o would not render options the compiler accepts: Std is not a version such as CL2.0 or CLC++,
+// a define is not an identifier, an include directory is empty, or warnings
+// are both inhibited and made errors. A nil *BuildOptions is valid.
+func (o *BuildOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	if o.Std != "" && !buildOptionStd.MatchString(o.Std) {
+		return fmt.Errorf("%w: Std %q is not a version such as CL2.0", ErrInvalidBuildOptions, o.Std)
+	}
+	for name := range o.Defines {
+		if !buildOptionName.MatchString(name) {
+			return fmt.Errorf("%w: define %q is not an identifier", ErrInvalidBuildOptions, name)
+		}
+	}
+	for _, dir := range o.IncludeDirs {
+		if dir == "" {
+			return fmt.Errorf("%w: empty include directory", ErrInvalidBuildOptions)
+		}
+	}
+	if o.NoWarnings && o.WarningsAsErrors {
+		return fmt.Errorf("%w: NoWarnings and WarningsAsErrors are exclusive", ErrInvalidBuildOptions)
+	}
+	return nil
+}
+
+// Renders the options to pass to clBuildProgram or clCompileProgram. A nil
+// *BuildOptions renders the defaults.
+func (o *BuildOptions) String() string {
+	if o == nil {
+		o = &BuildOptions{}
+	}
+	std := o.Std
+	if std == "" {
+		std = "CL1.2"
+	}
+	opts := []string{"-cl-std=" + quoteBuildOption(std)}
+	if !o.NoKernelArgInfo {
+		opts = append(opts, "-cl-kernel-arg-info")
+	}
+	names := make([]string, 0, len(o.Defines))
+	for name := range o.Defines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if value := o.Defines[name]; value != "" {
+			opts = append(opts, "-D", quoteBuildOption(name+"="+value))
+		} else {
+			opts = append(opts, "-D", quoteBuildOption(name))
+		}
+	}
+	for _, dir := range o.IncludeDirs {
+		opts = append(opts, "-I", quoteBuildOption(dir))
+	}
+	opts = append(opts, o.mathOptions()...)
+	if o.MadEnable {
+		opts = append(opts, "-cl-mad-enable")
+	}
+	if o.WarningsAsErrors {
+		opts = append(opts, "-Werror")
+	}
+	if o.NoWarnings {
+		opts = append(opts, "-w")
+	}
+	if o.Extra != "" {
+		opts = append(opts, o.Extra)
+	}
+	return strings.Join(opts, " ")
+}
+
+// Options that are valid both when compiling and when linking.
+func (o *BuildOptions) mathOptions() []string {
+	var opts []string
+	if o.FastRelaxedMath {
+		opts = append(opts, "-cl-fast-relaxed-math")
+	}
+	if o.DenormsAreZero {
+		opts = append(opts, "-cl-denorms-are-zero")
+	}
+	return opts
+}
+
+// Renders the options to pass to clLinkProgram, which rejects the
+// preprocessor and compiler options.
+func (o *BuildOptions) linkString() string {
+	if o == nil {
+		return ""
+	}
+	opts := o.mathOptions()
+	if o.LinkExtra != "" {
+		opts = append(opts, o.LinkExtra)
+	}
+	return strings.Join(opts, " ")
+}
+
+// Reports whether o and p render the same options.
+func (o *BuildOptions) Equal(p *BuildOptions) bool {
+	return o.String() == p.String()
+}
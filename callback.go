@@ -0,0 +1,58 @@
+package go2opencl
+
+import "sync"
+
+// Go functions handed to OpenCL as callbacks are kept in a table and only
+// an integer handle to them is passed through C as the user_data pointer.
+// cgo does not allow C code to keep Go pointers, so the handle is all the
+// OpenCL runtime ever sees.
+
+// ////////////// Abstract Types ////////////////
+type callbackTable struct {
+	mu    sync.Mutex
+	next  uintptr
+	funcs map[uintptr]interface{}
+}
+
+var callbacks = &callbackTable{funcs: make(map[uintptr]interface{})}
+
+// ////////////// Basic Functions ////////////////
+
+// Stores fn and returns its handle. Handles are never 0, so 0 can be used
+// for "no callback".
+func (t *callbackTable) register(fn interface{}) uintptr {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for {
+		t.next++
+		if _, used := t.funcs[t.next]; t.next != 0 && !used {
+			break
+		}
+	}
+	t.funcs[t.next] = fn
+	return t.next
+}
+
+// Returns the function registered under handle, or nil if it has been removed.
+func (t *callbackTable) lookup(handle uintptr) interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.funcs[handle]
+}
+
+// Returns the function registered under handle and removes it, for callbacks
+// that fire only once. Returns nil if it has already been removed.
+func (t *callbackTable) take(handle uintptr) interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fn := t.funcs[handle]
+	delete(t.funcs, handle)
+	return fn
+}
+
+// Removes the function registered under handle. Removing a handle twice is harmless.
+func (t *callbackTable) unregister(handle uintptr) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.funcs, handle)
+}
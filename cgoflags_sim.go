@@ -0,0 +1,10 @@
+//go:build clsim
+// +build clsim
+
+package go2opencl
+
+// With the clsim build tag, binaries find the go2opencl-sim library built in
+// stubs/lib (make -C stubs sim) at run time, without LD_LIBRARY_PATH.
+
+//#cgo linux LDFLAGS: -Wl,-rpath,${SRCDIR}/stubs/lib
+import "C"
@@ -32,6 +32,8 @@ var ErrUnsupported = errors.New("cl: unsupported")
 
 var (
 	ErrUnknown = errors.New("cl: unknown error") // Generally an unexpected result from an OpenCL function (e.g. CL_SUCCESS but null pointer)
+	// Profiling information was requested for an event whose command queue was created without CommandQueueProfilingEnable
+	ErrProfilingNotEnabled = errors.New("cl: profiling is not enabled on the command queue")
 )
 
 type ErrOther int
@@ -40,6 +42,123 @@ func (e ErrOther) Error() string {
 	return fmt.Sprintf("cl: error %d", int(e))
 }
 
+// Returned when setting kernel arguments, launching kernels, or creating and
+// transferring buffers fails, with the arguments of the failing call. Err
+// is the error of Code, such as ErrInvalidArgSize, which errors.Is matches.
+// Fields that do not apply to the call are left zero, and ArgIndex is -1.
+type Error struct {
+	Func       string // OpenCL function that failed, such as "clSetKernelArg"
+	Code       int
+	Err        error
+	Kernel     string
+	ArgIndex   int
+	GlobalSize []int
+	LocalSize  []int
+	Size       int   // in bytes, of the argument or of the buffer range
+	Offset     int   // in bytes, into the buffer
+	Origin     []int // of the region of rect and image calls, in bytes or pixels
+	Region     []int
+}
+
+func (e *Error) Error() string {
+	var details []string
+	if e.Kernel != "" {
+		details = append(details, fmt.Sprintf("kernel %q", e.Kernel))
+	}
+	if e.ArgIndex >= 0 {
+		details = append(details, fmt.Sprintf("arg %d", e.ArgIndex))
+	}
+	if e.GlobalSize != nil {
+		details = append(details, fmt.Sprintf("global %v", e.GlobalSize))
+	}
+	if e.LocalSize != nil {
+		details = append(details, fmt.Sprintf("local %v", e.LocalSize))
+	}
+	if e.Size != 0 {
+		details = append(details, fmt.Sprintf("size %d", e.Size))
+	}
+	if e.Offset != 0 {
+		details = append(details, fmt.Sprintf("offset %d", e.Offset))
+	}
+	if e.Origin != nil {
+		details = append(details, fmt.Sprintf("origin %v", e.Origin))
+	}
+	if e.Region != nil {
+		details = append(details, fmt.Sprintf("region %v", e.Region))
+	}
+	if len(details) == 0 {
+		return fmt.Sprintf("%v in %s", e.Err, e.Func)
+	}
+	return fmt.Sprintf("%v in %s (%s)", e.Err, e.Func, strings.Join(details, ", "))
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Returns an *Error for a call to fn that failed with code.
+func newError(fn string, code C.cl_int) *Error {
+	return &Error{Func: fn, Code: int(code), Err: toError(code), ArgIndex: -1}
+}
+
+// Returns nil if code is CL_SUCCESS, else an *Error for setting the argument
+// index of kernel to size bytes.
+func argError(code C.cl_int, kernel *Kernel, index, size int) error {
+	if code == C.CL_SUCCESS {
+		return nil
+	}
+	err := newError("clSetKernelArg", code)
+	err.Kernel, _ = kernel.FunctionName()
+	err.ArgIndex = index
+	err.Size = size
+	return err
+}
+
+// Returns nil if code is CL_SUCCESS, else an *Error for a launch of kernel.
+func kernelError(fn string, code C.cl_int, kernel *Kernel, globalSize, localSize []int) error {
+	if code == C.CL_SUCCESS {
+		return nil
+	}
+	err := newError(fn, code)
+	err.Kernel, _ = kernel.FunctionName()
+	err.GlobalSize = globalSize
+	err.LocalSize = localSize
+	return err
+}
+
+// Returns nil if code is CL_SUCCESS, else an *Error for a call to fn on
+// size bytes of a buffer at offset.
+func bufferError(fn string, code C.cl_int, size, offset int) error {
+	if code == C.CL_SUCCESS {
+		return nil
+	}
+	err := newError(fn, code)
+	err.Size = size
+	err.Offset = offset
+	return err
+}
+
+// Returns nil if code is CL_SUCCESS, else an *Error for a call to fn on the
+// region of a rect or image call at origin, and at offset bytes into the
+// buffer of copies between images and buffers.
+func regionError(fn string, code C.cl_int, origin, region *Dim3, offset int) error {
+	if code == C.CL_SUCCESS {
+		return nil
+	}
+	err := newError(fn, code)
+	err.Origin = dim3Ints(origin)
+	err.Region = dim3Ints(region)
+	err.Offset = offset
+	return err
+}
+
+func dim3Ints(d *Dim3) []int {
+	if d == nil {
+		return []int{0, 0, 0}
+	}
+	return []int{d.X, d.Y, d.Z}
+}
+
 var (
 	ErrDeviceNotFound                     = errors.New("cl: Device Not Found")
 	ErrDeviceNotAvailable                 = errors.New("cl: Device Not Available")
@@ -97,63 +216,249 @@ var (
 	ErrInvalidCompilerOptions             = errors.New("cl: Invalid Compiler Options")
 	ErrInvalidLinkerOptions               = errors.New("cl: Invalid Linker Options")
 	ErrInvalidDevicePartitionCount        = errors.New("cl: Invalid Device Partition Count")
+	ErrInvalidGLObject                    = errors.New("cl: Invalid GL Object")
+	ErrInvalidMipLevel                    = errors.New("cl: Invalid Mip Level")
+	ErrInvalidPipeSize                    = errors.New("cl: Invalid Pipe Size")
+	ErrInvalidDeviceQueue                 = errors.New("cl: Invalid Device Queue")
+	ErrInvalidSpecID                      = errors.New("cl: Invalid Spec ID")
+	ErrMaxSizeRestrictionExceeded         = errors.New("cl: Max Size Restriction Exceeded")
+
+	// Errors of extensions
+	ErrInvalidGLSharegroupReference       = errors.New("cl: Invalid GL Sharegroup Reference")
+	ErrPlatformNotFound                   = errors.New("cl: Platform Not Found")
+	ErrInvalidD3D10Device                 = errors.New("cl: Invalid D3D10 Device")
+	ErrInvalidD3D10Resource               = errors.New("cl: Invalid D3D10 Resource")
+	ErrD3D10ResourceAlreadyAcquired       = errors.New("cl: D3D10 Resource Already Acquired")
+	ErrD3D10ResourceNotAcquired           = errors.New("cl: D3D10 Resource Not Acquired")
+	ErrInvalidD3D11Device                 = errors.New("cl: Invalid D3D11 Device")
+	ErrInvalidD3D11Resource               = errors.New("cl: Invalid D3D11 Resource")
+	ErrD3D11ResourceAlreadyAcquired       = errors.New("cl: D3D11 Resource Already Acquired")
+	ErrD3D11ResourceNotAcquired           = errors.New("cl: D3D11 Resource Not Acquired")
+	ErrInvalidDX9MediaAdapter             = errors.New("cl: Invalid DX9 Media Adapter")
+	ErrInvalidDX9MediaSurface             = errors.New("cl: Invalid DX9 Media Surface")
+	ErrDX9MediaSurfaceAlreadyAcquired     = errors.New("cl: DX9 Media Surface Already Acquired")
+	ErrDX9MediaSurfaceNotAcquired         = errors.New("cl: DX9 Media Surface Not Acquired")
+	ErrDevicePartitionFailedExt           = errors.New("cl: Device Partition Failed (EXT)")
+	ErrInvalidPartitionCountExt           = errors.New("cl: Invalid Partition Count")
+	ErrInvalidPartitionNameExt            = errors.New("cl: Invalid Partition Name")
+	ErrEGLResourceNotAcquired             = errors.New("cl: EGL Resource Not Acquired")
+	ErrInvalidEGLObject                   = errors.New("cl: Invalid EGL Object")
+	ErrInvalidAccelerator                 = errors.New("cl: Invalid Accelerator")
+	ErrInvalidAcceleratorType             = errors.New("cl: Invalid Accelerator Type")
+	ErrInvalidAcceleratorDescriptor       = errors.New("cl: Invalid Accelerator Descriptor")
+	ErrAcceleratorTypeNotSupported        = errors.New("cl: Accelerator Type Not Supported")
+	ErrInvalidVAAPIMediaAdapter           = errors.New("cl: Invalid VA API Media Adapter")
+	ErrInvalidVAAPIMediaSurface           = errors.New("cl: Invalid VA API Media Surface")
+	ErrVAAPIMediaSurfaceAlreadyAcquired   = errors.New("cl: VA API Media Surface Already Acquired")
+	ErrVAAPIMediaSurfaceNotAcquired       = errors.New("cl: VA API Media Surface Not Acquired")
+	ErrCommandTerminatedItselfWithFailure = errors.New("cl: Command Terminated Itself With Failure")
+	ErrContextTerminated                  = errors.New("cl: Context Terminated")
+	ErrInvalidCommandBuffer               = errors.New("cl: Invalid Command Buffer")
+	ErrInvalidSyncPointWaitList           = errors.New("cl: Invalid Sync Point Wait List")
+	ErrIncompatibleCommandQueue           = errors.New("cl: Incompatible Command Queue")
+	ErrInvalidSemaphore                   = errors.New("cl: Invalid Semaphore")
 )
 
 var errorMap = map[C.cl_int]error{
-	C.CL_SUCCESS:                         nil,
-	C.CL_DEVICE_NOT_FOUND:                ErrDeviceNotFound,
-	C.CL_DEVICE_NOT_AVAILABLE:            ErrDeviceNotAvailable,
-	C.CL_COMPILER_NOT_AVAILABLE:          ErrCompilerNotAvailable,
-	C.CL_MEM_OBJECT_ALLOCATION_FAILURE:   ErrMemObjectAllocationFailure,
-	C.CL_OUT_OF_RESOURCES:                ErrOutOfResources,
-	C.CL_OUT_OF_HOST_MEMORY:              ErrOutOfHostMemory,
-	C.CL_PROFILING_INFO_NOT_AVAILABLE:    ErrProfilingInfoNotAvailable,
-	C.CL_MEM_COPY_OVERLAP:                ErrMemCopyOverlap,
-	C.CL_IMAGE_FORMAT_MISMATCH:           ErrImageFormatMismatch,
-	C.CL_IMAGE_FORMAT_NOT_SUPPORTED:      ErrImageFormatNotSupported,
-	C.CL_BUILD_PROGRAM_FAILURE:           ErrBuildProgramFailure,
-	C.CL_MAP_FAILURE:                     ErrMapFailure,
-	C.CL_INVALID_VALUE:                   ErrInvalidValue,
-	C.CL_INVALID_DEVICE_TYPE:             ErrInvalidDeviceType,
-	C.CL_INVALID_PLATFORM:                ErrInvalidPlatform,
-	C.CL_INVALID_DEVICE:                  ErrInvalidDevice,
-	C.CL_INVALID_CONTEXT:                 ErrInvalidContext,
-	C.CL_INVALID_QUEUE_PROPERTIES:        ErrInvalidQueueProperties,
-	C.CL_INVALID_COMMAND_QUEUE:           ErrInvalidCommandQueue,
-	C.CL_INVALID_HOST_PTR:                ErrInvalidHostPtr,
-	C.CL_INVALID_MEM_OBJECT:              ErrInvalidMemObject,
-	C.CL_INVALID_IMAGE_FORMAT_DESCRIPTOR: ErrInvalidImageFormatDescriptor,
-	C.CL_INVALID_IMAGE_SIZE:              ErrInvalidImageSize,
-	C.CL_INVALID_SAMPLER:                 ErrInvalidSampler,
-	C.CL_INVALID_BINARY:                  ErrInvalidBinary,
-	C.CL_INVALID_BUILD_OPTIONS:           ErrInvalidBuildOptions,
-	C.CL_INVALID_PROGRAM:                 ErrInvalidProgram,
-	C.CL_INVALID_PROGRAM_EXECUTABLE:      ErrInvalidProgramExecutable,
-	C.CL_INVALID_KERNEL_NAME:             ErrInvalidKernelName,
-	C.CL_INVALID_KERNEL_DEFINITION:       ErrInvalidKernelDefinition,
-	C.CL_INVALID_KERNEL:                  ErrInvalidKernel,
-	C.CL_INVALID_ARG_INDEX:               ErrInvalidArgIndex,
-	C.CL_INVALID_ARG_VALUE:               ErrInvalidArgValue,
-	C.CL_INVALID_ARG_SIZE:                ErrInvalidArgSize,
-	C.CL_INVALID_KERNEL_ARGS:             ErrInvalidKernelArgs,
-	C.CL_INVALID_WORK_DIMENSION:          ErrInvalidWorkDimension,
-	C.CL_INVALID_WORK_GROUP_SIZE:         ErrInvalidWorkGroupSize,
-	C.CL_INVALID_WORK_ITEM_SIZE:          ErrInvalidWorkItemSize,
-	C.CL_INVALID_GLOBAL_OFFSET:           ErrInvalidGlobalOffset,
-	C.CL_INVALID_EVENT_WAIT_LIST:         ErrInvalidEventWaitList,
-	C.CL_INVALID_EVENT:                   ErrInvalidEvent,
-	C.CL_INVALID_OPERATION:               ErrInvalidOperation,
-	C.CL_INVALID_BUFFER_SIZE:             ErrInvalidBufferSize,
-	C.CL_INVALID_GLOBAL_WORK_SIZE:        ErrInvalidGlobalWorkSize,
-	C.CL_COMPILE_PROGRAM_FAILURE:         ErrCompileProgramFailure,
-	C.CL_DEVICE_PARTITION_FAILED:         ErrDevicePartitionFailed,
-	C.CL_INVALID_COMPILER_OPTIONS:        ErrInvalidCompilerOptions,
-	C.CL_INVALID_DEVICE_PARTITION_COUNT:  ErrInvalidDevicePartitionCount,
-	C.CL_INVALID_IMAGE_DESCRIPTOR:        ErrInvalidImageDescriptor,
-	C.CL_INVALID_LINKER_OPTIONS:          ErrInvalidLinkerOptions,
-	C.CL_KERNEL_ARG_INFO_NOT_AVAILABLE:   ErrKernelArgInfoNotAvailable,
-	C.CL_LINK_PROGRAM_FAILURE:            ErrLinkProgramFailure,
-	C.CL_LINKER_NOT_AVAILABLE:            ErrLinkerNotAvailable,
+	C.CL_SUCCESS:                                   nil,
+	C.CL_DEVICE_NOT_FOUND:                          ErrDeviceNotFound,
+	C.CL_DEVICE_NOT_AVAILABLE:                      ErrDeviceNotAvailable,
+	C.CL_COMPILER_NOT_AVAILABLE:                    ErrCompilerNotAvailable,
+	C.CL_MEM_OBJECT_ALLOCATION_FAILURE:             ErrMemObjectAllocationFailure,
+	C.CL_OUT_OF_RESOURCES:                          ErrOutOfResources,
+	C.CL_OUT_OF_HOST_MEMORY:                        ErrOutOfHostMemory,
+	C.CL_PROFILING_INFO_NOT_AVAILABLE:              ErrProfilingInfoNotAvailable,
+	C.CL_MEM_COPY_OVERLAP:                          ErrMemCopyOverlap,
+	C.CL_IMAGE_FORMAT_MISMATCH:                     ErrImageFormatMismatch,
+	C.CL_IMAGE_FORMAT_NOT_SUPPORTED:                ErrImageFormatNotSupported,
+	C.CL_BUILD_PROGRAM_FAILURE:                     ErrBuildProgramFailure,
+	C.CL_MAP_FAILURE:                               ErrMapFailure,
+	C.CL_MISALIGNED_SUB_BUFFER_OFFSET:              ErrMisalignedSubBufferOffset,
+	C.CL_EXEC_STATUS_ERROR_FOR_EVENTS_IN_WAIT_LIST: ErrExecStatusErrorForEventsInWaitList,
+	C.CL_INVALID_VALUE:                             ErrInvalidValue,
+	C.CL_INVALID_DEVICE_TYPE:                       ErrInvalidDeviceType,
+	C.CL_INVALID_PLATFORM:                          ErrInvalidPlatform,
+	C.CL_INVALID_DEVICE:                            ErrInvalidDevice,
+	C.CL_INVALID_CONTEXT:                           ErrInvalidContext,
+	C.CL_INVALID_QUEUE_PROPERTIES:                  ErrInvalidQueueProperties,
+	C.CL_INVALID_COMMAND_QUEUE:                     ErrInvalidCommandQueue,
+	C.CL_INVALID_HOST_PTR:                          ErrInvalidHostPtr,
+	C.CL_INVALID_MEM_OBJECT:                        ErrInvalidMemObject,
+	C.CL_INVALID_IMAGE_FORMAT_DESCRIPTOR:           ErrInvalidImageFormatDescriptor,
+	C.CL_INVALID_IMAGE_SIZE:                        ErrInvalidImageSize,
+	C.CL_INVALID_SAMPLER:                           ErrInvalidSampler,
+	C.CL_INVALID_BINARY:                            ErrInvalidBinary,
+	C.CL_INVALID_BUILD_OPTIONS:                     ErrInvalidBuildOptions,
+	C.CL_INVALID_PROGRAM:                           ErrInvalidProgram,
+	C.CL_INVALID_PROGRAM_EXECUTABLE:                ErrInvalidProgramExecutable,
+	C.CL_INVALID_KERNEL_NAME:                       ErrInvalidKernelName,
+	C.CL_INVALID_KERNEL_DEFINITION:                 ErrInvalidKernelDefinition,
+	C.CL_INVALID_KERNEL:                            ErrInvalidKernel,
+	C.CL_INVALID_ARG_INDEX:                         ErrInvalidArgIndex,
+	C.CL_INVALID_ARG_VALUE:                         ErrInvalidArgValue,
+	C.CL_INVALID_ARG_SIZE:                          ErrInvalidArgSize,
+	C.CL_INVALID_KERNEL_ARGS:                       ErrInvalidKernelArgs,
+	C.CL_INVALID_WORK_DIMENSION:                    ErrInvalidWorkDimension,
+	C.CL_INVALID_WORK_GROUP_SIZE:                   ErrInvalidWorkGroupSize,
+	C.CL_INVALID_WORK_ITEM_SIZE:                    ErrInvalidWorkItemSize,
+	C.CL_INVALID_GLOBAL_OFFSET:                     ErrInvalidGlobalOffset,
+	C.CL_INVALID_EVENT_WAIT_LIST:                   ErrInvalidEventWaitList,
+	C.CL_INVALID_EVENT:                             ErrInvalidEvent,
+	C.CL_INVALID_OPERATION:                         ErrInvalidOperation,
+	C.CL_INVALID_BUFFER_SIZE:                       ErrInvalidBufferSize,
+	C.CL_INVALID_GLOBAL_WORK_SIZE:                  ErrInvalidGlobalWorkSize,
+	C.CL_COMPILE_PROGRAM_FAILURE:                   ErrCompileProgramFailure,
+	C.CL_DEVICE_PARTITION_FAILED:                   ErrDevicePartitionFailed,
+	C.CL_INVALID_COMPILER_OPTIONS:                  ErrInvalidCompilerOptions,
+	C.CL_INVALID_DEVICE_PARTITION_COUNT:            ErrInvalidDevicePartitionCount,
+	C.CL_INVALID_IMAGE_DESCRIPTOR:                  ErrInvalidImageDescriptor,
+	C.CL_INVALID_LINKER_OPTIONS:                    ErrInvalidLinkerOptions,
+	C.CL_KERNEL_ARG_INFO_NOT_AVAILABLE:             ErrKernelArgInfoNotAvailable,
+	C.CL_LINK_PROGRAM_FAILURE:                      ErrLinkProgramFailure,
+	C.CL_LINKER_NOT_AVAILABLE:                      ErrLinkerNotAvailable,
+	C.CL_INVALID_GL_OBJECT:                         ErrInvalidGLObject,
+	C.CL_INVALID_MIP_LEVEL:                         ErrInvalidMipLevel,
+	C.CL_INVALID_PROPERTY:                          ErrInvalidProperty,
+
+	// Codes of OpenCL 2.x and 3.0, and of extensions, which the headers may not
+	// declare at CL_TARGET_OPENCL_VERSION 120
+	-69:   ErrInvalidPipeSize,                    // CL_INVALID_PIPE_SIZE
+	-70:   ErrInvalidDeviceQueue,                 // CL_INVALID_DEVICE_QUEUE
+	-71:   ErrInvalidSpecID,                      // CL_INVALID_SPEC_ID
+	-72:   ErrMaxSizeRestrictionExceeded,         // CL_MAX_SIZE_RESTRICTION_EXCEEDED
+	-1000: ErrInvalidGLSharegroupReference,       // CL_INVALID_GL_SHAREGROUP_REFERENCE_KHR
+	-1001: ErrPlatformNotFound,                   // CL_PLATFORM_NOT_FOUND_KHR
+	-1002: ErrInvalidD3D10Device,                 // CL_INVALID_D3D10_DEVICE_KHR
+	-1003: ErrInvalidD3D10Resource,               // CL_INVALID_D3D10_RESOURCE_KHR
+	-1004: ErrD3D10ResourceAlreadyAcquired,       // CL_D3D10_RESOURCE_ALREADY_ACQUIRED_KHR
+	-1005: ErrD3D10ResourceNotAcquired,           // CL_D3D10_RESOURCE_NOT_ACQUIRED_KHR
+	-1006: ErrInvalidD3D11Device,                 // CL_INVALID_D3D11_DEVICE_KHR
+	-1007: ErrInvalidD3D11Resource,               // CL_INVALID_D3D11_RESOURCE_KHR
+	-1008: ErrD3D11ResourceAlreadyAcquired,       // CL_D3D11_RESOURCE_ALREADY_ACQUIRED_KHR
+	-1009: ErrD3D11ResourceNotAcquired,           // CL_D3D11_RESOURCE_NOT_ACQUIRED_KHR
+	-1010: ErrInvalidDX9MediaAdapter,             // CL_INVALID_DX9_MEDIA_ADAPTER_KHR
+	-1011: ErrInvalidDX9MediaSurface,             // CL_INVALID_DX9_MEDIA_SURFACE_KHR
+	-1012: ErrDX9MediaSurfaceAlreadyAcquired,     // CL_DX9_MEDIA_SURFACE_ALREADY_ACQUIRED_KHR
+	-1013: ErrDX9MediaSurfaceNotAcquired,         // CL_DX9_MEDIA_SURFACE_NOT_ACQUIRED_KHR
+	-1057: ErrDevicePartitionFailedExt,           // CL_DEVICE_PARTITION_FAILED_EXT
+	-1058: ErrInvalidPartitionCountExt,           // CL_INVALID_PARTITION_COUNT_EXT
+	-1059: ErrInvalidPartitionNameExt,            // CL_INVALID_PARTITION_NAME_EXT
+	-1092: ErrEGLResourceNotAcquired,             // CL_EGL_RESOURCE_NOT_ACQUIRED_KHR
+	-1093: ErrInvalidEGLObject,                   // CL_INVALID_EGL_OBJECT_KHR
+	-1094: ErrInvalidAccelerator,                 // CL_INVALID_ACCELERATOR_INTEL
+	-1095: ErrInvalidAcceleratorType,             // CL_INVALID_ACCELERATOR_TYPE_INTEL
+	-1096: ErrInvalidAcceleratorDescriptor,       // CL_INVALID_ACCELERATOR_DESCRIPTOR_INTEL
+	-1097: ErrAcceleratorTypeNotSupported,        // CL_ACCELERATOR_TYPE_NOT_SUPPORTED_INTEL
+	-1098: ErrInvalidVAAPIMediaAdapter,           // CL_INVALID_VA_API_MEDIA_ADAPTER_INTEL
+	-1099: ErrInvalidVAAPIMediaSurface,           // CL_INVALID_VA_API_MEDIA_SURFACE_INTEL
+	-1100: ErrVAAPIMediaSurfaceAlreadyAcquired,   // CL_VA_API_MEDIA_SURFACE_ALREADY_ACQUIRED_INTEL
+	-1101: ErrVAAPIMediaSurfaceNotAcquired,       // CL_VA_API_MEDIA_SURFACE_NOT_ACQUIRED_INTEL
+	-1108: ErrCommandTerminatedItselfWithFailure, // CL_COMMAND_TERMINATED_ITSELF_WITH_FAILURE_ARM
+	-1121: ErrContextTerminated,                  // CL_CONTEXT_TERMINATED_KHR
+	-1138: ErrInvalidCommandBuffer,               // CL_INVALID_COMMAND_BUFFER_KHR
+	-1139: ErrInvalidSyncPointWaitList,           // CL_INVALID_SYNC_POINT_WAIT_LIST_KHR
+	-1140: ErrIncompatibleCommandQueue,           // CL_INCOMPATIBLE_COMMAND_QUEUE_KHR
+	-1142: ErrInvalidSemaphore,                   // CL_INVALID_SEMAPHORE_KHR
+}
+
+// Symbolic names of the codes, including those that have no error
+var codeNames = map[int]string{
+	0:     "CL_SUCCESS",
+	-1:    "CL_DEVICE_NOT_FOUND",
+	-2:    "CL_DEVICE_NOT_AVAILABLE",
+	-3:    "CL_COMPILER_NOT_AVAILABLE",
+	-4:    "CL_MEM_OBJECT_ALLOCATION_FAILURE",
+	-5:    "CL_OUT_OF_RESOURCES",
+	-6:    "CL_OUT_OF_HOST_MEMORY",
+	-7:    "CL_PROFILING_INFO_NOT_AVAILABLE",
+	-8:    "CL_MEM_COPY_OVERLAP",
+	-9:    "CL_IMAGE_FORMAT_MISMATCH",
+	-10:   "CL_IMAGE_FORMAT_NOT_SUPPORTED",
+	-11:   "CL_BUILD_PROGRAM_FAILURE",
+	-12:   "CL_MAP_FAILURE",
+	-13:   "CL_MISALIGNED_SUB_BUFFER_OFFSET",
+	-14:   "CL_EXEC_STATUS_ERROR_FOR_EVENTS_IN_WAIT_LIST",
+	-15:   "CL_COMPILE_PROGRAM_FAILURE",
+	-16:   "CL_LINKER_NOT_AVAILABLE",
+	-17:   "CL_LINK_PROGRAM_FAILURE",
+	-18:   "CL_DEVICE_PARTITION_FAILED",
+	-19:   "CL_KERNEL_ARG_INFO_NOT_AVAILABLE",
+	-30:   "CL_INVALID_VALUE",
+	-31:   "CL_INVALID_DEVICE_TYPE",
+	-32:   "CL_INVALID_PLATFORM",
+	-33:   "CL_INVALID_DEVICE",
+	-34:   "CL_INVALID_CONTEXT",
+	-35:   "CL_INVALID_QUEUE_PROPERTIES",
+	-36:   "CL_INVALID_COMMAND_QUEUE",
+	-37:   "CL_INVALID_HOST_PTR",
+	-38:   "CL_INVALID_MEM_OBJECT",
+	-39:   "CL_INVALID_IMAGE_FORMAT_DESCRIPTOR",
+	-40:   "CL_INVALID_IMAGE_SIZE",
+	-41:   "CL_INVALID_SAMPLER",
+	-42:   "CL_INVALID_BINARY",
+	-43:   "CL_INVALID_BUILD_OPTIONS",
+	-44:   "CL_INVALID_PROGRAM",
+	-45:   "CL_INVALID_PROGRAM_EXECUTABLE",
+	-46:   "CL_INVALID_KERNEL_NAME",
+	-47:   "CL_INVALID_KERNEL_DEFINITION",
+	-48:   "CL_INVALID_KERNEL",
+	-49:   "CL_INVALID_ARG_INDEX",
+	-50:   "CL_INVALID_ARG_VALUE",
+	-51:   "CL_INVALID_ARG_SIZE",
+	-52:   "CL_INVALID_KERNEL_ARGS",
+	-53:   "CL_INVALID_WORK_DIMENSION",
+	-54:   "CL_INVALID_WORK_GROUP_SIZE",
+	-55:   "CL_INVALID_WORK_ITEM_SIZE",
+	-56:   "CL_INVALID_GLOBAL_OFFSET",
+	-57:   "CL_INVALID_EVENT_WAIT_LIST",
+	-58:   "CL_INVALID_EVENT",
+	-59:   "CL_INVALID_OPERATION",
+	-60:   "CL_INVALID_GL_OBJECT",
+	-61:   "CL_INVALID_BUFFER_SIZE",
+	-62:   "CL_INVALID_MIP_LEVEL",
+	-63:   "CL_INVALID_GLOBAL_WORK_SIZE",
+	-64:   "CL_INVALID_PROPERTY",
+	-65:   "CL_INVALID_IMAGE_DESCRIPTOR",
+	-66:   "CL_INVALID_COMPILER_OPTIONS",
+	-67:   "CL_INVALID_LINKER_OPTIONS",
+	-68:   "CL_INVALID_DEVICE_PARTITION_COUNT",
+	-69:   "CL_INVALID_PIPE_SIZE",
+	-70:   "CL_INVALID_DEVICE_QUEUE",
+	-71:   "CL_INVALID_SPEC_ID",
+	-72:   "CL_MAX_SIZE_RESTRICTION_EXCEEDED",
+	-1000: "CL_INVALID_GL_SHAREGROUP_REFERENCE_KHR",
+	-1001: "CL_PLATFORM_NOT_FOUND_KHR",
+	-1002: "CL_INVALID_D3D10_DEVICE_KHR",
+	-1003: "CL_INVALID_D3D10_RESOURCE_KHR",
+	-1004: "CL_D3D10_RESOURCE_ALREADY_ACQUIRED_KHR",
+	-1005: "CL_D3D10_RESOURCE_NOT_ACQUIRED_KHR",
+	-1006: "CL_INVALID_D3D11_DEVICE_KHR",
+	-1007: "CL_INVALID_D3D11_RESOURCE_KHR",
+	-1008: "CL_D3D11_RESOURCE_ALREADY_ACQUIRED_KHR",
+	-1009: "CL_D3D11_RESOURCE_NOT_ACQUIRED_KHR",
+	-1010: "CL_INVALID_DX9_MEDIA_ADAPTER_KHR",
+	-1011: "CL_INVALID_DX9_MEDIA_SURFACE_KHR",
+	-1012: "CL_DX9_MEDIA_SURFACE_ALREADY_ACQUIRED_KHR",
+	-1013: "CL_DX9_MEDIA_SURFACE_NOT_ACQUIRED_KHR",
+	-1057: "CL_DEVICE_PARTITION_FAILED_EXT",
+	-1058: "CL_INVALID_PARTITION_COUNT_EXT",
+	-1059: "CL_INVALID_PARTITION_NAME_EXT",
+	-1092: "CL_EGL_RESOURCE_NOT_ACQUIRED_KHR",
+	-1093: "CL_INVALID_EGL_OBJECT_KHR",
+	-1094: "CL_INVALID_ACCELERATOR_INTEL",
+	-1095: "CL_INVALID_ACCELERATOR_TYPE_INTEL",
+	-1096: "CL_INVALID_ACCELERATOR_DESCRIPTOR_INTEL",
+	-1097: "CL_ACCELERATOR_TYPE_NOT_SUPPORTED_INTEL",
+	-1098: "CL_INVALID_VA_API_MEDIA_ADAPTER_INTEL",
+	-1099: "CL_INVALID_VA_API_MEDIA_SURFACE_INTEL",
+	-1100: "CL_VA_API_MEDIA_SURFACE_ALREADY_ACQUIRED_INTEL",
+	-1101: "CL_VA_API_MEDIA_SURFACE_NOT_ACQUIRED_INTEL",
+	-1108: "CL_COMMAND_TERMINATED_ITSELF_WITH_FAILURE_ARM",
+	-1121: "CL_CONTEXT_TERMINATED_KHR",
+	-1138: "CL_INVALID_COMMAND_BUFFER_KHR",
+	-1139: "CL_INVALID_SYNC_POINT_WAIT_LIST_KHR",
+	-1140: "CL_INCOMPATIBLE_COMMAND_QUEUE_KHR",
+	-1142: "CL_INVALID_SEMAPHORE_KHR",
 }
 
 func toError(code interface{}) error {
@@ -170,9 +475,42 @@ func toError(code interface{}) error {
 			return err
 		}
 		return ErrOther(codeT)
+	case int:
+		// Untyped constants, such as C.CL_INVALID_MEM_OBJECT
+		return toError(C.cl_int(codeT))
 	}
 }
 
+// A status returned by an OpenCL function: CL_SUCCESS or an error code.
+type StatusCode int
+
+// The symbolic name of the code, such as "CL_INVALID_VALUE".
+func (c StatusCode) String() string {
+	if name, ok := codeNames[int(c)]; ok {
+		return name
+	}
+	return fmt.Sprintf("CL_UNKNOWN_ERROR(%d)", int(c))
+}
+
+// Returns the OpenCL error code of err, or of the first error it wraps that
+// has one. Returns false if err did not come from an OpenCL function.
+func ErrorCode(err error) (int, bool) {
+	for ; err != nil; err = errors.Unwrap(err) {
+		switch e := err.(type) {
+		case *Error:
+			return e.Code, true
+		case ErrOther:
+			return int(e), true
+		}
+		for code, sentinel := range errorMap {
+			if sentinel != nil && err == sentinel {
+				return int(code), true
+			}
+		}
+	}
+	return 0, false
+}
+
 type ExecCapability int
 
 const (
@@ -221,8 +559,50 @@ const (
 	CommandMapImage          CommandType = C.CL_COMMAND_MAP_IMAGE
 	CommandUnmapMemObject    CommandType = C.CL_COMMAND_UNMAP_MEM_OBJECT
 	CommandMarker            CommandType = C.CL_COMMAND_MARKER
+	CommandReadBufferRect    CommandType = C.CL_COMMAND_READ_BUFFER_RECT
+	CommandWriteBufferRect   CommandType = C.CL_COMMAND_WRITE_BUFFER_RECT
+	CommandCopyBufferRect    CommandType = C.CL_COMMAND_COPY_BUFFER_RECT
+	CommandUser              CommandType = C.CL_COMMAND_USER
+	CommandBarrier           CommandType = C.CL_COMMAND_BARRIER
+	CommandMigrateMemObjects CommandType = C.CL_COMMAND_MIGRATE_MEM_OBJECTS
+	CommandFillBuffer        CommandType = C.CL_COMMAND_FILL_BUFFER
+	CommandFillImage         CommandType = C.CL_COMMAND_FILL_IMAGE
 )
 
+var commandTypeNameMap = map[CommandType]string{
+	CommandNDRangeKernel:     "NDRangeKernel",
+	CommandTask:              "Task",
+	CommandNativeKernel:      "NativeKernel",
+	CommandReadBuffer:        "ReadBuffer",
+	CommandWriteBuffer:       "WriteBuffer",
+	CommandCopyBuffer:        "CopyBuffer",
+	CommandReadImage:         "ReadImage",
+	CommandWriteImage:        "WriteImage",
+	CommandCopyImage:         "CopyImage",
+	CommandCopyBufferToImage: "CopyBufferToImage",
+	CommandCopyImageToBuffer: "CopyImageToBuffer",
+	CommandMapBuffer:         "MapBuffer",
+	CommandMapImage:          "MapImage",
+	CommandUnmapMemObject:    "UnmapMemObject",
+	CommandMarker:            "Marker",
+	CommandReadBufferRect:    "ReadBufferRect",
+	CommandWriteBufferRect:   "WriteBufferRect",
+	CommandCopyBufferRect:    "CopyBufferRect",
+	CommandUser:              "User",
+	CommandBarrier:           "Barrier",
+	CommandMigrateMemObjects: "MigrateMemObjects",
+	CommandFillBuffer:        "FillBuffer",
+	CommandFillImage:         "FillImage",
+}
+
+func (ct CommandType) String() string {
+	name := commandTypeNameMap[ct]
+	if name == "" {
+		name = fmt.Sprintf("Unknown(%x)", int(ct))
+	}
+	return name
+}
+
 func clBool(b bool) C.cl_bool {
 	if b {
 		return C.CL_TRUE
@@ -238,6 +618,16 @@ func sizeT3(i3 [3]int) [3]C.size_t {
 	return val
 }
 
+func sizeTDim3(d *Dim3) [3]C.size_t {
+	var val [3]C.size_t
+	if d != nil {
+		val[0] = C.size_t(d.X)
+		val[1] = C.size_t(d.Y)
+		val[2] = C.size_t(d.Z)
+	}
+	return val
+}
+
 type CLUint C.cl_uint
 
 type Dim3 struct {
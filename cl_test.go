@@ -1,10 +1,25 @@
 package go2opencl
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io/ioutil"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+	"unsafe"
 )
 
 var kernelSource = `
@@ -19,6 +34,22 @@ __kernel void square(
 }
 `
 
+// Runs the square kernel on the go2opencl-sim platform
+func squareSim(l *SimLaunch) error {
+	input, output, count := l.Args[0].Float32s(), l.Args[1].Float32s(), l.Args[2].Uint32()
+	l.ForEachGlobalID(func(id [3]int) {
+		if i := id[0]; uint32(i) < count {
+			output[i] = input[i] * input[i]
+		}
+	})
+	return nil
+}
+
+func init() {
+	// Fails with ErrUnsupported on other platforms, which then run the OpenCL C kernel
+	RegisterSimKernel("square", squareSim)
+}
+
 func getObjectStrings(object interface{}) map[string]string {
 	v := reflect.ValueOf(object)
 	t := reflect.TypeOf(object)
@@ -183,7 +214,7 @@ func TestHello(t *testing.T) {
 
 	totalArgs, err := kernel.NumArgs()
 	if err != nil {
-		t.Errorf("Failed to get number of arguments of kernel: $+v", err)
+		t.Errorf("Failed to get number of arguments of kernel: %+v", err)
 	} else {
 		t.Logf("Number of arguments in kernel : %d", totalArgs)
 	}
@@ -239,8 +270,1396 @@ func TestHello(t *testing.T) {
 	}
 
 	if correct != len(data) {
-		t.Error("%d/%d correct values", correct, len(results))
+		t.Errorf("%d/%d correct values", correct, len(results))
 	}
 
 	t.Logf("Finished tests")
 }
+
+func TestHalfConversion(t *testing.T) {
+	cases := []struct {
+		f    float32
+		mode HalfRoundingMode
+		h    Half
+	}{
+		{1.0, HalfRoundToNearestEven, 0x3C00},
+		{-2.0, HalfRoundToNearestEven, 0xC000},
+		{65504, HalfRoundToNearestEven, 0x7BFF},
+		{1e6, HalfRoundToNearestEven, 0x7C00},
+		{1e6, HalfRoundToZero, 0x7BFF},
+		{5.960464477539063e-08, HalfRoundToNearestEven, 0x0001},
+		{1e-10, HalfRoundToPositiveInf, 0x0001},
+		{1e-10, HalfRoundToNearestEven, 0x0000},
+		{1.0009765625, HalfRoundToNearestEven, 0x3C01},
+		{1.00048828125, HalfRoundToNearestEven, 0x3C00},
+		{1.00048828125, HalfRoundToPositiveInf, 0x3C01},
+		{-1.00048828125, HalfRoundToNegativeInf, 0xBC01},
+	}
+	for _, c := range cases {
+		if h := HalfFromFloat32(c.f, c.mode); h != c.h {
+			t.Errorf("HalfFromFloat32(%g, %s) = %#04x, want %#04x", c.f, c.mode, uint16(h), uint16(c.h))
+		}
+	}
+
+	for i := 0; i < 0x10000; i++ {
+		h := Half(i)
+		if h.IsNaN() {
+			if !HalfFromFloat32(h.Float32(), HalfRoundToNearestEven).IsNaN() {
+				t.Fatalf("NaN %#04x did not round trip", i)
+			}
+			continue
+		}
+		if back := NewHalf(h.Float32()); back != h {
+			t.Fatalf("%#04x round tripped to %#04x", i, uint16(back))
+		}
+	}
+}
+
+func TestCallbackTable(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				h := callbacks.register(i)
+				if h == 0 {
+					t.Errorf("register returned the reserved handle 0")
+				}
+				if v := callbacks.take(h); v != i {
+					t.Errorf("take(%d) = %v, want %d", h, v, i)
+				}
+				if v := callbacks.take(h); v != nil {
+					t.Errorf("second take(%d) = %v, want nil", h, v)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestErrorCodes(t *testing.T) {
+	for _, c := range []struct {
+		err  error
+		code int
+		name string
+	}{
+		{ErrInvalidProperty, -64, "CL_INVALID_PROPERTY"},
+		{ErrInvalidPipeSize, -69, "CL_INVALID_PIPE_SIZE"},
+		{ErrMaxSizeRestrictionExceeded, -72, "CL_MAX_SIZE_RESTRICTION_EXCEEDED"},
+		{ErrPlatformNotFound, -1001, "CL_PLATFORM_NOT_FOUND_KHR"},
+		{ErrInvalidCommandBuffer, -1138, "CL_INVALID_COMMAND_BUFFER_KHR"},
+		{ErrDevicePartitionFailedExt, -1057, "CL_DEVICE_PARTITION_FAILED_EXT"},
+		{&Error{Func: "clSetKernelArg", Code: -51, Err: ErrInvalidArgSize}, -51, "CL_INVALID_ARG_SIZE"},
+		{fmt.Errorf("setting up: %w", ErrOutOfResources), -5, "CL_OUT_OF_RESOURCES"},
+		{ErrOther(-9999), -9999, "CL_UNKNOWN_ERROR(-9999)"},
+	} {
+		code, ok := ErrorCode(c.err)
+		if !ok || code != c.code {
+			t.Errorf("ErrorCode(%v) = %d, %t, want %d", c.err, code, ok, c.code)
+		}
+		if name := StatusCode(c.code).String(); name != c.name {
+			t.Errorf("StatusCode(%d).String() = %q, want %q", c.code, name, c.name)
+		}
+	}
+	// Untyped constants, such as C.CL_INVALID_SAMPLER in sampler.go, reach toError as int
+	for code, want := range map[int]error{0: nil, -41: ErrInvalidSampler, -1057: ErrDevicePartitionFailedExt, -9999: ErrOther(-9999)} {
+		if err := toError(code); err != want {
+			t.Errorf("toError(%d) = %v, want %v", code, err, want)
+		}
+	}
+	if ErrDevicePartitionFailedExt.Error() == ErrDevicePartitionFailed.Error() {
+		t.Errorf("ErrDevicePartitionFailedExt prints as ErrDevicePartitionFailed: %q", ErrDevicePartitionFailedExt)
+	}
+	if _, ok := ErrorCode(errors.New("not from OpenCL")); ok {
+		t.Error("ErrorCode returned true for an error not from OpenCL")
+	}
+	if name := StatusCode(0).String(); name != "CL_SUCCESS" {
+		t.Errorf("StatusCode(0).String() = %q, want CL_SUCCESS", name)
+	}
+}
+
+func simDevice(t *testing.T) *Device {
+	if !SimAvailable() {
+		t.Skip("the go2opencl-sim platform is not linked")
+	}
+	platforms, err := GetPlatforms()
+	if err != nil {
+		t.Fatalf("Failed to get platforms: %+v", err)
+	}
+	for _, p := range platforms {
+		if p.Name() == SimPlatformName {
+			devices, err := p.GetDevices(DeviceTypeAll)
+			if err != nil {
+				t.Fatalf("Failed to get devices: %+v", err)
+			}
+			return devices[0]
+		}
+	}
+	t.Fatalf("Platform %s not found", SimPlatformName)
+	return nil
+}
+
+// Creates a context on the go2opencl-sim device and builds src in it. Both
+// are released at the end of the test.
+func simProgram(t *testing.T, src string) (*Context, *Program) {
+	t.Helper()
+	context, err := CreateContext([]*Device{simDevice(t)})
+	if err != nil {
+		t.Fatalf("CreateContext failed: %+v", err)
+	}
+	t.Cleanup(context.Release)
+	program, err := context.CreateProgramWithSource([]string{src})
+	if err != nil {
+		t.Fatalf("CreateProgramWithSource failed: %+v", err)
+	}
+	t.Cleanup(program.Release)
+	if err := program.BuildProgram(nil, ""); err != nil {
+		t.Fatalf("BuildProgram failed: %+v", err)
+	}
+	return context, program
+}
+
+// Builds src as simProgram does and creates its kernel name, which is
+// released at the end of the test.
+func simKernel(t *testing.T, src, name string) (*Context, *Kernel) {
+	t.Helper()
+	context, program := simProgram(t, src)
+	kernel, err := program.CreateKernel(name)
+	if err != nil {
+		t.Fatalf("CreateKernel failed: %+v", err)
+	}
+	t.Cleanup(kernel.Release)
+	return context, kernel
+}
+
+func TestSimUserEvents(t *testing.T) {
+	device := simDevice(t)
+	context, err := CreateContext([]*Device{device})
+	if err != nil {
+		t.Fatalf("CreateContext failed: %+v", err)
+	}
+	defer context.Release()
+	queue, err := context.CreateCommandQueue(device, CommandQueueProfilingEnable)
+	if err != nil {
+		t.Fatalf("CreateCommandQueue failed: %+v", err)
+	}
+	defer queue.Release()
+	buffer, err := context.CreateEmptyBuffer(MemReadWrite, 16)
+	if err != nil {
+		t.Fatalf("CreateEmptyBuffer failed: %+v", err)
+	}
+	defer buffer.Release()
+
+	gate, err := context.CreateUserEvent()
+	if err != nil {
+		t.Fatalf("CreateUserEvent failed: %+v", err)
+	}
+	data := []float32{1, 2, 3, 4}
+	write, err := queue.EnqueueWriteBufferFloat32(buffer, false, 0, data, []*Event{gate})
+	if err != nil {
+		t.Fatalf("EnqueueWriteBufferFloat32 failed: %+v", err)
+	}
+	marker, err := queue.EnqueueMarkerWithWaitList(nil)
+	if err != nil {
+		t.Fatalf("EnqueueMarkerWithWaitList failed: %+v", err)
+	}
+	if status, _ := marker.GetStatus(); status != CommandExecStatusQueued {
+		t.Fatalf("marker status is %v before the user event completed", status)
+	}
+
+	if err := gate.SetUserEventStatus(CommandExecStatusComplete); err != nil {
+		t.Fatalf("SetUserEventStatus failed: %+v", err)
+	}
+	<-marker.Done()
+	if status, _ := write.GetStatus(); status != CommandExecStatusComplete {
+		t.Fatalf("write status is %v after the marker completed", status)
+	}
+	profile, err := write.Profile()
+	if err != nil {
+		t.Fatalf("Profile failed: %+v", err)
+	}
+	if profile.Queued > profile.Submit || profile.Submit > profile.Start || profile.Start > profile.End {
+		t.Errorf("timestamps out of order: %+v", profile)
+	}
+
+	results := make([]float32, len(data))
+	if _, err := queue.EnqueueReadBufferFloat32(buffer, true, 0, results, nil); err != nil {
+		t.Fatalf("EnqueueReadBufferFloat32 failed: %+v", err)
+	}
+	if !reflect.DeepEqual(results, data) {
+		t.Errorf("read %v, want %v", results, data)
+	}
+
+	// Commands waiting on a failed user event fail too
+	failed, _ := context.CreateUserEvent()
+	blocked, err := queue.EnqueueBarrierWithWaitList([]*Event{failed})
+	if err != nil {
+		t.Fatalf("EnqueueBarrierWithWaitList failed: %+v", err)
+	}
+	failed.SetUserEventStatus(-5) // CL_OUT_OF_RESOURCES
+	if err := WaitForEvents([]*Event{blocked}); err != ErrExecStatusErrorForEventsInWaitList {
+		t.Errorf("WaitForEvents returned %v, want %v", err, ErrExecStatusErrorForEventsInWaitList)
+	}
+}
+
+func TestSimEventWait(t *testing.T) {
+	device := simDevice(t)
+	clContext, err := CreateContext([]*Device{device})
+	if err != nil {
+		t.Fatalf("CreateContext failed: %+v", err)
+	}
+	defer clContext.Release()
+	queue, err := clContext.CreateCommandQueue(device, 0)
+	if err != nil {
+		t.Fatalf("CreateCommandQueue failed: %+v", err)
+	}
+	defer queue.Release()
+	gate, err := clContext.CreateUserEvent()
+	if err != nil {
+		t.Fatalf("CreateUserEvent failed: %+v", err)
+	}
+	marker, err := queue.EnqueueMarkerWithWaitList([]*Event{gate})
+	if err != nil {
+		t.Fatalf("EnqueueMarkerWithWaitList failed: %+v", err)
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := marker.Wait(canceled); err != context.Canceled {
+		t.Errorf("Wait returned %v with a canceled context, want %v", err, context.Canceled)
+	}
+	expired, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := marker.Wait(expired); err != context.DeadlineExceeded {
+		t.Errorf("Wait returned %v with an expired context, want %v", err, context.DeadlineExceeded)
+	}
+	if err := WaitForEventsContext(expired, []*Event{marker}); err != context.DeadlineExceeded {
+		t.Errorf("WaitForEventsContext returned %v with an expired context, want %v", err, context.DeadlineExceeded)
+	}
+
+	if err := gate.SetUserEventStatus(CommandExecStatusComplete); err != nil {
+		t.Fatalf("SetUserEventStatus failed: %+v", err)
+	}
+	if err := WaitForEventsContext(context.Background(), []*Event{marker}); err != nil {
+		t.Errorf("WaitForEventsContext failed: %+v", err)
+	}
+	if _, err := marker.Profile(); err != ErrProfilingNotEnabled {
+		t.Errorf("Profile returned %v on a queue without profiling, want %v", err, ErrProfilingNotEnabled)
+	}
+}
+
+func TestSimKernelError(t *testing.T) {
+	device := simDevice(t)
+	context, err := CreateContext([]*Device{device})
+	if err != nil {
+		t.Fatalf("CreateContext failed: %+v", err)
+	}
+	defer context.Release()
+	queue, err := context.CreateCommandQueue(device, 0)
+	if err != nil {
+		t.Fatalf("CreateCommandQueue failed: %+v", err)
+	}
+	defer queue.Release()
+
+	program, err := context.CreateProgramWithSource([]string{"__kernel void fail(void) {}\n__kernel void missing(void) {}\n"})
+	if err != nil {
+		t.Fatalf("CreateProgramWithSource failed: %+v", err)
+	}
+	if err := program.BuildProgram(nil, ""); err != nil {
+		t.Fatalf("BuildProgram failed: %+v", err)
+	}
+	if err := RegisterSimKernel("fail", func(*SimLaunch) error { return ErrOutOfResources }); err != nil {
+		t.Fatalf("RegisterSimKernel failed: %+v", err)
+	}
+	defer UnregisterSimKernel("fail")
+
+	for name, want := range map[string]error{"fail": ErrOutOfResources, "missing": ErrInvalidKernelName} {
+		kernel, err := program.CreateKernel(name)
+		if err != nil {
+			t.Fatalf("CreateKernel failed: %+v", err)
+		}
+		_, err = queue.EnqueueNDRangeKernel(kernel, nil, []int{1}, nil, nil)
+		if !errors.Is(err, want) {
+			t.Errorf("EnqueueNDRangeKernel(%s) returned %v, want %v", name, err, want)
+		}
+		if e, ok := err.(*Error); !ok || e.Func != "clEnqueueNDRangeKernel" || e.Kernel != name || len(e.GlobalSize) != 1 {
+			t.Errorf("EnqueueNDRangeKernel(%s) returned %#v, want an *Error for the launch", name, err)
+		}
+		kernel.Release()
+	}
+
+	kernel, err := program.CreateKernel("fail")
+	if err != nil {
+		t.Fatalf("CreateKernel failed: %+v", err)
+	}
+	defer kernel.Release()
+	err = kernel.SetArgUint32(0, 1)
+	if e, ok := err.(*Error); !ok || !errors.Is(err, ErrInvalidArgIndex) || e.Func != "clSetKernelArg" || e.Kernel != "fail" || e.ArgIndex != 0 || e.Size != 4 {
+		t.Errorf("SetArgUint32 returned %#v, want an *Error for argument 0", err)
+	}
+}
+
+func TestSimBufferRange(t *testing.T) {
+	device := simDevice(t)
+	context, err := CreateContext([]*Device{device})
+	if err != nil {
+		t.Fatalf("CreateContext failed: %+v", err)
+	}
+	defer context.Release()
+	queue, err := context.CreateCommandQueue(device, 0)
+	if err != nil {
+		t.Fatalf("CreateCommandQueue failed: %+v", err)
+	}
+	defer queue.Release()
+	buffer, err := context.CreateEmptyBuffer(MemReadWrite, 64)
+	if err != nil {
+		t.Fatalf("CreateEmptyBuffer failed: %+v", err)
+	}
+	defer buffer.Release()
+	// The same buffer, as a memory object of unknown size
+	unsized := &MemObject{clMem: buffer.clMem}
+
+	data := make([]float32, 16)
+	for _, tt := range []struct {
+		name string
+		call func() (*Event, error)
+		want *ErrBufferRange
+	}{
+		{"in range", func() (*Event, error) { return queue.EnqueueWriteBufferFloat32(buffer, true, 56, data[:2], nil) }, nil},
+		{"whole buffer", func() (*Event, error) { return queue.EnqueueReadBufferFloat32(buffer, true, 0, data, nil) }, nil},
+		{"empty slice", func() (*Event, error) { return queue.EnqueueWriteBufferFloat32(buffer, true, 0, data[:0], nil) }, &ErrBufferRange{0, 0, 64}},
+		{"negative offset", func() (*Event, error) { return queue.EnqueueWriteBufferFloat32(buffer, true, -4, data[:1], nil) }, &ErrBufferRange{-4, 4, 64}},
+		{"past the end", func() (*Event, error) { return queue.EnqueueWriteBufferFloat32(buffer, true, 60, data[:2], nil) }, &ErrBufferRange{60, 8, 64}},
+		{"offset at the end", func() (*Event, error) { return queue.EnqueueReadBufferFloat32(buffer, true, 64, data[:1], nil) }, &ErrBufferRange{64, 4, 64}},
+		{"slice longer than the buffer", func() (*Event, error) {
+			return queue.EnqueueReadBufferFloat32(buffer, true, 0, make([]float32, 17), nil)
+		}, &ErrBufferRange{0, 68, 64}},
+		{"copy source", func() (*Event, error) { return queue.EnqueueCopyBuffer(buffer, buffer, 48, 0, 32, nil) }, &ErrBufferRange{48, 32, 64}},
+		{"copy destination", func() (*Event, error) { return queue.EnqueueCopyBuffer(buffer, buffer, 0, 48, 32, nil) }, &ErrBufferRange{48, 32, 64}},
+		{"fill", func() (*Event, error) {
+			return queue.EnqueueFillBuffer(buffer, unsafe.Pointer(&data[0]), 4, 0, 128, nil)
+		}, &ErrBufferRange{0, 128, 64}},
+		{"map", func() (*Event, error) {
+			_, ev, err := queue.EnqueueMapBuffer(buffer, true, MapFlagRead, 32, 64, nil)
+			return ev, err
+		}, &ErrBufferRange{32, 64, 64}},
+		// The size of the buffer is not known, so only the range is checked
+		{"unknown size, negative offset", func() (*Event, error) { return queue.EnqueueWriteBufferFloat32(unsized, true, -4, data[:1], nil) }, &ErrBufferRange{-4, 4, 0}},
+		{"unknown size, empty slice", func() (*Event, error) { return queue.EnqueueWriteBufferFloat32(unsized, true, 0, data[:0], nil) }, &ErrBufferRange{0, 0, 0}},
+		{"unknown size, in range", func() (*Event, error) { return queue.EnqueueWriteBufferFloat32(unsized, true, 56, data[:2], nil) }, nil},
+	} {
+		ev, err := tt.call()
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: returned %v", tt.name, err)
+			}
+		} else if e, ok := err.(ErrBufferRange); !ok || e != *tt.want || ev != nil {
+			t.Errorf("%s: returned %v, %v, want no event and %v", tt.name, ev, err, *tt.want)
+		}
+	}
+
+	// Past the end of a buffer of unknown size, the driver reports the error
+	_, err = queue.EnqueueWriteBufferFloat32(unsized, true, 60, data[:2], nil)
+	if e, ok := err.(*Error); !ok || !errors.Is(err, ErrInvalidValue) || e.Offset != 60 || e.Size != 8 {
+		t.Errorf("EnqueueWriteBufferFloat32 past the end of a buffer of unknown size returned %#v, want an *Error from the driver", err)
+	}
+	if _, err := queue.EnqueueWriteBufferFloat32(nil, true, 0, data, nil); !errors.Is(err, ErrInvalidMemObject) {
+		t.Errorf("EnqueueWriteBufferFloat32 returned %v for a nil buffer, want %v", err, ErrInvalidMemObject)
+	}
+}
+
+func TestGoImagePixels(t *testing.T) {
+	gray := image.NewGray16(image.Rect(0, 0, 4, 3))
+	rgba := image.NewNRGBA64(image.Rect(0, 0, 4, 3))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 4; x++ {
+			v := uint16(0x1000*x + y)
+			gray.SetGray16(x, y, color.Gray16{Y: v})
+			rgba.SetNRGBA64(x, y, color.NRGBA64{R: v, G: v + 0x100, B: v + 0x200, A: 0xffff})
+		}
+	}
+	sub := image.Rect(1, 1, 3, 3)
+	for _, test := range []struct {
+		img    image.Image
+		want   []uint16
+		unpack image.Image
+	}{
+		{gray.SubImage(sub), []uint16{0x1001, 0x2001, 0x1002, 0x2002}, image.NewGray16(image.Rect(0, 0, 2, 2))},
+		{rgba.SubImage(sub), []uint16{
+			0x1001, 0x1101, 0x1201, 0xffff, 0x2001, 0x2101, 0x2201, 0xffff,
+			0x1002, 0x1102, 0x1202, 0xffff, 0x2002, 0x2102, 0x2202, 0xffff,
+		}, image.NewNRGBA64(image.Rect(0, 0, 2, 2))},
+	} {
+		pix, err := goImagePixels(test.img)
+		if err != nil {
+			t.Fatalf("goImagePixels failed for %T: %v", test.img, err)
+		}
+		want := make([]byte, 2*len(test.want))
+		for i, v := range test.want {
+			hostByteOrder.PutUint16(want[2*i:], v)
+		}
+		if !bytes.Equal(pix, want) {
+			t.Errorf("goImagePixels returned % x for %T, want % x", pix, test.img, want)
+			continue
+		}
+		// EnqueueReadGoImage swaps the samples back into a new image
+		swapByteOrder16(pix, binary.BigEndian, hostByteOrder)
+		var unpacked []byte
+		switch m := test.unpack.(type) {
+		case *image.Gray16:
+			unpacked = m.Pix
+		case *image.NRGBA64:
+			unpacked = m.Pix
+		}
+		copy(unpacked, pix)
+		for y := 0; y < 2; y++ {
+			for x := 0; x < 2; x++ {
+				if got, want := test.unpack.At(x, y), test.img.At(x+1, y+1); got != want {
+					t.Errorf("%T pixel (%d, %d) is %v after unpacking, want %v", test.img, x, y, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestSimCreateImageFromGoImageFlags(t *testing.T) {
+	device := simDevice(t)
+	context, err := CreateContext([]*Device{device})
+	if err != nil {
+		t.Fatalf("CreateContext failed: %+v", err)
+	}
+	defer context.Release()
+	img := image.NewGray(image.Rect(0, 0, 4, 4))
+	if _, err := context.CreateImageFromGoImage(MemReadOnly|MemUseHostPtr, img); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("CreateImageFromGoImage returned %v with MemUseHostPtr, want %v", err, ErrInvalidValue)
+	}
+	// The simulator has no images, so the flags are only checked to pass to it
+	for _, flags := range []MemFlag{MemReadOnly, MemReadOnly | MemAllocHostPtr, MemReadOnly | MemCopyHostPtr} {
+		if _, err := context.CreateImageFromGoImage(flags, img); errors.Is(err, ErrInvalidValue) {
+			t.Errorf("CreateImageFromGoImage returned %v with flags %v", err, flags)
+		}
+	}
+}
+
+func TestSimRegionError(t *testing.T) {
+	device := simDevice(t)
+	context, err := CreateContext([]*Device{device})
+	if err != nil {
+		t.Fatalf("CreateContext failed: %+v", err)
+	}
+	defer context.Release()
+	queue, err := context.CreateCommandQueue(device, 0)
+	if err != nil {
+		t.Fatalf("CreateCommandQueue failed: %+v", err)
+	}
+	defer queue.Release()
+	buffer, err := context.CreateEmptyBuffer(MemReadWrite, 16)
+	if err != nil {
+		t.Fatalf("CreateEmptyBuffer failed: %+v", err)
+	}
+	defer buffer.Release()
+
+	// A 2x2 block in the middle of a 4x4 buffer.
+	in := []byte{1, 2, 3, 4}
+	if _, err := queue.EnqueueWriteBufferRect(buffer, true, &Dim3{1, 1, 0}, &Dim3{}, &Dim3{2, 2, 1}, 4, 16, 2, 4, unsafe.Pointer(&in[0]), nil); err != nil {
+		t.Fatalf("EnqueueWriteBufferRect failed: %+v", err)
+	}
+	out := make([]byte, 16)
+	if _, err := queue.EnqueueReadBufferRect(buffer, true, &Dim3{}, &Dim3{}, &Dim3{4, 4, 1}, 4, 16, 4, 16, unsafe.Pointer(&out[0]), nil); err != nil {
+		t.Fatalf("EnqueueReadBufferRect failed: %+v", err)
+	}
+	if want := []byte{0, 0, 0, 0, 0, 1, 2, 0, 0, 3, 4, 0, 0, 0, 0, 0}; !bytes.Equal(out, want) {
+		t.Errorf("EnqueueReadBufferRect read %v, want %v", out, want)
+	}
+
+	_, err = queue.EnqueueWriteBufferRect(buffer, true, &Dim3{3, 3, 0}, &Dim3{}, &Dim3{2, 2, 1}, 4, 16, 2, 4, unsafe.Pointer(&in[0]), nil)
+	if e, ok := err.(*Error); !ok || !errors.Is(err, ErrInvalidValue) || e.Func != "clEnqueueWriteBufferRect" ||
+		!reflect.DeepEqual(e.Origin, []int{3, 3, 0}) || !reflect.DeepEqual(e.Region, []int{2, 2, 1}) {
+		t.Errorf("EnqueueWriteBufferRect returned %#v, want an *Error for the region", err)
+	}
+	_, err = queue.EnqueueCopyBufferToImage(buffer, buffer, 4, &Dim3{1, 0, 0}, &Dim3{1, 1, 1}, nil)
+	if e, ok := err.(*Error); !ok || !errors.Is(err, ErrInvalidMemObject) || e.Func != "clEnqueueCopyBufferToImage" || e.Offset != 4 {
+		t.Errorf("EnqueueCopyBufferToImage returned %#v, want an *Error for the copy", err)
+	}
+}
+
+func TestSimFaults(t *testing.T) {
+	device := simDevice(t)
+	defer SimClearFaults()
+	context, err := CreateContext([]*Device{device})
+	if err != nil {
+		t.Fatalf("CreateContext failed: %+v", err)
+	}
+	defer context.Release()
+	queue, err := context.CreateCommandQueue(device, 0)
+	if err != nil {
+		t.Fatalf("CreateCommandQueue failed: %+v", err)
+	}
+	defer queue.Release()
+
+	if err := SimInjectFault("clCreateBuffer", 2, ErrMemObjectAllocationFailure); err != nil {
+		t.Fatalf("SimInjectFault failed: %+v", err)
+	}
+	for i, want := range []error{nil, ErrMemObjectAllocationFailure, nil} {
+		buffer, err := context.CreateEmptyBuffer(MemReadWrite, 64)
+		if !errors.Is(err, want) {
+			t.Errorf("CreateEmptyBuffer call %d returned %v, want %v", i+1, err, want)
+		}
+		if buffer != nil {
+			buffer.Release()
+		}
+	}
+
+	const log = "<kernel>:2:5: error: use of undeclared identifier 'y'\n1 error generated.\n"
+	if err := SimInjectBuildFault("BROKEN", log); err != nil {
+		t.Fatalf("SimInjectBuildFault failed: %+v", err)
+	}
+	program, err := context.CreateProgramWithSource([]string{"// BROKEN\n__kernel void noop(void) {}\n"})
+	if err != nil {
+		t.Fatalf("CreateProgramWithSource failed: %+v", err)
+	}
+	if err, ok := program.BuildProgram(nil, "").(BuildError); !ok || err.Message != log || !errors.Is(err, ErrBuildProgramFailure) {
+		t.Errorf("BuildProgram returned %v, want a BuildError with the injected log", err)
+	}
+	program, err = context.CreateProgramWithSource([]string{"__kernel void noop(void) {}\n"})
+	if err != nil {
+		t.Fatalf("CreateProgramWithSource failed: %+v", err)
+	}
+	if err := program.BuildProgram(nil, ""); err != nil {
+		t.Fatalf("BuildProgram failed: %+v", err)
+	}
+	if err := RegisterSimKernel("noop", func(*SimLaunch) error { return nil }); err != nil {
+		t.Fatalf("RegisterSimKernel failed: %+v", err)
+	}
+	defer UnregisterSimKernel("noop")
+	kernel, err := program.CreateKernel("noop")
+	if err != nil {
+		t.Fatalf("CreateKernel failed: %+v", err)
+	}
+	defer kernel.Release()
+
+	if err := SimInjectFault("clEnqueueNDRangeKernel", 0, ErrOutOfResources); err != nil {
+		t.Fatalf("SimInjectFault failed: %+v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := queue.EnqueueNDRangeKernel(kernel, nil, []int{1}, nil, nil); !errors.Is(err, ErrOutOfResources) {
+			t.Errorf("EnqueueNDRangeKernel returned %v, want %v", err, ErrOutOfResources)
+		}
+	}
+	SimClearFaults()
+
+	if err := SimLoseDevice(ErrDeviceNotAvailable); err != nil {
+		t.Fatalf("SimLoseDevice failed: %+v", err)
+	}
+	if device.Available() {
+		t.Error("Available returned true on a lost device")
+	}
+	if _, err := queue.EnqueueBarrierWithWaitList(nil); err != ErrDeviceNotAvailable {
+		t.Errorf("EnqueueBarrierWithWaitList returned %v, want %v", err, ErrDeviceNotAvailable)
+	}
+	if err := SimLoseDevice(nil); err != nil {
+		t.Fatalf("SimLoseDevice failed: %+v", err)
+	}
+	if _, err := queue.EnqueueNDRangeKernel(kernel, nil, []int{1}, nil, nil); err != nil {
+		t.Errorf("EnqueueNDRangeKernel failed after restoring the device: %+v", err)
+	}
+
+	if err := SimInjectFault("clGetPlatformIDs", 1, ErrOutOfResources); err != ErrInvalidValue {
+		t.Errorf("SimInjectFault(clGetPlatformIDs) returned %v, want %v", err, ErrInvalidValue)
+	}
+}
+
+func TestSimVkFFTError(t *testing.T) {
+	device := simDevice(t)
+	defer SimClearFaults()
+	context, err := CreateContext([]*Device{device})
+	if err != nil {
+		t.Fatalf("CreateContext failed: %+v", err)
+	}
+	defer context.Release()
+	input, err := context.CreateEmptyBuffer(MemReadWrite, 64*4)
+	if err != nil {
+		t.Fatalf("CreateEmptyBuffer failed: %+v", err)
+	}
+	defer input.Release()
+	output, err := context.CreateEmptyBuffer(MemReadWrite, 66*4)
+	if err != nil {
+		t.Fatalf("CreateEmptyBuffer failed: %+v", err)
+	}
+	defer output.Release()
+
+	// The log is checked below, without the code VkFFT prints with it
+	SetVkFFTPrintBuildErrors(false)
+	defer SetVkFFTPrintBuildErrors(true)
+	const log = "<kernel>:1:1: error: injected\n"
+	if err := SimInjectBuildFault("__kernel", log); err != nil {
+		t.Fatalf("SimInjectBuildFault failed: %+v", err)
+	}
+	plan := NewVkFFTPlan(context)
+	defer plan.Destroy()
+	plan.VkFFTSetFFTPlanSize([]int{64})
+	err = plan.EnqueueForwardTransform([]*MemObject{input}, []*MemObject{output})
+	var fftErr *VkFFTError
+	if !errors.As(err, &fftErr) {
+		t.Fatalf("EnqueueForwardTransform returned %v, want a *VkFFTError", err)
+	}
+	if !errors.Is(err, ErrVkFFTFailCompileProgram) || !errors.Is(err, ErrBuildProgramFailure) {
+		t.Errorf("EnqueueForwardTransform returned %v, want %v caused by %v", err, ErrVkFFTFailCompileProgram, ErrBuildProgramFailure)
+	}
+	if code, ok := ErrorCode(err); !ok || StatusCode(code).String() != "CL_BUILD_PROGRAM_FAILURE" {
+		t.Errorf("ErrorCode(%v) = %d, %v", err, code, ok)
+	}
+	if fftErr.Dim != 1 || fftErr.Size[0] != 64 || !fftErr.R2C || fftErr.Precision != "single" || fftErr.BuildLog != log {
+		t.Errorf("VkFFTError = %+v", fftErr)
+	}
+}
+
+func TestBuildOptions(t *testing.T) {
+	var defaults *BuildOptions
+	if s := defaults.String(); s != "-cl-std=CL1.2 -cl-kernel-arg-info" {
+		t.Errorf("nil BuildOptions rendered %q", s)
+	}
+	o := &BuildOptions{
+		Std:              "CL2.0",
+		Defines:          map[string]string{"N": "16", "MSG": "a \"b\"", "DEBUG": ""},
+		IncludeDirs:      []string{"/opt/kernels", "C:\\My Kernels"},
+		FastRelaxedMath:  true,
+		MadEnable:        true,
+		WarningsAsErrors: true,
+	}
+	want := `-cl-std=CL2.0 -cl-kernel-arg-info -D DEBUG -D "MSG=a \"b\"" -D N=16 -I /opt/kernels -I "C:\\My Kernels" -cl-fast-relaxed-math -cl-mad-enable -Werror`
+	if s := o.String(); s != want {
+		t.Errorf("BuildOptions rendered\n%s\nwant\n%s", s, want)
+	}
+	if s := o.linkString(); s != "-cl-fast-relaxed-math" {
+		t.Errorf("BuildOptions rendered link options %q", s)
+	}
+	link := &BuildOptions{DenormsAreZero: true, Extra: "-O0", LinkExtra: "-create-library"}
+	if s := link.linkString(); s != "-cl-denorms-are-zero -create-library" {
+		t.Errorf("BuildOptions rendered link options %q", s)
+	}
+	if err := o.Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+	for _, bad := range []*BuildOptions{
+		{Std: "2.0"},
+		{Defines: map[string]string{"": "1"}},
+		{Defines: map[string]string{"A B": ""}},
+		{IncludeDirs: []string{""}},
+		{NoWarnings: true, WarningsAsErrors: true},
+	} {
+		if err := bad.Validate(); !errors.Is(err, ErrInvalidBuildOptions) {
+			t.Errorf("Validate returned %v for %q, want ErrInvalidBuildOptions", err, bad)
+		}
+	}
+	for _, std := range []string{"CL1.1", "CL3.0", "CLC++", "CLC++2021"} {
+		if err := (&BuildOptions{Std: std}).Validate(); err != nil {
+			t.Errorf("Validate failed for Std %q: %v", std, err)
+		}
+	}
+	p := *o
+	p.Defines = map[string]string{"DEBUG": "", "N": "16", "MSG": "a \"b\""}
+	if !o.Equal(&p) {
+		t.Error("Equal returned false for the same options")
+	}
+	p.Std = ""
+	if o.Equal(&p) {
+		t.Error("Equal returned true for different options")
+	}
+}
+
+func TestSimProgramCache(t *testing.T) {
+	device := simDevice(t)
+	defer SimClearFaults()
+	context, err := CreateContext([]*Device{device})
+	if err != nil {
+		t.Fatalf("CreateContext failed: %+v", err)
+	}
+	defer context.Release()
+	cache, err := NewProgramCache(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewProgramCache failed: %+v", err)
+	}
+	sources := []string{"__kernel void cached(void) {}\n"}
+	path := cache.path(cache.Key(device, sources, "-cl-std=CL1.2 -cl-kernel-arg-info -DN=1"))
+	if cache.Key(device, sources, "-DN=2") == cache.Key(device, sources, "-DN=1") {
+		t.Error("Key does not depend on the build options")
+	}
+
+	program, err := cache.BuildProgram(context, sources, "-DN=1")
+	if err != nil {
+		t.Fatalf("BuildProgram failed: %+v", err)
+	}
+	program.Release()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("BuildProgram did not store the binary: %+v", err)
+	}
+
+	// A hit must not touch the sources
+	if err := SimInjectFault("clCreateProgramWithSource", 0, ErrOutOfHostMemory); err != nil {
+		t.Fatalf("SimInjectFault failed: %+v", err)
+	}
+	program, err = cache.BuildProgram(context, sources, "-DN=1")
+	if err != nil {
+		t.Fatalf("BuildProgram from the cache failed: %+v", err)
+	}
+	program.Release()
+	SimClearFaults()
+
+	if err := ioutil.WriteFile(path, []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	program, err = cache.BuildProgram(context, sources, "-DN=1")
+	if err != nil {
+		t.Fatalf("BuildProgram with an invalid binary failed: %+v", err)
+	}
+	program.Release()
+	if bin, err := ioutil.ReadFile(path); err != nil || string(bin) == "garbage" {
+		t.Errorf("BuildProgram did not replace the invalid binary: %q, %v", bin, err)
+	}
+
+	// A stale binary that the driver loads but fails to build
+	stale := "go2opencl-sim binary 1\n// stale\n" + sources[0]
+	if err := ioutil.WriteFile(path, []byte(stale), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SimInjectBuildFault("// stale", "<kernel>:1:1: error: stale binary\n"); err != nil {
+		t.Fatalf("SimInjectBuildFault failed: %+v", err)
+	}
+	program, err = cache.BuildProgram(context, sources, "-DN=1")
+	if err != nil {
+		t.Fatalf("BuildProgram with a stale binary failed: %+v", err)
+	}
+	program.Release()
+	if bin, err := ioutil.ReadFile(path); err != nil || string(bin) == stale {
+		t.Errorf("BuildProgram did not replace the stale binary: %q, %v", bin, err)
+	}
+}
+
+func TestSimVkFFTProfiling(t *testing.T) {
+	device := simDevice(t)
+	context, err := CreateContext([]*Device{device})
+	if err != nil {
+		t.Fatalf("CreateContext failed: %+v", err)
+	}
+	defer context.Release()
+	plan := NewVkFFTPlan(context)
+	defer plan.Destroy()
+	queue := func() *CommandQueue {
+		return &CommandQueue{clQueue: plan.vkfftPlanStruct.commandQueue}
+	}
+	if props, err := queue().GetQueueProperties(); err != nil || props&CommandQueueProfilingEnable != 0 {
+		t.Errorf("the queue of a new plan has properties %v, %v, want no profiling", props, err)
+	}
+	if err := plan.SetRecorder(NewRecorder()); err != nil {
+		t.Fatalf("SetRecorder failed: %+v", err)
+	}
+	if props, err := queue().GetQueueProperties(); err != nil || props&CommandQueueProfilingEnable == 0 {
+		t.Errorf("the queue of a recorded plan has properties %v, %v, want profiling", props, err)
+	}
+}
+
+func TestSimRecorder(t *testing.T) {
+	device := simDevice(t)
+	context, err := CreateContext([]*Device{device})
+	if err != nil {
+		t.Fatalf("CreateContext failed: %+v", err)
+	}
+	defer context.Release()
+	var queues [2]*CommandQueue
+	for i := range queues {
+		if queues[i], err = context.CreateCommandQueue(device, CommandQueueProfilingEnable); err != nil {
+			t.Fatalf("CreateCommandQueue failed: %+v", err)
+		}
+		defer queues[i].Release()
+	}
+	program, err := context.CreateProgramWithSource([]string{"__kernel void nap(const unsigned int us) {}\n"})
+	if err != nil {
+		t.Fatalf("CreateProgramWithSource failed: %+v", err)
+	}
+	defer program.Release()
+	if err := program.BuildProgram(nil, ""); err != nil {
+		t.Fatalf("BuildProgram failed: %+v", err)
+	}
+	// The simulator times the commands with the clock of the host
+	if err := RegisterSimKernel("nap", func(l *SimLaunch) error {
+		time.Sleep(time.Duration(l.Args[0].Uint32()) * time.Microsecond)
+		return nil
+	}); err != nil {
+		t.Fatalf("RegisterSimKernel failed: %+v", err)
+	}
+	defer UnregisterSimKernel("nap")
+	kernel, err := program.CreateKernel("nap")
+	if err != nil {
+		t.Fatalf("CreateKernel failed: %+v", err)
+	}
+	defer kernel.Release()
+	buffer, err := context.CreateEmptyBuffer(MemReadWrite, 256)
+	if err != nil {
+		t.Fatalf("CreateEmptyBuffer failed: %+v", err)
+	}
+	defer buffer.Release()
+
+	recorder := NewRecorder()
+	defer recorder.Reset()
+	for _, q := range queues {
+		q.SetRecorder(recorder)
+	}
+	const naps = 20
+	for i := 1; i <= naps; i++ {
+		if err := kernel.SetArgUint32(0, uint32(i*200)); err != nil {
+			t.Fatalf("SetArgUint32 failed: %+v", err)
+		}
+		if _, err := queues[0].EnqueueNDRangeKernel(kernel, nil, []int{1}, nil, nil); err != nil {
+			t.Fatalf("EnqueueNDRangeKernel failed: %+v", err)
+		}
+	}
+	data := make([]uint8, 256)
+	for _, n := range []int{16, 64, 256} {
+		if _, err := queues[1].EnqueueWriteBufferUint8(buffer, false, 0, data[:n], nil); err != nil {
+			t.Fatalf("EnqueueWriteBufferUint8 failed: %+v", err)
+		}
+	}
+	if _, err := queues[1].EnqueueReadBufferUint8(buffer, true, 0, data[:32], nil); err != nil {
+		t.Fatalf("EnqueueReadBufferUint8 failed: %+v", err)
+	}
+	if _, err := queues[1].EnqueueMarkerWithWaitList(nil); err != nil {
+		t.Fatalf("EnqueueMarkerWithWaitList failed: %+v", err)
+	}
+	queues[1].SetRecorder(nil)
+	if _, err := queues[1].EnqueueReadBufferUint8(buffer, true, 0, data, nil); err != nil {
+		t.Fatalf("EnqueueReadBufferUint8 failed: %+v", err)
+	}
+
+	report, err := recorder.Report()
+	if err != nil {
+		t.Fatalf("Report failed: %+v", err)
+	}
+	stats := make(map[string]CommandStats)
+	for i, s := range report {
+		stats[s.Name] = s
+		if i > 0 && s.Total > report[i-1].Total {
+			t.Errorf("Report is not sorted by total time: %v", report)
+		}
+	}
+	for name, want := range map[string]struct{ count, bytes int }{
+		"nap":                       {naps, 0},
+		CommandWriteBuffer.String(): {3, 16 + 64 + 256},
+		CommandReadBuffer.String():  {1, 32},
+		CommandMarker.String():      {1, 0},
+	} {
+		if s := stats[name]; s.Count != want.count || s.Bytes != int64(want.bytes) {
+			t.Errorf("Report has %d commands and %d bytes for %s, want %d and %d", s.Count, s.Bytes, name, want.count, want.bytes)
+		}
+	}
+	if len(report) != 4 {
+		t.Errorf("Report has %d rows, want 4:\n%v", len(report), report)
+	}
+
+	// The statistics of the launches against their own profiles
+	var durations []time.Duration
+	var total time.Duration
+	records := recorder.Records()
+	for i := range records {
+		if records[i].Name != "nap" {
+			continue
+		}
+		profile, err := records[i].Profile()
+		if err != nil {
+			t.Fatalf("Profile failed: %+v", err)
+		}
+		durations = append(durations, profile.ExecDuration())
+		total += profile.ExecDuration()
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	nap := stats["nap"]
+	if nap.Total != total || nap.Mean != total/naps || nap.Min != durations[0] || nap.Max != durations[naps-1] || nap.P95 != durations[naps-2] {
+		t.Errorf("Report has %+v for nap, want total %v, min %v, max %v and p95 %v", nap, total, durations[0], durations[naps-1], durations[naps-2])
+	}
+	if nap.Min < 200*time.Microsecond || nap.Max < naps*200*time.Microsecond || nap.P95 > nap.Max {
+		t.Errorf("Report has %+v for nap, want the launches to take at least the time they sleep", nap)
+	}
+
+	var buf bytes.Buffer
+	if err := recorder.WriteChromeTrace(&buf); err != nil {
+		t.Fatalf("WriteChromeTrace failed: %+v", err)
+	}
+	var trace struct {
+		TraceEvents []struct {
+			Name string
+			Cat  string
+			Ph   string
+			Ts   float64
+			Dur  float64
+			Pid  int
+			Tid  int
+			Args map[string]interface{}
+		}
+		DisplayTimeUnit string
+	}
+	if err := json.Unmarshal(buf.Bytes(), &trace); err != nil {
+		t.Fatalf("WriteChromeTrace wrote invalid JSON: %v\n%s", err, buf.String())
+	}
+	metadata := make(map[string]int)
+	tids := make(map[string]map[int]bool)
+	var complete int
+	minTs := -1.0
+	for _, e := range trace.TraceEvents {
+		switch e.Ph {
+		case "M":
+			metadata[e.Name]++
+			if e.Pid != 1 || e.Args["name"] == "" {
+				t.Errorf("metadata event %+v, want one for device 1", e)
+			}
+		case "X":
+			complete++
+			if tids[e.Cat] == nil {
+				tids[e.Cat] = make(map[int]bool)
+			}
+			tids[e.Cat][e.Tid] = true
+			if e.Pid != 1 || e.Ts < 0 || e.Dur < 0 {
+				t.Errorf("complete event %+v, want one for device 1 at a nonnegative time", e)
+			}
+			if minTs < 0 || e.Ts < minTs {
+				minTs = e.Ts
+			}
+			if e.Name == CommandWriteBuffer.String() && e.Args["bytes"] == nil {
+				t.Errorf("complete event %+v has no bytes", e)
+			}
+		default:
+			t.Errorf("event %+v has phase %q, want M or X", e, e.Ph)
+		}
+	}
+	if trace.DisplayTimeUnit != "ns" || metadata["process_name"] != 1 || metadata["thread_name"] != 2 {
+		t.Errorf("WriteChromeTrace wrote %v metadata events in %s, want one process and two threads in ns", metadata, trace.DisplayTimeUnit)
+	}
+	if complete != len(records) || minTs != 0 {
+		t.Errorf("WriteChromeTrace wrote %d complete events from %v, want %d from 0", complete, minTs, len(records))
+	}
+	if !reflect.DeepEqual(tids, map[string]map[int]bool{"kernel": {1: true}, "transfer": {2: true}, "sync": {2: true}}) {
+		t.Errorf("WriteChromeTrace put the categories on threads %v, want kernels on 1 and the rest on 2", tids)
+	}
+}
+
+func TestParseBuildLog(t *testing.T) {
+	sources := []string{
+		"#define N 4\n",
+		"__kernel void f(__global float *x) {\n  x[0] = y;\n}\n",
+		"// tail, ", "no newline",
+	}
+	log := "<source>:3:10: error: use of undeclared identifier 'y'\n" +
+		"  x[0] = y;\n" +
+		"         ^\n" +
+		"util.h:7:1: warning: unused function 'g'\n" +
+		"<kernel>(5): error: identifier \"z\" is undefined\n" +
+		"<kernel>:5:11: note: here\n" +
+		"2 errors generated.\n"
+	want := []Diagnostic{
+		{File: "<source>", Line: 3, Column: 10, Severity: "error", Text: "use of undeclared identifier 'y'", Source: 1, SourceLine: 2, SourceColumn: 10},
+		{File: "util.h", Line: 7, Column: 1, Severity: "warning", Text: "unused function 'g'", Source: -1},
+		{File: "<kernel>", Line: 5, Severity: "error", Text: `identifier "z" is undefined`, Source: 3, SourceLine: 1},
+		{File: "<kernel>", Line: 5, Column: 11, Severity: "note", Text: "here", Source: 3, SourceLine: 1, SourceColumn: 2},
+	}
+	if diags := ParseBuildLog(log, sources); !reflect.DeepEqual(diags, want) {
+		t.Errorf("ParseBuildLog returned\n%+v\nwant\n%+v", diags, want)
+	}
+
+	// The same error as logged by the compilers of each vendor.
+	sources = []string{"__kernel void f(__global float *x) {\n  x[0] = y;\n}\n"}
+	for _, tt := range []struct {
+		vendor, log, file string
+		column            int
+	}{
+		{"Clang", "<source>:2:10: error: use of undeclared identifier 'y'\n  x[0] = y;\n         ^\n1 error generated.\n", "<source>", 10},
+		{"Intel", "Compilation started\n1:2:10: error: use of undeclared identifier 'y'\nCompilation failed\n", "1", 10},
+		{"AMD ROCm", "/tmp/comgr-5c6b7a/input/CompileSource:2:10: error: use of undeclared identifier 'y'\n  x[0] = y;\n         ^\n1 error generated.\nError: Failed to compile source (from CL or HIP source to LLVM IR).\n", "/tmp/comgr-5c6b7a/input/CompileSource", 10},
+		{"AMD", "/tmp/OCL4242T3.cl:2:10: error: use of undeclared identifier 'y'\n  x[0] = y;\n         ^\n1 error generated.\n\nerror: Clang front-end compilation failed!\n", "/tmp/OCL4242T3.cl", 10},
+		{"AMD Windows", "C:\\Users\\dev\\AppData\\Local\\Temp\\OCL4242T3.cl:2:10: error: use of undeclared identifier 'y'\n", "C:\\Users\\dev\\AppData\\Local\\Temp\\OCL4242T3.cl", 10},
+		{"NVIDIA", "<kernel>:2:10: error: use of undeclared identifier 'y'\n  x[0] = y;\n         ^\n", "<kernel>", 10},
+		{"NVIDIA legacy", "<kernel>(2): error: identifier \"y\" is undefined\n\n1 error detected in the compilation of \"/tmp/tmpxft_0000_00000000-7_kernel.cl\".\n", "<kernel>", 0},
+		{"Apple", "<program source>:2:10: error: use of undeclared identifier 'y'\n", "<program source>", 10},
+		{"POCL", "<stdin>:2:10: error: use of undeclared identifier 'y'\n", "<stdin>", 10},
+		{"Mesa", "input.cl:2:10: error: use of undeclared identifier 'y'\n", "input.cl", 10},
+	} {
+		diags := ParseBuildLog(tt.log, sources)
+		if len(diags) != 1 {
+			t.Errorf("%s: ParseBuildLog returned %+v, want one diagnostic", tt.vendor, diags)
+			continue
+		}
+		d := diags[0]
+		if d.File != tt.file || d.Line != 2 || d.Column != tt.column || d.Severity != "error" ||
+			d.Source != 0 || d.SourceLine != 2 || d.SourceColumn != tt.column {
+			t.Errorf("%s: ParseBuildLog returned %+v", tt.vendor, d)
+		}
+	}
+}
+
+func TestSimBuildDiagnostics(t *testing.T) {
+	device := simDevice(t)
+	context, err := CreateContext([]*Device{device})
+	if err != nil {
+		t.Fatalf("CreateContext failed: %+v", err)
+	}
+	defer context.Release()
+	program, err := context.CreateProgramWithSource([]string{
+		"#define N 4\n",
+		"__kernel void f(void) {}\n#error broken\n",
+	})
+	if err != nil {
+		t.Fatalf("CreateProgramWithSource failed: %+v", err)
+	}
+	defer program.Release()
+	buildErr, ok := program.BuildProgram(nil, "").(BuildError)
+	if !ok || len(buildErr.Logs) != 1 || buildErr.Logs[0].Device.id != device.id {
+		t.Fatalf("BuildProgram returned %v, want a BuildError with the log of the device", buildErr)
+	}
+	diags := buildErr.Diagnostics()
+	if len(diags) != 1 || diags[0].Severity != "error" || diags[0].Source != 1 || diags[0].SourceLine != 2 || diags[0].SourceColumn != 2 {
+		t.Errorf("Diagnostics returned %+v", diags)
+	}
+}
+
+func TestSimProgramBundle(t *testing.T) {
+	device := simDevice(t)
+	context, err := CreateContext([]*Device{device})
+	if err != nil {
+		t.Fatalf("CreateContext failed: %+v", err)
+	}
+	defer context.Release()
+	program, err := context.CreateProgramWithSource([]string{"__kernel void bundled(void) {}\n"})
+	if err != nil {
+		t.Fatalf("CreateProgramWithSource failed: %+v", err)
+	}
+	defer program.Release()
+	options := &BuildOptions{Std: "CL2.0", Defines: map[string]string{"N": "4"}}
+	if err := program.BuildProgramWithOptions(nil, options, nil); err != nil {
+		t.Fatalf("BuildProgramWithOptions failed: %+v", err)
+	}
+	name := filepath.Join(t.TempDir(), "bundled.bin")
+	if err := program.SaveBundle(name); err != nil {
+		t.Fatalf("SaveBundle failed: %+v", err)
+	}
+	loaded, err := context.LoadProgramBundle(name)
+	if err != nil {
+		t.Fatalf("LoadProgramBundle failed: %+v", err)
+	}
+	defer loaded.Release()
+	if opts, err := loaded.GetBuildOptions(device); err != nil || opts != options.String() {
+		t.Errorf("GetBuildOptions returned %q, %v, want %q", opts, err, options.String())
+	}
+
+	bundle, err := program.Bundle()
+	if err != nil {
+		t.Fatalf("Bundle failed: %+v", err)
+	}
+	bundle.Binaries[0].DriverVersion += "-updated"
+	if _, err := context.CreateProgramFromBundle(bundle); !errors.Is(err, ErrBundleDevice) {
+		t.Errorf("CreateProgramFromBundle returned %v for another driver, want %v", err, ErrBundleDevice)
+	}
+	var buf bytes.Buffer
+	bundle.WriteTo(&buf)
+	data := buf.Bytes()
+	data[len("go2opencl bundle\n")] = 2
+	if _, err := ReadProgramBundle(bytes.NewReader(data)); !errors.Is(err, ErrBundleVersion) {
+		t.Errorf("ReadProgramBundle returned %v for version 2, want %v", err, ErrBundleVersion)
+	}
+
+	binaries := [][]byte{bundle.Binaries[0].Binary}
+	if _, err := context.CreateProgramWithBinaryOptions([]*Device{device}, binaries, &BuildOptions{Std: "2.0"}); !errors.Is(err, ErrInvalidBuildOptions) {
+		t.Errorf("CreateProgramWithBinaryOptions returned %v for invalid options, want %v", err, ErrInvalidBuildOptions)
+	}
+
+	_, err = context.CreateProgramWithBinary([]*Device{device}, []int{7}, [][]byte{[]byte("garbage")})
+	var binErr *BinaryError
+	if !errors.As(err, &binErr) || !errors.Is(err, ErrInvalidBinary) || binErr.Status[0] != ErrInvalidBinary {
+		t.Errorf("CreateProgramWithBinary returned %v for an invalid binary, want a *BinaryError", err)
+	}
+
+	// Linked programs bundle the options they were compiled and linked with.
+	compile := func(options *BuildOptions) *Program {
+		p, err := context.CreateProgramWithSource([]string{"__kernel void part(void) {}\n"})
+		if err != nil {
+			t.Fatalf("CreateProgramWithSource failed: %+v", err)
+		}
+		if _, err := p.Bundle(); !errors.Is(err, ErrBundleOptions) {
+			t.Errorf("Bundle returned %v before compiling, want %v", err, ErrBundleOptions)
+		}
+		if err := p.CompileProgramWithOptions(nil, options, nil, nil); err != nil {
+			t.Fatalf("CompileProgramWithOptions failed: %+v", err)
+		}
+		return p
+	}
+	part1, part2 := compile(options), compile(options)
+	defer part1.Release()
+	defer part2.Release()
+	linkOptions := &BuildOptions{FastRelaxedMath: true}
+	linked, err := context.LinkProgramWithOptions([]*Program{part1, part2}, nil, linkOptions, nil)
+	if err != nil {
+		t.Fatalf("LinkProgramWithOptions failed: %+v", err)
+	}
+	defer linked.Release()
+	bundle, err = linked.Bundle()
+	if err != nil || bundle.Options != options.String()+" "+linkOptions.linkString() {
+		t.Fatalf("Bundle of the linked program returned %+v, %v, want options %q", bundle, err, options.String()+" "+linkOptions.linkString())
+	}
+	// Programs linked without a device list are linked for the devices of the context
+	if len(bundle.Binaries) == 0 {
+		t.Errorf("Bundle of the linked program has no binaries")
+	}
+	relinked, err := context.CreateProgramFromBundle(bundle)
+	if err != nil {
+		t.Fatalf("CreateProgramFromBundle of the linked program failed: %+v", err)
+	}
+	relinked.Release()
+	part3 := compile(nil)
+	defer part3.Release()
+	mixed, err := context.LinkProgram([]*Program{part1, part3}, nil, "")
+	if err != nil {
+		t.Fatalf("LinkProgram failed: %+v", err)
+	}
+	defer mixed.Release()
+	if _, err := mixed.Bundle(); !errors.Is(err, ErrBundleOptions) {
+		t.Errorf("Bundle returned %v for programs compiled with different options, want %v", err, ErrBundleOptions)
+	}
+}
+
+func TestSimKernelArgChecking(t *testing.T) {
+	device := simDevice(t)
+	context, err := CreateContext([]*Device{device})
+	if err != nil {
+		t.Fatalf("CreateContext failed: %+v", err)
+	}
+	defer context.Release()
+	const source = "__kernel void scale(__global const float * restrict x, __local float *tmp, const unsigned int n, float f) {}\n"
+	program, err := context.CreateProgramWithSource([]string{source})
+	if err != nil {
+		t.Fatalf("CreateProgramWithSource failed: %+v", err)
+	}
+	defer program.Release()
+	if err := program.BuildProgram(nil, ""); err != nil {
+		t.Fatalf("BuildProgram failed: %+v", err)
+	}
+	kernel, err := program.CreateKernel("scale")
+	if err != nil {
+		t.Fatalf("CreateKernel failed: %+v", err)
+	}
+	defer kernel.Release()
+
+	signature, err := kernel.Signature()
+	if err != nil {
+		t.Fatalf("Signature failed: %+v", err)
+	}
+	want := []string{"__global const float* restrict x", "__local float* tmp", "uint n", "float f"}
+	if len(signature) != len(want) {
+		t.Fatalf("Signature returned %d arguments, want %d", len(signature), len(want))
+	}
+	for i, arg := range signature {
+		if arg.String() != want[i] {
+			t.Errorf("argument %d is %q, want %q", i, arg, want[i])
+		}
+	}
+	if name, err := kernel.ArgName(2); err != nil || name != "n" {
+		t.Errorf("ArgName returned %q, %v, want n", name, err)
+	}
+
+	buffer, err := context.CreateEmptyBuffer(MemReadWrite, 64)
+	if err != nil {
+		t.Fatalf("CreateEmptyBuffer failed: %+v", err)
+	}
+	defer buffer.Release()
+	// int32 has the size of uint, so it is only caught in checked mode
+	if err := kernel.SetArg(2, int32(1)); err != nil {
+		t.Errorf("SetArg failed without checking: %+v", err)
+	}
+	if err := kernel.SetArgChecking(true); err != nil {
+		t.Fatalf("SetArgChecking failed: %+v", err)
+	}
+	for index, arg := range map[int]interface{}{0: LocalBuffer(64), 1: buffer, 2: int32(1), 3: float64(1)} {
+		err := kernel.SetArg(index, arg)
+		if e, ok := err.(ErrArgumentTypeMismatch); !ok || e.Kernel != "scale" || e.Index != index || e.Arg.Name != signature[index].Name {
+			t.Errorf("SetArg(%d, %T) returned %v, want an ErrArgumentTypeMismatch", index, arg, err)
+		}
+	}
+	if err := kernel.SetArgs(buffer, LocalBuffer(64), uint32(1), float32(2)); err != nil {
+		t.Errorf("SetArgs failed in checked mode: %+v", err)
+	}
+
+	// Images and buffers are both memory objects, but only match their own
+	// parameters. The simulator has no images, so a buffer stands in.
+	program, err = context.CreateProgramWithSource([]string{"__kernel void blur(__read_only image2d_t img, __global float *out) {}\n"})
+	if err != nil {
+		t.Fatalf("CreateProgramWithSource failed: %+v", err)
+	}
+	defer program.Release()
+	if err := program.BuildProgram(nil, ""); err != nil {
+		t.Fatalf("BuildProgram failed: %+v", err)
+	}
+	blur, err := program.CreateKernel("blur")
+	if err != nil {
+		t.Fatalf("CreateKernel failed: %+v", err)
+	}
+	defer blur.Release()
+	if err := blur.SetArgChecking(true); err != nil {
+		t.Fatalf("SetArgChecking failed: %+v", err)
+	}
+	if err := blur.SetArgBuffer(0, buffer); !errors.As(err, new(ErrArgumentTypeMismatch)) {
+		t.Errorf("SetArgBuffer returned %v for an image, want an ErrArgumentTypeMismatch", err)
+	}
+	if err := blur.SetArgImage(1, buffer); !errors.As(err, new(ErrArgumentTypeMismatch)) {
+		t.Errorf("SetArgImage returned %v for a buffer, want an ErrArgumentTypeMismatch", err)
+	}
+	if err := blur.SetArgImage(0, buffer); err != nil {
+		t.Errorf("SetArgImage failed: %+v", err)
+	}
+	if err := blur.SetArgs(buffer, buffer); err != nil {
+		t.Errorf("SetArgs failed for an image and a buffer: %+v", err)
+	}
+
+	program, err = context.CreateProgramWithSource([]string{"__kernel void widths(short s, unsigned short u, long l) {}\n"})
+	if err != nil {
+		t.Fatalf("CreateProgramWithSource failed: %+v", err)
+	}
+	defer program.Release()
+	if err := program.BuildProgram(nil, ""); err != nil {
+		t.Fatalf("BuildProgram failed: %+v", err)
+	}
+	widths, err := program.CreateKernel("widths")
+	if err != nil {
+		t.Fatalf("CreateKernel failed: %+v", err)
+	}
+	defer widths.Release()
+	if err := widths.SetArgChecking(true); err != nil {
+		t.Fatalf("SetArgChecking failed: %+v", err)
+	}
+	if err := widths.SetArgs(int16(-1), uint16(1), int64(-1)); err != nil {
+		t.Errorf("SetArgs failed for short, ushort and long: %+v", err)
+	}
+	if err := widths.SetArg(0, uint16(1)); !errors.As(err, new(ErrArgumentTypeMismatch)) {
+		t.Errorf("SetArg returned %v for a uint16 short, want an ErrArgumentTypeMismatch", err)
+	}
+	if err := widths.SetArgInt64(2, 1); err != nil {
+		t.Errorf("SetArgInt64 failed: %+v", err)
+	}
+	if err := widths.SetArgByName("u", uint16(2)); err != nil {
+		t.Errorf("SetArgByName failed for a ushort: %+v", err)
+	}
+
+	program, err = context.CreateProgramWithSource([]string{source})
+	if err != nil {
+		t.Fatalf("CreateProgramWithSource failed: %+v", err)
+	}
+	defer program.Release()
+	if err := program.BuildProgramWithOptions(nil, &BuildOptions{NoKernelArgInfo: true}, nil); err != nil {
+		t.Fatalf("BuildProgramWithOptions failed: %+v", err)
+	}
+	kernel, err = program.CreateKernel("scale")
+	if err != nil {
+		t.Fatalf("CreateKernel failed: %+v", err)
+	}
+	defer kernel.Release()
+	if err := kernel.SetArgChecking(true); !errors.Is(err, ErrKernelArgInfoNotAvailable) {
+		t.Errorf("SetArgChecking returned %v without argument information, want ErrKernelArgInfoNotAvailable", err)
+	}
+}
+
+func TestSimKernelBind(t *testing.T) {
+	context, kernel := simKernel(t, "__kernel void saxpy(__global float *y, const float a, __global const float *x, const uint n) {}\n", "saxpy")
+	queue, err := context.CreateCommandQueue(simDevice(t), 0)
+	if err != nil {
+		t.Fatalf("CreateCommandQueue failed: %+v", err)
+	}
+	defer queue.Release()
+	if err := RegisterSimKernel("saxpy", func(l *SimLaunch) error {
+		y, a, x, n := l.Args[0].Float32s(), l.Args[1].Float32(), l.Args[2].Float32s(), l.Args[3].Uint32()
+		l.ForEachGlobalID(func(id [3]int) {
+			if i := id[0]; uint32(i) < n {
+				y[i] += a * x[i]
+			}
+		})
+		return nil
+	}); err != nil {
+		t.Fatalf("RegisterSimKernel failed: %+v", err)
+	}
+	defer UnregisterSimKernel("saxpy")
+
+	data := []float32{1, 2, 3, 4}
+	x, err := context.CreateEmptyBuffer(MemReadOnly, 4*len(data))
+	if err != nil {
+		t.Fatalf("CreateEmptyBuffer failed: %+v", err)
+	}
+	defer x.Release()
+	y, err := context.CreateEmptyBuffer(MemReadWrite, 4*len(data))
+	if err != nil {
+		t.Fatalf("CreateEmptyBuffer failed: %+v", err)
+	}
+	defer y.Release()
+	for _, b := range []*MemObject{x, y} {
+		if _, err := queue.EnqueueWriteBufferFloat32(b, true, 0, data, nil); err != nil {
+			t.Fatalf("EnqueueWriteBufferFloat32 failed: %+v", err)
+		}
+	}
+
+	// The fields are not in the order of the parameters
+	args := struct {
+		N       uint32     `cl:"n"`
+		X       *MemObject `cl:"x"`
+		Alpha   float32    `cl:"a"`
+		Comment string
+	}{N: uint32(len(data)), X: x, Alpha: 2}
+	if err := kernel.Bind(&args); err != nil {
+		t.Errorf("Bind failed: %+v", err)
+	}
+	if err := kernel.SetArgByName("y", y); err != nil {
+		t.Errorf("SetArgByName failed: %+v", err)
+	}
+	if _, err := queue.EnqueueNDRangeKernel(kernel, nil, []int{len(data)}, nil, nil); err != nil {
+		t.Fatalf("EnqueueNDRangeKernel failed: %+v", err)
+	}
+	results := make([]float32, len(data))
+	if _, err := queue.EnqueueReadBufferFloat32(y, true, 0, results, nil); err != nil {
+		t.Fatalf("EnqueueReadBufferFloat32 failed: %+v", err)
+	}
+	for i, v := range results {
+		if want := 3 * data[i]; v != want {
+			t.Errorf("y[%d] = %v, want %v", i, v, want)
+		}
+	}
+
+	if err := kernel.SetArgByName("count", uint32(1)); err != (ErrUnknownArgumentName{Kernel: "saxpy", Name: "count"}) {
+		t.Errorf("SetArgByName returned %v for an unknown name, want an ErrUnknownArgumentName", err)
+	}
+	err = kernel.Bind(struct {
+		Count uint32 `cl:"count"`
+	}{1})
+	if want := (ErrUnknownArgumentName{Kernel: "saxpy", Name: "count"}); !errors.Is(err, want) {
+		t.Errorf("Bind returned %v for an unknown name, want it to wrap %v", err, want)
+	}
+	if err == nil || !strings.Contains(err.Error(), `field Count ("count")`) {
+		t.Errorf("Bind returned %v, want it to name the field", err)
+	}
+	if err := kernel.Bind(3); err == nil {
+		t.Errorf("Bind succeeded with an int")
+	}
+}
+
+func TestSimArgWidth(t *testing.T) {
+	value := SimArg{Value: []byte{1, 0, 0, 0}}
+	if v := value.Uint32(); v != 1 {
+		t.Errorf("Uint32 returned %d, want 1", v)
+	}
+	for name, read := range map[string]func(){
+		"Uint64 of a 4-byte argument":  func() { value.Uint64() },
+		"Int32 of a __local argument":  func() { SimArg{LocalSize: 64}.Int32() },
+		"Float64 of an empty argument": func() { SimArg{Value: []byte{}}.Float64() },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s did not panic", name)
+				}
+			}()
+			read()
+		}()
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"strings"
+	"unicode"
+)
+
+// How a kernel argument is passed from Go.
+type goArg struct {
+	Name   string // Go parameter name
+	Type   string // Go parameter type
+	Set    string // Statement setting the argument, with %[1]d the index and %[2]s the name
+	Unsafe bool   // Set uses package unsafe
+}
+
+// Go types of the scalar types of OpenCL C, and their SetArg methods
+var scalarTypes = map[string][2]string{
+	"char":   {"int8", "SetArgInt8"},
+	"uchar":  {"uint8", "SetArgUint8"},
+	"short":  {"int16", "SetArgInt16"},
+	"ushort": {"uint16", "SetArgUint16"},
+	"int":    {"int32", "SetArgInt32"},
+	"uint":   {"uint32", "SetArgUint32"},
+	"long":   {"int64", "SetArgInt64"},
+	"ulong":  {"uint64", "SetArgUint64"},
+	"float":  {"float32", "SetArgFloat32"},
+	"double": {"float64", "SetArgFloat64"},
+	"half":   {"cl.Half", "SetArgHalf"},
+}
+
+// Converts an OpenCL C name, such as vec_add, to a Go name, such as VecAdd,
+// with its first letter in upper case if exported.
+func goName(name string, exported bool) string {
+	var b strings.Builder
+	upper := exported
+	for _, r := range name {
+		if r == '_' {
+			upper = b.Len() > 0 || exported
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+		} else if b.Len() == 0 {
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+		upper = false
+	}
+	if b.Len() == 0 {
+		return "arg"
+	}
+	return b.String()
+}
+
+// Returns how arg is passed from Go.
+func goArgFor(arg kernelArg) (goArg, error) {
+	g := goArg{Name: goName(arg.Name, false)}
+	switch {
+	case strings.HasSuffix(arg.Type, "*") && arg.Address == "local":
+		g.Type = "cl.LocalBuffer"
+		g.Set = "k.SetArgLocal(%d, int(%s))"
+	case strings.HasSuffix(arg.Type, "*") || strings.HasPrefix(arg.Type, "pipe"):
+		g.Type = "*cl.MemObject"
+		g.Set = "k.SetArgBuffer(%d, %s)"
+	case strings.HasPrefix(arg.Type, "image"):
+		g.Type = "*cl.MemObject"
+		g.Set = "k.SetArgImage(%d, %s)"
+	case arg.Type == "sampler_t":
+		g.Type = "*cl.Sampler"
+		g.Set = "k.SetArgSampler(%d, %s)"
+	default:
+		scalar, n := splitVectorType(arg.Type)
+		t, ok := scalarTypes[scalar]
+		if !ok {
+			return g, fmt.Errorf("argument %s: unsupported type %s", arg.Name, arg.Type)
+		}
+		if n == 0 {
+			g.Type = t[0]
+			g.Set = "k." + t[1] + "(%d, %s)"
+			return g, nil
+		}
+		if n == 3 {
+			// 3-component vectors have the size of 4-component ones
+			n = 4
+		}
+		g.Type = fmt.Sprintf("[%d]%s", n, t[0])
+		g.Set = "k.SetArgUnsafe(%[1]d, int(unsafe.Sizeof(%[2]s)), unsafe.Pointer(&%[2]s))"
+		g.Unsafe = true
+	}
+	return g, nil
+}
+
+// Splits a vector type, such as float4, into its scalar type and number of
+// components, 0 for scalar types.
+func splitVectorType(t string) (string, int) {
+	for _, n := range []int{16, 8, 4, 3, 2} {
+		suffix := fmt.Sprint(n)
+		if strings.HasSuffix(t, suffix) {
+			if _, ok := scalarTypes[strings.TrimSuffix(t, suffix)]; ok {
+				return strings.TrimSuffix(t, suffix), n
+			}
+		}
+	}
+	return t, 0
+}
+
+// Returns the Go source of the wrappers of decls, in package pkg.
+func generate(pkg, source string, decls []kernelDecl) ([]byte, error) {
+	var body bytes.Buffer
+	usesUnsafe := false
+	for _, decl := range decls {
+		typeName := goName(decl.Name, true) + "Kernel"
+		args := make([]goArg, len(decl.Args))
+		// The parameters of Launch besides the kernel arguments
+		used := map[string]bool{"k": true, "q": true, "global": true, "local": true, "wait": true, "err": true, "cl": true, "unsafe": true}
+		for i, arg := range decl.Args {
+			g, err := goArgFor(arg)
+			if err != nil {
+				return nil, fmt.Errorf("kernel %s: %v", decl.Name, err)
+			}
+			for used[g.Name] || token.Lookup(g.Name).IsKeyword() {
+				g.Name += "Arg"
+			}
+			used[g.Name] = true
+			usesUnsafe = usesUnsafe || g.Unsafe
+			args[i] = g
+		}
+
+		var params []string
+		for i := 0; i < len(args); i++ {
+			// Consecutive arguments of the same type share it
+			j := i
+			names := []string{args[i].Name}
+			for j+1 < len(args) && args[j+1].Type == args[i].Type {
+				j++
+				names = append(names, args[j].Name)
+			}
+			params = append(params, strings.Join(names, ", ")+" "+args[i].Type)
+			i = j
+		}
+		params = append([]string{"q *cl.CommandQueue"}, params...)
+		params = append(params, "global, local []int", "wait []*cl.Event")
+
+		fmt.Fprintf(&body, "\n// %s wraps the OpenCL kernel %s.\n", typeName, decl.Name)
+		fmt.Fprintf(&body, "type %s struct {\n\t*cl.Kernel\n}\n\n", typeName)
+		fmt.Fprintf(&body, "// New%s creates the kernel %s of program.\n", typeName, decl.Name)
+		fmt.Fprintf(&body, "func New%s(program *cl.Program) (*%s, error) {\n", typeName, typeName)
+		fmt.Fprintf(&body, "\tk, err := program.CreateKernel(%q)\n\tif err != nil {\n\t\treturn nil, err\n\t}\n", decl.Name)
+		fmt.Fprintf(&body, "\treturn &%s{Kernel: k}, nil\n}\n\n", typeName)
+		fmt.Fprintf(&body, "// SetArgs sets the arguments of %s.\n", decl.Name)
+		fmt.Fprintf(&body, "func (k *%s) SetArgs(%s) error {\n", typeName, strings.Join(params[1:len(params)-2], ", "))
+		for i, g := range args {
+			fmt.Fprintf(&body, "\tif err := "+g.Set+"; err != nil {\n\t\treturn err\n\t}\n", i, g.Name)
+		}
+		fmt.Fprintf(&body, "\treturn nil\n}\n\n")
+		fmt.Fprintf(&body, "// Launch sets the arguments of %s and enqueues it on q.\n", decl.Name)
+		fmt.Fprintf(&body, "func (k *%s) Launch(%s) (*cl.Event, error) {\n", typeName, strings.Join(params, ", "))
+		names := make([]string, len(args))
+		for i, g := range args {
+			names[i] = g.Name
+		}
+		fmt.Fprintf(&body, "\tif err := k.SetArgs(%s); err != nil {\n\t\treturn nil, err\n\t}\n", strings.Join(names, ", "))
+		fmt.Fprintf(&body, "\treturn q.EnqueueNDRangeKernel(k.Kernel, nil, global, local, wait)\n}\n")
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by clbindgen from %s; DO NOT EDIT.\n\npackage %s\n\n", source, pkg)
+	fmt.Fprintf(&out, "import (\n")
+	if usesUnsafe {
+		fmt.Fprintf(&out, "\t\"unsafe\"\n\n")
+	}
+	fmt.Fprintf(&out, "\tcl %q\n)\n", "github.com/seeder-research/go2opencl")
+	out.Write(body.Bytes())
+	return format.Source(out.Bytes())
+}
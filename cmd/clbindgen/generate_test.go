@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files of testdata")
+
+func TestGoName(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		exported bool
+		want     string
+	}{
+		{"vec_add", true, "VecAdd"},
+		{"vec_add", false, "vecAdd"},
+		{"Input", false, "input"},
+		{"_private", false, "private"},
+		{"_private", true, "Private"},
+		{"a__b", false, "aB"},
+		{"x2", true, "X2"},
+		{"_", false, "arg"},
+	} {
+		if got := goName(tt.name, tt.exported); got != tt.want {
+			t.Errorf("goName(%q, %v) = %q, want %q", tt.name, tt.exported, got, tt.want)
+		}
+	}
+}
+
+func TestGoArgFor(t *testing.T) {
+	for _, tt := range []struct {
+		arg  kernelArg
+		want goArg
+	}{
+		{kernelArg{Name: "in_data", Type: "float*", Address: "global"}, goArg{Name: "inData", Type: "*cl.MemObject", Set: "k.SetArgBuffer(%d, %s)"}},
+		{kernelArg{Name: "tmp", Type: "float*", Address: "local"}, goArg{Name: "tmp", Type: "cl.LocalBuffer", Set: "k.SetArgLocal(%d, int(%s))"}},
+		{kernelArg{Name: "p", Type: "pipe", Address: "global"}, goArg{Name: "p", Type: "*cl.MemObject", Set: "k.SetArgBuffer(%d, %s)"}},
+		{kernelArg{Name: "img", Type: "image2d_t", Address: "global", Access: "read_only"}, goArg{Name: "img", Type: "*cl.MemObject", Set: "k.SetArgImage(%d, %s)"}},
+		{kernelArg{Name: "s", Type: "sampler_t", Address: "private"}, goArg{Name: "s", Type: "*cl.Sampler", Set: "k.SetArgSampler(%d, %s)"}},
+		{kernelArg{Name: "n", Type: "uint", Address: "private"}, goArg{Name: "n", Type: "uint32", Set: "k.SetArgUint32(%d, %s)"}},
+		{kernelArg{Name: "h", Type: "half", Address: "private"}, goArg{Name: "h", Type: "cl.Half", Set: "k.SetArgHalf(%d, %s)"}},
+		{kernelArg{Name: "bias", Type: "short", Address: "private"}, goArg{Name: "bias", Type: "int16", Set: "k.SetArgInt16(%d, %s)"}},
+		{kernelArg{Name: "v", Type: "float4", Address: "private"}, goArg{Name: "v", Type: "[4]float32", Set: "k.SetArgUnsafe(%[1]d, int(unsafe.Sizeof(%[2]s)), unsafe.Pointer(&%[2]s))", Unsafe: true}},
+		{kernelArg{Name: "v", Type: "int3", Address: "private"}, goArg{Name: "v", Type: "[4]int32", Set: "k.SetArgUnsafe(%[1]d, int(unsafe.Sizeof(%[2]s)), unsafe.Pointer(&%[2]s))", Unsafe: true}},
+	} {
+		g, err := goArgFor(tt.arg)
+		if err != nil || g != tt.want {
+			t.Errorf("goArgFor(%+v) returned %+v, %v, want %+v", tt.arg, g, err, tt.want)
+		}
+	}
+
+	for _, arg := range []kernelArg{
+		{Name: "p", Type: "params", Address: "private"},
+		{Name: "v", Type: "float5", Address: "private"},
+	} {
+		if g, err := goArgFor(arg); err == nil {
+			t.Errorf("goArgFor(%+v) returned %+v, want an error", arg, g)
+		}
+	}
+}
+
+// Compares the wrappers generated for testdata/kernels.cl with
+// testdata/kernels.go.golden, which go test -update rewrites.
+func TestGenerate(t *testing.T) {
+	source, err := ioutil.ReadFile(filepath.Join("testdata", "kernels.cl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decls, err := parseKernels(string(source))
+	if err != nil {
+		t.Fatalf("parseKernels failed: %v", err)
+	}
+	got, err := generate("kernels", "kernels.cl", decls)
+	if err != nil {
+		t.Fatalf("generate failed: %v", err)
+	}
+	golden := filepath.Join("testdata", "kernels.go.golden")
+	if *update {
+		if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("generate returned\n%s\nwant\n%s", got, want)
+	}
+}
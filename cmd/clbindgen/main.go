@@ -0,0 +1,179 @@
+// Clbindgen generates typed Go wrappers for the kernels of an OpenCL C file,
+// so that a change of a kernel signature breaks the Go build rather than the
+// kernel launch.
+//
+// Usage:
+//
+//	clbindgen [flags] file.cl
+//
+// For a kernel
+//
+//	__kernel void square(__global float *input, __global float *output, const uint count)
+//
+// it generates a SquareKernel type, with
+//
+//	func NewSquareKernel(program *cl.Program) (*SquareKernel, error)
+//	func (k *SquareKernel) SetArgs(input, output *cl.MemObject, count uint32) error
+//	func (k *SquareKernel) Launch(q *cl.CommandQueue, input, output *cl.MemObject, count uint32, global, local []int, wait []*cl.Event) (*cl.Event, error)
+//
+// The signatures are queried from a build of the file with
+// -cl-kernel-arg-info on an OpenCL device. Without a device, or with -parse,
+// they are read from the file by a parser of C declarations, which does not
+// expand macros.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	cl "github.com/seeder-research/go2opencl"
+	"github.com/seeder-research/go2opencl/internal/cmdutil"
+)
+
+var (
+	output  = flag.String("o", "", "write the wrappers to `file` instead of the standard output")
+	pkg     = flag.String("package", "", "package of the wrappers (default the name of the directory of -o)")
+	device  = flag.String("device", "", "index of the device to query, or a substring of its name (default the first device)")
+	parse   = flag.Bool("parse", false, "parse the declarations instead of querying a device")
+	std     = flag.String("cl-std", "", "OpenCL C version of the build, such as CL2.0 (default CL1.2)")
+	defines cmdutil.ListFlag
+	dirs    cmdutil.ListFlag
+)
+
+func main() {
+	flag.Var(&defines, "D", "define `name` or name=value for the build (repeatable)")
+	flag.Var(&dirs, "I", "search `dir` for included files (repeatable)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: clbindgen [flags] file.cl\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	file := flag.Arg(0)
+	packageName := *pkg
+	if packageName == "" {
+		packageName = "main"
+		if *output != "" {
+			abs, err := filepath.Abs(*output)
+			if err != nil {
+				cmdutil.Fatalf("%v", err)
+			}
+			packageName = filepath.Base(filepath.Dir(abs))
+		}
+	}
+
+	fsys, _, names, fsDirs, err := cmdutil.SourceFS([]string{file}, dirs)
+	if err != nil {
+		cmdutil.Fatalf("%v", err)
+	}
+	loader := cl.NewKernelLoader(fsys, fsDirs...)
+	sources, err := loader.Load(names[0])
+	if err != nil {
+		cmdutil.Fatalf("%v", err)
+	}
+
+	var decls []kernelDecl
+	var dev *cl.Device
+	if !*parse {
+		devices, err := cmdutil.Devices()
+		if err == nil {
+			dev, err = cmdutil.SelectDevice(devices, *device)
+		}
+		if err != nil && *device != "" {
+			cmdutil.Fatalf("%v", err)
+		}
+	}
+	if dev != nil {
+		decls, err = queryKernels(dev, sources)
+	} else {
+		decls, err = parseKernels(sources[0])
+	}
+	if err != nil {
+		cmdutil.Fatalf("%v", err)
+	}
+	sort.Slice(decls, func(i, j int) bool { return decls[i].Name < decls[j].Name })
+
+	src, err := generate(packageName, filepath.Base(file), decls)
+	if err != nil {
+		cmdutil.Fatalf("%v", err)
+	}
+	if *output == "" {
+		os.Stdout.Write(src)
+	} else if err := ioutil.WriteFile(*output, src, 0644); err != nil {
+		cmdutil.Fatalf("%v", err)
+	}
+}
+
+// Builds sources on dev with argument information, and returns the
+// signatures of their kernels.
+func queryKernels(dev *cl.Device, sources []string) ([]kernelDecl, error) {
+	context, err := cl.CreateContext([]*cl.Device{dev})
+	if err != nil {
+		return nil, err
+	}
+	defer context.Release()
+	program, err := context.CreateProgramWithSource(sources)
+	if err != nil {
+		return nil, err
+	}
+	defer program.Release()
+	options := &cl.BuildOptions{Std: *std, Defines: cmdutil.Defines(defines)}
+	if err := program.BuildProgramWithOptions(nil, options, nil); err != nil {
+		return nil, err
+	}
+	names, err := program.GetKernelNames()
+	if err != nil {
+		return nil, err
+	}
+	var decls []kernelDecl
+	for _, name := range strings.Split(names, ";") {
+		if name == "" {
+			continue
+		}
+		kernel, err := program.CreateKernel(name)
+		if err != nil {
+			return nil, err
+		}
+		decl, err := kernelSignature(kernel, name)
+		kernel.Release()
+		if err != nil {
+			return nil, fmt.Errorf("kernel %s: %v", name, err)
+		}
+		decls = append(decls, decl)
+	}
+	return decls, nil
+}
+
+func kernelSignature(kernel *cl.Kernel, name string) (kernelDecl, error) {
+	decl := kernelDecl{Name: name}
+	signature, err := kernel.Signature()
+	if err != nil {
+		return decl, err
+	}
+	for _, a := range signature {
+		// Normalize the type name as the parser does, such as unsigned int to uint
+		arg, err := parseParam(a.TypeName + " " + a.Name)
+		if err != nil {
+			return decl, err
+		}
+		arg.Address = strings.ToLower(a.AddressQualifier)
+		switch a.AccessQualifier {
+		case "ReadOnly":
+			arg.Access = "read_only"
+		case "WriteOnly":
+			arg.Access = "write_only"
+		case "ReadWrite":
+			arg.Access = "read_write"
+		}
+		decl.Args = append(decl.Args, arg)
+	}
+	return decl, nil
+}
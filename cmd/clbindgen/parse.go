@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// A kernel argument, as reported by clGetKernelArgInfo.
+type kernelArg struct {
+	Name    string
+	Type    string // Type name without qualifiers, such as "float*" or "uint4".
+	Address string // "global", "local", "constant" or "private".
+	Access  string // "read_only", "write_only", "read_write" or "" if not an image.
+}
+
+type kernelDecl struct {
+	Name string
+	Args []kernelArg
+}
+
+var (
+	blockComment = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	lineComment  = regexp.MustCompile(`//[^\n]*`)
+	directive    = regexp.MustCompile(`(?m)^[ \t]*#(?:[^\n]*\\\n)*[^\n]*`)
+	kernelStart  = regexp.MustCompile(`\b(?:__kernel|kernel)\b`)
+	attribute    = regexp.MustCompile(`__attribute__\s*\(\(`)
+	identifier   = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+)
+
+// Unsigned type names, and the OpenCL C names they stand for
+var unsignedTypes = map[string]string{
+	"char":  "uchar",
+	"short": "ushort",
+	"int":   "uint",
+	"long":  "ulong",
+	"":      "uint",
+}
+
+// Parses the declarations of the kernels of source. Comments and
+// preprocessor directives are skipped, and macros are not expanded, so the
+// signatures must be written out.
+func parseKernels(source string) ([]kernelDecl, error) {
+	src := blockComment.ReplaceAllStringFunc(source, func(c string) string {
+		// Keep the line numbers
+		return strings.Repeat("\n", strings.Count(c, "\n"))
+	})
+	src = lineComment.ReplaceAllString(src, "")
+	src = directive.ReplaceAllString(src, "")
+
+	var decls []kernelDecl
+	for _, loc := range kernelStart.FindAllStringIndex(src, -1) {
+		rest := skipAttributes(src[loc[1]:])
+		rest = strings.TrimSpace(rest)
+		if !strings.HasPrefix(rest, "void") {
+			continue
+		}
+		rest = skipAttributes(rest[len("void"):])
+		open := strings.Index(rest, "(")
+		if open < 0 {
+			continue
+		}
+		name := strings.TrimSpace(rest[:open])
+		if !identifier.MatchString(name) {
+			continue
+		}
+		params, ok := matchParen(rest[open:])
+		if !ok {
+			return nil, fmt.Errorf("kernel %s: unbalanced parentheses", name)
+		}
+		decl := kernelDecl{Name: name}
+		if p := strings.TrimSpace(params); p != "" && p != "void" {
+			for i, param := range splitParams(p) {
+				arg, err := parseParam(param)
+				if err != nil {
+					return nil, fmt.Errorf("kernel %s: argument %d: %v", name, i, err)
+				}
+				decl.Args = append(decl.Args, arg)
+			}
+		}
+		decls = append(decls, decl)
+	}
+	return decls, nil
+}
+
+// Returns s without its leading __attribute__((...)).
+func skipAttributes(s string) string {
+	for {
+		t := strings.TrimSpace(s)
+		loc := attribute.FindStringIndex(t)
+		if loc == nil || loc[0] != 0 {
+			return s
+		}
+		_, n, ok := parenLen(t[len("__attribute__"):])
+		if !ok {
+			return s
+		}
+		s = t[len("__attribute__"):][n:]
+	}
+}
+
+// Returns the text between the parenthesis s starts with and its match.
+func matchParen(s string) (string, bool) {
+	inner, _, ok := parenLen(s)
+	return inner, ok
+}
+
+func parenLen(s string) (string, int, bool) {
+	s2 := strings.TrimLeft(s, " \t\n")
+	skipped := len(s) - len(s2)
+	depth := 0
+	for i, c := range s2 {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return s2[1:i], skipped + i + 1, true
+			}
+		}
+	}
+	return "", 0, false
+}
+
+func splitParams(s string) []string {
+	var params []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(', '[':
+			depth++
+		case ')', ']':
+			depth--
+		case ',':
+			if depth == 0 {
+				params = append(params, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(params, s[start:])
+}
+
+func parseParam(param string) (kernelArg, error) {
+	arg := kernelArg{Address: "private"}
+	param = skipAttributes(param)
+	pointers := strings.Count(param, "*")
+	if i := strings.Index(param, "["); i >= 0 {
+		// An array parameter is a pointer
+		param = param[:i]
+		pointers++
+	}
+	fields := strings.Fields(strings.Replace(param, "*", " ", -1))
+	if len(fields) < 2 {
+		return arg, fmt.Errorf("cannot parse %q", strings.TrimSpace(param))
+	}
+	arg.Name = fields[len(fields)-1]
+	var typeWords []string
+	unsigned := false
+	for _, f := range fields[:len(fields)-1] {
+		switch f {
+		case "__global", "global":
+			arg.Address = "global"
+		case "__local", "local":
+			arg.Address = "local"
+		case "__constant", "constant":
+			arg.Address = "constant"
+		case "__private", "private":
+			arg.Address = "private"
+		case "__read_only", "read_only":
+			arg.Access = "read_only"
+		case "__write_only", "write_only":
+			arg.Access = "write_only"
+		case "__read_write", "read_write":
+			arg.Access = "read_write"
+		case "const", "volatile", "restrict", "__restrict", "struct":
+		case "unsigned":
+			unsigned = true
+		case "signed":
+		default:
+			typeWords = append(typeWords, f)
+		}
+	}
+	typeName := strings.Join(typeWords, " ")
+	if unsigned {
+		t, ok := unsignedTypes[typeName]
+		if !ok {
+			return arg, fmt.Errorf("unknown type unsigned %s", typeName)
+		}
+		typeName = t
+	}
+	if typeName == "" || !identifier.MatchString(arg.Name) {
+		return arg, fmt.Errorf("cannot parse %q", strings.TrimSpace(param))
+	}
+	if strings.HasPrefix(typeName, "image") && arg.Access == "" {
+		arg.Access = "read_only"
+	}
+	arg.Type = typeName + strings.Repeat("*", pointers)
+	return arg, nil
+}
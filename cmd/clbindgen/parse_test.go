@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseParam(t *testing.T) {
+	for _, tt := range []struct {
+		param string
+		want  kernelArg
+	}{
+		{"__global const float * restrict x", kernelArg{Name: "x", Type: "float*", Address: "global"}},
+		{"global float4 *out", kernelArg{Name: "out", Type: "float4*", Address: "global"}},
+		{"__local int tmp[64]", kernelArg{Name: "tmp", Type: "int*", Address: "local"}},
+		{"__constant struct params *p", kernelArg{Name: "p", Type: "params*", Address: "constant"}},
+		{"const unsigned int n", kernelArg{Name: "n", Type: "uint", Address: "private"}},
+		{"unsigned n", kernelArg{Name: "n", Type: "uint", Address: "private"}},
+		{"signed char c", kernelArg{Name: "c", Type: "char", Address: "private"}},
+		{"unsigned long long_value", kernelArg{Name: "long_value", Type: "ulong", Address: "private"}},
+		{"image2d_t img", kernelArg{Name: "img", Type: "image2d_t", Address: "private", Access: "read_only"}},
+		{"__write_only image3d_t img", kernelArg{Name: "img", Type: "image3d_t", Address: "private", Access: "write_only"}},
+		{"sampler_t s", kernelArg{Name: "s", Type: "sampler_t", Address: "private"}},
+		{"__global float ** ptrs", kernelArg{Name: "ptrs", Type: "float**", Address: "global"}},
+	} {
+		arg, err := parseParam(tt.param)
+		if err != nil || arg != tt.want {
+			t.Errorf("parseParam(%q) returned %+v, %v, want %+v", tt.param, arg, err, tt.want)
+		}
+	}
+
+	for _, param := range []string{"float", "unsigned float x", "__global *x", "int 2x"} {
+		if arg, err := parseParam(param); err == nil {
+			t.Errorf("parseParam(%q) returned %+v, want an error", param, arg)
+		}
+	}
+}
+
+func TestParseKernels(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		source string
+		want   []kernelDecl
+	}{
+		{"none", "float helper(float x) { return x; }\n", nil},
+		{"void", "__kernel void noop(void) {}\n", []kernelDecl{{Name: "noop"}}},
+		{"empty", "kernel void noop() {}\n", []kernelDecl{{Name: "noop"}}},
+		{
+			"args",
+			"__kernel void add(__global const float *a, __global const float *b, __global float *c, const uint n) {}\n",
+			[]kernelDecl{{Name: "add", Args: []kernelArg{
+				{Name: "a", Type: "float*", Address: "global"},
+				{Name: "b", Type: "float*", Address: "global"},
+				{Name: "c", Type: "float*", Address: "global"},
+				{Name: "n", Type: "uint", Address: "private"},
+			}}},
+		},
+		{
+			"attributes",
+			"__kernel __attribute__((reqd_work_group_size(64, 1, 1))) void __attribute__((vec_type_hint(float4))) fill(__global float4 *x) {}\n",
+			[]kernelDecl{{Name: "fill", Args: []kernelArg{{Name: "x", Type: "float4*", Address: "global"}}}},
+		},
+		{
+			"comments and directives",
+			"// __kernel void commented(int x) {}\n" +
+				"/* __kernel void blocked(int x) {} */\n" +
+				"#define KERNEL(name) __kernel void name(int x) {}\n" +
+				"#if 0\n" +
+				"#endif\n" +
+				"__kernel void kept(int x /* the count */) {}\n",
+			[]kernelDecl{{Name: "kept", Args: []kernelArg{{Name: "x", Type: "int", Address: "private"}}}},
+		},
+		{
+			"multiple",
+			"__kernel void first(int x) {}\nvoid helper(void) {}\n__kernel void second(__local float *tmp) {}\n",
+			[]kernelDecl{
+				{Name: "first", Args: []kernelArg{{Name: "x", Type: "int", Address: "private"}}},
+				{Name: "second", Args: []kernelArg{{Name: "tmp", Type: "float*", Address: "local"}}},
+			},
+		},
+	} {
+		decls, err := parseKernels(tt.source)
+		if err != nil || !reflect.DeepEqual(decls, tt.want) {
+			t.Errorf("%s: parseKernels returned %+v, %v, want %+v", tt.name, decls, err, tt.want)
+		}
+	}
+
+	for _, source := range []string{
+		"__kernel void open(int x {}\n",
+		"__kernel void bad(float) {}\n",
+	} {
+		if decls, err := parseKernels(source); err == nil {
+			t.Errorf("parseKernels(%q) returned %+v, want an error", source, decls)
+		}
+	}
+}
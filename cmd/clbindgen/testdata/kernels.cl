@@ -0,0 +1,15 @@
+// Kernels covering the kinds of arguments clbindgen wraps.
+
+#define N 64
+
+__kernel void vec_add(__global const float *a, __global const float *b, __global float *c, const unsigned int n) {
+    int i = get_global_id(0);
+    if (i < n)
+        c[i] = a[i] + b[i];
+}
+
+__kernel void reduce(__global const float4 *in, __local float *tmp, __global float *out) {}
+
+__kernel void sample(__read_only image2d_t src, __write_only image2d_t dst, sampler_t s, float2 scale, short bias) {}
+
+__kernel void keywords(int type, float func, uint global) {}
@@ -0,0 +1,218 @@
+// Clc compiles OpenCL C files for a device, to catch errors before the
+// kernels are shipped.
+//
+// Usage:
+//
+//	clc [flags] file.cl...
+//
+// The files are loaded with their #include "..." directives resolved and
+// built together as one program, or compiled separately and linked with -c.
+// Diagnostics are printed as file:line:column: severity: text, and clc exits
+// with status 1 if the build fails. -kernels prints the signatures of the
+// kernels of the program, and -o writes its binary for the device, which
+// CreateProgramWithBinary loads, or its bundle with -bundle, which
+// LoadProgramBundle loads.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cl "github.com/seeder-research/go2opencl"
+	"github.com/seeder-research/go2opencl/internal/cmdutil"
+)
+
+var (
+	list     = flag.Bool("list", false, "list the devices and exit")
+	device   = flag.String("device", "0", "index of the device in -list, or a substring of its name")
+	std      = flag.String("cl-std", "", "OpenCL C version, such as CL2.0 (default CL1.2)")
+	fastMath = flag.Bool("cl-fast-relaxed-math", false, "pass -cl-fast-relaxed-math")
+	mad      = flag.Bool("cl-mad-enable", false, "pass -cl-mad-enable")
+	denorms  = flag.Bool("cl-denorms-are-zero", false, "pass -cl-denorms-are-zero")
+	werror   = flag.Bool("Werror", false, "make warnings errors")
+	nowarn   = flag.Bool("w", false, "inhibit warnings")
+	extra    = flag.String("options", "", "more options passed to the compiler as is")
+	separate = flag.Bool("c", false, "compile the files separately and link them")
+	kernels  = flag.Bool("kernels", false, "print the signatures of the kernels")
+	output   = flag.String("o", "", "write the binary of the program to `file`")
+	bundle   = flag.Bool("bundle", false, "write a program bundle with -o instead of the bare binary")
+
+	defines     cmdutil.ListFlag
+	includeDirs cmdutil.ListFlag
+)
+
+func main() {
+	flag.Var(&defines, "D", "define `name` or name=value (repeatable)")
+	flag.Var(&includeDirs, "I", "search `dir` for included files (repeatable)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: clc [flags] file.cl...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	devices, err := cmdutil.Devices()
+	if err != nil {
+		cmdutil.Fatalf("%v", err)
+	}
+	if *list {
+		for i, d := range devices {
+			fmt.Printf("%d: %s / %s (%s)\n", i, d.Platform().Name(), d.Name(), d.DriverVersion())
+		}
+		return
+	}
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dev, err := cmdutil.SelectDevice(devices, *device)
+	if err != nil {
+		cmdutil.Fatalf("%v, see -list", err)
+	}
+	fsys, root, names, dirs, err := cmdutil.SourceFS(flag.Args(), includeDirs)
+	if err != nil {
+		cmdutil.Fatalf("%v", err)
+	}
+
+	options := &cl.BuildOptions{
+		Std:              *std,
+		Defines:          cmdutil.Defines(defines),
+		IncludeDirs:      includeDirs,
+		FastRelaxedMath:  *fastMath,
+		MadEnable:        *mad,
+		DenormsAreZero:   *denorms,
+		WarningsAsErrors: *werror,
+		NoWarnings:       *nowarn,
+		Extra:            *extra,
+	}
+
+	context, err := cl.CreateContext([]*cl.Device{dev})
+	if err != nil {
+		cmdutil.Fatalf("%v", err)
+	}
+	defer context.Release()
+	loader := cl.NewKernelLoader(fsys, dirs...)
+	program, err := build(context, loader, names, options)
+	if err != nil {
+		printBuildError(os.Stderr, err, root)
+		os.Exit(1)
+	}
+	defer program.Release()
+
+	if *kernels {
+		if err := printKernels(os.Stdout, program); err != nil {
+			cmdutil.Fatalf("%v", err)
+		}
+	}
+	if *output != "" {
+		if err := writeOutput(program, *output); err != nil {
+			cmdutil.Fatalf("%v", err)
+		}
+	}
+}
+
+func build(context *cl.Context, loader *cl.KernelLoader, names []string, options *cl.BuildOptions) (*cl.Program, error) {
+	if !*separate {
+		program, err := loader.CreateProgram(context, names...)
+		if err != nil {
+			return nil, err
+		}
+		if err := program.BuildProgramWithOptions(nil, options, nil); err != nil {
+			program.Release()
+			return nil, err
+		}
+		return program, nil
+	}
+	var objects []*cl.Program
+	defer func() {
+		for _, o := range objects {
+			o.Release()
+		}
+	}()
+	for _, name := range names {
+		object, err := loader.CompileProgram(context, name, options)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+	return context.LinkProgramWithOptions(objects, nil, options, nil)
+}
+
+// Prints the diagnostics of err to w, with the paths of their files joined
+// with root, the root of the file system of the sources.
+func printBuildError(w io.Writer, err error, root string) {
+	var buildErr cl.BuildError
+	if !errors.As(err, &buildErr) {
+		fmt.Fprintf(w, "%s: %v\n", cmdutil.Name, err)
+		return
+	}
+	for _, log := range buildErr.Logs {
+		if len(log.Diagnostics) == 0 {
+			fmt.Fprint(w, log.Log)
+			continue
+		}
+		for _, d := range log.Diagnostics {
+			file := d.File
+			if root != "." && !strings.HasPrefix(file, "<") {
+				file = filepath.Join(root, filepath.FromSlash(file))
+			}
+			pos := fmt.Sprintf("%s:%d", file, d.Line)
+			if d.Column > 0 {
+				pos += fmt.Sprintf(":%d", d.Column)
+			}
+			fmt.Fprintf(w, "%s: %s: %s\n", pos, d.Severity, d.Text)
+		}
+	}
+	if len(buildErr.Logs) == 0 {
+		fmt.Fprintf(w, "%s: %v\n", cmdutil.Name, err)
+	}
+}
+
+// Prints the signatures of the kernels of program to w.
+func printKernels(w io.Writer, program *cl.Program) error {
+	names, err := program.GetKernelNames()
+	if err != nil {
+		return err
+	}
+	for _, name := range strings.Split(names, ";") {
+		if name == "" {
+			continue
+		}
+		kernel, err := program.CreateKernel(name)
+		if err != nil {
+			return err
+		}
+		signature, err := kernel.Signature()
+		kernel.Release()
+		if err != nil {
+			return fmt.Errorf("kernel %s: %v", name, err)
+		}
+		args := make([]string, len(signature))
+		for i, arg := range signature {
+			args[i] = arg.String()
+		}
+		fmt.Fprintf(w, "__kernel void %s(%s)\n", name, strings.Join(args, ", "))
+	}
+	return nil
+}
+
+func writeOutput(program *cl.Program, name string) error {
+	if *bundle {
+		return program.SaveBundle(name)
+	}
+	binaries, err := program.GetBinaries()
+	if err != nil {
+		return err
+	}
+	// The context has a single device
+	if sizes := binaries.GetBinarySizes(); len(sizes) == 0 || sizes[0] == 0 {
+		return fmt.Errorf("the driver returned no binary")
+	}
+	return ioutil.WriteFile(name, binaries.GetBinaryArray()[0], 0644)
+}
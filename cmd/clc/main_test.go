@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	cl "github.com/seeder-research/go2opencl"
+	"github.com/seeder-research/go2opencl/internal/cmdutil"
+)
+
+func TestPrintBuildError(t *testing.T) {
+	root := string(filepath.Separator)
+	err := cl.BuildError{Logs: []cl.BuildLog{
+		{Log: "error: internal compiler error\n"},
+		{Diagnostics: []cl.Diagnostic{
+			{File: "src/kernels/a.cl", Line: 3, Column: 5, Severity: "error", Text: "use of undeclared identifier 'y'"},
+			{File: "<source>", Line: 7, Severity: "warning", Text: "unused variable 'z'"},
+		}},
+	}}
+	var buf bytes.Buffer
+	printBuildError(&buf, err, root)
+	want := "error: internal compiler error\n" +
+		filepath.Join(root, "src", "kernels", "a.cl") + ":3:5: error: use of undeclared identifier 'y'\n" +
+		"<source>:7: warning: unused variable 'z'\n"
+	if buf.String() != want {
+		t.Errorf("printBuildError printed\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	// Relative to the working directory, the paths are printed as is
+	buf.Reset()
+	printBuildError(&buf, cl.BuildError{Logs: err.Logs[1:]}, ".")
+	want = "src/kernels/a.cl:3:5: error: use of undeclared identifier 'y'\n" +
+		"<source>:7: warning: unused variable 'z'\n"
+	if buf.String() != want {
+		t.Errorf("printBuildError printed\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	// Wrapped build errors are printed as diagnostics too
+	buf.Reset()
+	printBuildError(&buf, fmt.Errorf("linking: %w", cl.BuildError{Logs: err.Logs[1:]}), ".")
+	if buf.String() != want {
+		t.Errorf("printBuildError printed\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	printBuildError(&buf, cl.ErrInvalidBuildOptions, root)
+	if want := cmdutil.Name + ": " + cl.ErrInvalidBuildOptions.Error() + "\n"; buf.String() != want {
+		t.Errorf("printBuildError printed %q, want %q", buf.String(), want)
+	}
+}
+
+func simDevice(t *testing.T) *cl.Device {
+	if !cl.SimAvailable() {
+		t.Skip("the go2opencl-sim platform is not linked")
+	}
+	devices, err := cmdutil.Devices()
+	if err != nil {
+		t.Fatalf("Devices failed: %v", err)
+	}
+	for _, d := range devices {
+		if d.Platform().Name() == cl.SimPlatformName {
+			return d
+		}
+	}
+	t.Fatalf("Platform %s not found", cl.SimPlatformName)
+	return nil
+}
+
+func TestSimBuild(t *testing.T) {
+	dev := simDevice(t)
+	dir := t.TempDir()
+	files := map[string]string{
+		"scale.cl":         "#include \"common.h\"\n__kernel void scale(__global float *x, const unsigned int n) {}\n",
+		"offset.cl":        "#include \"common.h\"\n__kernel void offset(__global float *x, real_t d) {}\n",
+		"include/common.h": "typedef float real_t;\n",
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fsys, _, names, dirs, err := cmdutil.SourceFS(
+		[]string{filepath.Join(dir, "offset.cl"), filepath.Join(dir, "scale.cl")},
+		[]string{filepath.Join(dir, "include")})
+	if err != nil {
+		t.Fatalf("SourceFS failed: %v", err)
+	}
+	context, err := cl.CreateContext([]*cl.Device{dev})
+	if err != nil {
+		t.Fatalf("CreateContext failed: %v", err)
+	}
+	defer context.Release()
+	loader := cl.NewKernelLoader(fsys, dirs...)
+
+	want := "__kernel void offset(__global float* x, real_t d)\n" +
+		"__kernel void scale(__global float* x, uint n)\n"
+	defer func(s bool) { *separate = s }(*separate)
+	for _, sep := range []bool{false, true} {
+		*separate = sep
+		program, err := build(context, loader, names, &cl.BuildOptions{})
+		if err != nil {
+			t.Fatalf("build with -c=%v failed: %v", sep, err)
+		}
+		var buf bytes.Buffer
+		err = printKernels(&buf, program)
+		program.Release()
+		if err != nil {
+			t.Errorf("printKernels with -c=%v failed: %v", sep, err)
+		} else if buf.String() != want {
+			t.Errorf("printKernels with -c=%v printed\n%s\nwant\n%s", sep, buf.String(), want)
+		}
+	}
+}
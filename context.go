@@ -6,24 +6,24 @@ package go2opencl
 /*
 #include "./opencl.h"
 
-extern void go_ctx_notify(char *errinfo, void *private_info, int cb, void *user_data);
+extern void go_ctx_notify(char *errinfo, void *private_info, int cb, uintptr_t handle);
 static void CL_CALLBACK c_ctx_notify(const char *errinfo, const void *private_info, size_t cb, void *user_data) {
-        go_ctx_notify((char *)errinfo, (void *)private_info, cb, user_data);
+        go_ctx_notify((char *)errinfo, (void *)private_info, cb, (uintptr_t)user_data);
 }
 
 static cl_context CLCreateContext(      const cl_context_properties *   properties,
                                                         cl_uint                                 num_devices,
                                                         const cl_device_id *                    devices,
-                                                        void *                                  user_data,
+                                                        uintptr_t                               handle,
                                                         cl_int *                                errcode_ret){
-        return clCreateContext(properties, num_devices, devices, c_ctx_notify, user_data, errcode_ret);
+        return clCreateContext(properties, num_devices, devices, handle ? c_ctx_notify : NULL, (void *)handle, errcode_ret);
 }
 
 static cl_context CLCreateContextFromType(      const cl_context_properties *   properties,
                                                                         cl_device_type                                  device_type,
-                                                                        void *                                  user_data,
+                                                                        uintptr_t                               handle,
                                                                         cl_int *                                errcode_ret){
-	return clCreateContextFromType(properties, device_type, c_ctx_notify, user_data, errcode_ret);
+	return clCreateContextFromType(properties, device_type, handle ? c_ctx_notify : NULL, (void *)handle, errcode_ret);
 }
 
 static cl_context CLCreateContextOnPlatform(      const cl_platform_id				id,
@@ -69,6 +69,7 @@ const (
 type Context struct {
 	clContext C.cl_context
 	devices   []*Device
+	notify    uintptr
 }
 
 ////////////////// Golang Types ////////////////
@@ -76,20 +77,20 @@ type CLContext C.cl_context
 type CLContextProperties C.cl_context_properties
 
 ////////////////// Supporting Types ////////////////
-type CL_ctx_notify func(errinfo string, private_info unsafe.Pointer, cb int, user_data unsafe.Pointer)
-
-var ctx_notify map[unsafe.Pointer]CL_ctx_notify
+// Called by the OpenCL runtime to report errors in a context. private_info
+// is implementation specific data that may help debugging the error.
+type CL_ctx_notify func(errinfo string, private_info []byte)
 
 ////////////////// Basic Functions ////////////////
-func init() {
-	ctx_notify = make(map[unsafe.Pointer]CL_ctx_notify)
-}
-
 //export go_ctx_notify
-func go_ctx_notify(errinfo *C.char, private_info unsafe.Pointer, cb C.int, user_data unsafe.Pointer) {
-	var c_user_data []unsafe.Pointer
-	c_user_data = *(*[]unsafe.Pointer)(user_data)
-	ctx_notify[c_user_data[1]](C.GoString(errinfo), private_info, int(cb), c_user_data[0])
+func go_ctx_notify(errinfo *C.char, private_info unsafe.Pointer, cb C.int, handle C.uintptr_t) {
+	if fn, ok := callbacks.lookup(uintptr(handle)).(CL_ctx_notify); ok {
+		var info []byte
+		if private_info != nil && cb > 0 {
+			info = C.GoBytes(private_info, cb)
+		}
+		fn(C.GoString(errinfo), info)
+	}
 }
 
 func releaseContext(c *Context) {
@@ -97,6 +98,10 @@ func releaseContext(c *Context) {
 		C.clReleaseContext(c.clContext)
 		c.clContext = nil
 	}
+	if c.notify != 0 {
+		callbacks.unregister(c.notify)
+		c.notify = 0
+	}
 }
 
 func retainContext(c *Context) {
@@ -106,65 +111,57 @@ func retainContext(c *Context) {
 }
 
 func CreateContext(devices []*Device) (*Context, error) {
-	clContext, err := CreateContextUnsafe(nil, devices, nil, nil)
+	clContext, err := CreateContextUnsafe(nil, devices, nil)
 	return clContext, err
 }
 
-func CreateContextUnsafe(properties *C.cl_context_properties, devices []*Device, pfn_notify CL_ctx_notify, user_data unsafe.Pointer) (*Context, error) {
+// Creates a context. pfn_notify, if not nil, is called by the OpenCL runtime
+// to report errors for as long as the returned Context has not been released.
+func CreateContextUnsafe(properties *C.cl_context_properties, devices []*Device, pfn_notify CL_ctx_notify) (*Context, error) {
 	deviceIds := buildDeviceIdList(devices)
 	var err C.cl_int
-	var clContext C.cl_context
+	var handle uintptr
 	if pfn_notify != nil {
-		var c_user_data []unsafe.Pointer
-		c_user_data = make([]unsafe.Pointer, 2)
-		c_user_data[0] = user_data
-		c_user_data[1] = unsafe.Pointer(&pfn_notify)
-
-		ctx_notify[c_user_data[1]] = pfn_notify
-
-		clContext = C.CLCreateContext(properties, C.cl_uint(len(devices)), &deviceIds[0], unsafe.Pointer(&c_user_data), &err)
-	} else {
-		clContext = C.clCreateContext(properties, C.cl_uint(len(devices)), &deviceIds[0], nil, nil, &err)
+		handle = callbacks.register(pfn_notify)
 	}
+	clContext := C.CLCreateContext(properties, C.cl_uint(len(devices)), &deviceIds[0], C.uintptr_t(handle), &err)
 	if err != C.CL_SUCCESS {
+		callbacks.unregister(handle)
 		return nil, toError(err)
 	}
 	if clContext == nil {
+		callbacks.unregister(handle)
 		return nil, ErrUnknown
 	}
-	context := &Context{clContext: clContext, devices: devices}
+	context := &Context{clContext: clContext, devices: devices, notify: handle}
 	runtime.SetFinalizer(context, releaseContext)
 	return context, nil
 }
 
-func CreateContextFromTypeUnsafe(properties *C.cl_context_properties, device_type C.cl_device_type, pfn_notify CL_ctx_notify, user_data unsafe.Pointer) (*Context, error) {
+// Creates a context from a device type. pfn_notify, if not nil, is called by the
+// OpenCL runtime to report errors for as long as the returned Context has not been released.
+func CreateContextFromTypeUnsafe(properties *C.cl_context_properties, device_type C.cl_device_type, pfn_notify CL_ctx_notify) (*Context, error) {
 	var err C.cl_int
-	var clContext C.cl_context
+	var handle uintptr
 	if pfn_notify != nil {
-		var c_user_data []unsafe.Pointer
-		c_user_data = make([]unsafe.Pointer, 2)
-		c_user_data[0] = user_data
-		c_user_data[1] = unsafe.Pointer(&pfn_notify)
-
-		ctx_notify[c_user_data[1]] = pfn_notify
-
-		clContext = C.CLCreateContextFromType(properties, device_type, unsafe.Pointer(&c_user_data), &err)
-	} else {
-		clContext = C.clCreateContextFromType(properties, device_type, nil, nil, &err)
+		handle = callbacks.register(pfn_notify)
 	}
+	clContext := C.CLCreateContextFromType(properties, device_type, C.uintptr_t(handle), &err)
 	if err != C.CL_SUCCESS {
+		callbacks.unregister(handle)
 		return nil, toError(err)
 	}
 	if clContext == nil {
+		callbacks.unregister(handle)
 		return nil, ErrUnknown
 	}
-	contextTmp := &Context{clContext: clContext, devices: nil}
+	contextTmp := &Context{clContext: clContext, devices: nil, notify: handle}
 	cDevices, errD := contextTmp.GetDevices()
 	if errD != nil {
 		runtime.SetFinalizer(contextTmp, releaseContext)
 		return contextTmp, toError(err)
 	}
-	context := &Context{clContext: clContext, devices: cDevices}
+	context := &Context{clContext: clContext, devices: cDevices, notify: handle}
 	runtime.SetFinalizer(context, releaseContext)
 	return context, nil
 }
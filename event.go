@@ -3,21 +3,24 @@ package go2opencl
 /*
 #include "./opencl.h"
 
-extern void go_set_event_callback(cl_event event, cl_int execution_status, void *user_args);
+extern void go_set_event_callback(cl_event event, cl_int execution_status, uintptr_t handle);
 static void CL_CALLBACK c_set_event_callback(cl_event event, cl_int execution_status, void *user_args) {
-        go_set_event_callback((cl_event) event, (cl_int) execution_status, (void *)user_args);
+        go_set_event_callback((cl_event) event, (cl_int) execution_status, (uintptr_t)user_args);
 }
 
 static cl_int CLSetEventCallback(      cl_event		event,
 				       cl_int		callback_type,
-                                       void *		user_args) {
-	return clSetEventCallback(event, callback_type, c_set_event_callback, user_args);
+                                       uintptr_t	handle) {
+	return clSetEventCallback(event, callback_type, c_set_event_callback, (void *)handle);
 }
 */
 import "C"
 
 import (
+	"context"
 	"runtime"
+	"sync"
+	"time"
 	"unsafe"
 )
 
@@ -45,23 +48,55 @@ const (
 	ProfilingInfoCommandEnd ProfilingInfo = C.CL_PROFILING_COMMAND_END
 )
 
+// Device timestamps of a profiled command, in nanoseconds.
+type EventProfile struct {
+	Queued int64 // when the command was enqueued by the host
+	Submit int64 // when the command was submitted to the device
+	Start  int64 // when the command started executing
+	End    int64 // when the command finished executing
+}
+
+// Time the command spent in the queue before being submitted.
+func (p EventProfile) QueueLatency() time.Duration {
+	return time.Duration(p.Submit - p.Queued)
+}
+
+// Time between submission to the device and the start of execution.
+func (p EventProfile) SubmitLatency() time.Duration {
+	return time.Duration(p.Start - p.Submit)
+}
+
+// Time the command took to execute on the device.
+func (p EventProfile) ExecDuration() time.Duration {
+	return time.Duration(p.End - p.Start)
+}
+
 // ////////////// Abstract Types ///////////////
 type Event struct {
 	clEvent C.cl_event
+
+	doneOnce sync.Once
+	done     chan struct{}
+	doneErr  error
 }
 
 // //////////////// Supporting Types ////////////////
-type CL_go_set_event_callback func(event C.cl_event, callback_status C.cl_int, user_data unsafe.Pointer)
+// Called once the event reaches the requested execution status. status is
+// negative if the command terminated abnormally.
+type CL_go_set_event_callback func(event *Event, status CommandExecStatus)
 
-var go_set_event_callback_func map[unsafe.Pointer]CL_go_set_event_callback
+type eventCallback struct {
+	event *Event
+	fn    CL_go_set_event_callback
+}
 
 // ////////////// Basic Functions ///////////////
 //
 //export go_set_event_callback
-func go_set_event_callback(event C.cl_event, callback_status C.cl_int, user_data unsafe.Pointer) {
-	var c_user_data []unsafe.Pointer
-	c_user_data = *(*[]unsafe.Pointer)(user_data)
-	go_set_event_callback_func[c_user_data[1]](event, callback_status, c_user_data[0])
+func go_set_event_callback(event C.cl_event, callback_status C.cl_int, handle C.uintptr_t) {
+	if cb, ok := callbacks.take(uintptr(handle)).(eventCallback); ok {
+		cb.fn(cb.event, CommandExecStatus(callback_status))
+	}
 }
 
 func releaseEvent(ev *Event) {
@@ -92,6 +127,18 @@ func WaitForEvents(events []*Event) error {
 	return toError(C.clWaitForEvents(C.cl_uint(WaitListLen), eventWaitListPtr))
 }
 
+// Waits for the command of every event to complete, or for ctx to be done.
+// Returns ctx.Err() if ctx is done first, or the error of the first event
+// whose command terminated abnormally.
+func WaitForEventsContext(ctx context.Context, events []*Event) error {
+	for _, ev := range events {
+		if err := ev.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func newEvent(clEvent C.cl_event) *Event {
 	ev := &Event{clEvent: clEvent}
 	runtime.SetFinalizer(ev, releaseEvent)
@@ -135,6 +182,46 @@ func (e *Event) GetEventProfilingInfo(paramName ProfilingInfo) (int64, error) {
 	return int64(-1), toError(C.CL_INVALID_EVENT)
 }
 
+// Returns all profiling counters of a completed command. Returns
+// ErrProfilingNotEnabled if the queue of the command was not created with
+// CommandQueueProfilingEnable.
+func (e *Event) Profile() (EventProfile, error) {
+	var profile EventProfile
+	if e.clEvent == nil {
+		return profile, toError(C.CL_INVALID_EVENT)
+	}
+	for _, counter := range []struct {
+		param ProfilingInfo
+		value *int64
+	}{
+		{ProfilingInfoCommandQueued, &profile.Queued},
+		{ProfilingInfoCommandSubmit, &profile.Submit},
+		{ProfilingInfoCommandStart, &profile.Start},
+		{ProfilingInfoCommandEnd, &profile.End},
+	} {
+		var paramValue C.cl_ulong
+		if err := C.clGetEventProfilingInfo(e.clEvent, C.cl_profiling_info(counter.param), C.size_t(unsafe.Sizeof(paramValue)), unsafe.Pointer(&paramValue), nil); err != C.CL_SUCCESS {
+			if err == C.CL_PROFILING_INFO_NOT_AVAILABLE && !e.profilingEnabled() {
+				return EventProfile{}, ErrProfilingNotEnabled
+			}
+			return EventProfile{}, toError(err)
+		}
+		*counter.value = int64(paramValue)
+	}
+	return profile, nil
+}
+
+// Reports whether the event belongs to a command queue with profiling enabled.
+// User events have no queue and are reported as enabled.
+func (e *Event) profilingEnabled() bool {
+	var queue C.cl_command_queue
+	if C.clGetEventInfo(e.clEvent, C.CL_EVENT_COMMAND_QUEUE, C.size_t(unsafe.Sizeof(queue)), unsafe.Pointer(&queue), nil) != C.CL_SUCCESS || queue == nil {
+		return true
+	}
+	props, err := (&CommandQueue{clQueue: queue}).GetQueueProperties()
+	return err != nil || props&CommandQueueProfilingEnable != 0
+}
+
 func (e *Event) GetCommandQueue() (*CommandQueue, error) {
 	if e.clEvent != nil {
 		var outQueue C.cl_command_queue
@@ -189,6 +276,22 @@ func (e *Event) GetCommandType() (CommandType, error) {
 			return CommandUnmapMemObject, toError(err)
 		case C.CL_COMMAND_MARKER:
 			return CommandMarker, toError(err)
+		case C.CL_COMMAND_READ_BUFFER_RECT:
+			return CommandReadBufferRect, toError(err)
+		case C.CL_COMMAND_WRITE_BUFFER_RECT:
+			return CommandWriteBufferRect, toError(err)
+		case C.CL_COMMAND_COPY_BUFFER_RECT:
+			return CommandCopyBufferRect, toError(err)
+		case C.CL_COMMAND_USER:
+			return CommandUser, toError(err)
+		case C.CL_COMMAND_BARRIER:
+			return CommandBarrier, toError(err)
+		case C.CL_COMMAND_MIGRATE_MEM_OBJECTS:
+			return CommandMigrateMemObjects, toError(err)
+		case C.CL_COMMAND_FILL_BUFFER:
+			return CommandFillBuffer, toError(err)
+		case C.CL_COMMAND_FILL_IMAGE:
+			return CommandFillImage, toError(err)
 		default:
 			return -1, toError(err)
 		}
@@ -274,8 +377,21 @@ func (ctx *Context) CreateSubmittedEvent() (*Event, error) {
 	return outEvent, toError(err)
 }
 
-func (ev *Event) SetEventCallback(status CommandExecStatus, user_data unsafe.Pointer) error {
-	return toError(C.CLSetEventCallback(ev.clEvent, (C.cl_int)(status), user_data))
+// Registers fn to be called once when the event reaches status. The callback
+// runs on a thread of the OpenCL runtime and must not block.
+func (ev *Event) SetEventCallback(status CommandExecStatus, fn CL_go_set_event_callback) error {
+	if ev.clEvent == nil {
+		return toError(C.CL_INVALID_EVENT)
+	}
+	if fn == nil {
+		return ErrInvalidValue
+	}
+	handle := callbacks.register(eventCallback{event: ev, fn: fn})
+	if err := C.CLSetEventCallback(ev.clEvent, (C.cl_int)(status), C.uintptr_t(handle)); err != C.CL_SUCCESS {
+		callbacks.unregister(handle)
+		return toError(err)
+	}
+	return nil
 }
 
 // A synchronization point that enqueues a barrier operation.
@@ -283,7 +399,7 @@ func (q *CommandQueue) EnqueueBarrierWithWaitList(eventWaitList []*Event) (*Even
 	var event C.cl_event
 	eventWaitListPtr, WaitListLen := eventListPtr(eventWaitList)
 	err := toError(C.clEnqueueBarrierWithWaitList(q.clQueue, C.cl_uint(WaitListLen), eventWaitListPtr, &event))
-	return newEvent(event), err
+	return q.recorded(newEvent(event), err, CommandBarrier, 0)
 }
 
 // Enqueues a marker command which waits for either a list of events to complete, or all previously enqueued commands to complete.
@@ -291,5 +407,47 @@ func (q *CommandQueue) EnqueueMarkerWithWaitList(eventWaitList []*Event) (*Event
 	var event C.cl_event
 	eventWaitListPtr, WaitListLen := eventListPtr(eventWaitList)
 	err := toError(C.clEnqueueMarkerWithWaitList(q.clQueue, C.cl_uint(WaitListLen), eventWaitListPtr, &event))
-	return newEvent(event), err
+	return q.recorded(newEvent(event), err, CommandMarker, 0)
+}
+
+// Returns a channel that is closed once the command of the event has completed
+// or terminated abnormally. The command queue of the event is flushed, so that
+// the command is eventually submitted to the device.
+func (ev *Event) Done() <-chan struct{} {
+	ev.doneOnce.Do(func() {
+		ev.done = make(chan struct{})
+		if ev.clEvent == nil {
+			ev.doneErr = toError(C.CL_INVALID_EVENT)
+			close(ev.done)
+			return
+		}
+		err := ev.SetEventCallback(CommandExecStatusComplete, func(_ *Event, status CommandExecStatus) {
+			if status < 0 {
+				ev.doneErr = toError(C.cl_int(status))
+			}
+			close(ev.done)
+		})
+		if err != nil {
+			ev.doneErr = err
+			close(ev.done)
+			return
+		}
+		var queue C.cl_command_queue
+		if C.clGetEventInfo(ev.clEvent, C.CL_EVENT_COMMAND_QUEUE, C.size_t(unsafe.Sizeof(queue)), unsafe.Pointer(&queue), nil) == C.CL_SUCCESS && queue != nil {
+			C.clFlush(queue)
+		}
+	})
+	return ev.done
+}
+
+// Waits for the command of the event to complete, or for ctx to be done.
+// Returns ctx.Err() if ctx is done first, or an error if the command
+// terminated abnormally.
+func (ev *Event) Wait(ctx context.Context) error {
+	select {
+	case <-ev.Done():
+		return ev.doneErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
@@ -5,8 +5,184 @@
 #define __SIZEOF_HALF__   2
 #define __SIZEOF_FLOAT__  4
 #define __SIZEOF_DOUBLE__ 8
+#include <stdarg.h>
 #include <stdbool.h>
+#include <stdio.h>
+#include <stdlib.h>
+#ifndef CL_USE_DEPRECATED_OPENCL_1_2_APIS
+#define CL_USE_DEPRECATED_OPENCL_1_2_APIS
+#endif
+#ifndef CL_TARGET_OPENCL_VERSION
+#define CL_TARGET_OPENCL_VERSION 120
+#endif
+#ifdef __APPLE__
+#include "OpenCL/opencl.h"
+#else
+#include "CL/cl.h"
+#endif
+
+// vkFFT reports a failing OpenCL call only through its own result code, so
+// the OpenCL functions it uses are wrapped to record the first call that
+// failed on this thread, together with the build log of a failed build.
+typedef struct vkfftCLError {
+    const char* function;
+    cl_int      code;
+    char*       buildLog;
+    bool        buildFailed;
+} vkfftCLError;
+
+static __thread vkfftCLError vkfftLastCLError;
+
+static void vkfftResetCLError(void) {
+    free(vkfftLastCLError.buildLog);
+    vkfftLastCLError.function = NULL;
+    vkfftLastCLError.code     = CL_SUCCESS;
+    vkfftLastCLError.buildLog = NULL;
+    vkfftLastCLError.buildFailed = false;
+}
+
+static cl_int vkfftRecordCLError(const char* function, cl_int code) {
+    if ((code != CL_SUCCESS) && (vkfftLastCLError.function == NULL)) {
+        vkfftLastCLError.function = function;
+        vkfftLastCLError.code     = code;
+    }
+    return code;
+}
+
+static cl_int vkfftCLBuildProgram(cl_program program, cl_uint numDevices, const cl_device_id* devices, const char* options, void (CL_CALLBACK* notify)(cl_program, void*), void* userData) {
+    cl_int res = clBuildProgram(program, numDevices, devices, options, notify, userData);
+    if ((res == CL_SUCCESS) || (vkfftLastCLError.function != NULL)) {
+        return res;
+    }
+    vkfftRecordCLError("clBuildProgram", res);
+    vkfftLastCLError.buildFailed = true;
+    size_t logSize = 0;
+    if ((numDevices > 0) && (clGetProgramBuildInfo(program, devices[0], CL_PROGRAM_BUILD_LOG, 0, NULL, &logSize) == CL_SUCCESS) && (logSize > 0)) {
+        vkfftLastCLError.buildLog = (char*)calloc(logSize + 1, 1);
+        if ((vkfftLastCLError.buildLog != NULL) && (clGetProgramBuildInfo(program, devices[0], CL_PROGRAM_BUILD_LOG, logSize, vkfftLastCLError.buildLog, NULL) != CL_SUCCESS)) {
+            vkfftLastCLError.buildLog[0] = 0;
+        }
+    }
+    return res;
+}
+
+static cl_mem vkfftCLCreateBuffer(cl_context context, cl_mem_flags flags, size_t size, void* hostPtr, cl_int* errcodeRet) {
+    cl_int res;
+    cl_mem mem = clCreateBuffer(context, flags, size, hostPtr, &res);
+    vkfftRecordCLError("clCreateBuffer", res);
+    if (errcodeRet != NULL) { *errcodeRet = res; }
+    return mem;
+}
+
+static cl_command_queue vkfftCLCreateCommandQueue(cl_context context, cl_device_id device, cl_command_queue_properties properties, cl_int* errcodeRet) {
+    cl_int res;
+    cl_command_queue queue = clCreateCommandQueue(context, device, properties, &res);
+    vkfftRecordCLError("clCreateCommandQueue", res);
+    if (errcodeRet != NULL) { *errcodeRet = res; }
+    return queue;
+}
+
+static cl_kernel vkfftCLCreateKernel(cl_program program, const char* name, cl_int* errcodeRet) {
+    cl_int res;
+    cl_kernel kernel = clCreateKernel(program, name, &res);
+    vkfftRecordCLError("clCreateKernel", res);
+    if (errcodeRet != NULL) { *errcodeRet = res; }
+    return kernel;
+}
+
+static cl_program vkfftCLCreateProgramWithSource(cl_context context, cl_uint count, const char** strings, const size_t* lengths, cl_int* errcodeRet) {
+    cl_int res;
+    cl_program program = clCreateProgramWithSource(context, count, strings, lengths, &res);
+    vkfftRecordCLError("clCreateProgramWithSource", res);
+    if (errcodeRet != NULL) { *errcodeRet = res; }
+    return program;
+}
+
+static cl_program vkfftCLCreateProgramWithBinary(cl_context context, cl_uint numDevices, const cl_device_id* devices, const size_t* lengths, const unsigned char** binaries, cl_int* binaryStatus, cl_int* errcodeRet) {
+    cl_int res;
+    cl_program program = clCreateProgramWithBinary(context, numDevices, devices, lengths, binaries, binaryStatus, &res);
+    vkfftRecordCLError("clCreateProgramWithBinary", res);
+    if (errcodeRet != NULL) { *errcodeRet = res; }
+    return program;
+}
+
+static cl_int vkfftCLEnqueueNDRangeKernel(cl_command_queue queue, cl_kernel kernel, cl_uint workDim, const size_t* globalOffset, const size_t* globalSize, const size_t* localSize, cl_uint numEvents, const cl_event* waitList, cl_event* event) {
+    return vkfftRecordCLError("clEnqueueNDRangeKernel", clEnqueueNDRangeKernel(queue, kernel, workDim, globalOffset, globalSize, localSize, numEvents, waitList, event));
+}
+
+static cl_int vkfftCLEnqueueReadBuffer(cl_command_queue queue, cl_mem buffer, cl_bool blocking, size_t offset, size_t size, void* ptr, cl_uint numEvents, const cl_event* waitList, cl_event* event) {
+    return vkfftRecordCLError("clEnqueueReadBuffer", clEnqueueReadBuffer(queue, buffer, blocking, offset, size, ptr, numEvents, waitList, event));
+}
+
+static cl_int vkfftCLEnqueueWriteBuffer(cl_command_queue queue, cl_mem buffer, cl_bool blocking, size_t offset, size_t size, const void* ptr, cl_uint numEvents, const cl_event* waitList, cl_event* event) {
+    return vkfftRecordCLError("clEnqueueWriteBuffer", clEnqueueWriteBuffer(queue, buffer, blocking, offset, size, ptr, numEvents, waitList, event));
+}
+
+static cl_int vkfftCLFinish(cl_command_queue queue) {
+    return vkfftRecordCLError("clFinish", clFinish(queue));
+}
+
+static cl_int vkfftCLGetDeviceInfo(cl_device_id device, cl_device_info param, size_t size, void* value, size_t* sizeRet) {
+    return vkfftRecordCLError("clGetDeviceInfo", clGetDeviceInfo(device, param, size, value, sizeRet));
+}
+
+static cl_int vkfftCLGetProgramInfo(cl_program program, cl_program_info param, size_t size, void* value, size_t* sizeRet) {
+    return vkfftRecordCLError("clGetProgramInfo", clGetProgramInfo(program, param, size, value, sizeRet));
+}
+
+static cl_int vkfftCLSetKernelArg(cl_kernel kernel, cl_uint index, size_t size, const void* value) {
+    return vkfftRecordCLError("clSetKernelArg", clSetKernelArg(kernel, index, size, value));
+}
+
+// vkFFT prints the build log and the code of a kernel that failed to build
+// to the standard output. The log is also recorded above, so the output of
+// vkFFT after a failed build may be turned off.
+static bool vkfftPrintBuildErrors = true;
+
+static void vkfftSetPrintBuildErrors(bool print) {
+    vkfftPrintBuildErrors = print;
+}
+
+static int vkfftPrintf(const char* format, ...) {
+    if (!vkfftPrintBuildErrors && vkfftLastCLError.buildFailed) {
+        return 0;
+    }
+    va_list args;
+    va_start(args, format);
+    int n = vprintf(format, args);
+    va_end(args);
+    return n;
+}
+
+#define printf                    vkfftPrintf
+#define clBuildProgram            vkfftCLBuildProgram
+#define clCreateBuffer            vkfftCLCreateBuffer
+#define clCreateCommandQueue      vkfftCLCreateCommandQueue
+#define clCreateKernel            vkfftCLCreateKernel
+#define clCreateProgramWithSource vkfftCLCreateProgramWithSource
+#define clCreateProgramWithBinary vkfftCLCreateProgramWithBinary
+#define clEnqueueNDRangeKernel    vkfftCLEnqueueNDRangeKernel
+#define clEnqueueReadBuffer       vkfftCLEnqueueReadBuffer
+#define clEnqueueWriteBuffer      vkfftCLEnqueueWriteBuffer
+#define clFinish                  vkfftCLFinish
+#define clGetDeviceInfo           vkfftCLGetDeviceInfo
+#define clGetProgramInfo          vkfftCLGetProgramInfo
+#define clSetKernelArg            vkfftCLSetKernelArg
 #include "vkFFT.h"
+#undef printf
+#undef clBuildProgram
+#undef clCreateBuffer
+#undef clCreateCommandQueue
+#undef clCreateKernel
+#undef clCreateProgramWithSource
+#undef clCreateProgramWithBinary
+#undef clEnqueueNDRangeKernel
+#undef clEnqueueReadBuffer
+#undef clEnqueueWriteBuffer
+#undef clFinish
+#undef clGetDeviceInfo
+#undef clGetProgramInfo
+#undef clSetKernelArg
 
 typedef enum vkfft_transform_dir {
     VKFFT_FORWARD_TRANSFORM    = -1,
@@ -27,6 +203,10 @@ struct interfaceFFTPlan {
     int                   dataType;
     uint64_t              inputBufferSize;
     uint64_t              outputBufferSize;
+    // First OpenCL call that failed during the last bake or transform
+    const char*           clFunction;
+    cl_int                clError;
+    char*                 buildLog;
 };
 
 typedef struct interfaceFFTPlan interfaceFFTPlan;
@@ -40,6 +220,12 @@ void vkfftSetFFTPlanBufferSizes(interfaceFFTPlan* plan);
 void vkfftSetFFTPlanDataType(interfaceFFTPlan* plan, int dataType);
 void vkfftSetFFTPlanSize(interfaceFFTPlan* plan, size_t lengths[3]);
 
+// Moves the OpenCL error recorded on this thread into the plan
+void vkfftSavePlanCLError(interfaceFFTPlan* plan);
+
+// Replaces the command queue of the plan with one with profiling enabled
+cl_int vkfftEnablePlanProfiling(interfaceFFTPlan* plan);
+
 // Interface functions to make the library compatible with other conventional FFT libraries
 VkFFTResult vkfftBakeFFTPlan(interfaceFFTPlan* plan);
 VkFFTResult vkfftEnqueueTransform(interfaceFFTPlan* plan, vkfft_transform_dir dir, cl_mem* input, cl_mem* dst);
@@ -241,11 +427,44 @@ void vkfftSetFFTPlanBufferSizes(interfaceFFTPlan* plan) {
     plan->config->bufferSize            = &plan->outputBufferSize;
 }
 
+void vkfftSavePlanCLError(interfaceFFTPlan* plan) {
+    free(plan->buildLog);
+    plan->clFunction = vkfftLastCLError.function;
+    plan->clError    = vkfftLastCLError.code;
+    plan->buildLog   = vkfftLastCLError.buildLog;
+    vkfftLastCLError.buildLog = NULL;
+    vkfftResetCLError();
+}
+
+// Profiling has a cost, so the queue of a plan only enables it once its
+// transforms are recorded. The commands enqueued on the old queue finish
+// first.
+cl_int vkfftEnablePlanProfiling(interfaceFFTPlan* plan) {
+    cl_command_queue_properties props = 0;
+    cl_command_queue queue;
+    cl_int res = clGetCommandQueueInfo(plan->commandQueue, CL_QUEUE_PROPERTIES, sizeof(props), &props, NULL);
+    if (res != CL_SUCCESS) {
+        return res;
+    }
+    if (props & CL_QUEUE_PROFILING_ENABLE) {
+        return CL_SUCCESS;
+    }
+    queue = clCreateCommandQueue(plan->context, plan->device, props | CL_QUEUE_PROFILING_ENABLE, &res);
+    if (res != CL_SUCCESS) {
+        return res;
+    }
+    clFinish(plan->commandQueue);
+    clReleaseCommandQueue(plan->commandQueue);
+    plan->commandQueue = queue;
+    return CL_SUCCESS;
+}
+
 // Interface to initializeVkFFT()
 // Provide this function so that initialization can be checked prior to
 // any execution
 VkFFTResult vkfftBakeFFTPlan(interfaceFFTPlan* plan) {
     VkFFTResult res;
+    vkfftResetCLError();
 #if(__DEBUG__>0)
     printf("Begin initialization...\n");
 #endif
@@ -265,6 +484,7 @@ VkFFTResult vkfftBakeFFTPlan(interfaceFFTPlan* plan) {
         plan->isBaked = false;
     }
     plan->notInit = true;
+    vkfftSavePlanCLError(plan);
     return res;
 }
 
@@ -290,7 +510,10 @@ VkFFTResult vkfftEnqueueTransform(interfaceFFTPlan* plan, vkfft_transform_dir di
     }
 
     // Plan is guaranteed to be initialized so we launch the execution
-    return VkFFTAppend(plan->app, dir, plan->lParams);
+    vkfftResetCLError();
+    res = VkFFTAppend(plan->app, dir, plan->lParams);
+    vkfftSavePlanCLError(plan);
+    return res;
 }
 
 // Interface function to clean up
@@ -300,6 +523,8 @@ void vkfftDestroyFFTPlan(interfaceFFTPlan* plan) {
     }
     free(plan->config);
     free(plan->lParams);
+    free(plan->buildLog);
+    plan->buildLog = NULL;
 }
 
 cl_event vkfftGetPlanEvent(interfaceFFTPlan* plan) {
@@ -1,3 +1,3 @@
 module github.com/seeder-research/go2opencl
 
-go 1.12
+go 1.16
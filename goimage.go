@@ -0,0 +1,175 @@
+package go2opencl
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"unsafe"
+)
+
+// Conversion between the image types of the Go standard library and 2D
+// OpenCL images. Pixel data is always transferred blocking, since the
+// converted host copy only lives for the duration of the call.
+
+var (
+	ImageFormatRGBA8  = ImageFormat{ChannelOrder: ChannelOrderRGBA, ChannelDataType: ChannelDataTypeUNormInt8}
+	ImageFormatR8     = ImageFormat{ChannelOrder: ChannelOrderR, ChannelDataType: ChannelDataTypeUNormInt8}
+	ImageFormatR16    = ImageFormat{ChannelOrder: ChannelOrderR, ChannelDataType: ChannelDataTypeUNormInt16}
+	ImageFormatRGBA16 = ImageFormat{ChannelOrder: ChannelOrderRGBA, ChannelDataType: ChannelDataTypeUNormInt16}
+)
+
+// Go stores 16-bit samples big-endian while OpenCL images use the host byte order.
+var hostByteOrder binary.ByteOrder = func() binary.ByteOrder {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return binary.LittleEndian
+	}
+	return binary.BigEndian
+}()
+
+// Returns the OpenCL image format with the same pixel layout as img. Only
+// *image.RGBA, *image.Gray, *image.Gray16 and *image.NRGBA64 are supported.
+func ImageFormatOf(img image.Image) (ImageFormat, error) {
+	switch img.(type) {
+	case *image.RGBA:
+		return ImageFormatRGBA8, nil
+	case *image.Gray:
+		return ImageFormatR8, nil
+	case *image.Gray16:
+		return ImageFormatR16, nil
+	case *image.NRGBA64:
+		return ImageFormatRGBA16, nil
+	}
+	return ImageFormat{}, ErrImageFormatNotSupported
+}
+
+// Returns the pixels of img tightly packed in OpenCL layout.
+func goImagePixels(img image.Image) ([]byte, error) {
+	var pix []byte
+	var stride, offset, pixelSize int
+	swap16 := false
+	switch m := img.(type) {
+	case *image.RGBA:
+		pix, stride, offset, pixelSize = m.Pix, m.Stride, m.PixOffset(m.Rect.Min.X, m.Rect.Min.Y), 4
+	case *image.Gray:
+		pix, stride, offset, pixelSize = m.Pix, m.Stride, m.PixOffset(m.Rect.Min.X, m.Rect.Min.Y), 1
+	case *image.Gray16:
+		pix, stride, offset, pixelSize, swap16 = m.Pix, m.Stride, m.PixOffset(m.Rect.Min.X, m.Rect.Min.Y), 2, true
+	case *image.NRGBA64:
+		pix, stride, offset, pixelSize, swap16 = m.Pix, m.Stride, m.PixOffset(m.Rect.Min.X, m.Rect.Min.Y), 8, true
+	default:
+		return nil, ErrImageFormatNotSupported
+	}
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	rowSize := width * pixelSize
+	out := make([]byte, rowSize*height)
+	for y := 0; y < height; y++ {
+		copy(out[y*rowSize:(y+1)*rowSize], pix[offset+y*stride:offset+y*stride+rowSize])
+	}
+	if swap16 {
+		swapByteOrder16(out, hostByteOrder, binary.BigEndian)
+	}
+	return out, nil
+}
+
+// Rewrites the 16-bit samples of pix from the byte order from to the byte
+// order to.
+func swapByteOrder16(pix []byte, to, from binary.ByteOrder) {
+	for i := 0; i+1 < len(pix); i += 2 {
+		to.PutUint16(pix[i:], from.Uint16(pix[i:]))
+	}
+}
+
+// Creates a 2D image initialised with the pixels of img. The pixels are
+// copied from a converted host copy, so MemCopyHostPtr is always added to
+// flags, and MemUseHostPtr, which would keep a pointer to that copy, fails
+// with ErrInvalidValue. MemAllocHostPtr may be combined with it.
+func (ctx *Context) CreateImageFromGoImage(flags MemFlag, img image.Image) (*MemObject, error) {
+	if flags&MemUseHostPtr != 0 {
+		return nil, fmt.Errorf("%w: CreateImageFromGoImage copies the pixels and cannot use MemUseHostPtr", ErrInvalidValue)
+	}
+	format, err := ImageFormatOf(img)
+	if err != nil {
+		return nil, err
+	}
+	pix, err := goImagePixels(img)
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil, ErrInvalidImageSize
+	}
+	return ctx.CreateImage2D(flags|MemCopyHostPtr, format, bounds.Dx(), bounds.Dy(), 0, pix)
+}
+
+// Uploads the pixels of img into the top left corner of a 2D image. The
+// image format must match ImageFormatOf(img).
+func (q *CommandQueue) EnqueueWriteGoImage(dst *MemObject, img image.Image, eventWaitList []*Event) (*Event, error) {
+	format, err := ImageFormatOf(img)
+	if err != nil {
+		return nil, err
+	}
+	dstFormat, err := dst.GetImageFormat()
+	if err != nil {
+		return nil, err
+	}
+	if dstFormat != format {
+		return nil, ErrImageFormatMismatch
+	}
+	pix, err := goImagePixels(img)
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil, ErrInvalidImageSize
+	}
+	region := &Dim3{X: bounds.Dx(), Y: bounds.Dy(), Z: 1}
+	return q.EnqueueWriteImage(dst, true, &Dim3{}, region, 0, 0, unsafe.Pointer(&pix[0]), eventWaitList)
+}
+
+// Downloads a whole 2D image into a newly allocated Go image of the matching
+// type: *image.RGBA, *image.Gray, *image.Gray16 or *image.NRGBA64.
+func (q *CommandQueue) EnqueueReadGoImage(src *MemObject, eventWaitList []*Event) (image.Image, *Event, error) {
+	info, err := src.ImageInfo()
+	if err != nil {
+		return nil, nil, err
+	}
+	width, height := info.Width, info.Height
+	if height == 0 {
+		height = 1
+	}
+	rect := image.Rect(0, 0, width, height)
+	var img image.Image
+	var pix []byte
+	swap16 := false
+	switch info.Format {
+	case ImageFormatRGBA8:
+		m := image.NewRGBA(rect)
+		img, pix = m, m.Pix
+	case ImageFormatR8:
+		m := image.NewGray(rect)
+		img, pix = m, m.Pix
+	case ImageFormatR16:
+		m := image.NewGray16(rect)
+		img, pix, swap16 = m, m.Pix, true
+	case ImageFormatRGBA16:
+		m := image.NewNRGBA64(rect)
+		img, pix, swap16 = m, m.Pix, true
+	default:
+		return nil, nil, ErrImageFormatNotSupported
+	}
+	if len(pix) == 0 {
+		return nil, nil, ErrInvalidImageSize
+	}
+	region := &Dim3{X: width, Y: height, Z: 1}
+	ev, err := q.EnqueueReadImage(src, true, &Dim3{}, region, 0, 0, unsafe.Pointer(&pix[0]), eventWaitList)
+	if err != nil {
+		return nil, ev, err
+	}
+	if swap16 {
+		swapByteOrder16(pix, binary.BigEndian, hostByteOrder)
+	}
+	return img, ev, nil
+}
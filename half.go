@@ -0,0 +1,187 @@
+package go2opencl
+
+import (
+	"fmt"
+	"math"
+)
+
+// Host side support for the OpenCL half (cl_half) type. The conversions
+// follow cl_half.h from the Khronos headers, including its rounding modes.
+
+// ////////////// Basic Types ////////////////
+type Half uint16
+
+type HalfRoundingMode int
+
+// Same order as cl_half_rounding_mode in cl_half.h
+const (
+	HalfRoundToNearestEven HalfRoundingMode = iota // CL_HALF_RTE
+	HalfRoundToZero                                // CL_HALF_RTZ
+	HalfRoundToPositiveInf                         // CL_HALF_RTP
+	HalfRoundToNegativeInf                         // CL_HALF_RTN
+)
+
+func (m HalfRoundingMode) String() string {
+	switch m {
+	case HalfRoundToNearestEven:
+		return "RTE"
+	case HalfRoundToZero:
+		return "RTZ"
+	case HalfRoundToPositiveInf:
+		return "RTP"
+	case HalfRoundToNegativeInf:
+		return "RTN"
+	}
+	return fmt.Sprintf("Unknown(%d)", int(m))
+}
+
+// ////////////// Constants ////////////////
+const (
+	halfExpMask        = 0x7C00
+	halfMaxFiniteMag   = 0x7BFF
+	halfMantDig        = 11
+	halfMaxExp         = 16
+	halfMinExp         = -13
+	float32MantDig     = 24
+	float32MaxExp      = 128
+	float32ExpBitsMask = 0xFF
+)
+
+// ////////////// Basic Functions ////////////////
+func halfOverflow(mode HalfRoundingMode, sign uint16) Half {
+	switch {
+	case mode == HalfRoundToZero:
+		return Half(sign<<15 | halfMaxFiniteMag)
+	case mode == HalfRoundToPositiveInf && sign != 0:
+		return Half(1<<15 | halfMaxFiniteMag)
+	case mode == HalfRoundToNegativeInf && sign == 0:
+		return Half(halfMaxFiniteMag)
+	}
+	return Half(sign<<15 | halfExpMask)
+}
+
+func halfUnderflow(mode HalfRoundingMode, sign uint16) Half {
+	if (mode == HalfRoundToPositiveInf && sign == 0) || (mode == HalfRoundToNegativeInf && sign != 0) {
+		return Half(sign<<15 | 1)
+	}
+	return Half(sign << 15)
+}
+
+// Converts a float32 to half precision using the given rounding mode.
+func HalfFromFloat32(f float32, mode HalfRoundingMode) Half {
+	bits := math.Float32bits(f)
+	sign := uint16(bits >> 31)
+	fExp := (bits >> (float32MantDig - 1)) & float32ExpBitsMask
+	fMant := bits & (1<<(float32MantDig-1) - 1)
+
+	exp := int32(fExp) - float32MaxExp + 1
+	hExp := uint16(exp + halfMaxExp - 1)
+	lsbPos := uint32(float32MantDig - halfMantDig)
+
+	if fExp == float32ExpBitsMask {
+		if fMant != 0 {
+			// NaN: propagate the mantissa and make it quiet
+			hMant := uint16(fMant>>lsbPos) | 0x200
+			return Half(sign<<15 | halfExpMask | hMant)
+		}
+		return Half(sign<<15 | halfExpMask)
+	}
+	if fExp == 0 && fMant == 0 {
+		return Half(sign << 15)
+	}
+	if exp >= halfMaxExp {
+		return halfOverflow(mode, sign)
+	}
+	if exp < halfMinExp-halfMantDig-1 {
+		return halfUnderflow(mode, sign)
+	}
+	if exp < -14 {
+		// Denormal: include the implicit leading 1 of the float32 mantissa
+		hExp = 0
+		fMant |= 1 << (float32MantDig - 1)
+		lsbPos = uint32(-exp + (float32MantDig - 25))
+	}
+
+	hMant := uint16(fMant >> lsbPos)
+	halfway := uint32(1) << (lsbPos - 1)
+	mask := halfway<<1 - 1
+	switch mode {
+	case HalfRoundToNearestEven:
+		if fMant&mask > halfway || (fMant&mask == halfway && hMant&1 != 0) {
+			hMant++
+		}
+	case HalfRoundToPositiveInf:
+		if fMant&mask != 0 && sign == 0 {
+			hMant++
+		}
+	case HalfRoundToNegativeInf:
+		if fMant&mask != 0 && sign != 0 {
+			hMant++
+		}
+	}
+	if hMant&0x400 != 0 {
+		hExp++
+		hMant = 0
+	}
+	return Half(sign<<15 | hExp<<10 | hMant)
+}
+
+// Converts a float32 to half precision, rounding to nearest even.
+func NewHalf(f float32) Half {
+	return HalfFromFloat32(f, HalfRoundToNearestEven)
+}
+
+// Converts the half to a float32. The conversion is exact.
+func (h Half) Float32() float32 {
+	sign := uint32(h>>15) << 31
+	exp := uint32(h>>10) & 0x1F
+	mant := uint32(h) & 0x3FF
+	switch {
+	case exp == 0x1F && mant != 0:
+		// NaN: propagate the mantissa and make it quiet
+		return math.Float32frombits(sign | float32ExpBitsMask<<23 | mant<<13 | 0x400000)
+	case exp == 0x1F:
+		return math.Float32frombits(sign | float32ExpBitsMask<<23)
+	case exp == 0 && mant == 0:
+		return math.Float32frombits(sign)
+	case exp == 0:
+		// Denormal: normalise the mantissa
+		e := uint32(127 - 15 + 1)
+		for mant&0x400 == 0 {
+			mant <<= 1
+			e--
+		}
+		return math.Float32frombits(sign | e<<23 | (mant&0x3FF)<<13)
+	}
+	return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+}
+
+func (h Half) IsNaN() bool {
+	return h&halfExpMask == halfExpMask && h&0x3FF != 0
+}
+
+func (h Half) IsInf() bool {
+	return h&0x7FFF == halfExpMask
+}
+
+func (h Half) String() string {
+	return fmt.Sprint(h.Float32())
+}
+
+// Converts a slice of float32 values to half precision.
+func Float32ToHalfSlice(src []float32, mode HalfRoundingMode) []Half {
+	dst := make([]Half, len(src))
+	for i, f := range src {
+		dst[i] = HalfFromFloat32(f, mode)
+	}
+	return dst
+}
+
+// Converts a slice of halfs to float32 values.
+func HalfToFloat32Slice(src []Half) []float32 {
+	dst := make([]float32, len(src))
+	for i, h := range src {
+		dst[i] = h.Float32()
+	}
+	return dst
+}
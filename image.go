@@ -0,0 +1,475 @@
+package go2opencl
+
+/*
+#include "./opencl.h"
+#include <string.h>
+
+static cl_mem CLCreateImage(      cl_context              context,
+                                  cl_mem_flags            flags,
+                                  cl_channel_order        channel_order,
+                                  cl_channel_type         channel_data_type,
+                                  cl_mem_object_type      image_type,
+                                  size_t                  image_width,
+                                  size_t                  image_height,
+                                  size_t                  image_depth,
+                                  size_t                  image_array_size,
+                                  size_t                  image_row_pitch,
+                                  size_t                  image_slice_pitch,
+                                  cl_uint                 num_mip_levels,
+                                  cl_uint                 num_samples,
+                                  cl_mem                  buffer,
+                                  void *                  host_ptr,
+                                  cl_int *                errcode_ret) {
+	cl_image_format image_format;
+	image_format.image_channel_order = channel_order;
+	image_format.image_channel_data_type = channel_data_type;
+
+	cl_image_desc image_desc;
+	memset(&image_desc, 0, sizeof(cl_image_desc));
+	image_desc.image_type = image_type;
+	image_desc.image_width = image_width;
+	image_desc.image_height = image_height;
+	image_desc.image_depth = image_depth;
+	image_desc.image_array_size = image_array_size;
+	image_desc.image_row_pitch = image_row_pitch;
+	image_desc.image_slice_pitch = image_slice_pitch;
+	image_desc.num_mip_levels = num_mip_levels;
+	image_desc.num_samples = num_samples;
+	image_desc.buffer = buffer;
+	return clCreateImage(context, flags, &image_format, &image_desc, host_ptr, errcode_ret);
+}
+
+static cl_int CLGetImageInfoParamUnsafe(cl_mem                 image,
+                                        cl_image_info     param_name,
+                                        size_t      param_value_size,
+                                        void            *param_value) {
+	return clGetImageInfo(image, param_name, param_value_size, param_value, NULL);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// ////////////// Basic Types ////////////////
+type ChannelOrder int
+
+const (
+	ChannelOrderR            ChannelOrder = C.CL_R
+	ChannelOrderA            ChannelOrder = C.CL_A
+	ChannelOrderRG           ChannelOrder = C.CL_RG
+	ChannelOrderRA           ChannelOrder = C.CL_RA
+	ChannelOrderRGB          ChannelOrder = C.CL_RGB
+	ChannelOrderRGBA         ChannelOrder = C.CL_RGBA
+	ChannelOrderBGRA         ChannelOrder = C.CL_BGRA
+	ChannelOrderARGB         ChannelOrder = C.CL_ARGB
+	ChannelOrderIntensity    ChannelOrder = C.CL_INTENSITY
+	ChannelOrderLuminance    ChannelOrder = C.CL_LUMINANCE
+	ChannelOrderRx           ChannelOrder = C.CL_Rx
+	ChannelOrderRGx          ChannelOrder = C.CL_RGx
+	ChannelOrderRGBx         ChannelOrder = C.CL_RGBx
+	ChannelOrderDepth        ChannelOrder = C.CL_DEPTH
+	ChannelOrderDepthStencil ChannelOrder = C.CL_DEPTH_STENCIL
+)
+
+var channelOrderNameMap = map[ChannelOrder]string{
+	ChannelOrderR:            "R",
+	ChannelOrderA:            "A",
+	ChannelOrderRG:           "RG",
+	ChannelOrderRA:           "RA",
+	ChannelOrderRGB:          "RGB",
+	ChannelOrderRGBA:         "RGBA",
+	ChannelOrderBGRA:         "BGRA",
+	ChannelOrderARGB:         "ARGB",
+	ChannelOrderIntensity:    "Intensity",
+	ChannelOrderLuminance:    "Luminance",
+	ChannelOrderRx:           "Rx",
+	ChannelOrderRGx:          "RGx",
+	ChannelOrderRGBx:         "RGBx",
+	ChannelOrderDepth:        "Depth",
+	ChannelOrderDepthStencil: "DepthStencil",
+}
+
+func (co ChannelOrder) String() string {
+	name := channelOrderNameMap[co]
+	if name == "" {
+		name = fmt.Sprintf("Unknown(%x)", int(co))
+	}
+	return name
+}
+
+// Number of channels stored per pixel for the channel order.
+func (co ChannelOrder) channelCount() int {
+	switch co {
+	case ChannelOrderR, ChannelOrderA, ChannelOrderIntensity, ChannelOrderLuminance, ChannelOrderRx, ChannelOrderDepth:
+		return 1
+	case ChannelOrderRG, ChannelOrderRA, ChannelOrderRGx, ChannelOrderDepthStencil:
+		return 2
+	case ChannelOrderRGB, ChannelOrderRGBx:
+		return 3
+	case ChannelOrderRGBA, ChannelOrderBGRA, ChannelOrderARGB:
+		return 4
+	}
+	return 0
+}
+
+type ChannelDataType int
+
+const (
+	ChannelDataTypeSNormInt8      ChannelDataType = C.CL_SNORM_INT8
+	ChannelDataTypeSNormInt16     ChannelDataType = C.CL_SNORM_INT16
+	ChannelDataTypeUNormInt8      ChannelDataType = C.CL_UNORM_INT8
+	ChannelDataTypeUNormInt16     ChannelDataType = C.CL_UNORM_INT16
+	ChannelDataTypeUNormShort565  ChannelDataType = C.CL_UNORM_SHORT_565
+	ChannelDataTypeUNormShort555  ChannelDataType = C.CL_UNORM_SHORT_555
+	ChannelDataTypeUNormInt101010 ChannelDataType = C.CL_UNORM_INT_101010
+	ChannelDataTypeSignedInt8     ChannelDataType = C.CL_SIGNED_INT8
+	ChannelDataTypeSignedInt16    ChannelDataType = C.CL_SIGNED_INT16
+	ChannelDataTypeSignedInt32    ChannelDataType = C.CL_SIGNED_INT32
+	ChannelDataTypeUnsignedInt8   ChannelDataType = C.CL_UNSIGNED_INT8
+	ChannelDataTypeUnsignedInt16  ChannelDataType = C.CL_UNSIGNED_INT16
+	ChannelDataTypeUnsignedInt32  ChannelDataType = C.CL_UNSIGNED_INT32
+	ChannelDataTypeHalfFloat      ChannelDataType = C.CL_HALF_FLOAT
+	ChannelDataTypeFloat          ChannelDataType = C.CL_FLOAT
+	ChannelDataTypeUNormInt24     ChannelDataType = C.CL_UNORM_INT24
+)
+
+var channelDataTypeNameMap = map[ChannelDataType]string{
+	ChannelDataTypeSNormInt8:      "SNormInt8",
+	ChannelDataTypeSNormInt16:     "SNormInt16",
+	ChannelDataTypeUNormInt8:      "UNormInt8",
+	ChannelDataTypeUNormInt16:     "UNormInt16",
+	ChannelDataTypeUNormShort565:  "UNormShort565",
+	ChannelDataTypeUNormShort555:  "UNormShort555",
+	ChannelDataTypeUNormInt101010: "UNormInt101010",
+	ChannelDataTypeSignedInt8:     "SignedInt8",
+	ChannelDataTypeSignedInt16:    "SignedInt16",
+	ChannelDataTypeSignedInt32:    "SignedInt32",
+	ChannelDataTypeUnsignedInt8:   "UnsignedInt8",
+	ChannelDataTypeUnsignedInt16:  "UnsignedInt16",
+	ChannelDataTypeUnsignedInt32:  "UnsignedInt32",
+	ChannelDataTypeHalfFloat:      "HalfFloat",
+	ChannelDataTypeFloat:          "Float",
+	ChannelDataTypeUNormInt24:     "UNormInt24",
+}
+
+func (ct ChannelDataType) String() string {
+	name := channelDataTypeNameMap[ct]
+	if name == "" {
+		name = fmt.Sprintf("Unknown(%x)", int(ct))
+	}
+	return name
+}
+
+//////////////// Abstract Types ////////////////
+
+// Describes the channel layout of the pixels stored in an image.
+type ImageFormat struct {
+	ChannelOrder    ChannelOrder
+	ChannelDataType ChannelDataType
+}
+
+// Describes the type and dimensions of an image. Fields not used by the
+// image type (e.g. Depth for a 2D image) are ignored. A zero RowPitch or
+// SlicePitch lets OpenCL derive the pitch from the width and element size.
+// Buffer is only used by MemObjectTypeImage1DBuffer images.
+type ImageDesc struct {
+	Type         MemObjectType
+	Width        int
+	Height       int
+	Depth        int
+	ArraySize    int
+	RowPitch     int
+	SlicePitch   int
+	NumMipLevels int
+	NumSamples   int
+	Buffer       *MemObject
+}
+
+// Result of the clGetImageInfo queries on an image memory object.
+type ImageInfo struct {
+	Format       ImageFormat
+	ElementSize  int
+	RowPitch     int
+	SlicePitch   int
+	Width        int
+	Height       int
+	Depth        int
+	ArraySize    int
+	NumMipLevels int
+	NumSamples   int
+	Buffer       *MemObject
+}
+
+// ////////////// Basic Functions ////////////////
+func (f ImageFormat) String() string {
+	return fmt.Sprintf("%s/%s", f.ChannelOrder, f.ChannelDataType)
+}
+
+// Size in bytes of a single pixel of the format, or 0 if the format is not known.
+func (f ImageFormat) PixelSize() int {
+	switch f.ChannelDataType {
+	case ChannelDataTypeUNormShort565, ChannelDataTypeUNormShort555:
+		return 2
+	case ChannelDataTypeUNormInt101010:
+		return 4
+	case ChannelDataTypeUNormInt24:
+		if f.ChannelOrder == ChannelOrderDepthStencil {
+			return 4
+		}
+		return 3
+	}
+	var channelSize int
+	switch f.ChannelDataType {
+	case ChannelDataTypeSNormInt8, ChannelDataTypeUNormInt8, ChannelDataTypeSignedInt8, ChannelDataTypeUnsignedInt8:
+		channelSize = 1
+	case ChannelDataTypeSNormInt16, ChannelDataTypeUNormInt16, ChannelDataTypeSignedInt16, ChannelDataTypeUnsignedInt16, ChannelDataTypeHalfFloat:
+		channelSize = 2
+	case ChannelDataTypeSignedInt32, ChannelDataTypeUnsignedInt32, ChannelDataTypeFloat:
+		channelSize = 4
+	}
+	if f.ChannelOrder == ChannelOrderDepthStencil && f.ChannelDataType == ChannelDataTypeFloat {
+		// 32-bit float depth plus 8-bit stencil padded to 64 bits
+		return 8
+	}
+	return channelSize * f.ChannelOrder.channelCount()
+}
+
+// Number of pixels along each of the dimensions used by the image type.
+func (d ImageDesc) extent() (width, height, depth int) {
+	switch d.Type {
+	case MemObjectTypeImage1D, MemObjectTypeImage1DBuffer:
+		return d.Width, 1, 1
+	case MemObjectTypeImage1DArray:
+		return d.Width, d.ArraySize, 1
+	case MemObjectTypeImage2D:
+		return d.Width, d.Height, 1
+	case MemObjectTypeImage2DArray:
+		return d.Width, d.Height, d.ArraySize
+	case MemObjectTypeImage3D:
+		return d.Width, d.Height, d.Depth
+	}
+	return 0, 0, 0
+}
+
+// Number of bytes the image occupies when stored tightly packed.
+func (d ImageDesc) byteSize(format ImageFormat) int {
+	width, height, depth := d.extent()
+	return format.PixelSize() * width * height * depth
+}
+
+// Number of bytes of host memory read when the image is initialised from a host pointer.
+func (d ImageDesc) hostSize(format ImageFormat) int {
+	width, height, depth := d.extent()
+	rowPitch := d.RowPitch
+	if rowPitch == 0 {
+		rowPitch = width * format.PixelSize()
+	}
+	slicePitch := d.SlicePitch
+	if slicePitch == 0 {
+		slicePitch = rowPitch * height
+	}
+	if d.Type == MemObjectTypeImage1DArray && d.SlicePitch == 0 {
+		slicePitch = rowPitch
+	}
+	switch d.Type {
+	case MemObjectTypeImage1DArray:
+		return slicePitch * height
+	case MemObjectTypeImage2DArray, MemObjectTypeImage3D:
+		return slicePitch * depth
+	}
+	return rowPitch * height
+}
+
+//////////////// Abstract Functions ////////////////
+
+// Creates an image memory object of the type given in desc. The host data,
+// if any, is laid out according to desc.RowPitch and desc.SlicePitch.
+func (ctx *Context) CreateImageUnsafe(flags MemFlag, format ImageFormat, desc ImageDesc, dataPtr unsafe.Pointer) (*MemObject, error) {
+	if !desc.Type.IsImage() {
+		return nil, toError(C.CL_INVALID_IMAGE_DESCRIPTOR)
+	}
+	var buffer C.cl_mem
+	if desc.Buffer != nil {
+		buffer = desc.Buffer.clMem
+	}
+	var err C.cl_int
+	clImage := C.CLCreateImage(ctx.clContext, C.cl_mem_flags(flags), C.cl_channel_order(format.ChannelOrder), C.cl_channel_type(format.ChannelDataType),
+		C.cl_mem_object_type(desc.Type), C.size_t(desc.Width), C.size_t(desc.Height), C.size_t(desc.Depth), C.size_t(desc.ArraySize),
+		C.size_t(desc.RowPitch), C.size_t(desc.SlicePitch), C.cl_uint(desc.NumMipLevels), C.cl_uint(desc.NumSamples), buffer, dataPtr, &err)
+	if err != C.CL_SUCCESS {
+		return nil, toError(err)
+	}
+	if clImage == nil {
+		return nil, ErrUnknown
+	}
+	return newMemObject(clImage, desc.byteSize(format)), nil
+}
+
+// Creates an image memory object of the type given in desc. data may be nil
+// for an uninitialised image; otherwise it must hold the whole image.
+func (ctx *Context) CreateImage(flags MemFlag, format ImageFormat, desc ImageDesc, data []byte) (*MemObject, error) {
+	if len(data) == 0 {
+		return ctx.CreateImageUnsafe(flags, format, desc, nil)
+	}
+	if len(data) < desc.hostSize(format) {
+		return nil, ErrInvalidHostPtr
+	}
+	return ctx.CreateImageUnsafe(flags, format, desc, unsafe.Pointer(&data[0]))
+}
+
+func (ctx *Context) CreateImage1D(flags MemFlag, format ImageFormat, width int, data []byte) (*MemObject, error) {
+	return ctx.CreateImage(flags, format, ImageDesc{Type: MemObjectTypeImage1D, Width: width}, data)
+}
+
+// Creates a 1D image whose storage is the buffer object given.
+func (ctx *Context) CreateImage1DBuffer(flags MemFlag, format ImageFormat, width int, buffer *MemObject) (*MemObject, error) {
+	if buffer == nil {
+		return nil, toError(C.CL_INVALID_IMAGE_DESCRIPTOR)
+	}
+	return ctx.CreateImage(flags, format, ImageDesc{Type: MemObjectTypeImage1DBuffer, Width: width, Buffer: buffer}, nil)
+}
+
+func (ctx *Context) CreateImage1DArray(flags MemFlag, format ImageFormat, width, arraySize, rowPitch int, data []byte) (*MemObject, error) {
+	desc := ImageDesc{Type: MemObjectTypeImage1DArray, Width: width, ArraySize: arraySize, RowPitch: rowPitch}
+	return ctx.CreateImage(flags, format, desc, data)
+}
+
+func (ctx *Context) CreateImage2D(flags MemFlag, format ImageFormat, width, height, rowPitch int, data []byte) (*MemObject, error) {
+	desc := ImageDesc{Type: MemObjectTypeImage2D, Width: width, Height: height, RowPitch: rowPitch}
+	return ctx.CreateImage(flags, format, desc, data)
+}
+
+func (ctx *Context) CreateImage2DArray(flags MemFlag, format ImageFormat, width, height, arraySize, rowPitch, slicePitch int, data []byte) (*MemObject, error) {
+	desc := ImageDesc{Type: MemObjectTypeImage2DArray, Width: width, Height: height, ArraySize: arraySize, RowPitch: rowPitch, SlicePitch: slicePitch}
+	return ctx.CreateImage(flags, format, desc, data)
+}
+
+func (ctx *Context) CreateImage3D(flags MemFlag, format ImageFormat, width, height, depth, rowPitch, slicePitch int, data []byte) (*MemObject, error) {
+	desc := ImageDesc{Type: MemObjectTypeImage3D, Width: width, Height: height, Depth: depth, RowPitch: rowPitch, SlicePitch: slicePitch}
+	return ctx.CreateImage(flags, format, desc, data)
+}
+
+// Lists the image formats supported by the context for the given memory flags and image type.
+func (ctx *Context) SupportedImageFormats(flags MemFlag, imageType MemObjectType) ([]ImageFormat, error) {
+	var numFormats C.cl_uint
+	if err := C.clGetSupportedImageFormats(ctx.clContext, C.cl_mem_flags(flags), C.cl_mem_object_type(imageType), 0, nil, &numFormats); err != C.CL_SUCCESS {
+		return nil, toError(err)
+	}
+	if numFormats == 0 {
+		return []ImageFormat{}, nil
+	}
+	clFormats := make([]C.cl_image_format, int(numFormats))
+	if err := C.clGetSupportedImageFormats(ctx.clContext, C.cl_mem_flags(flags), C.cl_mem_object_type(imageType), numFormats, &clFormats[0], nil); err != C.CL_SUCCESS {
+		return nil, toError(err)
+	}
+	formats := make([]ImageFormat, len(clFormats))
+	for i, f := range clFormats {
+		formats[i] = ImageFormat{ChannelOrder: ChannelOrder(f.image_channel_order), ChannelDataType: ChannelDataType(f.image_channel_data_type)}
+	}
+	return formats, nil
+}
+
+// Reports whether format is among the formats returned by SupportedImageFormats.
+func (ctx *Context) IsImageFormatSupported(flags MemFlag, imageType MemObjectType, format ImageFormat) (bool, error) {
+	formats, err := ctx.SupportedImageFormats(flags, imageType)
+	if err != nil {
+		return false, err
+	}
+	for _, f := range formats {
+		if f == format {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (b *MemObject) getImageInfoSize(param C.cl_image_info) (int, error) {
+	var val C.size_t
+	if err := C.CLGetImageInfoParamUnsafe(b.clMem, param, C.size_t(unsafe.Sizeof(val)), unsafe.Pointer(&val)); err != C.CL_SUCCESS {
+		return 0, toError(err)
+	}
+	return int(val), nil
+}
+
+func (b *MemObject) getImageInfoUint(param C.cl_image_info) (int, error) {
+	var val C.cl_uint
+	if err := C.CLGetImageInfoParamUnsafe(b.clMem, param, C.size_t(unsafe.Sizeof(val)), unsafe.Pointer(&val)); err != C.CL_SUCCESS {
+		return 0, toError(err)
+	}
+	return int(val), nil
+}
+
+// Returns the format of an image memory object.
+func (b *MemObject) GetImageFormat() (ImageFormat, error) {
+	if b.clMem != nil {
+		var val C.cl_image_format
+		if err := C.CLGetImageInfoParamUnsafe(b.clMem, C.CL_IMAGE_FORMAT, C.size_t(unsafe.Sizeof(val)), unsafe.Pointer(&val)); err != C.CL_SUCCESS {
+			return ImageFormat{}, toError(err)
+		}
+		return ImageFormat{ChannelOrder: ChannelOrder(val.image_channel_order), ChannelDataType: ChannelDataType(val.image_channel_data_type)}, nil
+	}
+	return ImageFormat{}, toError(C.CL_INVALID_MEM_OBJECT)
+}
+
+// Queries all image specific information of an image memory object.
+func (b *MemObject) ImageInfo() (*ImageInfo, error) {
+	if b.clMem == nil {
+		return nil, toError(C.CL_INVALID_MEM_OBJECT)
+	}
+	format, err := b.GetImageFormat()
+	if err != nil {
+		return nil, err
+	}
+	info := &ImageInfo{Format: format}
+	sizeParams := []struct {
+		param C.cl_image_info
+		dst   *int
+	}{
+		{C.CL_IMAGE_ELEMENT_SIZE, &info.ElementSize},
+		{C.CL_IMAGE_ROW_PITCH, &info.RowPitch},
+		{C.CL_IMAGE_SLICE_PITCH, &info.SlicePitch},
+		{C.CL_IMAGE_WIDTH, &info.Width},
+		{C.CL_IMAGE_HEIGHT, &info.Height},
+		{C.CL_IMAGE_DEPTH, &info.Depth},
+		{C.CL_IMAGE_ARRAY_SIZE, &info.ArraySize},
+	}
+	for _, p := range sizeParams {
+		if *p.dst, err = b.getImageInfoSize(p.param); err != nil {
+			return nil, err
+		}
+	}
+	if info.NumMipLevels, err = b.getImageInfoUint(C.CL_IMAGE_NUM_MIP_LEVELS); err != nil {
+		return nil, err
+	}
+	if info.NumSamples, err = b.getImageInfoUint(C.CL_IMAGE_NUM_SAMPLES); err != nil {
+		return nil, err
+	}
+	var buffer C.cl_mem
+	if errC := C.CLGetImageInfoParamUnsafe(b.clMem, C.CL_IMAGE_BUFFER, C.size_t(unsafe.Sizeof(buffer)), unsafe.Pointer(&buffer)); errC != C.CL_SUCCESS {
+		return nil, toError(errC)
+	}
+	if buffer != nil {
+		var size C.size_t
+		if errC := C.clGetMemObjectInfo(buffer, C.CL_MEM_SIZE, C.size_t(unsafe.Sizeof(size)), unsafe.Pointer(&size), nil); errC != C.CL_SUCCESS {
+			return nil, toError(errC)
+		}
+		C.clRetainMemObject(buffer)
+		info.Buffer = newMemObject(buffer, int(size))
+	}
+	return info, nil
+}
+
+// Returns the number of bytes in region of image when q is recording, 0 otherwise.
+func (q *CommandQueue) imageRegionBytes(image *MemObject, region *Dim3) int {
+	if q.recorder == nil || region == nil {
+		return 0
+	}
+	elementSize, err := image.getImageInfoSize(C.CL_IMAGE_ELEMENT_SIZE)
+	if err != nil {
+		return 0
+	}
+	return elementSize * region.X * region.Y * region.Z
+}
@@ -0,0 +1,130 @@
+// Package cmdutil holds the helpers the commands of go2opencl share: flags,
+// error reporting, the file system of the sources passed on the command line
+// and the selection of a device.
+package cmdutil
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	cl "github.com/seeder-research/go2opencl"
+)
+
+// The name errors are reported with, that of the command by default.
+var Name = strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe")
+
+// A flag that may be repeated.
+type ListFlag []string
+
+func (l *ListFlag) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *ListFlag) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// Prints the error to the standard error, prefixed with Name, and exits with
+// status 1.
+func Fatalf(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, Name+": "+format+"\n", args...)
+	os.Exit(1)
+}
+
+// Returns the macros defined by defines, given as name or name=value.
+func Defines(defines []string) map[string]string {
+	m := make(map[string]string, len(defines))
+	for _, d := range defines {
+		name, value := d, ""
+		if i := strings.Index(d, "="); i >= 0 {
+			name, value = d[:i], d[i+1:]
+		}
+		m[name] = value
+	}
+	return m
+}
+
+// Returns a file system holding the files and include directories, its root,
+// and their paths in it. The file system is the working directory, or the
+// root of the volume if a path is outside of it.
+func SourceFS(files, dirs []string) (fs.FS, string, []string, []string, error) {
+	root := "."
+	for _, p := range append(append([]string(nil), files...), dirs...) {
+		if !fs.ValidPath(filepath.ToSlash(filepath.Clean(p))) {
+			abs, err := filepath.Abs(p)
+			if err != nil {
+				return nil, "", nil, nil, err
+			}
+			root = filepath.VolumeName(abs) + string(filepath.Separator)
+			break
+		}
+	}
+	paths := func(ps []string) ([]string, error) {
+		out := make([]string, len(ps))
+		for i, p := range ps {
+			if root != "." {
+				abs, err := filepath.Abs(p)
+				if err != nil {
+					return nil, err
+				}
+				p = abs[len(root):]
+			}
+			out[i] = filepath.ToSlash(filepath.Clean(p))
+		}
+		return out, nil
+	}
+	names, err := paths(files)
+	if err != nil {
+		return nil, "", nil, nil, err
+	}
+	fsDirs, err := paths(dirs)
+	if err != nil {
+		return nil, "", nil, nil, err
+	}
+	return os.DirFS(root), root, names, fsDirs, nil
+}
+
+// Returns the devices of all platforms.
+func Devices() ([]*cl.Device, error) {
+	platforms, err := cl.GetPlatforms()
+	if err != nil {
+		return nil, err
+	}
+	var devices []*cl.Device
+	for _, p := range platforms {
+		ds, err := p.GetDevices(cl.DeviceTypeAll)
+		if err != nil {
+			continue
+		}
+		devices = append(devices, ds...)
+	}
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("no OpenCL device found")
+	}
+	return devices, nil
+}
+
+// Returns the device of devices selected by sel, an index or a substring of
+// the name of the device, or the first device if sel is empty.
+func SelectDevice(devices []*cl.Device, sel string) (*cl.Device, error) {
+	if sel == "" {
+		return devices[0], nil
+	}
+	if i, err := strconv.Atoi(sel); err == nil {
+		if i < 0 || i >= len(devices) {
+			return nil, fmt.Errorf("no device %d", i)
+		}
+		return devices[i], nil
+	}
+	for _, d := range devices {
+		if strings.Contains(strings.ToLower(d.Name()), strings.ToLower(sel)) {
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("no device matches %q", sel)
+}
@@ -0,0 +1,66 @@
+package cmdutil
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSourceFS(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "src", "include"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "src", "a.cl"), []byte("__kernel void a(void) {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(filepath.Join(dir, "src")); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// Paths under the working directory are kept relative to it
+	fsys, root, names, dirs, err := SourceFS([]string{"./a.cl"}, []string{"include/"})
+	if err != nil {
+		t.Fatalf("SourceFS failed: %v", err)
+	}
+	if root != "." || !reflect.DeepEqual(names, []string{"a.cl"}) || !reflect.DeepEqual(dirs, []string{"include"}) {
+		t.Errorf("SourceFS returned %q, %q, %q, want ., [a.cl], [include]", root, names, dirs)
+	}
+	if _, err := fs.ReadFile(fsys, names[0]); err != nil {
+		t.Errorf("ReadFile(%s) failed: %v", names[0], err)
+	}
+
+	// A path outside of it rebases all of them on the root of the volume
+	abs := filepath.Join(dir, "src", "a.cl")
+	fsys, root, names, dirs, err = SourceFS([]string{abs}, []string{"include", "../src"})
+	if err != nil {
+		t.Fatalf("SourceFS failed: %v", err)
+	}
+	volume := filepath.VolumeName(abs) + string(filepath.Separator)
+	rel := func(p string) string {
+		return filepath.ToSlash(p[len(volume):])
+	}
+	wantNames := []string{rel(abs)}
+	wantDirs := []string{rel(filepath.Join(dir, "src", "include")), rel(filepath.Join(dir, "src"))}
+	if root != volume || !reflect.DeepEqual(names, wantNames) || !reflect.DeepEqual(dirs, wantDirs) {
+		t.Errorf("SourceFS returned %q, %q, %q, want %q, %q, %q", root, names, dirs, volume, wantNames, wantDirs)
+	}
+	if _, err := fs.ReadFile(fsys, names[0]); err != nil {
+		t.Errorf("ReadFile(%s) failed: %v", names[0], err)
+	}
+}
+
+func TestDefines(t *testing.T) {
+	got := Defines([]string{"N=4", "DEBUG", "EXPR=a=b", "EMPTY="})
+	want := map[string]string{"N": "4", "DEBUG": "", "EXPR": "a=b", "EMPTY": ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Defines returned %v, want %v", got, want)
+	}
+}
@@ -3,21 +3,37 @@ package go2opencl
 /*
 #include "./opencl.h"
 
-extern void go_native_kernel(void *user_args);
-static void CL_CALLBACK c_enqueue_native_kernel(void *user_args) {
-        go_native_kernel((void *)user_args);
+extern void go_native_kernel(void *args);
+static void CL_CALLBACK c_enqueue_native_kernel(void *args) {
+        go_native_kernel(args);
 }
 
+// The argument block holds the callback handle followed by one slot per memory
+// object, which the runtime replaces with a pointer to the object's memory.
 static cl_int CLEnqueueNativeKernel(      cl_command_queue command_queue,
-                                                        void *                                  user_args,
-							size_t					num_args,
+                                                        uintptr_t                               handle,
 							cl_uint					num_mem_objects,
 						const cl_mem *				mem_list,
-						const void **				args_mem_ptrs,
 							cl_uint					num_events_in_list,
 						const cl_event *				eventsWaitList,
                                                         cl_event *                                ret_event){
-        return clEnqueueNativeKernel(command_queue, c_enqueue_native_kernel, user_args, num_args, num_mem_objects, mem_list, args_mem_ptrs, num_events_in_list, eventsWaitList, ret_event);
+	size_t cb_args = (num_mem_objects + 1) * sizeof(void *);
+	void **args = malloc(cb_args);
+	const void **args_mem_loc = NULL;
+	cl_uint i;
+	cl_int err;
+	args[0] = (void *)handle;
+	if (num_mem_objects > 0) {
+		args_mem_loc = malloc(num_mem_objects * sizeof(void *));
+		for (i = 0; i < num_mem_objects; i++) {
+			args[i + 1] = (void *)mem_list[i];
+			args_mem_loc[i] = (const void *)&args[i + 1];
+		}
+	}
+        err = clEnqueueNativeKernel(command_queue, c_enqueue_native_kernel, args, cb_args, num_mem_objects, mem_list, args_mem_loc, num_events_in_list, eventsWaitList, ret_event);
+	free(args_mem_loc);
+	free(args);
+	return err;
 }
 */
 import "C"
@@ -39,28 +55,36 @@ func (e ErrUnsupportedArgumentType) Error() string {
 
 //////////////// Abstract Types ////////////////
 type Kernel struct {
-	clKernel C.cl_kernel
-	name     string
+	clKernel  C.cl_kernel
+	name      string
+	signature []KernelArg // Cached by Signature
+	checked   bool        // Set by SetArgChecking
 }
 
 //////////////// Golang Types ////////////////
 type LocalBuffer int
 
 ////////////////// Supporting Types ////////////////
-type CL_go_native_kernel func(user_data unsafe.Pointer)
+// Runs on the host as a native kernel. memPtrs holds a pointer to the memory
+// of each memory object passed to EnqueueNativeKernel, in the same order.
+type CL_go_native_kernel func(memPtrs []unsafe.Pointer)
 
-var go_native_kernel_func map[unsafe.Pointer]CL_go_native_kernel
-
-//////////////// Basic Functions ////////////////
-func init() {
-	go_native_kernel_func = make(map[unsafe.Pointer]CL_go_native_kernel)
+type nativeKernel struct {
+	fn            CL_go_native_kernel
+	numMemObjects int
 }
 
+//////////////// Basic Functions ////////////////
 //export go_native_kernel
-func go_native_kernel(user_data unsafe.Pointer) {
-	var c_user_data []unsafe.Pointer
-	c_user_data = *(*[]unsafe.Pointer)(user_data)
-	go_native_kernel_func[c_user_data[1]](c_user_data[0])
+func go_native_kernel(args unsafe.Pointer) {
+	slots := (*[1 << 28]unsafe.Pointer)(args)
+	nk, ok := callbacks.take(uintptr(*(*C.uintptr_t)(args))).(nativeKernel)
+	if !ok {
+		return
+	}
+	memPtrs := make([]unsafe.Pointer, nk.numMemObjects)
+	copy(memPtrs, slots[1:nk.numMemObjects+1])
+	nk.fn(memPtrs)
 }
 
 func releaseKernel(k *Kernel) {
@@ -100,18 +124,31 @@ func (k *Kernel) SetArg(index int, arg interface{}) error {
 		return k.SetArgUint8(index, val)
 	case int8:
 		return k.SetArgInt8(index, val)
+	case uint16:
+		return k.SetArgUint16(index, val)
+	case int16:
+		return k.SetArgInt16(index, val)
 	case uint32:
 		return k.SetArgUint32(index, val)
 	case uint64:
 		return k.SetArgUint64(index, val)
 	case int32:
 		return k.SetArgInt32(index, val)
+	case int64:
+		return k.SetArgInt64(index, val)
 	case float32:
 		return k.SetArgFloat32(index, val)
+	case Half:
+		return k.SetArgHalf(index, val)
 	case float64:
 		return k.SetArgFloat64(index, val)
 	case *MemObject:
+		if k.isImageArg(index) {
+			return k.SetArgImage(index, val)
+		}
 		return k.SetArgBuffer(index, val)
+	case *Sampler:
+		return k.SetArgSampler(index, val)
 	case LocalBuffer:
 		return k.SetArgLocal(index, int(val))
 	default:
@@ -122,7 +159,6 @@ func (k *Kernel) SetArg(index int, arg interface{}) error {
 func (k *Kernel) ArgAddressQualifier(index int) (string, error) {
 	var val C.cl_kernel_arg_address_qualifier
 	var err C.cl_int
-	defer C.free(unsafe.Pointer(&err))
 	if err = C.clGetKernelArgInfo(k.clKernel, C.cl_uint(index), C.CL_KERNEL_ARG_ADDRESS_QUALIFIER, C.size_t(unsafe.Sizeof(val)), unsafe.Pointer(&val), nil); err != C.CL_SUCCESS {
 		return "", toError(err)
 	}
@@ -143,7 +179,6 @@ func (k *Kernel) ArgAddressQualifier(index int) (string, error) {
 func (k *Kernel) ArgAccessQualifier(index int) (string, error) {
 	var val C.cl_kernel_arg_access_qualifier
 	var err C.cl_int
-	defer C.free(unsafe.Pointer(&err))
 	if err = C.clGetKernelArgInfo(k.clKernel, C.cl_uint(index), C.CL_KERNEL_ARG_ACCESS_QUALIFIER, C.size_t(unsafe.Sizeof(val)), unsafe.Pointer(&val), nil); err != C.CL_SUCCESS {
 		return "", toError(err)
 	}
@@ -173,7 +208,11 @@ func (k *Kernel) ArgName(index int) (string, error) {
 	if err := C.clGetKernelArgInfo(k.clKernel, C.cl_uint(index), C.CL_KERNEL_ARG_NAME, 1024, unsafe.Pointer(&strC[0]), &strN); err != C.CL_SUCCESS {
 		return "", toError(err)
 	}
-	return string(strC[:strN]), nil
+	if strN == 0 {
+		return "", nil
+	}
+	// Strip the NUL terminator
+	return string(strC[:strN-1]), nil
 }
 
 func (k *Kernel) ArgTypeName(index int) (string, error) {
@@ -182,48 +221,121 @@ func (k *Kernel) ArgTypeName(index int) (string, error) {
 	if err := C.clGetKernelArgInfo(k.clKernel, C.cl_uint(index), C.CL_KERNEL_ARG_TYPE_NAME, 1024, unsafe.Pointer(&strC[0]), &strN); err != C.CL_SUCCESS {
 		return "", toError(err)
 	}
-	return string(strC[:strN]), nil
+	if strN == 0 {
+		return "", nil
+	}
+	// Strip the NUL terminator
+	return string(strC[:strN-1]), nil
 }
 
 func (k *Kernel) SetArgBuffer(index int, buffer *MemObject) error {
+	if err := k.checkArg(index, argMemory); err != nil {
+		return err
+	}
 	return k.SetArgUnsafe(index, int(unsafe.Sizeof(buffer.clMem)), unsafe.Pointer(&buffer.clMem))
 }
 
+func (k *Kernel) SetArgImage(index int, image *MemObject) error {
+	if err := k.checkArg(index, argImage); err != nil {
+		return err
+	}
+	return k.SetArgUnsafe(index, int(unsafe.Sizeof(image.clMem)), unsafe.Pointer(&image.clMem))
+}
+
+func (k *Kernel) SetArgSampler(index int, sampler *Sampler) error {
+	if err := k.checkArg(index, argSampler); err != nil {
+		return err
+	}
+	return k.SetArgUnsafe(index, int(unsafe.Sizeof(sampler.clSampler)), unsafe.Pointer(&sampler.clSampler))
+}
+
 func (k *Kernel) SetArgFloat32(index int, val float32) error {
+	if err := k.checkArg(index, argFloat32); err != nil {
+		return err
+	}
 	return k.SetArgUnsafe(index, int(unsafe.Sizeof(val)), unsafe.Pointer(&val))
 }
 
 func (k *Kernel) SetArgFloat64(index int, val float64) error {
+	if err := k.checkArg(index, argFloat64); err != nil {
+		return err
+	}
+	return k.SetArgUnsafe(index, int(unsafe.Sizeof(val)), unsafe.Pointer(&val))
+}
+
+func (k *Kernel) SetArgHalf(index int, val Half) error {
+	if err := k.checkArg(index, argHalf); err != nil {
+		return err
+	}
 	return k.SetArgUnsafe(index, int(unsafe.Sizeof(val)), unsafe.Pointer(&val))
 }
 
 func (k *Kernel) SetArgInt8(index int, val int8) error {
+	if err := k.checkArg(index, argInt8); err != nil {
+		return err
+	}
 	return k.SetArgUnsafe(index, int(unsafe.Sizeof(val)), unsafe.Pointer(&val))
 }
 
 func (k *Kernel) SetArgUint8(index int, val uint8) error {
+	if err := k.checkArg(index, argUint8); err != nil {
+		return err
+	}
+	return k.SetArgUnsafe(index, int(unsafe.Sizeof(val)), unsafe.Pointer(&val))
+}
+
+func (k *Kernel) SetArgInt16(index int, val int16) error {
+	if err := k.checkArg(index, argInt16); err != nil {
+		return err
+	}
+	return k.SetArgUnsafe(index, int(unsafe.Sizeof(val)), unsafe.Pointer(&val))
+}
+
+func (k *Kernel) SetArgUint16(index int, val uint16) error {
+	if err := k.checkArg(index, argUint16); err != nil {
+		return err
+	}
 	return k.SetArgUnsafe(index, int(unsafe.Sizeof(val)), unsafe.Pointer(&val))
 }
 
 func (k *Kernel) SetArgInt32(index int, val int32) error {
+	if err := k.checkArg(index, argInt32); err != nil {
+		return err
+	}
 	return k.SetArgUnsafe(index, int(unsafe.Sizeof(val)), unsafe.Pointer(&val))
 }
 
 func (k *Kernel) SetArgUint32(index int, val uint32) error {
+	if err := k.checkArg(index, argUint32); err != nil {
+		return err
+	}
+	return k.SetArgUnsafe(index, int(unsafe.Sizeof(val)), unsafe.Pointer(&val))
+}
+
+func (k *Kernel) SetArgInt64(index int, val int64) error {
+	if err := k.checkArg(index, argInt64); err != nil {
+		return err
+	}
 	return k.SetArgUnsafe(index, int(unsafe.Sizeof(val)), unsafe.Pointer(&val))
 }
 
 func (k *Kernel) SetArgUint64(index int, val uint64) error {
+	if err := k.checkArg(index, argUint64); err != nil {
+		return err
+	}
 	return k.SetArgUnsafe(index, int(unsafe.Sizeof(val)), unsafe.Pointer(&val))
 }
 
 func (k *Kernel) SetArgLocal(index int, size int) error {
+	if err := k.checkArg(index, argLocal); err != nil {
+		return err
+	}
 	return k.SetArgUnsafe(index, size, nil)
 }
 
 func (k *Kernel) SetArgUnsafe(index, argSize int, arg unsafe.Pointer) error {
 	//fmt.Println("FUNKY: ", index, argSize)
-	return toError(C.clSetKernelArg(k.clKernel, C.cl_uint(index), C.size_t(argSize), arg))
+	return argError(C.clSetKernelArg(k.clKernel, C.cl_uint(index), C.size_t(argSize), arg), k, index, argSize)
 }
 
 func (k *Kernel) GlobalWorkGroupSize(device *Device) ([3]int, error) {
@@ -279,16 +391,31 @@ func (k *Kernel) ReferenceCount() (int, error) {
 	return int(num), toError(err)
 }
 
+func (k *Kernel) getInfoString(param C.cl_kernel_info) (string, error) {
+	var strN C.size_t
+	if err := C.clGetKernelInfo(k.clKernel, param, 0, nil, &strN); err != C.CL_SUCCESS {
+		return "", toError(err)
+	}
+	if strN == 0 {
+		return "", nil
+	}
+	name := make([]byte, strN)
+	if err := C.clGetKernelInfo(k.clKernel, param, strN, unsafe.Pointer(&name[0]), nil); err != C.CL_SUCCESS {
+		return "", toError(err)
+	}
+	// Strip the NUL terminator
+	return string(name[:strN-1]), nil
+}
+
 func (k *Kernel) FunctionName() (string, error) {
-	var name C.char
-	err := C.clGetKernelInfo(k.clKernel, C.CL_KERNEL_FUNCTION_NAME, C.size_t(unsafe.Sizeof(name)), unsafe.Pointer(&name), nil)
-	return C.GoString(&name), toError(err)
+	if k.name != "" {
+		return k.name, nil
+	}
+	return k.getInfoString(C.CL_KERNEL_FUNCTION_NAME)
 }
 
 func (k *Kernel) Attributes() (string, error) {
-	var name C.char
-	err := C.clGetKernelInfo(k.clKernel, C.CL_KERNEL_ATTRIBUTES, C.size_t(unsafe.Sizeof(name)), unsafe.Pointer(&name), nil)
-	return C.GoString(&name), toError(err)
+	return k.getInfoString(C.CL_KERNEL_ATTRIBUTES)
 }
 
 func (k *Kernel) Context() (*Context, error) {
@@ -335,8 +462,8 @@ func (q *CommandQueue) EnqueueNDRangeKernel(kernel *Kernel, globalWorkOffset, gl
 	}
 	var event C.cl_event
 	eventWaitListPtr, WaitListLen := eventListPtr(eventWaitList)
-	err := toError(C.clEnqueueNDRangeKernel(q.clQueue, kernel.clKernel, C.cl_uint(workDim), globalWorkOffsetPtr, globalWorkSizePtr, localWorkSizePtr, C.cl_uint(WaitListLen), eventWaitListPtr, &event))
-	return newEvent(event), err
+	err := kernelError("clEnqueueNDRangeKernel", C.clEnqueueNDRangeKernel(q.clQueue, kernel.clKernel, C.cl_uint(workDim), globalWorkOffsetPtr, globalWorkSizePtr, localWorkSizePtr, C.cl_uint(WaitListLen), eventWaitListPtr, &event), kernel, globalWorkSize, localWorkSize)
+	return q.recordedKernel(newEvent(event), err, CommandNDRangeKernel, kernel)
 }
 
 // Enqueues a command to execute a kernel on a device, except with globalWorkSize = localWorkSize = 1
@@ -344,20 +471,33 @@ func (q *CommandQueue) EnqueueNDRangeKernel(kernel *Kernel, globalWorkOffset, gl
 func (q *CommandQueue) EnqueueTask(kernel *Kernel, eventWaitList []*Event) (*Event, error) {
 	var event C.cl_event
 	eventWaitListPtr, WaitListLen := eventListPtr(eventWaitList)
-	err := toError(C.clEnqueueTask(q.clQueue, kernel.clKernel, C.cl_uint(WaitListLen), eventWaitListPtr, &event))
-	return newEvent(event), err
+	err := kernelError("clEnqueueTask", C.clEnqueueTask(q.clQueue, kernel.clKernel, C.cl_uint(WaitListLen), eventWaitListPtr, &event), kernel, nil, nil)
+	return q.recordedKernel(newEvent(event), err, CommandTask, kernel)
 }
 
 // Enqueues a native user function for execution on on a device. Need CL_EXEC_NATIVE_KERNEL capability to be present.
-func (q *CommandQueue) EnqueueNativeKernel(user_args unsafe.Pointer, num_user_args int, memObjects []*MemObject, ptr_memobj_in_args []unsafe.Pointer, eventWaitList []*Event) (*Event, error) {
+// fn is called once, on a thread of the OpenCL runtime, with the host pointers of memObjects.
+func (q *CommandQueue) EnqueueNativeKernel(fn CL_go_native_kernel, memObjects []*MemObject, eventWaitList []*Event) (*Event, error) {
+	if fn == nil {
+		return nil, ErrInvalidValue
+	}
 	var event C.cl_event
+	var memListPtr *C.cl_mem
 	UserMemObjs := make([]C.cl_mem, len(memObjects))
 	for i, mb := range memObjects {
 		UserMemObjs[i] = mb.clMem
 	}
+	if len(UserMemObjs) > 0 {
+		memListPtr = &UserMemObjs[0]
+	}
+	handle := callbacks.register(nativeKernel{fn: fn, numMemObjects: len(memObjects)})
 	eventWaitListPtr, WaitListLen := eventListPtr(eventWaitList)
-	err := toError(C.CLEnqueueNativeKernel(q.clQueue, user_args, C.size_t(num_user_args), C.cl_uint(len(memObjects)), &UserMemObjs[0], &ptr_memobj_in_args[0], C.cl_uint(WaitListLen), eventWaitListPtr, &event))
-	return newEvent(event), err
+	err := C.CLEnqueueNativeKernel(q.clQueue, C.uintptr_t(handle), C.cl_uint(len(memObjects)), memListPtr, C.cl_uint(WaitListLen), eventWaitListPtr, &event)
+	if err != C.CL_SUCCESS {
+		callbacks.unregister(handle)
+		return nil, toError(err)
+	}
+	return newEvent(event), nil
 }
 
 func (p *Program) CreateKernelsInProgram() ([]*Kernel, error) {
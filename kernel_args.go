@@ -0,0 +1,305 @@
+package go2opencl
+
+/*
+#include "./opencl.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Kernel signatures are read from the argument information of the program,
+// which is kept when it is built with -cl-kernel-arg-info, as BuildProgram
+// and BuildOptions do by default. In checked mode, the SetArg methods compare
+// the Go type of each argument with its parameter, so that a mismatch is
+// reported with the parameter rather than as an ErrInvalidArgSize, or not at
+// all when the sizes agree. SetArgByName and Bind set arguments by the names
+// of their parameters, so that they do not depend on the order of the
+// parameters.
+
+// ////////////// Basic Types ////////////////
+type ErrArgumentTypeMismatch struct {
+	Kernel string
+	Index  int
+	Arg    KernelArg
+	GoType string // The Go type the argument was set from.
+}
+
+func (e ErrArgumentTypeMismatch) Error() string {
+	return fmt.Sprintf("cl: kernel %s: argument %d (%s) cannot be set from %s", e.Kernel, e.Index, e.Arg, e.GoType)
+}
+
+type ErrUnknownArgumentName struct {
+	Kernel string
+	Name   string
+}
+
+func (e ErrUnknownArgumentName) Error() string {
+	return fmt.Sprintf("cl: kernel %s has no argument named %q", e.Kernel, e.Name)
+}
+
+// ////////////// Abstract Types ////////////////
+// A parameter of a kernel.
+type KernelArg struct {
+	Name             string
+	TypeName         string // Type without qualifiers, such as "float*" or "uint4".
+	AddressQualifier string // As returned by ArgAddressQualifier, such as "Global".
+	AccessQualifier  string // As returned by ArgAccessQualifier, "None" if not an image.
+	Const            bool
+	Restrict         bool
+	Volatile         bool
+}
+
+// ////////////// Basic Functions ////////////////
+// The kinds of arguments the SetArg methods set.
+type argKind int
+
+const (
+	argInt8 argKind = iota
+	argUint8
+	argInt16
+	argUint16
+	argInt32
+	argUint32
+	argInt64
+	argUint64
+	argFloat32
+	argFloat64
+	argHalf
+	argMemory
+	argImage
+	argSampler
+	argLocal
+)
+
+var argKinds = map[argKind]struct {
+	goType string
+	clType string // The scalar type of OpenCL C, empty if not a scalar.
+}{
+	argInt8:    {"int8", "char"},
+	argUint8:   {"uint8", "uchar"},
+	argInt16:   {"int16", "short"},
+	argUint16:  {"uint16", "ushort"},
+	argInt32:   {"int32", "int"},
+	argUint32:  {"uint32", "uint"},
+	argInt64:   {"int64", "long"},
+	argUint64:  {"uint64", "ulong"},
+	argFloat32: {"float32", "float"},
+	argFloat64: {"float64", "double"},
+	argHalf:    {"Half", "half"},
+	argMemory:  {"*MemObject", ""},
+	argImage:   {"*MemObject", ""},
+	argSampler: {"*Sampler", ""},
+	argLocal:   {"LocalBuffer", ""},
+}
+
+var builtinScalarTypes = map[string]bool{
+	"bool": true, "char": true, "uchar": true, "short": true, "ushort": true,
+	"int": true, "uint": true, "long": true, "ulong": true,
+	"float": true, "double": true, "half": true,
+	"size_t": true, "ptrdiff_t": true, "intptr_t": true, "uintptr_t": true,
+}
+
+// Reports whether t is a built-in type of OpenCL C, rather than a typedef
+// or a struct whose size is unknown.
+func isBuiltinType(t string) bool {
+	if builtinScalarTypes[t] || t == "sampler_t" || t == "event_t" || isImageType(t) {
+		return true
+	}
+	for _, n := range []string{"16", "2", "3", "4", "8"} {
+		if strings.HasSuffix(t, n) && builtinScalarTypes[strings.TrimSuffix(t, n)] {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether t is an image type, such as image2d_t or image1d_buffer_t.
+func isImageType(t string) bool {
+	return strings.HasPrefix(t, "image")
+}
+
+// Reports whether an argument of kind may be passed to arg. Scalars of
+// unknown types, such as typedefs, are accepted.
+func (kind argKind) accepts(arg KernelArg) bool {
+	switch kind {
+	case argMemory:
+		return (arg.AddressQualifier == "Global" || arg.AddressQualifier == "Constant") && !isImageType(arg.TypeName)
+	case argImage:
+		return isImageType(arg.TypeName)
+	case argLocal:
+		return arg.AddressQualifier == "Local"
+	case argSampler:
+		return arg.TypeName == "sampler_t"
+	}
+	if arg.AddressQualifier != "Private" || strings.HasSuffix(arg.TypeName, "*") {
+		return false
+	}
+	return arg.TypeName == argKinds[kind].clType || !isBuiltinType(arg.TypeName)
+}
+
+// Returns the declaration of arg in OpenCL C.
+func (arg KernelArg) String() string {
+	var decl []string
+	switch arg.AccessQualifier {
+	case "ReadOnly":
+		decl = append(decl, "__read_only")
+	case "WriteOnly":
+		decl = append(decl, "__write_only")
+	case "ReadWrite":
+		decl = append(decl, "__read_write")
+	}
+	if arg.AddressQualifier != "Private" && arg.AddressQualifier != "" {
+		decl = append(decl, "__"+strings.ToLower(arg.AddressQualifier))
+	}
+	if arg.Const {
+		decl = append(decl, "const")
+	}
+	if arg.Volatile {
+		decl = append(decl, "volatile")
+	}
+	decl = append(decl, arg.TypeName)
+	if arg.Restrict {
+		decl = append(decl, "restrict")
+	}
+	if arg.Name != "" {
+		decl = append(decl, arg.Name)
+	}
+	return strings.Join(decl, " ")
+}
+
+// ////////////// Abstract Functions ////////////////
+// Returns the parameters of k. They are queried once and cached, and fail
+// with ErrKernelArgInfoNotAvailable if the program was built without
+// -cl-kernel-arg-info.
+func (k *Kernel) Signature() ([]KernelArg, error) {
+	if k.signature != nil {
+		return k.signature, nil
+	}
+	n, err := k.NumArgs()
+	if err != nil {
+		return nil, err
+	}
+	signature := make([]KernelArg, n)
+	for i := range signature {
+		arg := &signature[i]
+		if arg.Name, err = k.ArgName(i); err != nil {
+			return nil, err
+		}
+		if arg.TypeName, err = k.ArgTypeName(i); err != nil {
+			return nil, err
+		}
+		if arg.AddressQualifier, err = k.ArgAddressQualifier(i); err != nil {
+			return nil, err
+		}
+		if arg.AccessQualifier, err = k.ArgAccessQualifier(i); err != nil {
+			return nil, err
+		}
+		qualifier, err := k.ArgTypeQualifier(i)
+		if err != nil {
+			return nil, err
+		}
+		arg.Const = qualifier&C.CL_KERNEL_ARG_TYPE_CONST != 0
+		arg.Restrict = qualifier&C.CL_KERNEL_ARG_TYPE_RESTRICT != 0
+		arg.Volatile = qualifier&C.CL_KERNEL_ARG_TYPE_VOLATILE != 0
+	}
+	k.signature = signature
+	return signature, nil
+}
+
+// Turns the checked mode of k on or off. In checked mode the typed SetArg
+// methods, and SetArg and SetArgs through them, fail with an
+// ErrArgumentTypeMismatch if the Go type of an argument does not match its
+// parameter. SetArgUnsafe is never checked. Turning it on queries the
+// signature of k, and fails if it is not available.
+func (k *Kernel) SetArgChecking(checked bool) error {
+	if checked {
+		if _, err := k.Signature(); err != nil {
+			return err
+		}
+	}
+	k.checked = checked
+	return nil
+}
+
+// Returns an error if k is in checked mode and an argument of kind may not be
+// passed to parameter index. Invalid indices are left to the driver.
+func (k *Kernel) checkArg(index int, kind argKind) error {
+	if !k.checked || index < 0 || index >= len(k.signature) {
+		return nil
+	}
+	arg := k.signature[index]
+	if kind.accepts(arg) {
+		return nil
+	}
+	name, _ := k.FunctionName()
+	return ErrArgumentTypeMismatch{Kernel: name, Index: index, Arg: arg, GoType: argKinds[kind].goType}
+}
+
+// Reports whether k is in checked mode and parameter index is an image, so
+// that SetArg sets memory objects passed to it as images.
+func (k *Kernel) isImageArg(index int) bool {
+	return k.checked && index >= 0 && index < len(k.signature) && isImageType(k.signature[index].TypeName)
+}
+
+// Returns the index of the parameter of k named name.
+func (k *Kernel) ArgIndex(name string) (int, error) {
+	signature, err := k.Signature()
+	if err != nil {
+		return -1, err
+	}
+	for i, arg := range signature {
+		if arg.Name == name {
+			return i, nil
+		}
+	}
+	kernelName, _ := k.FunctionName()
+	return -1, ErrUnknownArgumentName{Kernel: kernelName, Name: name}
+}
+
+// Sets the argument of the parameter of k named name, as SetArg does.
+func (k *Kernel) SetArgByName(name string, arg interface{}) error {
+	index, err := k.ArgIndex(name)
+	if err != nil {
+		return err
+	}
+	return k.SetArg(index, arg)
+}
+
+// Sets the arguments of k from the fields of args, a struct or a pointer to
+// a struct, tagged with the names of their parameters, such as
+//
+//	kernel.Bind(struct {
+//		Input *MemObject `cl:"input"`
+//		Count uint32     `cl:"count"`
+//	}{input, uint32(n)})
+//
+// Fields without a cl tag, or tagged "-", are skipped. An error of SetArgByName
+// is wrapped with the field, and errors.Is and errors.As see through it.
+func (k *Kernel) Bind(args interface{}) error {
+	v := reflect.ValueOf(args)
+	if v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("cl: Bind needs a struct, not %T", args)
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("cl")
+		if name == "" || name == "-" {
+			continue
+		}
+		if field.PkgPath != "" {
+			return fmt.Errorf("cl: Bind: field %s of %s is unexported", field.Name, t)
+		}
+		if err := k.SetArgByName(name, v.Field(i).Interface()); err != nil {
+			return fmt.Errorf("cl: Bind: field %s (%q): %w", field.Name, name, err)
+		}
+	}
+	return nil
+}
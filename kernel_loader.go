@@ -0,0 +1,225 @@
+package go2opencl
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Loading of kernel sources from a file system, such as an embed.FS. The
+// #include "name" directives of the files are resolved against the
+// directory of the including file, then against the include directories of
+// the loader. Angle bracket includes are left to the compiler.
+//
+// Load expands the includes into the sources, for CreateProgramWithSource.
+// Every file is expanded at most once per program, as if it started with
+// #pragma once, and #line directives keep the positions reported by the
+// compiler those of the files. ProgramHeaders instead creates a program per
+// included file, for separate compilation with CompileProgram.
+
+// ////////////// Abstract Types ////////////////
+type KernelLoader struct {
+	FS          fs.FS
+	IncludeDirs []string // Searched in order, as slash separated paths of FS.
+}
+
+// ////////////// Basic Functions ////////////////
+var (
+	includeDirective = regexp.MustCompile(`^\s*#\s*include\s*"([^"]+)"`)
+	pragmaOnce       = regexp.MustCompile(`^\s*#\s*pragma\s+once\b`)
+)
+
+func NewKernelLoader(fsys fs.FS, includeDirs ...string) *KernelLoader {
+	return &KernelLoader{FS: fsys, IncludeDirs: includeDirs}
+}
+
+// Quotes file for a #line directive.
+func lineFileName(file string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(file) + `"`
+}
+
+// Returns the lines of text, each with its newline.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Returns the path of the file included as name by the file includer.
+func (l *KernelLoader) resolve(includer string, line int, name string) (string, error) {
+	candidates := []string{path.Join(path.Dir(includer), name)}
+	for _, dir := range l.IncludeDirs {
+		candidates = append(candidates, path.Join(dir, name))
+	}
+	for _, c := range candidates {
+		if info, err := fs.Stat(l.FS, c); err == nil && !info.IsDir() {
+			return c, nil
+		}
+	}
+	return "", fmt.Errorf("%s:%d: cannot find included file %q: %w", includer, line, name, fs.ErrNotExist)
+}
+
+// Appends file to b with its includes expanded. seen holds the files already
+// expanded.
+func (l *KernelLoader) expand(b *strings.Builder, file string, seen map[string]bool) error {
+	seen[file] = true
+	src, err := fs.ReadFile(l.FS, file)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(b, "#line 1 %s\n", lineFileName(file))
+	for i, line := range splitLines(string(src)) {
+		if pragmaOnce.MatchString(line) {
+			b.WriteString("\n")
+			continue
+		}
+		m := includeDirective.FindStringSubmatch(line)
+		if m == nil {
+			b.WriteString(line)
+			continue
+		}
+		included, err := l.resolve(file, i+1, m[1])
+		if err != nil {
+			return err
+		}
+		if seen[included] {
+			b.WriteString("\n")
+			continue
+		}
+		if err := l.expand(b, included, seen); err != nil {
+			return err
+		}
+		fmt.Fprintf(b, "#line %d %s\n", i+2, lineFileName(file))
+	}
+	if !strings.HasSuffix(b.String(), "\n") {
+		b.WriteString("\n")
+	}
+	return nil
+}
+
+// Adds the files included by file, directly or not, to headers, by the name
+// they are included with.
+func (l *KernelLoader) collectHeaders(file string, headers map[string]string) error {
+	src, err := fs.ReadFile(l.FS, file)
+	if err != nil {
+		return err
+	}
+	for i, line := range splitLines(string(src)) {
+		m := includeDirective.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		included, err := l.resolve(file, i+1, m[1])
+		if err != nil {
+			return err
+		}
+		if prev, ok := headers[m[1]]; ok {
+			if prev != included {
+				return fmt.Errorf("%s:%d: %q includes %s, but also %s elsewhere", file, i+1, m[1], included, prev)
+			}
+			continue
+		}
+		headers[m[1]] = included
+		if err := l.collectHeaders(included, headers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ////////////// Abstract Functions ////////////////
+// Returns the files names with their includes expanded, in the order of
+// names. The strings are meant to be passed together to
+// CreateProgramWithSource, so a file included by several of them is only
+// expanded in the first. A name expanded by an earlier one is left with only
+// its #line marker.
+func (l *KernelLoader) Load(names ...string) ([]string, error) {
+	seen := make(map[string]bool)
+	sources := make([]string, len(names))
+	for i, name := range names {
+		if seen[name] {
+			sources[i] = fmt.Sprintf("#line 1 %s\n", lineFileName(name))
+			continue
+		}
+		var b strings.Builder
+		if err := l.expand(&b, name, seen); err != nil {
+			return nil, err
+		}
+		sources[i] = b.String()
+	}
+	return sources, nil
+}
+
+// Creates a program in ctx from the files names, with their includes expanded.
+func (l *KernelLoader) CreateProgram(ctx *Context, names ...string) (*Program, error) {
+	sources, err := l.Load(names...)
+	if err != nil {
+		return nil, err
+	}
+	return ctx.CreateProgramWithSource(sources)
+}
+
+// Returns a header program in ctx for every file included by name, directly
+// or not, named as it is included, so that name can be compiled with
+// CompileProgram without expanding its includes. The files must not include
+// different files by the same name.
+func (l *KernelLoader) ProgramHeaders(ctx *Context, name string) ([]*ProgramHeaders, error) {
+	files := make(map[string]string)
+	if err := l.collectHeaders(name, files); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(files))
+	for includeName := range files {
+		names = append(names, includeName)
+	}
+	sort.Strings(names)
+	headers := make([]*ProgramHeaders, 0, len(files))
+	for _, includeName := range names {
+		src, err := fs.ReadFile(l.FS, files[includeName])
+		if err == nil {
+			var program *Program
+			if program, err = ctx.CreateProgramWithSource([]string{string(src)}); err == nil {
+				headers = append(headers, NewProgramHeaders(program, includeName))
+				continue
+			}
+		}
+		for _, h := range headers {
+			h.codes.Release()
+		}
+		return nil, err
+	}
+	return headers, nil
+}
+
+// Creates a program in ctx from the file name and compiles it with options,
+// which may be nil, and the headers it includes.
+func (l *KernelLoader) CompileProgram(ctx *Context, name string, options *BuildOptions) (*Program, error) {
+	src, err := fs.ReadFile(l.FS, name)
+	if err != nil {
+		return nil, err
+	}
+	headers, err := l.ProgramHeaders(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for _, h := range headers {
+			h.codes.Release()
+		}
+	}()
+	program, err := ctx.CreateProgramWithSource([]string{string(src)})
+	if err != nil {
+		return nil, err
+	}
+	if err := program.CompileProgramWithOptions(nil, options, headers, nil); err != nil {
+		program.Release()
+		return nil, err
+	}
+	return program, nil
+}
@@ -0,0 +1,94 @@
+package go2opencl
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var kernelFS = fstest.MapFS{
+	"kernels/fft.cl":         {Data: []byte("#include \"common.h\"\n#include \"math/twiddle.h\"\n__kernel void fft(void) {}\n")},
+	"kernels/common.h":       {Data: []byte("#pragma once\n#define N 64\n")},
+	"include/math/twiddle.h": {Data: []byte("#include \"common.h\"\nfloat twiddle(int k);")},
+	"include/common.h":       {Data: []byte("#define M 8\n")},
+	"kernels/missing.cl":     {Data: []byte("\n#include \"nope.h\"\n")},
+}
+
+func TestKernelLoader(t *testing.T) {
+	loader := NewKernelLoader(kernelFS, "include")
+	sources, err := loader.Load("kernels/fft.cl", "kernels/common.h")
+	if err != nil {
+		t.Fatalf("Load failed: %+v", err)
+	}
+	want := "#line 1 \"kernels/fft.cl\"\n" +
+		"#line 1 \"kernels/common.h\"\n" +
+		"\n" +
+		"#define N 64\n" +
+		"#line 2 \"kernels/fft.cl\"\n" +
+		"#line 1 \"include/math/twiddle.h\"\n" +
+		"#line 1 \"include/common.h\"\n" +
+		"#define M 8\n" +
+		"#line 2 \"include/math/twiddle.h\"\n" +
+		"float twiddle(int k);\n" +
+		"#line 3 \"kernels/fft.cl\"\n" +
+		"__kernel void fft(void) {}\n"
+	if len(sources) != 2 || sources[0] != want {
+		t.Fatalf("Load returned\n%q\nwant\n%q", sources, want)
+	}
+	// common.h was expanded in fft.cl
+	if sources[1] != "#line 1 \"kernels/common.h\"\n" {
+		t.Errorf("Load returned %q for the second file", sources[1])
+	}
+	sources, err = loader.Load("kernels/common.h", "kernels/fft.cl")
+	if err != nil {
+		t.Fatalf("Load failed: %+v", err)
+	}
+	if len(sources) != 2 || sources[0] != "#line 1 \"kernels/common.h\"\n\n#define N 64\n" || strings.Contains(sources[1], "#define N") {
+		t.Errorf("Load returned %q, want common.h expanded only in the first file", sources)
+	}
+	if _, err := loader.Load("kernels/missing.cl"); !errors.Is(err, fs.ErrNotExist) || err.Error() != `kernels/missing.cl:2: cannot find included file "nope.h": file does not exist` {
+		t.Errorf("Load returned %v for a missing include", err)
+	}
+}
+
+func TestSimKernelLoaderCompile(t *testing.T) {
+	device := simDevice(t)
+	context, err := CreateContext([]*Device{device})
+	if err != nil {
+		t.Fatalf("CreateContext failed: %+v", err)
+	}
+	defer context.Release()
+	loader := NewKernelLoader(kernelFS, "include")
+
+	// common.h is included as common.h by both fft.cl and twiddle.h, but
+	// resolves to different files
+	if _, err := loader.ProgramHeaders(context, "kernels/fft.cl"); err == nil {
+		t.Error("ProgramHeaders accepted two files included by the same name")
+	}
+	headers, err := loader.ProgramHeaders(context, "include/math/twiddle.h")
+	if err != nil {
+		t.Fatalf("ProgramHeaders failed: %+v", err)
+	}
+	if len(headers) != 1 || headers[0].names != "common.h" {
+		t.Errorf("ProgramHeaders returned %+v", headers)
+	}
+	for _, h := range headers {
+		h.codes.Release()
+	}
+	compiled, err := loader.CompileProgram(context, "include/math/twiddle.h", &BuildOptions{Std: "CL2.0"})
+	if err != nil {
+		t.Fatalf("CompileProgram failed: %+v", err)
+	}
+	compiled.Release()
+
+	program, err := loader.CreateProgram(context, "kernels/fft.cl")
+	if err != nil {
+		t.Fatalf("CreateProgram failed: %+v", err)
+	}
+	defer program.Release()
+	if err := program.BuildProgram(nil, ""); err != nil {
+		t.Fatalf("BuildProgram failed: %+v", err)
+	}
+}
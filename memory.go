@@ -3,13 +3,13 @@ package go2opencl
 /*
 #include "./opencl.h"
 
-extern void go_set_memdestructor_callback(cl_mem memobj, void *user_args);
+extern void go_set_memdestructor_callback(cl_mem memobj, uintptr_t handle);
 static void CL_CALLBACK c_set_memdestructor_callback(cl_mem memobj, void *user_args) {
-        go_set_memdestructor_callback((cl_mem) memobj, (void *)user_args);
+        go_set_memdestructor_callback((cl_mem) memobj, (uintptr_t)user_args);
 }
 static cl_int CLSetMemObjectDestructorCallback(      cl_mem         memobj,
-                                       void *         user_args) {
-        return clSetMemObjectDestructorCallback(memobj, c_set_memdestructor_callback, user_args);
+                                       uintptr_t      handle) {
+        return clSetMemObjectDestructorCallback(memobj, c_set_memdestructor_callback, (void *)handle);
 }
 static cl_mem CLcreateSubBuffer(	cl_mem		memobj,
 					cl_mem_flags	flags,
@@ -104,9 +104,38 @@ const (
 type MemObjectType int
 
 const (
-	MemObjectTypeBuffer MemObjectType = C.CL_MEM_OBJECT_BUFFER
+	MemObjectTypeBuffer        MemObjectType = C.CL_MEM_OBJECT_BUFFER
+	MemObjectTypeImage1D       MemObjectType = C.CL_MEM_OBJECT_IMAGE1D
+	MemObjectTypeImage1DBuffer MemObjectType = C.CL_MEM_OBJECT_IMAGE1D_BUFFER
+	MemObjectTypeImage1DArray  MemObjectType = C.CL_MEM_OBJECT_IMAGE1D_ARRAY
+	MemObjectTypeImage2D       MemObjectType = C.CL_MEM_OBJECT_IMAGE2D
+	MemObjectTypeImage2DArray  MemObjectType = C.CL_MEM_OBJECT_IMAGE2D_ARRAY
+	MemObjectTypeImage3D       MemObjectType = C.CL_MEM_OBJECT_IMAGE3D
 )
 
+var memObjectTypeMap = map[MemObjectType]string{
+	MemObjectTypeBuffer:        "Buffer",
+	MemObjectTypeImage1D:       "Image1D",
+	MemObjectTypeImage1DBuffer: "Image1DBuffer",
+	MemObjectTypeImage1DArray:  "Image1DArray",
+	MemObjectTypeImage2D:       "Image2D",
+	MemObjectTypeImage2DArray:  "Image2DArray",
+	MemObjectTypeImage3D:       "Image3D",
+}
+
+func (t MemObjectType) String() string {
+	name := memObjectTypeMap[t]
+	if name == "" {
+		name = "Unknown"
+	}
+	return name
+}
+
+// Reports whether the memory object type is one of the image types.
+func (t MemObjectType) IsImage() bool {
+	return t != MemObjectTypeBuffer && memObjectTypeMap[t] != ""
+}
+
 type MapFlag int
 
 const (
@@ -133,6 +162,18 @@ type MappedMemObject struct {
 	slicePitch int
 }
 
+// Returned when a transfer would access bytes outside of a buffer, or
+// when a host slice is empty.
+type ErrBufferRange struct {
+	Offset     int
+	Size       int
+	BufferSize int
+}
+
+func (e ErrBufferRange) Error() string {
+	return fmt.Sprintf("cl: range [%d, %d) is invalid for buffer of %d bytes", e.Offset, e.Offset+e.Size, e.BufferSize)
+}
+
 //////////////// Abstract Types ////////////////
 type MemObject struct {
 	clMem C.cl_mem
@@ -140,16 +181,15 @@ type MemObject struct {
 }
 
 ////////////////// Supporting Types ////////////////
-type CL_go_set_memdestructor_callback func(memObj C.cl_mem, user_data unsafe.Pointer)
-
-var go_set_memdestructor_callback_func map[unsafe.Pointer]CL_go_set_memdestructor_callback
+// Called once the memory object has been deleted by the OpenCL runtime.
+type CL_go_set_memdestructor_callback func()
 
 //////////////// Basic Functions ///////////////
 //export go_set_memdestructor_callback
-func go_set_memdestructor_callback(memObj C.cl_mem, user_data unsafe.Pointer) {
-	var c_user_data []unsafe.Pointer
-	c_user_data = *(*[]unsafe.Pointer)(user_data)
-	go_set_memdestructor_callback_func[c_user_data[1]](memObj, c_user_data[0])
+func go_set_memdestructor_callback(memObj C.cl_mem, handle C.uintptr_t) {
+	if fn, ok := callbacks.take(uintptr(handle)).(CL_go_set_memdestructor_callback); ok {
+		fn()
+	}
 }
 
 func retainMemObject(b *MemObject) {
@@ -165,6 +205,18 @@ func releaseMemObject(b *MemObject) {
 	}
 }
 
+// Checks that the byte range [offset, offset+size) lies within the buffer. Memory
+// objects of unknown size (0) are only checked for a valid range.
+func (b *MemObject) checkRange(offset, size int) error {
+	if b == nil || b.clMem == nil {
+		return toError(C.CL_INVALID_MEM_OBJECT)
+	}
+	if offset < 0 || size <= 0 || (b.size > 0 && offset+size > b.size) {
+		return ErrBufferRange{Offset: offset, Size: size, BufferSize: b.size}
+	}
+	return nil
+}
+
 func newMemObject(mo C.cl_mem, size int) *MemObject {
 	memObject := &MemObject{clMem: mo, size: size}
 	runtime.SetFinalizer(memObject, releaseMemObject)
@@ -218,12 +270,7 @@ func (b *MemObject) GetType() (string, error) {
 		if toError(err) != nil {
 			return "Unknown", toError(err)
 		}
-		switch {
-		case MemObjectType(tmp) == MemObjectTypeBuffer:
-			return "Buffer", nil
-		default:
-			return "Unknown", nil
-		}
+		return MemObjectType(tmp).String(), nil
 	}
 	return "Unknown", toError(C.CL_INVALID_MEM_OBJECT)
 }
@@ -418,21 +465,34 @@ func (b *MemObject) GetAssociatedMemObject() (*MemObject, error) {
 	return nil, toError(C.CL_INVALID_MEM_OBJECT)
 }
 
-func (b *MemObject) SetMemObjectDestructorCallback(user_data unsafe.Pointer) error {
-	if b.clMem != nil {
-		return toError(C.CLSetMemObjectDestructorCallback(b.clMem, user_data))
+// Registers fn to be called once the memory object is deleted. fn must not
+// refer to b, otherwise b is never finalized and the callback never fires.
+func (b *MemObject) SetMemObjectDestructorCallback(fn CL_go_set_memdestructor_callback) error {
+	if b.clMem == nil {
+		return toError(C.CL_INVALID_MEM_OBJECT)
+	}
+	if fn == nil {
+		return ErrInvalidValue
+	}
+	handle := callbacks.register(fn)
+	if err := C.CLSetMemObjectDestructorCallback(b.clMem, C.uintptr_t(handle)); err != C.CL_SUCCESS {
+		callbacks.unregister(handle)
+		return toError(err)
 	}
-	return toError(C.CL_INVALID_MEM_OBJECT)
+	return nil
 }
 
 // Enqueues a command to map a region of the buffer object given by buffer into the host address space and returns a pointer to this mapped region.
 func (q *CommandQueue) EnqueueMapBuffer(buffer *MemObject, blocking bool, flags MapFlag, offset, size int, eventWaitList []*Event) (*MappedMemObject, *Event, error) {
+	if err := buffer.checkRange(offset, size); err != nil {
+		return nil, nil, err
+	}
 	var event C.cl_event
 	var err C.cl_int
 	eventWaitListPtr, WaitListLen := eventListPtr(eventWaitList)
 	ptr := C.clEnqueueMapBuffer(q.clQueue, buffer.clMem, clBool(blocking), flags.toCl(), C.size_t(offset), C.size_t(size), C.cl_uint(WaitListLen), eventWaitListPtr, &event, &err)
 	if err != C.CL_SUCCESS {
-		return nil, nil, toError(err)
+		return nil, nil, bufferError("clEnqueueMapBuffer", err, size, offset)
 	}
 	ev := newEvent(event)
 	if ptr == nil {
@@ -441,126 +501,150 @@ func (q *CommandQueue) EnqueueMapBuffer(buffer *MemObject, blocking bool, flags
 	return &MappedMemObject{ptr: ptr, size: size}, ev, nil
 }
 
+// Enqueues a command to map a region of an image object into the host address space and returns a pointer to this mapped region.
+// The row and slice pitch of the mapped region are available through the returned MappedMemObject.
+func (q *CommandQueue) EnqueueMapImage(image *MemObject, blocking bool, flags MapFlag, origin, region *Dim3, eventWaitList []*Event) (*MappedMemObject, *Event, error) {
+	elementSize, errInfo := image.getImageInfoSize(C.CL_IMAGE_ELEMENT_SIZE)
+	if errInfo != nil {
+		return nil, nil, errInfo
+	}
+	var event C.cl_event
+	var err C.cl_int
+	var rowPitch, slicePitch C.size_t
+	cOrigin := sizeTDim3(origin)
+	cRegion := sizeTDim3(region)
+	eventWaitListPtr, WaitListLen := eventListPtr(eventWaitList)
+	ptr := C.clEnqueueMapImage(q.clQueue, image.clMem, clBool(blocking), flags.toCl(), &cOrigin[0], &cRegion[0], &rowPitch, &slicePitch, C.cl_uint(WaitListLen), eventWaitListPtr, &event, &err)
+	if err != C.CL_SUCCESS {
+		return nil, nil, regionError("clEnqueueMapImage", err, origin, region, 0)
+	}
+	ev := newEvent(event)
+	if ptr == nil {
+		return nil, ev, ErrUnknown
+	}
+	// Extent of the mapped region: the last row of the last slice is only width pixels long
+	size := int(cRegion[0]) * elementSize
+	if cRegion[1] > 1 {
+		if rowPitch != 0 {
+			size += int(rowPitch) * (int(cRegion[1]) - 1)
+		} else {
+			// 1D image arrays step through the array with the slice pitch
+			size += int(slicePitch) * (int(cRegion[1]) - 1)
+		}
+	}
+	if cRegion[2] > 1 {
+		size += int(slicePitch) * (int(cRegion[2]) - 1)
+	}
+	return &MappedMemObject{ptr: ptr, size: size, rowPitch: int(rowPitch), slicePitch: int(slicePitch)}, ev, nil
+}
+
 // Enqueues a command to unmap a previously mapped region of a memory object.
 func (q *CommandQueue) EnqueueUnmapMemObject(buffer *MemObject, mappedObj *MappedMemObject, eventWaitList []*Event) (*Event, error) {
 	var event C.cl_event
 	eventWaitListPtr, WaitListLen := eventListPtr(eventWaitList)
 	if err := C.clEnqueueUnmapMemObject(q.clQueue, buffer.clMem, mappedObj.ptr, C.cl_uint(WaitListLen), eventWaitListPtr, &event); err != C.CL_SUCCESS {
-		return nil, toError(err)
+		return nil, bufferError("clEnqueueUnmapMemObject", err, mappedObj.size, 0)
 	}
 	return newEvent(event), nil
 }
 
 // Enqueues a command to copy a buffer object to another buffer object.
 func (q *CommandQueue) EnqueueCopyBuffer(srcBuffer, dstBuffer *MemObject, srcOffset, dstOffset, byteCount int, eventWaitList []*Event) (*Event, error) {
+	if err := srcBuffer.checkRange(srcOffset, byteCount); err != nil {
+		return nil, err
+	}
+	if err := dstBuffer.checkRange(dstOffset, byteCount); err != nil {
+		return nil, err
+	}
 	var event C.cl_event
 	eventWaitListPtr, WaitListLen := eventListPtr(eventWaitList)
-	err := toError(C.clEnqueueCopyBuffer(q.clQueue, srcBuffer.clMem, dstBuffer.clMem, C.size_t(srcOffset), C.size_t(dstOffset), C.size_t(byteCount), C.cl_uint(WaitListLen), eventWaitListPtr, &event))
-	return newEvent(event), err
+	err := bufferError("clEnqueueCopyBuffer", C.clEnqueueCopyBuffer(q.clQueue, srcBuffer.clMem, dstBuffer.clMem, C.size_t(srcOffset), C.size_t(dstOffset), C.size_t(byteCount), C.cl_uint(WaitListLen), eventWaitListPtr, &event), byteCount, dstOffset)
+	return q.recorded(newEvent(event), err, CommandCopyBuffer, byteCount)
 }
 
 // Enqueue command to write to a region in buffer object from host memory.
 func (q *CommandQueue) EnqueueCopyBufferRect(dst, src *MemObject, dst_origin, src_origin, region *Dim3, dst_row_pitch, dst_slice_pitch, src_row_pitch, src_slice_pitch int, eventWaitList []*Event) (*Event, error) {
 	var event C.cl_event
 	dst_offset := make([]C.size_t, 3)
-	defer C.free(unsafe.Pointer(&dst_offset))
 	dst_offset[0], dst_offset[1], dst_offset[2] = (C.size_t)(dst_origin.X), (C.size_t)(dst_origin.Y), (C.size_t)(dst_origin.Z)
 	src_offset := make([]C.size_t, 3)
-	defer C.free(unsafe.Pointer(&src_offset))
 	src_offset[0], src_offset[1], src_offset[2] = (C.size_t)(src_origin.X), (C.size_t)(src_origin.Y), (C.size_t)(src_origin.Z)
 	mem_size := make([]C.size_t, 3)
-	defer C.free(unsafe.Pointer(&mem_size))
 	mem_size[0], mem_size[1], mem_size[2] = (C.size_t)(region.X), (C.size_t)(region.Y), (C.size_t)(region.Z)
 	eventWaitListPtr, WaitListLen := eventListPtr(eventWaitList)
-	err := toError(C.clEnqueueCopyBufferRect(q.clQueue, src.clMem, dst.clMem, &src_offset[0], &dst_offset[0], &mem_size[0],
+	err := regionError("clEnqueueCopyBufferRect", C.clEnqueueCopyBufferRect(q.clQueue, src.clMem, dst.clMem, &src_offset[0], &dst_offset[0], &mem_size[0],
 		(C.size_t)(src_row_pitch), (C.size_t)(src_slice_pitch), (C.size_t)(dst_row_pitch), (C.size_t)(dst_slice_pitch),
-		C.cl_uint(WaitListLen), eventWaitListPtr, &event))
-	return newEvent(event), err
+		C.cl_uint(WaitListLen), eventWaitListPtr, &event), dst_origin, region, 0)
+	return q.recorded(newEvent(event), err, CommandCopyBufferRect, region.X*region.Y*region.Z)
 }
 
 // Enqueue commands to write to a buffer object from host memory.
 func (q *CommandQueue) EnqueueWriteBuffer(buffer *MemObject, blocking bool, offset, dataSize int, dataPtr unsafe.Pointer, eventWaitList []*Event) (*Event, error) {
+	if err := buffer.checkRange(offset, dataSize); err != nil {
+		return nil, err
+	}
 	var event C.cl_event
 	eventWaitListPtr, WaitListLen := eventListPtr(eventWaitList)
-	err := toError(C.clEnqueueWriteBuffer(q.clQueue, buffer.clMem, clBool(blocking), C.size_t(offset), C.size_t(dataSize), dataPtr, C.cl_uint(WaitListLen), eventWaitListPtr, &event))
-	return newEvent(event), err
+	err := bufferError("clEnqueueWriteBuffer", C.clEnqueueWriteBuffer(q.clQueue, buffer.clMem, clBool(blocking), C.size_t(offset), C.size_t(dataSize), dataPtr, C.cl_uint(WaitListLen), eventWaitListPtr, &event), dataSize, offset)
+	return q.recorded(newEvent(event), err, CommandWriteBuffer, dataSize)
 }
 
 func (q *CommandQueue) EnqueueWriteBufferByte(buffer *MemObject, blocking bool, offset int, data []byte, eventWaitList []*Event) (*Event, error) {
-	dataPtr := unsafe.Pointer(&data[0])
-	dataSize := int(unsafe.Sizeof(data[0])) * len(data)
-	return q.EnqueueWriteBuffer(buffer, blocking, offset, dataSize, dataPtr, eventWaitList)
-}
-
-func (q *CommandQueue) EnqueueWriteBufferFloat32(buffer *MemObject, blocking bool, offset int, data []float32, eventWaitList []*Event) (*Event, error) {
-	dataPtr := unsafe.Pointer(&data[0])
-	dataSize := int(unsafe.Sizeof(data[0])) * len(data)
-	return q.EnqueueWriteBuffer(buffer, blocking, offset, dataSize, dataPtr, eventWaitList)
+	return q.EnqueueWriteBufferUint8(buffer, blocking, offset, data, eventWaitList)
 }
 
 // Enqueue commands to write to a region in buffer object from host memory.
 func (q *CommandQueue) EnqueueWriteBufferRect(buffer *MemObject, blocking bool, buffer_origin, host_origin, region *Dim3, buffer_row_pitch, buffer_slice_pitch, host_row_pitch, host_slice_pitch int, dataPtr unsafe.Pointer, eventWaitList []*Event) (*Event, error) {
 	var event C.cl_event
 	host_offset := make([]C.size_t, 3)
-	defer C.free(unsafe.Pointer(&host_offset))
 	host_offset[0], host_offset[1], host_offset[2] = (C.size_t)(host_origin.X), (C.size_t)(host_origin.Y), (C.size_t)(host_origin.Z)
 	buffer_offset := make([]C.size_t, 3)
-	defer C.free(unsafe.Pointer(&buffer_offset))
 	buffer_offset[0], buffer_offset[1], buffer_offset[2] = (C.size_t)(buffer_origin.X), (C.size_t)(buffer_origin.Y), (C.size_t)(buffer_origin.Z)
 	mem_size := make([]C.size_t, 3)
-	defer C.free(unsafe.Pointer(&mem_size))
 	mem_size[0], mem_size[1], mem_size[2] = (C.size_t)(region.X), (C.size_t)(region.Y), (C.size_t)(region.Z)
 	eventWaitListPtr, WaitListLen := eventListPtr(eventWaitList)
-	err := toError(C.clEnqueueWriteBufferRect(q.clQueue, buffer.clMem, clBool(blocking), &buffer_offset[0], &host_offset[0], &mem_size[0],
+	err := regionError("clEnqueueWriteBufferRect", C.clEnqueueWriteBufferRect(q.clQueue, buffer.clMem, clBool(blocking), &buffer_offset[0], &host_offset[0], &mem_size[0],
 		(C.size_t)(buffer_row_pitch), (C.size_t)(buffer_slice_pitch), (C.size_t)(host_row_pitch), (C.size_t)(host_slice_pitch),
-		dataPtr, C.cl_uint(WaitListLen), eventWaitListPtr, &event))
-	return newEvent(event), err
+		dataPtr, C.cl_uint(WaitListLen), eventWaitListPtr, &event), buffer_origin, region, 0)
+	return q.recorded(newEvent(event), err, CommandWriteBufferRect, region.X*region.Y*region.Z)
 }
 
 // Enqueue commands to read from a buffer object to host memory.
 func (q *CommandQueue) EnqueueReadBuffer(buffer *MemObject, blocking bool, offset, dataSize int, dataPtr unsafe.Pointer, eventWaitList []*Event) (*Event, error) {
+	if err := buffer.checkRange(offset, dataSize); err != nil {
+		return nil, err
+	}
 	var event C.cl_event
 	eventWaitListPtr, WaitListLen := eventListPtr(eventWaitList)
-	err := toError(C.clEnqueueReadBuffer(q.clQueue, buffer.clMem, clBool(blocking), C.size_t(offset), C.size_t(dataSize), dataPtr, C.cl_uint(WaitListLen), eventWaitListPtr, &event))
-	return newEvent(event), err
+	err := bufferError("clEnqueueReadBuffer", C.clEnqueueReadBuffer(q.clQueue, buffer.clMem, clBool(blocking), C.size_t(offset), C.size_t(dataSize), dataPtr, C.cl_uint(WaitListLen), eventWaitListPtr, &event), dataSize, offset)
+	return q.recorded(newEvent(event), err, CommandReadBuffer, dataSize)
 }
 
 func (q *CommandQueue) EnqueueReadBufferByte(buffer *MemObject, blocking bool, offset int, data []byte, eventWaitList []*Event) (*Event, error) {
-	dataPtr := unsafe.Pointer(&data[0])
-	dataSize := int(unsafe.Sizeof(data[0])) * len(data)
-	return q.EnqueueReadBuffer(buffer, blocking, offset, dataSize, dataPtr, eventWaitList)
-}
-
-func (q *CommandQueue) EnqueueReadBufferFloat32(buffer *MemObject, blocking bool, offset int, data []float32, eventWaitList []*Event) (*Event, error) {
-	dataPtr := unsafe.Pointer(&data[0])
-	dataSize := int(unsafe.Sizeof(data[0])) * len(data)
-	return q.EnqueueReadBuffer(buffer, blocking, offset, dataSize, dataPtr, eventWaitList)
+	return q.EnqueueReadBufferUint8(buffer, blocking, offset, data, eventWaitList)
 }
 
 // Enqueue commands to read from a region in buffer object to host memory.
 func (q *CommandQueue) EnqueueReadBufferRect(buffer *MemObject, blocking bool, buffer_origin, host_origin, region *Dim3, buffer_row_pitch, buffer_slice_pitch, host_row_pitch, host_slice_pitch int, dataPtr unsafe.Pointer, eventWaitList []*Event) (*Event, error) {
 	var event C.cl_event
 	host_offset := make([]C.size_t, 3)
-	defer C.free(unsafe.Pointer(&host_offset))
 	host_offset[0], host_offset[1], host_offset[2] = (C.size_t)(host_origin.X), (C.size_t)(host_origin.Y), (C.size_t)(host_origin.Z)
 	buffer_offset := make([]C.size_t, 3)
-	defer C.free(unsafe.Pointer(&buffer_offset))
 	buffer_offset[0], buffer_offset[1], buffer_offset[2] = (C.size_t)(buffer_origin.X), (C.size_t)(buffer_origin.Y), (C.size_t)(buffer_origin.Z)
 	mem_size := make([]C.size_t, 3)
-	defer C.free(unsafe.Pointer(&mem_size))
 	mem_size[0], mem_size[1], mem_size[2] = (C.size_t)(region.X), (C.size_t)(region.Y), (C.size_t)(region.Z)
 	eventWaitListPtr, WaitListLen := eventListPtr(eventWaitList)
-	err := toError(C.clEnqueueReadBufferRect(q.clQueue, buffer.clMem, clBool(blocking), &buffer_offset[0], &host_offset[0], &mem_size[0],
+	err := regionError("clEnqueueReadBufferRect", C.clEnqueueReadBufferRect(q.clQueue, buffer.clMem, clBool(blocking), &buffer_offset[0], &host_offset[0], &mem_size[0],
 		(C.size_t)(buffer_row_pitch), (C.size_t)(buffer_slice_pitch), (C.size_t)(host_row_pitch), (C.size_t)(host_slice_pitch),
-		dataPtr, C.cl_uint(WaitListLen), eventWaitListPtr, &event))
-	return newEvent(event), err
+		dataPtr, C.cl_uint(WaitListLen), eventWaitListPtr, &event), buffer_origin, region, 0)
+	return q.recorded(newEvent(event), err, CommandReadBufferRect, region.X*region.Y*region.Z)
 }
 
 func (ctx *Context) CreateBufferUnsafe(flags MemFlag, size int, dataPtr unsafe.Pointer) (*MemObject, error) {
 	var err C.cl_int
 	clBuffer := C.clCreateBuffer(ctx.clContext, C.cl_mem_flags(flags), C.size_t(size), dataPtr, &err)
 	if err != C.CL_SUCCESS {
-		return nil, toError(err)
+		return nil, bufferError("clCreateBuffer", err, size, 0)
 	}
 	if clBuffer == nil {
 		return nil, ErrUnknown
@@ -572,33 +656,15 @@ func (ctx *Context) CreateEmptyBuffer(flags MemFlag, size int) (*MemObject, erro
 	return ctx.CreateBufferUnsafe(flags, size, nil)
 }
 
-func (ctx *Context) CreateEmptyBufferFloat32(flags MemFlag, size int) (*MemObject, error) {
-	return ctx.CreateBufferUnsafe(flags, 4*size, nil)
-}
-
-func (ctx *Context) CreateEmptyBufferFloat64(flags MemFlag, size int) (*MemObject, error) {
-	return ctx.CreateBufferUnsafe(flags, 8*size, nil)
-}
-
 func (ctx *Context) CreateBuffer(flags MemFlag, data []byte) (*MemObject, error) {
-	return ctx.CreateBufferUnsafe(flags, len(data), unsafe.Pointer(&data[0]))
-}
-
-//float32
-func (ctx *Context) CreateBufferFloat32(flags MemFlag, data []float32) (*MemObject, error) {
-	return ctx.CreateBufferUnsafe(flags, 4*len(data), unsafe.Pointer(&data[0]))
-}
-
-//float64
-func (ctx *Context) CreateBufferFloat64(flags MemFlag, data []float64) (*MemObject, error) {
-	return ctx.CreateBufferUnsafe(flags, 8*len(data), unsafe.Pointer(&data[0]))
+	return ctx.CreateBufferUint8(flags, data)
 }
 
 func (mobj *MemObject) CreateSubBuffer(flags MemFlag, origin, bSize int) (*MemObject, error) {
 	var err C.cl_int
 	clBuffer := C.CLcreateSubBuffer(mobj.clMem, C.cl_mem_flags(flags), (C.size_t)(origin), (C.size_t)(bSize), &err)
 	if err != C.CL_SUCCESS {
-		return nil, toError(err)
+		return nil, bufferError("clCreateSubBuffer", err, bSize, origin)
 	}
 	if clBuffer == nil {
 		return nil, ErrUnknown
@@ -607,36 +673,113 @@ func (mobj *MemObject) CreateSubBuffer(flags MemFlag, origin, bSize int) (*MemOb
 }
 
 func (q *CommandQueue) EnqueueFillBuffer(buffer *MemObject, pattern unsafe.Pointer, patternSize, offset, size int, eventWaitList []*Event) (*Event, error) {
+	if err := buffer.checkRange(offset, size); err != nil {
+		return nil, err
+	}
+	var event C.cl_event
+	eventWaitListPtr, WaitListLen := eventListPtr(eventWaitList)
+	err := bufferError("clEnqueueFillBuffer", C.clEnqueueFillBuffer(q.clQueue, buffer.clMem, pattern, C.size_t(patternSize), C.size_t(offset), C.size_t(size), C.cl_uint(WaitListLen), eventWaitListPtr, &event), size, offset)
+	return q.recorded(newEvent(event), err, CommandFillBuffer, size)
+}
+
+// Enqueue commands to read from an image object to host memory. A rowPitch or
+// slicePitch of 0 means the host data is tightly packed.
+func (q *CommandQueue) EnqueueReadImage(image *MemObject, blocking bool, origin, region *Dim3, rowPitch, slicePitch int, dataPtr unsafe.Pointer, eventWaitList []*Event) (*Event, error) {
+	var event C.cl_event
+	cOrigin := sizeTDim3(origin)
+	cRegion := sizeTDim3(region)
+	eventWaitListPtr, WaitListLen := eventListPtr(eventWaitList)
+	err := regionError("clEnqueueReadImage", C.clEnqueueReadImage(q.clQueue, image.clMem, clBool(blocking), &cOrigin[0], &cRegion[0], C.size_t(rowPitch), C.size_t(slicePitch), dataPtr, C.cl_uint(WaitListLen), eventWaitListPtr, &event), origin, region, 0)
+	return q.recorded(newEvent(event), err, CommandReadImage, q.imageRegionBytes(image, region))
+}
+
+// Enqueue commands to write to an image object from host memory. A rowPitch or
+// slicePitch of 0 means the host data is tightly packed.
+func (q *CommandQueue) EnqueueWriteImage(image *MemObject, blocking bool, origin, region *Dim3, rowPitch, slicePitch int, dataPtr unsafe.Pointer, eventWaitList []*Event) (*Event, error) {
+	var event C.cl_event
+	cOrigin := sizeTDim3(origin)
+	cRegion := sizeTDim3(region)
+	eventWaitListPtr, WaitListLen := eventListPtr(eventWaitList)
+	err := regionError("clEnqueueWriteImage", C.clEnqueueWriteImage(q.clQueue, image.clMem, clBool(blocking), &cOrigin[0], &cRegion[0], C.size_t(rowPitch), C.size_t(slicePitch), dataPtr, C.cl_uint(WaitListLen), eventWaitListPtr, &event), origin, region, 0)
+	return q.recorded(newEvent(event), err, CommandWriteImage, q.imageRegionBytes(image, region))
+}
+
+// Enqueues a command to copy image objects.
+func (q *CommandQueue) EnqueueCopyImage(srcImage, dstImage *MemObject, srcOrigin, dstOrigin, region *Dim3, eventWaitList []*Event) (*Event, error) {
+	var event C.cl_event
+	cSrcOrigin := sizeTDim3(srcOrigin)
+	cDstOrigin := sizeTDim3(dstOrigin)
+	cRegion := sizeTDim3(region)
+	eventWaitListPtr, WaitListLen := eventListPtr(eventWaitList)
+	err := regionError("clEnqueueCopyImage", C.clEnqueueCopyImage(q.clQueue, srcImage.clMem, dstImage.clMem, &cSrcOrigin[0], &cDstOrigin[0], &cRegion[0], C.cl_uint(WaitListLen), eventWaitListPtr, &event), dstOrigin, region, 0)
+	return q.recorded(newEvent(event), err, CommandCopyImage, q.imageRegionBytes(srcImage, region))
+}
+
+// Enqueues a command to fill an image object with a specified color. The fill
+// color is a four component float, int or uint vector depending on the image channel type.
+func (q *CommandQueue) EnqueueFillImage(image *MemObject, fillColor unsafe.Pointer, origin, region *Dim3, eventWaitList []*Event) (*Event, error) {
+	var event C.cl_event
+	cOrigin := sizeTDim3(origin)
+	cRegion := sizeTDim3(region)
+	eventWaitListPtr, WaitListLen := eventListPtr(eventWaitList)
+	err := regionError("clEnqueueFillImage", C.clEnqueueFillImage(q.clQueue, image.clMem, fillColor, &cOrigin[0], &cRegion[0], C.cl_uint(WaitListLen), eventWaitListPtr, &event), origin, region, 0)
+	return q.recorded(newEvent(event), err, CommandFillImage, q.imageRegionBytes(image, region))
+}
+
+func (q *CommandQueue) EnqueueFillImageFloat32(image *MemObject, fillColor [4]float32, origin, region *Dim3, eventWaitList []*Event) (*Event, error) {
+	return q.EnqueueFillImage(image, unsafe.Pointer(&fillColor[0]), origin, region, eventWaitList)
+}
+
+func (q *CommandQueue) EnqueueFillImageInt32(image *MemObject, fillColor [4]int32, origin, region *Dim3, eventWaitList []*Event) (*Event, error) {
+	return q.EnqueueFillImage(image, unsafe.Pointer(&fillColor[0]), origin, region, eventWaitList)
+}
+
+func (q *CommandQueue) EnqueueFillImageUint32(image *MemObject, fillColor [4]uint32, origin, region *Dim3, eventWaitList []*Event) (*Event, error) {
+	return q.EnqueueFillImage(image, unsafe.Pointer(&fillColor[0]), origin, region, eventWaitList)
+}
+
+// Enqueues a command to copy an image object to a buffer object.
+func (q *CommandQueue) EnqueueCopyImageToBuffer(srcImage, dstBuffer *MemObject, srcOrigin, region *Dim3, dstOffset int, eventWaitList []*Event) (*Event, error) {
+	var event C.cl_event
+	cSrcOrigin := sizeTDim3(srcOrigin)
+	cRegion := sizeTDim3(region)
+	eventWaitListPtr, WaitListLen := eventListPtr(eventWaitList)
+	err := regionError("clEnqueueCopyImageToBuffer", C.clEnqueueCopyImageToBuffer(q.clQueue, srcImage.clMem, dstBuffer.clMem, &cSrcOrigin[0], &cRegion[0], C.size_t(dstOffset), C.cl_uint(WaitListLen), eventWaitListPtr, &event), srcOrigin, region, dstOffset)
+	return q.recorded(newEvent(event), err, CommandCopyImageToBuffer, q.imageRegionBytes(srcImage, region))
+}
+
+// Enqueues a command to copy a buffer object to an image object.
+func (q *CommandQueue) EnqueueCopyBufferToImage(srcBuffer, dstImage *MemObject, srcOffset int, dstOrigin, region *Dim3, eventWaitList []*Event) (*Event, error) {
 	var event C.cl_event
+	cDstOrigin := sizeTDim3(dstOrigin)
+	cRegion := sizeTDim3(region)
 	eventWaitListPtr, WaitListLen := eventListPtr(eventWaitList)
-	err := toError(C.clEnqueueFillBuffer(q.clQueue, buffer.clMem, pattern, C.size_t(patternSize), C.size_t(offset), C.size_t(size), C.cl_uint(WaitListLen), eventWaitListPtr, &event))
-	return newEvent(event), err
+	err := regionError("clEnqueueCopyBufferToImage", C.clEnqueueCopyBufferToImage(q.clQueue, srcBuffer.clMem, dstImage.clMem, C.size_t(srcOffset), &cDstOrigin[0], &cRegion[0], C.cl_uint(WaitListLen), eventWaitListPtr, &event), dstOrigin, region, srcOffset)
+	return q.recorded(newEvent(event), err, CommandCopyBufferToImage, q.imageRegionBytes(dstImage, region))
 }
 
 // Enqueue a command to migrate memory objects into host
 func (q *CommandQueue) EnqueueMigrateMemObjectsToHost(memObjs []*MemObject, eventWaitList []*Event) (*Event, error) {
 	ObjCount := len(memObjs)
 	mem_obj_list := make([]C.cl_mem, ObjCount)
-	defer C.free(unsafe.Pointer(&mem_obj_list))
 	for idx, obj := range memObjs {
 		mem_obj_list[idx] = obj.clMem
 	}
 	var event C.cl_event
 	eventWaitListPtr, WaitListLen := eventListPtr(eventWaitList)
 	err := C.clEnqueueMigrateMemObjects(q.clQueue, C.cl_uint(ObjCount), &mem_obj_list[0], C.CL_MIGRATE_MEM_OBJECT_HOST, C.cl_uint(WaitListLen), eventWaitListPtr, &event)
-	return newEvent(event), toError(err)
+	return newEvent(event), bufferError("clEnqueueMigrateMemObjects", err, 0, 0)
 }
 
 // Enqueue a command to migrate memory objects into a command queue without their content
 func (q *CommandQueue) EnqueueMigrateMemObjectsIntoQueue(memObjs []*MemObject, eventWaitList []*Event) (*Event, error) {
 	ObjCount := len(memObjs)
 	mem_obj_list := make([]C.cl_mem, ObjCount)
-	defer C.free(unsafe.Pointer(&mem_obj_list))
 	for idx, obj := range memObjs {
 		mem_obj_list[idx] = obj.clMem
 	}
 	var event C.cl_event
 	eventWaitListPtr, WaitListLen := eventListPtr(eventWaitList)
 	err := C.clEnqueueMigrateMemObjects(q.clQueue, C.cl_uint(ObjCount), &mem_obj_list[0], C.CL_MIGRATE_MEM_OBJECT_CONTENT_UNDEFINED, C.cl_uint(WaitListLen), eventWaitListPtr, &event)
-	return newEvent(event), toError(err)
+	return newEvent(event), bufferError("clEnqueueMigrateMemObjects", err, 0, 0)
 }
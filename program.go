@@ -4,27 +4,17 @@ package go2opencl
 #include "./opencl.h"
 #include <stdio.h>
 #include <string.h>
-extern void go_program_notify(cl_program alt_program, void *user_data);
-extern void go_compile_program_notify(cl_program alt_program, void *user_data);
-extern void go_link_program_notify(cl_program alt_program, void *user_data);
+extern void go_program_notify(cl_program alt_program, uintptr_t handle);
 static void CL_CALLBACK c_program_notify(cl_program alt_program, void *user_data) {
-        go_program_notify((cl_program) alt_program, (void *)user_data);
-}
-
-static void CL_CALLBACK c_compile_program_notify(cl_program alt_program, void *user_data) {
-        go_compile_program_notify((cl_program) alt_program, (void *)user_data);
-}
-
-static void CL_CALLBACK c_link_program_notify(cl_program alt_program, void *user_data) {
-        go_link_program_notify((cl_program) alt_program, (void *)user_data);
+        go_program_notify((cl_program) alt_program, (uintptr_t)user_data);
 }
 
 static cl_int CLBuildProgram(      			cl_program 				program,
                                                         cl_uint                                 num_devices,
                                                   const cl_device_id *                    devices,
 						  const char *				build_options,
-                                                        void *                                  user_data) {
-        return clBuildProgram(program, num_devices, devices, build_options, c_program_notify, user_data);
+                                                        uintptr_t                               handle) {
+        return clBuildProgram(program, num_devices, devices, build_options, handle ? c_program_notify : NULL, (void *)handle);
 }
 
 static cl_int CLCompileProgram(                           cl_program                              program,
@@ -34,8 +24,8 @@ static cl_int CLCompileProgram(                           cl_program
 							cl_uint				num_headers,
 						const cl_program *			headers,
 						const char **				header_names,
-                                                        void *                                  user_data) {
-        return clCompileProgram(program, num_devices, devices, build_options, num_headers, headers, header_names, c_compile_program_notify, user_data);
+                                                        uintptr_t                               handle) {
+        return clCompileProgram(program, num_devices, devices, build_options, num_headers, headers, header_names, handle ? c_program_notify : NULL, (void *)handle);
 }
 
 static cl_program CLLinkProgram(                           cl_context                              context,
@@ -44,9 +34,9 @@ static cl_program CLLinkProgram(                           cl_context
                                                   const char *                          build_options,
 							cl_uint				num_programs,
 						const cl_program *			in_programs,
-                                                        void *                                  user_data,
+                                                        uintptr_t                               handle,
 							cl_int * err_ret) {
-        return clLinkProgram(context, num_devices, devices, build_options, num_programs, in_programs, c_link_program_notify, user_data, err_ret);
+        return clLinkProgram(context, num_devices, devices, build_options, num_programs, in_programs, handle ? c_program_notify : NULL, (void *)handle, err_ret);
 }
 
 static cl_int CLGetProgramInfo(                           cl_program                  program,
@@ -168,22 +158,6 @@ static void * bytecpy(void *dst, const void *src, const size_t dstOffset, size_t
 	return memcpy(dstPtr, srcPtr, count);
 }
 
-static void setPtrs(unsigned char **dst, const unsigned char  *src, const size_t *sizes, const size_t count) {
-	if ((dst == NULL) || (src == NULL) || (sizes == NULL) || (count <= 0)) {
-		return;
-	}
-	size_t srcOffset = 0;
-	for (size_t idx = 0; idx < count; idx++) {
-		size_t binSize = sizes[idx];
-		if (binSize > 0) {
-			dst[idx] = &src[srcOffset];
-			srcOffset += binSize;
-		} else {
-			dst[idx] = NULL;
-		}
-	}
-}
-
 */
 import "C"
 
@@ -215,12 +189,23 @@ const (
 )
 
 //////////////// Abstract Types ////////////////
+// A failed build, compile or link. Message and Device are those of the first
+// device with a build log, and Logs holds the logs of every such device.
 type BuildError struct {
 	Message string
 	Device  *Device
+	Logs    []BuildLog
+	Err     error // The error of the call, such as ErrBuildProgramFailure
 }
 
 func (e BuildError) Error() string {
+	if len(e.Logs) > 1 {
+		msgs := make([]string, len(e.Logs))
+		for i, l := range e.Logs {
+			msgs[i] = fmt.Sprintf("cl: build error on %q: %s", l.Device.Name(), l.Log)
+		}
+		return strings.Join(msgs, "\n")
+	}
 	if e.Device != nil {
 		return fmt.Sprintf("cl: build error on %q: %s", e.Device.Name(), e.Message)
 	} else {
@@ -228,14 +213,55 @@ func (e BuildError) Error() string {
 	}
 }
 
+func (e BuildError) Unwrap() error {
+	return e.Err
+}
+
+// Returns the diagnostics of the logs of all devices.
+func (e BuildError) Diagnostics() []Diagnostic {
+	var diags []Diagnostic
+	for _, l := range e.Logs {
+		diags = append(diags, l.Diagnostics...)
+	}
+	return diags
+}
+
+// The binaries passed to CreateProgramWithBinary that devices rejected.
+// Status holds the error of the binary of each device of Devices, nil for
+// those that were loaded.
+type BinaryError struct {
+	Err     error
+	Devices []*Device
+	Status  []error
+}
+
+func (e *BinaryError) Error() string {
+	var rejected []string
+	for i, err := range e.Status {
+		if err != nil {
+			rejected = append(rejected, fmt.Sprintf("%v on %q", err, e.Devices[i].Name()))
+		}
+	}
+	return fmt.Sprintf("%v: %s", e.Err, strings.Join(rejected, ", "))
+}
+
+func (e *BinaryError) Unwrap() error {
+	return e.Err
+}
+
 type Program struct {
-	clProgram C.cl_program
-	devices   []*Device
-	binaries  ProgramBinaries
+	clProgram  C.cl_program
+	devices    []*Device
+	binaries   ProgramBinaries
+	sources    []string // The strings passed to CreateProgramWithSource
+	options    string   // The options of the last successful build, compilation or link
+	hasOptions bool     // Whether options is known
 }
 
+// A header program, and the name by which the sources passed to
+// CompileProgram include it.
 type ProgramHeaders struct {
-	codes Program
+	codes *Program
 	names string
 }
 
@@ -246,44 +272,30 @@ type ProgramBinaries struct {
 }
 
 ////////////////// Supporting Types ////////////////
-type CL_program_notify func(alt_program C.cl_program, user_data unsafe.Pointer)
-
-var program_notify map[unsafe.Pointer]CL_program_notify
-
-type CL_compile_program_notify func(alt_program C.cl_program, user_data unsafe.Pointer)
-
-var compile_program_notify map[unsafe.Pointer]CL_compile_program_notify
-
-type CL_link_program_notify func(alt_program C.cl_program, user_data unsafe.Pointer)
-
-var link_program_notify map[unsafe.Pointer]CL_link_program_notify
+// Called once a build, compile or link started with a callback has finished.
+type CL_program_notify func(program *Program)
 
 ////////////////// Basic Functions ////////////////
-func init() {
-	program_notify = make(map[unsafe.Pointer]CL_program_notify)
-	compile_program_notify = make(map[unsafe.Pointer]CL_compile_program_notify)
-	link_program_notify = make(map[unsafe.Pointer]CL_link_program_notify)
-}
-
 //export go_program_notify
-func go_program_notify(alt_program C.cl_program, user_data unsafe.Pointer) {
-	var c_user_data []unsafe.Pointer
-	c_user_data = *(*[]unsafe.Pointer)(user_data)
-	program_notify[c_user_data[1]](alt_program, c_user_data[0])
-}
-
-//export go_compile_program_notify
-func go_compile_program_notify(alt_program C.cl_program, user_data unsafe.Pointer) {
-	var c_user_data []unsafe.Pointer
-	c_user_data = *(*[]unsafe.Pointer)(user_data)
-	compile_program_notify[c_user_data[1]](alt_program, c_user_data[0])
+func go_program_notify(alt_program C.cl_program, handle C.uintptr_t) {
+	if fn, ok := callbacks.take(uintptr(handle)).(func(C.cl_program)); ok {
+		fn(alt_program)
+	}
 }
 
-//export go_link_program_notify
-func go_link_program_notify(alt_program C.cl_program, user_data unsafe.Pointer) {
-	var c_user_data []unsafe.Pointer
-	c_user_data = *(*[]unsafe.Pointer)(user_data)
-	link_program_notify[c_user_data[1]](alt_program, c_user_data[0])
+// Registers pfn_notify for a build, compile or link. The callback is passed p,
+// or a Program referring to the program reported by OpenCL if p is nil.
+func registerProgramNotify(p *Program, devices []*Device, pfn_notify CL_program_notify) uintptr {
+	if pfn_notify == nil {
+		return 0
+	}
+	return callbacks.register(func(alt_program C.cl_program) {
+		if p != nil {
+			pfn_notify(p)
+		} else {
+			pfn_notify(&Program{clProgram: alt_program, devices: devices})
+		}
+	})
 }
 
 //////////////// Basic Functions ////////////////
@@ -300,6 +312,50 @@ func retainProgram(p *Program) {
 	}
 }
 
+// Returns the error of a failed build, compile or link of p, which failed
+// with code, with the build logs of devices.
+func (p *Program) buildError(code C.cl_int, devices []*Device) error {
+	buildErr := BuildError{Err: toError(code)}
+	buffer := make([]byte, 4096)
+	var bLen C.size_t
+	var err C.cl_int
+
+	for _, dev := range devices {
+		for i := 2; i >= 0; i-- {
+			err = C.clGetProgramBuildInfo(p.clProgram, dev.id, C.CL_PROGRAM_BUILD_LOG, C.size_t(len(buffer)), unsafe.Pointer(&buffer[0]), &bLen)
+			if err == C.CL_INVALID_VALUE && i > 0 && bLen < 1024*1024 {
+				// INVALID_VALUE probably means our buffer isn't large enough
+				buffer = make([]byte, bLen)
+			} else {
+				break
+			}
+		}
+		if err != C.CL_SUCCESS {
+			return toError(err)
+		}
+
+		if bLen > 1 {
+			log := string(buffer[:bLen-1])
+			buildErr.Logs = append(buildErr.Logs, BuildLog{Device: dev, Log: log, Diagnostics: ParseBuildLog(log, p.sources)})
+		}
+	}
+
+	if len(buildErr.Logs) == 0 {
+		return BuildError{
+			Device:  nil,
+			Message: "build failed and produced no log entries",
+			Err:     buildErr.Err,
+		}
+	}
+	buildErr.Device = buildErr.Logs[0].Device
+	buildErr.Message = buildErr.Logs[0].Log
+	return buildErr
+}
+
+func NewProgramHeaders(program *Program, name string) *ProgramHeaders {
+	return &ProgramHeaders{codes: program, names: name}
+}
+
 //////////////// Abstract Functions ////////////////
 func (p *Program) Release() {
 	releaseProgram(p)
@@ -310,13 +366,32 @@ func (p *Program) Retain() {
 }
 
 func (p *Program) BuildProgram(devices []*Device, options string) error {
+	return p.BuildProgramWithCallback(devices, options, nil)
+}
+
+// Builds the program. If pfn_notify is not nil the build may complete
+// asynchronously, and pfn_notify is called once it has finished.
+func (p *Program) BuildProgramWithCallback(devices []*Device, options string, pfn_notify CL_program_notify) error {
 	var optBuffer bytes.Buffer
 	optBuffer.WriteString("-cl-std=CL1.2 -cl-kernel-arg-info ")
-	var cOptions *C.char
 	if options != "" {
 		optBuffer.WriteString(options)
 	}
-	cOptions = C.CString(optBuffer.String())
+	return p.buildProgram(devices, optBuffer.String(), pfn_notify)
+}
+
+// Builds the program with options in place of the -cl-std=CL1.2 and
+// -cl-kernel-arg-info BuildProgram passes. options may be nil, and are
+// checked with Validate.
+func (p *Program) BuildProgramWithOptions(devices []*Device, options *BuildOptions, pfn_notify CL_program_notify) error {
+	if err := options.Validate(); err != nil {
+		return err
+	}
+	return p.buildProgram(devices, options.String(), pfn_notify)
+}
+
+func (p *Program) buildProgram(devices []*Device, options string, pfn_notify CL_program_notify) error {
+	cOptions := C.CString(options)
 	defer C.free(unsafe.Pointer(cOptions))
 
 	var deviceList []C.cl_device_id
@@ -326,38 +401,12 @@ func (p *Program) BuildProgram(devices []*Device, options string) error {
 		deviceList = buildDeviceIdList(devices)
 		deviceListPtr = &deviceList[0]
 	}
-	if err := C.clBuildProgram(p.clProgram, numDevices, deviceListPtr, cOptions, nil, nil); err != C.CL_SUCCESS {
-		buffer := make([]byte, 4096)
-		var bLen C.size_t
-		var err C.cl_int
-
-		for _, dev := range p.devices {
-			for i := 2; i >= 0; i-- {
-				err = C.clGetProgramBuildInfo(p.clProgram, dev.id, C.CL_PROGRAM_BUILD_LOG, C.size_t(len(buffer)), unsafe.Pointer(&buffer[0]), &bLen)
-				if err == C.CL_INVALID_VALUE && i > 0 && bLen < 1024*1024 {
-					// INVALID_VALUE probably means our buffer isn't large enough
-					buffer = make([]byte, bLen)
-				} else {
-					break
-				}
-			}
-			if err != C.CL_SUCCESS {
-				return toError(err)
-			}
-
-			if bLen > 1 {
-				return BuildError{
-					Device:  dev,
-					Message: string(buffer[:bLen-1]),
-				}
-			}
-		}
-
-		return BuildError{
-			Device:  nil,
-			Message: "build failed and produced no log entries",
-		}
+	handle := registerProgramNotify(p, nil, pfn_notify)
+	if err := C.CLBuildProgram(p.clProgram, numDevices, deviceListPtr, cOptions, C.uintptr_t(handle)); err != C.CL_SUCCESS {
+		callbacks.unregister(handle)
+		return p.buildError(err, p.devices)
 	}
+	p.options, p.hasOptions = options, true
 	return nil
 }
 
@@ -389,7 +438,7 @@ func (ctx *Context) CreateProgramWithSource(sources []string) (*Program, error)
 	if clProgram == nil {
 		return nil, ErrUnknown
 	}
-	program := &Program{clProgram: clProgram, devices: ctx.devices}
+	program := &Program{clProgram: clProgram, devices: ctx.devices, sources: append([]string(nil), sources...)}
 	runtime.SetFinalizer(program, releaseProgram)
 	return program, nil
 }
@@ -421,6 +470,21 @@ func (ctx *Context) CreateProgramWithBuiltInKernels(devices []*Device, kernel_na
 }
 
 func (p *Program) CompileProgram(devices []*Device, options string, program_headers []*ProgramHeaders) error {
+	return p.CompileProgramWithCallback(devices, options, program_headers, nil)
+}
+
+// Compiles the program with options, which may be nil, and are checked with
+// Validate.
+func (p *Program) CompileProgramWithOptions(devices []*Device, options *BuildOptions, program_headers []*ProgramHeaders, pfn_notify CL_program_notify) error {
+	if err := options.Validate(); err != nil {
+		return err
+	}
+	return p.CompileProgramWithCallback(devices, options.String(), program_headers, pfn_notify)
+}
+
+// Compiles the program. If pfn_notify is not nil the compilation may complete
+// asynchronously, and pfn_notify is called once it has finished.
+func (p *Program) CompileProgramWithCallback(devices []*Device, options string, program_headers []*ProgramHeaders, pfn_notify CL_program_notify) error {
 	var cOptions *C.char
 	if options != "" {
 		cOptions = C.CString(options)
@@ -433,119 +497,49 @@ func (p *Program) CompileProgram(devices []*Device, options string, program_head
 		deviceList = buildDeviceIdList(devices)
 		deviceListPtr = &deviceList[0]
 	}
-	var err C.cl_int
-	if program_headers == nil {
-		err = C.clCompileProgram(p.clProgram, numDevices, deviceListPtr, cOptions, 0, nil, nil, nil, nil)
-	} else {
-		num_headers := len(program_headers)
+	num_headers := len(program_headers)
+	var cHeadersPtr *C.cl_program
+	var cHeaderNamesPtr **C.char
+	if num_headers > 0 {
 		cHeaders := make([]C.cl_program, num_headers)
 		cHeader_names := make([]*C.char, num_headers)
 		for idx, ph := range program_headers {
-			chs := ph.codes
 			chn := C.CString(ph.names)
-			cHeaders[idx] = chs.clProgram
+			cHeaders[idx] = ph.codes.clProgram
 			cHeader_names[idx] = chn
-			defer C.free(unsafe.Pointer(&chs))
-			defer C.free(unsafe.Pointer(&chn))
+			defer C.free(unsafe.Pointer(chn))
 		}
-		err = C.clCompileProgram(p.clProgram, numDevices, deviceListPtr, cOptions, C.cl_uint(num_headers), &cHeaders[0], &cHeader_names[0], nil, nil)
+		cHeadersPtr = &cHeaders[0]
+		cHeaderNamesPtr = &cHeader_names[0]
 	}
+	handle := registerProgramNotify(p, nil, pfn_notify)
+	err := C.CLCompileProgram(p.clProgram, numDevices, deviceListPtr, cOptions, C.cl_uint(num_headers), cHeadersPtr, cHeaderNamesPtr, C.uintptr_t(handle))
 	if err != C.CL_SUCCESS {
-		buffer := make([]byte, 4096)
-		var bLen C.size_t
-		var err C.cl_int
-
-		for _, dev := range p.devices {
-			for i := 2; i >= 0; i-- {
-				err = C.clGetProgramBuildInfo(p.clProgram, dev.id, C.CL_PROGRAM_BUILD_LOG, C.size_t(len(buffer)), unsafe.Pointer(&buffer[0]), &bLen)
-				if err == C.CL_INVALID_VALUE && i > 0 && bLen < 1024*1024 {
-					// INVALID_VALUE probably means our buffer isn't large enough
-					buffer = make([]byte, bLen)
-				} else {
-					break
-				}
-			}
-			if err != C.CL_SUCCESS {
-				return toError(err)
-			}
-
-			if bLen > 1 {
-				return BuildError{
-					Device:  dev,
-					Message: string(buffer[:bLen-1]),
-				}
-			}
-		}
-
-		return BuildError{
-			Device:  nil,
-			Message: "build failed and produced no log entries",
-		}
+		callbacks.unregister(handle)
+		return p.buildError(err, p.devices)
 	}
+	p.options, p.hasOptions = options, true
 	return nil
 }
 
-func (p *Program) CompileProgramWithCallback(devices []*Device, options string, program_headers []*ProgramHeaders, user_data unsafe.Pointer) error {
-	var cOptions *C.char
-	if options != "" {
-		cOptions = C.CString(options)
-		defer C.free(unsafe.Pointer(cOptions))
-	}
-	var deviceList []C.cl_device_id
-	var deviceListPtr *C.cl_device_id
-	numDevices := C.cl_uint(len(devices))
-	if devices != nil && len(devices) > 0 {
-		deviceList = buildDeviceIdList(devices)
-		deviceListPtr = &deviceList[0]
-	}
-	num_headers := len(program_headers)
-	cHeaders := make([]C.cl_program, num_headers)
-	cHeader_names := make([]*C.char, num_headers)
-	for idx, ph := range program_headers {
-		chs := ph.codes
-		chn := C.CString(ph.names)
-		cHeaders[idx] = chs.clProgram
-		cHeader_names[idx] = chn
-		defer C.free(unsafe.Pointer(&chs))
-		defer C.free(unsafe.Pointer(&chn))
-	}
-	err := C.CLCompileProgram(p.clProgram, numDevices, deviceListPtr, cOptions, C.cl_uint(num_headers), &cHeaders[0], &cHeader_names[0], user_data)
-	if err != C.CL_SUCCESS {
-		buffer := make([]byte, 4096)
-		var bLen C.size_t
-		var err C.cl_int
-
-		for _, dev := range p.devices {
-			for i := 2; i >= 0; i-- {
-				err = C.clGetProgramBuildInfo(p.clProgram, dev.id, C.CL_PROGRAM_BUILD_LOG, C.size_t(len(buffer)), unsafe.Pointer(&buffer[0]), &bLen)
-				if err == C.CL_INVALID_VALUE && i > 0 && bLen < 1024*1024 {
-					// INVALID_VALUE probably means our buffer isn't large enough
-					buffer = make([]byte, bLen)
-				} else {
-					break
-				}
-			}
-			if err != C.CL_SUCCESS {
-				return toError(err)
-			}
-
-			if bLen > 1 {
-				return BuildError{
-					Device:  dev,
-					Message: string(buffer[:bLen-1]),
-				}
-			}
-		}
+func (ctx *Context) LinkProgram(programs []*Program, devices []*Device, options string) (*Program, error) {
+	return ctx.LinkProgramWithCallback(programs, devices, options, nil)
+}
 
-		return BuildError{
-			Device:  nil,
-			Message: "build failed and produced no log entries",
-		}
+// Links the programs with the options of options that apply to linking,
+// -cl-fast-relaxed-math, -cl-denorms-are-zero and LinkExtra. options may be
+// nil, and are checked with Validate.
+func (ctx *Context) LinkProgramWithOptions(programs []*Program, devices []*Device, options *BuildOptions, pfn_notify CL_program_notify) (*Program, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
 	}
-	return nil
+	return ctx.LinkProgramWithCallback(programs, devices, options.linkString(), pfn_notify)
 }
 
-func (ctx *Context) LinkProgram(programs []*Program, devices []*Device, options string) (*Program, error) {
+// Links the programs into an executable. If pfn_notify is not nil the link may
+// complete asynchronously, and pfn_notify is called with the linked program once
+// it has finished.
+func (ctx *Context) LinkProgramWithCallback(programs []*Program, devices []*Device, options string, pfn_notify CL_program_notify) (*Program, error) {
 	var cOptions *C.char
 	if options != "" {
 		cOptions = C.CString(options)
@@ -563,96 +557,39 @@ func (ctx *Context) LinkProgram(programs []*Program, devices []*Device, options
 		programList[idx] = progId.clProgram
 	}
 	var err C.cl_int
-	programExe := C.clLinkProgram(ctx.clContext, numDevices, deviceListPtr, cOptions, C.cl_uint(len(programs)), &programList[0], nil, nil, &err)
+	handle := registerProgramNotify(nil, devices, pfn_notify)
+	programExe := C.CLLinkProgram(ctx.clContext, numDevices, deviceListPtr, cOptions, C.cl_uint(len(programs)), &programList[0], C.uintptr_t(handle), &err)
+	// Without a device list the program is linked for every device of the context
+	if len(devices) == 0 {
+		devices = ctx.devices
+	}
 	p := &Program{clProgram: programExe, devices: devices}
 	if err != C.CL_SUCCESS {
-		buffer := make([]byte, 4096)
-		var bLen C.size_t
-		var err C.cl_int
-
-		for _, dev := range p.devices {
-			for i := 2; i >= 0; i-- {
-				err = C.clGetProgramBuildInfo(p.clProgram, dev.id, C.CL_PROGRAM_BUILD_LOG, C.size_t(len(buffer)), unsafe.Pointer(&buffer[0]), &bLen)
-				if err == C.CL_INVALID_VALUE && i > 0 && bLen < 1024*1024 {
-					// INVALID_VALUE probably means our buffer isn't large enough
-					buffer = make([]byte, bLen)
-				} else {
-					break
-				}
-			}
-			if err != C.CL_SUCCESS {
-				return nil, toError(err)
-			}
-
-			if bLen > 1 {
-				return nil, BuildError{
-					Device:  dev,
-					Message: string(buffer[:bLen-1]),
-				}
-			}
-		}
-
-		return nil, BuildError{
-			Device:  nil,
-			Message: "build failed and produced no log entries",
+		callbacks.unregister(handle)
+		if programExe == nil {
+			// No program to hold the build logs
+			return nil, toError(err)
 		}
+		buildErr := p.buildError(err, devices)
+		releaseProgram(p)
+		return nil, buildErr
 	}
+	p.options, p.hasOptions = linkedOptions(programs, options)
 	return p, nil
 }
 
-func (ctx *Context) LinkProgramWithCallback(programs []*Program, devices []*Device, options string, user_data unsafe.Pointer) (*Program, error) {
-	var cOptions *C.char
-	if options != "" {
-		cOptions = C.CString(options)
-		defer C.free(unsafe.Pointer(cOptions))
-	}
-	var deviceList []C.cl_device_id
-	var deviceListPtr *C.cl_device_id
-	numDevices := C.cl_uint(len(devices))
-	if devices != nil && len(devices) > 0 {
-		deviceList = buildDeviceIdList(devices)
-		deviceListPtr = &deviceList[0]
-	}
-	programList := make([]C.cl_program, len(programs))
-	for idx, progId := range programs {
-		programList[idx] = progId.clProgram
-	}
-	var err C.cl_int
-	programExe := C.CLLinkProgram(ctx.clContext, numDevices, deviceListPtr, cOptions, C.cl_uint(len(programs)), &programList[0], user_data, &err)
-	p := &Program{clProgram: programExe, devices: devices}
-	if err != C.CL_SUCCESS {
-		buffer := make([]byte, 4096)
-		var bLen C.size_t
-		var err C.cl_int
-
-		for _, dev := range p.devices {
-			for i := 2; i >= 0; i-- {
-				err = C.clGetProgramBuildInfo(p.clProgram, dev.id, C.CL_PROGRAM_BUILD_LOG, C.size_t(len(buffer)), unsafe.Pointer(&buffer[0]), &bLen)
-				if err == C.CL_INVALID_VALUE && i > 0 && bLen < 1024*1024 {
-					// INVALID_VALUE probably means our buffer isn't large enough
-					buffer = make([]byte, bLen)
-				} else {
-					break
-				}
-			}
-			if err != C.CL_SUCCESS {
-				return nil, toError(err)
-			}
-
-			if bLen > 1 {
-				return nil, BuildError{
-					Device:  dev,
-					Message: string(buffer[:bLen-1]),
-				}
-			}
-		}
-
-		return nil, BuildError{
-			Device:  nil,
-			Message: "build failed and produced no log entries",
+// Returns the options of a program linked from programs with options: those
+// the programs were compiled with, followed by options. They are unknown if
+// the programs were compiled with different or unknown options.
+func linkedOptions(programs []*Program, options string) (string, bool) {
+	var compiled string
+	for i, p := range programs {
+		if !p.hasOptions || (i > 0 && p.options != compiled) {
+			return "", false
 		}
+		compiled = p.options
 	}
-	return p, nil
+	return strings.TrimSpace(compiled + " " + options), true
 }
 
 func (p *Program) GetBuildStatus(device *Device) (BuildStatus, error) {
@@ -782,7 +719,6 @@ func (p *Program) GetSource() (string, error) {
 func (p *Program) GetBinarySizes() ([]int, error) {
 	var val C.size_t
 	if err := C.CLGetProgramInfoParamSize(p.clProgram, C.CL_PROGRAM_BINARY_SIZES, &val); err != C.CL_SUCCESS {
-		panic("Should never fail")
 		return nil, toError(err)
 	}
 
@@ -790,7 +726,6 @@ func (p *Program) GetBinarySizes() ([]int, error) {
 	arr := (*C.size_t)(C.calloc(numEntries, (C.size_t)(C.sizeof_size_t)))
 	defer C.free(unsafe.Pointer(arr))
 	if err := C.CLGetProgramInfoParamUnsafe(p.clProgram, C.CL_PROGRAM_BINARY_SIZES, val, (unsafe.Pointer)(arr)); err != C.CL_SUCCESS {
-		panic("Should never fail")
 		return nil, toError(err)
 	}
 	returnCount := make([]int, int(numEntries))
@@ -803,8 +738,7 @@ func (p *Program) GetBinarySizes() ([]int, error) {
 func (p *Program) GetBinaries() (*ProgramBinaries, error) {
 	binSizes, err := p.GetBinarySizes()
 	if err != nil {
-		panic("Unable to get program binary sizes")
-		return nil, toError(err)
+		return nil, err
 	}
 	arr := make([][]byte, len(binSizes))
 	arrPtrs := make([]*byte, len(binSizes))
@@ -853,81 +787,77 @@ func (p *Program) GetKernelNames() (string, error) {
 	return retString, nil
 }
 
+// Creates a program from program_lengths bytes of the binaries of
+// program_binaries, built for the devices of deviceList in order, and builds
+// it without options. If a device rejects its binary, the error is a
+// *BinaryError.
 func (ctx *Context) CreateProgramWithBinary(deviceList []*Device, program_lengths []int, program_binaries [][]byte) (*Program, error) {
-	device_list_in := make([]C.cl_device_id, len(deviceList))
-	binary_lengths := make([]C.size_t, len(program_lengths))
-
-	binErr := (*C.cl_int)(C.calloc((C.size_t)(len(deviceList)), C.sizeof_int))
-	defer C.free(unsafe.Pointer(binErr))
-
-	binErrGo := make([]int, len(deviceList))
-	var err C.cl_int
-
-	for i, devItem := range deviceList {
-		device_list_in[i] = devItem.id
-		binary_lengths[i] = (C.size_t)(program_lengths[i])
+	if len(program_lengths) != len(program_binaries) {
+		return nil, ErrInvalidValue
 	}
-
-	totalSize := int(0)
-	for _, binSz := range program_lengths {
-		if binSz > 0 {
-			totalSize += binSz
+	binaries := make([][]byte, len(program_binaries))
+	for i, bin := range program_binaries {
+		if program_lengths[i] < 0 || program_lengths[i] > len(bin) {
+			return nil, ErrInvalidValue
 		}
+		binaries[i] = bin[:program_lengths[i]]
 	}
+	return ctx.createProgramWithBinary(deviceList, binaries, "")
+}
 
-	binary_in_bytes := (*C.uchar)(C.calloc((C.size_t)(totalSize), 1))
-	defer C.free((unsafe.Pointer)(binary_in_bytes))
-
-	goBytes := make([]byte, totalSize)
-	goBytesIdx := int(0)
-	for _, bin := range program_binaries {
-		for _, binByte := range bin {
-			if goBytesIdx > totalSize {
-				fmt.Println("CreateProgramWithBinary (WARNING): total bytes exceeded!")
-			}
-			goBytes[goBytesIdx] = binByte
-			goBytesIdx++
-		}
+// Creates a program from binaries, built for the devices of deviceList in
+// order, and builds it with options, which should be those the binaries were
+// built with. options may be nil, and are checked with Validate.
+func (ctx *Context) CreateProgramWithBinaryOptions(deviceList []*Device, binaries [][]byte, options *BuildOptions) (*Program, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
 	}
+	return ctx.createProgramWithBinary(deviceList, binaries, options.String())
+}
 
-	C.memcpy((unsafe.Pointer)(binary_in_bytes), (unsafe.Pointer)(&goBytes[0]), (C.size_t)(totalSize))
-
-	binary_in := (**C.uchar)(C.calloc((C.size_t)(len(program_lengths)), C.sizeof_uchar))
-	defer C.free((unsafe.Pointer)(binary_in))
-
-	C.setPtrs(binary_in, binary_in_bytes, &binary_lengths[0], (C.size_t)(len(program_lengths)))
-
-	clProgram := C.clCreateProgramWithBinary(ctx.clContext, C.cl_uint(len(deviceList)), &device_list_in[0], &binary_lengths[0], binary_in, binErr, &err)
-	C.memcpy((unsafe.Pointer)(&binErrGo[0]), (unsafe.Pointer)(binErr), (C.size_t)(len(binErrGo))*C.sizeof_int)
-
-	for i := range binary_lengths {
-		if binErrGo[i] != C.CL_SUCCESS {
-			errMsg := int(binErrGo[i])
-			switch errMsg {
-			default:
-				fmt.Printf("Unknown error when loading binary %d \n", i)
-			case C.CL_INVALID_VALUE:
-				fmt.Printf("Loading empty binary %d \n", i)
-			case C.CL_INVALID_BINARY:
-				fmt.Printf("Loading an invalid binary %d \n", i)
-			}
+func (ctx *Context) createProgramWithBinary(deviceList []*Device, binaries [][]byte, options string) (*Program, error) {
+	numDevices := len(deviceList)
+	if numDevices == 0 || len(binaries) != numDevices {
+		return nil, ErrInvalidValue
+	}
+	deviceIds := buildDeviceIdList(deviceList)
+	lengths := make([]C.size_t, numDevices)
+	cBinaries := make([]*C.uchar, numDevices)
+	for i, bin := range binaries {
+		lengths[i] = C.size_t(len(bin))
+		if len(bin) > 0 {
+			cBinaries[i] = (*C.uchar)(C.CBytes(bin))
+			defer C.free(unsafe.Pointer(cBinaries[i]))
 		}
 	}
+	binaryStatus := make([]C.cl_int, numDevices)
 
+	var err C.cl_int
+	clProgram := C.clCreateProgramWithBinary(ctx.clContext, C.cl_uint(numDevices), &deviceIds[0], &lengths[0], &cBinaries[0], &binaryStatus[0], &err)
 	if err != C.CL_SUCCESS {
+		binErr := &BinaryError{Err: toError(err), Devices: deviceList, Status: make([]error, numDevices)}
+		rejected := false
+		for i, status := range binaryStatus {
+			if status != C.CL_SUCCESS {
+				binErr.Status[i] = toError(status)
+				rejected = true
+			}
+		}
+		if rejected {
+			return nil, binErr
+		}
 		return nil, toError(err)
 	}
 	if clProgram == nil {
 		return nil, ErrUnknown
 	}
 
-	err = C.clBuildProgram(clProgram, 0, nil, nil, nil, nil)
-	if err != C.CL_SUCCESS {
-		return nil, toError(err)
-	}
-
-	program := &Program{clProgram: clProgram, devices: ctx.devices}
+	program := &Program{clProgram: clProgram, devices: deviceList}
 	runtime.SetFinalizer(program, releaseProgram)
+	if err := program.buildProgram(nil, options, nil); err != nil {
+		program.Release()
+		return nil, err
+	}
 	return program, nil
 }
 
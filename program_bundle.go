@@ -0,0 +1,239 @@
+package go2opencl
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Program bundles hold the binaries of a built program for its devices, with
+// the identity of each device and the options the program was built with, so
+// that the program can be created again without its sources. The file format
+// is
+//
+//	"go2opencl bundle\n", version (uint32)
+//	options (string), SHA-256 of options (32 bytes)
+//	number of binaries (uint32), and for each binary
+//	device name, vendor, driver version, platform version (strings), binary (bytes)
+//
+// with integers in little endian, and strings and bytes prefixed by their
+// length as a uint64.
+
+// ////////////// Basic Errors ////////////////
+var (
+	ErrBundleFormat  = errors.New("cl: invalid program bundle")
+	ErrBundleVersion = errors.New("cl: unsupported program bundle version")
+	ErrBundleDevice  = errors.New("cl: program bundle has no binary for device")
+	ErrBundleOptions = errors.New("cl: build options of program are unknown")
+)
+
+// ////////////// Abstract Types ////////////////
+type ProgramBundle struct {
+	Options  string // The options passed to the driver to build the program.
+	Binaries []BundleBinary
+}
+
+// The binary of a program for a device.
+type BundleBinary struct {
+	DeviceName      string
+	DeviceVendor    string
+	DriverVersion   string
+	PlatformVersion string
+	Binary          []byte
+}
+
+// ////////////// Basic Functions ////////////////
+const (
+	bundleMagic   = "go2opencl bundle\n"
+	bundleVersion = 1
+
+	// Bounds the allocations of a corrupted bundle
+	maxBundleField = 1 << 32
+)
+
+func writeBundleBytes(b *bytes.Buffer, data []byte) {
+	var n [8]byte
+	binary.LittleEndian.PutUint64(n[:], uint64(len(data)))
+	b.Write(n[:])
+	b.Write(data)
+}
+
+func readBundleBytes(r io.Reader) ([]byte, error) {
+	var n uint64
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return nil, ErrBundleFormat
+	}
+	if n > maxBundleField {
+		return nil, ErrBundleFormat
+	}
+	// Read through a LimitReader so that a bad length fails at the end of
+	// the data rather than allocating it upfront
+	data, err := ioutil.ReadAll(io.LimitReader(r, int64(n)))
+	if err != nil || uint64(len(data)) != n {
+		return nil, ErrBundleFormat
+	}
+	return data, nil
+}
+
+func readBundleStrings(r io.Reader, strs ...*string) error {
+	for _, s := range strs {
+		data, err := readBundleBytes(r)
+		if err != nil {
+			return err
+		}
+		*s = string(data)
+	}
+	return nil
+}
+
+func bundleBinaryFor(device *Device) BundleBinary {
+	return BundleBinary{
+		DeviceName:      device.Name(),
+		DeviceVendor:    device.Vendor(),
+		DriverVersion:   device.DriverVersion(),
+		PlatformVersion: device.Platform().Version(),
+	}
+}
+
+// Reports whether b was built for a device with the identity of id.
+func (b *BundleBinary) matches(id BundleBinary) bool {
+	return b.DeviceName == id.DeviceName && b.DeviceVendor == id.DeviceVendor &&
+		b.DriverVersion == id.DriverVersion && b.PlatformVersion == id.PlatformVersion
+}
+
+// Reads a bundle written by ProgramBundle.WriteTo.
+func ReadProgramBundle(r io.Reader) (*ProgramBundle, error) {
+	magic := make([]byte, len(bundleMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != bundleMagic {
+		return nil, ErrBundleFormat
+	}
+	var version uint32
+	if err := binary.Read(r, binary.LittleEndian, &version); err != nil {
+		return nil, ErrBundleFormat
+	}
+	if version != bundleVersion {
+		return nil, fmt.Errorf("%w %d", ErrBundleVersion, version)
+	}
+	b := &ProgramBundle{}
+	if err := readBundleStrings(r, &b.Options); err != nil {
+		return nil, err
+	}
+	var sum [sha256.Size]byte
+	if _, err := io.ReadFull(r, sum[:]); err != nil || sum != sha256.Sum256([]byte(b.Options)) {
+		return nil, ErrBundleFormat
+	}
+	var count uint32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, ErrBundleFormat
+	}
+	for i := uint32(0); i < count; i++ {
+		var bin BundleBinary
+		if err := readBundleStrings(r, &bin.DeviceName, &bin.DeviceVendor, &bin.DriverVersion, &bin.PlatformVersion); err != nil {
+			return nil, err
+		}
+		data, err := readBundleBytes(r)
+		if err != nil {
+			return nil, err
+		}
+		bin.Binary = data
+		b.Binaries = append(b.Binaries, bin)
+	}
+	return b, nil
+}
+
+// Reads the bundle in the file name and creates its program for the devices
+// of ctx.
+func (ctx *Context) LoadProgramBundle(name string) (*Program, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := ReadProgramBundle(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return ctx.CreateProgramFromBundle(b)
+}
+
+// ////////////// Abstract Functions ////////////////
+// Returns the binaries of p for the devices it was built for, and the options
+// of its last build. The options of a linked program are those its programs
+// were compiled with, followed by those of the link, and Bundle fails with
+// ErrBundleOptions if they are unknown, for instance because the programs
+// were compiled with different options.
+func (p *Program) Bundle() (*ProgramBundle, error) {
+	if !p.hasOptions {
+		return nil, ErrBundleOptions
+	}
+	built, err := p.GetBinaries()
+	if err != nil {
+		return nil, err
+	}
+	// The binaries are in the order of the devices of the program
+	sizes := built.GetBinarySizes()
+	b := &ProgramBundle{Options: p.options}
+	for i, data := range built.GetBinaryArray() {
+		if i >= len(p.devices) || sizes[i] == 0 {
+			continue
+		}
+		bin := bundleBinaryFor(p.devices[i])
+		bin.Binary = data
+		b.Binaries = append(b.Binaries, bin)
+	}
+	return b, nil
+}
+
+// Writes the bundle of p to the file name, replacing it atomically.
+func (p *Program) SaveBundle(name string) error {
+	b, err := p.Bundle()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if _, err := b.WriteTo(&buf); err != nil {
+		return err
+	}
+	return writeFileAtomic(name, buf.Bytes())
+}
+
+func (b *ProgramBundle) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	buf.WriteString(bundleMagic)
+	binary.Write(&buf, binary.LittleEndian, uint32(bundleVersion))
+	writeBundleBytes(&buf, []byte(b.Options))
+	sum := sha256.Sum256([]byte(b.Options))
+	buf.Write(sum[:])
+	binary.Write(&buf, binary.LittleEndian, uint32(len(b.Binaries)))
+	for _, bin := range b.Binaries {
+		for _, s := range []string{bin.DeviceName, bin.DeviceVendor, bin.DriverVersion, bin.PlatformVersion} {
+			writeBundleBytes(&buf, []byte(s))
+		}
+		writeBundleBytes(&buf, bin.Binary)
+	}
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+// Creates the program of b for the devices of ctx, and builds it with the
+// options of b. Every device needs a binary built for a device with the same
+// name, vendor, driver version and platform version.
+func (ctx *Context) CreateProgramFromBundle(b *ProgramBundle) (*Program, error) {
+	binaries := make([][]byte, len(ctx.devices))
+	for i, device := range ctx.devices {
+		id := bundleBinaryFor(device)
+		for j := range b.Binaries {
+			if b.Binaries[j].matches(id) {
+				binaries[i] = b.Binaries[j].Binary
+				break
+			}
+		}
+		if binaries[i] == nil {
+			return nil, fmt.Errorf("%w %q", ErrBundleDevice, id.DeviceName)
+		}
+	}
+	return ctx.createProgramWithBinary(ctx.devices, binaries, b.Options)
+}
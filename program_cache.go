@@ -0,0 +1,161 @@
+package go2opencl
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// On-disk cache of program binaries. A program is looked up by a key hashed
+// from its sources, its build options, and the name and driver version of the
+// device and the version of its platform, so a driver update invalidates the
+// entries built by the previous driver. Entries are written to a temporary
+// file and renamed into place, so processes sharing a cache directory never
+// read a partly written binary.
+
+// ////////////// Abstract Types ////////////////
+type ProgramCache struct {
+	Dir string
+}
+
+// ////////////// Basic Functions ////////////////
+// Returns a cache storing its binaries in dir, which is created if needed.
+func NewProgramCache(dir string) (*ProgramCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &ProgramCache{Dir: dir}, nil
+}
+
+// Writes s to h prefixed by its length, so that the boundaries between the
+// hashed strings are part of the key.
+func hashString(h hash.Hash, s string) {
+	var n [8]byte
+	binary.LittleEndian.PutUint64(n[:], uint64(len(s)))
+	h.Write(n[:])
+	h.Write([]byte(s))
+}
+
+func (c *ProgramCache) path(key string) string {
+	return filepath.Join(c.Dir, key+".bin")
+}
+
+func (c *ProgramCache) load(key string) ([]byte, bool) {
+	bin, err := ioutil.ReadFile(c.path(key))
+	if err != nil || len(bin) == 0 {
+		return nil, false
+	}
+	return bin, true
+}
+
+func (c *ProgramCache) store(key string, bin []byte) error {
+	return writeFileAtomic(c.path(key), bin)
+}
+
+// Writes data to a temporary file next to name and renames it to name, so
+// that readers never see a partly written file.
+func writeFileAtomic(name string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), name); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// ////////////// Abstract Functions ////////////////
+// Returns the key of the binary of sources built with options for device.
+// options are those passed to the driver, which BuildOptions.String renders.
+func (c *ProgramCache) Key(device *Device, sources []string, options string) string {
+	h := sha256.New()
+	hashString(h, "go2opencl program cache 1")
+	hashString(h, device.Name())
+	hashString(h, device.DriverVersion())
+	hashString(h, device.Platform().Version())
+	hashString(h, options)
+	for _, s := range sources {
+		hashString(h, s)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Returns sources built with options for the devices of ctx. If the cache has
+// a binary for every device the program is created from them, otherwise, or
+// if creating or building the program from its binaries fails, it is built
+// from sources and its binaries are stored in the cache. Failing to store
+// them does not fail the build.
+func (c *ProgramCache) BuildProgram(ctx *Context, sources []string, options string) (*Program, error) {
+	return c.build(ctx, sources, "-cl-std=CL1.2 -cl-kernel-arg-info "+options, func(p *Program) error {
+		return p.BuildProgram(nil, options)
+	})
+}
+
+// Like BuildProgram, with typed options. options may be nil, and are checked
+// with Validate.
+func (c *ProgramCache) BuildProgramWithOptions(ctx *Context, sources []string, options *BuildOptions) (*Program, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+	return c.build(ctx, sources, options.String(), func(p *Program) error {
+		return p.BuildProgramWithOptions(nil, options, nil)
+	})
+}
+
+// Looks the program up by the options passed to the driver, and builds it
+// with build on a miss.
+func (c *ProgramCache) build(ctx *Context, sources []string, options string, build func(*Program) error) (*Program, error) {
+	devices := ctx.devices
+	keys := make([]string, len(devices))
+	binaries := make([][]byte, len(devices))
+	hit := len(devices) > 0
+	for i, device := range devices {
+		keys[i] = c.Key(device, sources, options)
+		if hit {
+			binaries[i], hit = c.load(keys[i])
+		}
+	}
+	if hit {
+		// A stale binary may be rejected when it is created or built, so any
+		// error falls back to the sources
+		if program, err := ctx.createProgramWithBinary(devices, binaries, options); err == nil {
+			return program, nil
+		}
+	}
+
+	program, err := ctx.CreateProgramWithSource(sources)
+	if err != nil {
+		return nil, err
+	}
+	if err := build(program); err != nil {
+		program.Release()
+		return nil, err
+	}
+	built, err := program.GetBinaries()
+	if err != nil {
+		return program, nil
+	}
+	// The binaries are in the order of the devices of the program, which
+	// are those of the context
+	for i, bin := range built.GetBinaryArray() {
+		if i < len(keys) && built.GetBinarySizes()[i] > 0 {
+			c.store(keys[i], bin)
+		}
+	}
+	return program, nil
+}
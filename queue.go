@@ -42,8 +42,9 @@ const (
 
 //////////////// Abstract Types ////////////////
 type CommandQueue struct {
-	clQueue C.cl_command_queue
-	device  *Device
+	clQueue  C.cl_command_queue
+	device   *Device
+	recorder *Recorder
 }
 
 //////////////// Golang Types ////////////////
@@ -106,7 +107,6 @@ func (q *CommandQueue) GetQueueContext() (*Context, error) {
 	if q.clQueue != nil {
 		var outContext C.cl_context
 		var tmpN C.size_t
-		defer C.free(unsafe.Pointer(&tmpN))
 		err := C.CLGetCommandQueueInfoParamSize(q.clQueue, C.CL_QUEUE_CONTEXT, &tmpN)
 		if toError(err) != nil {
 			return nil, toError(err)
@@ -124,7 +124,6 @@ func (q *CommandQueue) GetQueueDevice() (*Device, error) {
 	if q.clQueue != nil {
 		var outDevice C.cl_device_id
 		var tmpN C.size_t
-		defer C.free(unsafe.Pointer(&tmpN))
 		err := C.CLGetCommandQueueInfoParamSize(q.clQueue, C.CL_QUEUE_DEVICE, &tmpN)
 		if toError(err) != nil {
 			return nil, toError(err)
@@ -142,7 +141,6 @@ func (q *CommandQueue) GetQueueReferenceCount() (CLUint, error) {
 	if q.clQueue != nil {
 		var outCount C.cl_uint
 		var tmpN C.size_t
-		defer C.free(unsafe.Pointer(&tmpN))
 		err := C.CLGetCommandQueueInfoParamSize(q.clQueue, C.CL_QUEUE_REFERENCE_COUNT, &tmpN)
 		if toError(err) != nil {
 			return 0, toError(err)
@@ -158,18 +156,12 @@ func (q *CommandQueue) GetQueueReferenceCount() (CLUint, error) {
 
 func (q *CommandQueue) GetQueueProperties() (CommandQueueProperty, error) {
 	if q.clQueue != nil {
-		var outVar CommandQueueProperty
-		var tmpN C.size_t
-		defer C.free(unsafe.Pointer(&tmpN))
-		err := C.CLGetCommandQueueInfoParamSize(q.clQueue, C.CL_QUEUE_PROPERTIES, &tmpN)
-		if toError(err) != nil {
-			return 0, toError(err)
-		}
-		err = C.CLGetCommandQueueInfoParamUnsafe(q.clQueue, C.CL_QUEUE_PROPERTIES, tmpN, unsafe.Pointer(&outVar))
+		var outVar C.cl_command_queue_properties
+		err := C.clGetCommandQueueInfo(q.clQueue, C.CL_QUEUE_PROPERTIES, C.size_t(unsafe.Sizeof(outVar)), unsafe.Pointer(&outVar), nil)
 		if toError(err) != nil {
 			return 0, toError(err)
 		}
-		return outVar, toError(err)
+		return CommandQueueProperty(outVar), nil
 	}
 	return 0, toError(C.CL_INVALID_COMMAND_QUEUE)
 }
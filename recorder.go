@@ -0,0 +1,219 @@
+package go2opencl
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Profiling of the commands enqueued on a CommandQueue. A Recorder attached to
+// a queue keeps the event of every kernel launch, buffer and image transfer,
+// marker and VkFFT transform, and aggregates their device timings. The queue
+// must have been created with CommandQueueProfilingEnable.
+
+// ////////////// Abstract Types ////////////////
+type Recorder struct {
+	mu      sync.Mutex
+	records []CommandRecord
+}
+
+// A command enqueued while a Recorder was attached to its queue.
+type CommandRecord struct {
+	Type  CommandType
+	Name  string // kernel function name, or the command type for other commands
+	Bytes int    // bytes transferred by reads, writes, copies and fills
+	Queue *CommandQueue
+	Event *Event
+
+	// For commands made of several enqueues, like VkFFT transforms, the
+	// marker enqueued before the first of them. Event is then the marker
+	// enqueued after the last of them.
+	startEvent *Event
+}
+
+// Aggregated device timings of the commands with the same name.
+type CommandStats struct {
+	Name  string
+	Type  CommandType
+	Count int
+	Total time.Duration
+	Mean  time.Duration
+	Min   time.Duration
+	Max   time.Duration
+	P95   time.Duration
+	Bytes int64
+}
+
+// Statistics per command name, sorted by decreasing total device time.
+type RecorderReport []CommandStats
+
+// ////////////// Basic Functions ////////////////
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) add(q *CommandQueue, ev, startEvent *Event, cmd CommandType, name string, bytes int) {
+	// The recorder keeps its own references, so that the caller may release the events
+	retainEvent(ev)
+	rec := CommandRecord{Type: cmd, Name: name, Bytes: bytes, Queue: q, Event: newEvent(ev.clEvent)}
+	if startEvent != nil {
+		retainEvent(startEvent)
+		rec.startEvent = newEvent(startEvent.clEvent)
+	}
+	if rec.Name == "" {
+		rec.Name = cmd.String()
+	}
+	r.mu.Lock()
+	r.records = append(r.records, rec)
+	r.mu.Unlock()
+}
+
+// Records a successfully enqueued command on the recorder of q, if any.
+func (q *CommandQueue) recorded(ev *Event, err error, cmd CommandType, bytes int) (*Event, error) {
+	if q.recorder != nil && err == nil && ev != nil && ev.clEvent != nil {
+		q.recorder.add(q, ev, nil, cmd, "", bytes)
+	}
+	return ev, err
+}
+
+// Records a successfully enqueued kernel launch on the recorder of q, if any.
+func (q *CommandQueue) recordedKernel(ev *Event, err error, cmd CommandType, kernel *Kernel) (*Event, error) {
+	if q.recorder != nil && err == nil && ev != nil && ev.clEvent != nil {
+		name, _ := kernel.FunctionName()
+		q.recorder.add(q, ev, nil, cmd, name, 0)
+	}
+	return ev, err
+}
+
+// ////////////// Abstract Functions ////////////////
+
+// Attaches r to the queue, so that the commands enqueued afterwards are
+// recorded. A nil Recorder stops recording. Must not be called concurrently
+// with enqueues on the queue.
+func (q *CommandQueue) SetRecorder(r *Recorder) {
+	q.recorder = r
+}
+
+func (q *CommandQueue) Recorder() *Recorder {
+	return q.recorder
+}
+
+// Returns a copy of the records collected so far, in the order of enqueueing.
+func (r *Recorder) Records() []CommandRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]CommandRecord(nil), r.records...)
+}
+
+// Drops all records and their events.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	records := r.records
+	r.records = nil
+	r.mu.Unlock()
+	for _, rec := range records {
+		rec.Event.Release()
+		if rec.startEvent != nil {
+			rec.startEvent.Release()
+		}
+	}
+}
+
+// Waits for all recorded commands to complete and returns their records.
+func (r *Recorder) completedRecords() ([]CommandRecord, error) {
+	records := r.Records()
+	events := make([]*Event, 0, len(records))
+	for _, rec := range records {
+		events = append(events, rec.Event)
+	}
+	if len(events) > 0 {
+		if err := WaitForEvents(events); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// Returns the device timestamps of the recorded command.
+func (rec *CommandRecord) Profile() (EventProfile, error) {
+	end, err := rec.Event.Profile()
+	if err != nil || rec.startEvent == nil {
+		return end, err
+	}
+	start, err := rec.startEvent.Profile()
+	if err != nil {
+		return EventProfile{}, err
+	}
+	// Markers take no time: the commands started when the first marker completed
+	return EventProfile{Queued: start.Queued, Submit: start.Submit, Start: start.End, End: end.End}, nil
+}
+
+// Waits for all recorded commands to complete and aggregates their device
+// times per kernel name or command type.
+func (r *Recorder) Report() (RecorderReport, error) {
+	records, err := r.completedRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		cmd  CommandType
+		name string
+	}
+	durations := make(map[key][]time.Duration)
+	stats := make(map[key]*CommandStats)
+	var order []key
+	for i := range records {
+		rec := &records[i]
+		profile, err := rec.Profile()
+		if err != nil {
+			return nil, err
+		}
+		k := key{rec.Type, rec.Name}
+		s := stats[k]
+		if s == nil {
+			s = &CommandStats{Name: rec.Name, Type: rec.Type, Min: time.Duration(math.MaxInt64)}
+			stats[k] = s
+			order = append(order, k)
+		}
+		d := profile.ExecDuration()
+		s.Count++
+		s.Total += d
+		s.Bytes += int64(rec.Bytes)
+		if d < s.Min {
+			s.Min = d
+		}
+		if d > s.Max {
+			s.Max = d
+		}
+		durations[k] = append(durations[k], d)
+	}
+
+	report := make(RecorderReport, 0, len(order))
+	for _, k := range order {
+		s := stats[k]
+		s.Mean = s.Total / time.Duration(s.Count)
+		ds := durations[k]
+		sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+		// Nearest rank percentile
+		s.P95 = ds[int(math.Ceil(0.95*float64(len(ds))))-1]
+		report = append(report, *s)
+	}
+	sort.SliceStable(report, func(i, j int) bool { return report[i].Total > report[j].Total })
+	return report, nil
+}
+
+func (rep RecorderReport) String() string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Name\tCount\tTotal\tMean\tMin\tMax\tP95\tBytes\t")
+	for _, s := range rep {
+		fmt.Fprintf(w, "%s\t%d\t%v\t%v\t%v\t%v\t%v\t%d\t\n", s.Name, s.Count, s.Total, s.Mean, s.Min, s.Max, s.P95, s.Bytes)
+	}
+	w.Flush()
+	return buf.String()
+}
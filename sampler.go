@@ -0,0 +1,148 @@
+package go2opencl
+
+/*
+#include "./opencl.h"
+*/
+import "C"
+
+import (
+	"fmt"
+	"runtime"
+	"unsafe"
+)
+
+// ////////////// Basic Types ////////////////
+type AddressingMode int
+
+const (
+	AddressingModeNone           AddressingMode = C.CL_ADDRESS_NONE
+	AddressingModeClampToEdge    AddressingMode = C.CL_ADDRESS_CLAMP_TO_EDGE
+	AddressingModeClamp          AddressingMode = C.CL_ADDRESS_CLAMP
+	AddressingModeRepeat         AddressingMode = C.CL_ADDRESS_REPEAT
+	AddressingModeMirroredRepeat AddressingMode = C.CL_ADDRESS_MIRRORED_REPEAT
+)
+
+func (am AddressingMode) String() string {
+	switch am {
+	case AddressingModeNone:
+		return "None"
+	case AddressingModeClampToEdge:
+		return "ClampToEdge"
+	case AddressingModeClamp:
+		return "Clamp"
+	case AddressingModeRepeat:
+		return "Repeat"
+	case AddressingModeMirroredRepeat:
+		return "MirroredRepeat"
+	}
+	return fmt.Sprintf("Unknown(%x)", int(am))
+}
+
+type FilterMode int
+
+const (
+	FilterModeNearest FilterMode = C.CL_FILTER_NEAREST
+	FilterModeLinear  FilterMode = C.CL_FILTER_LINEAR
+)
+
+func (fm FilterMode) String() string {
+	switch fm {
+	case FilterModeNearest:
+		return "Nearest"
+	case FilterModeLinear:
+		return "Linear"
+	}
+	return fmt.Sprintf("Unknown(%x)", int(fm))
+}
+
+// ////////////// Abstract Types ////////////////
+type Sampler struct {
+	clSampler C.cl_sampler
+}
+
+// ////////////// Basic Functions ////////////////
+func releaseSampler(s *Sampler) {
+	if s.clSampler != nil {
+		C.clReleaseSampler(s.clSampler)
+		s.clSampler = nil
+	}
+}
+
+func retainSampler(s *Sampler) {
+	if s.clSampler != nil {
+		C.clRetainSampler(s.clSampler)
+	}
+}
+
+func newSampler(clSampler C.cl_sampler) *Sampler {
+	sampler := &Sampler{clSampler: clSampler}
+	runtime.SetFinalizer(sampler, releaseSampler)
+	return sampler
+}
+
+// ////////////// Abstract Functions ////////////////
+func (s *Sampler) Release() {
+	releaseSampler(s)
+}
+
+func (s *Sampler) Retain() {
+	retainSampler(s)
+}
+
+// Creates a sampler object describing how images are read by read_image{f,i,ui} in a kernel.
+func (ctx *Context) CreateSampler(normalizedCoords bool, addressingMode AddressingMode, filterMode FilterMode) (*Sampler, error) {
+	var err C.cl_int
+	clSampler := C.clCreateSampler(ctx.clContext, clBool(normalizedCoords), C.cl_addressing_mode(addressingMode), C.cl_filter_mode(filterMode), &err)
+	if err != C.CL_SUCCESS {
+		return nil, toError(err)
+	}
+	if clSampler == nil {
+		return nil, ErrUnknown
+	}
+	return newSampler(clSampler), nil
+}
+
+func (s *Sampler) GetReferenceCount() (int, error) {
+	if s.clSampler != nil {
+		var val C.cl_uint
+		err := C.clGetSamplerInfo(s.clSampler, C.CL_SAMPLER_REFERENCE_COUNT, C.size_t(unsafe.Sizeof(val)), unsafe.Pointer(&val), nil)
+		return int(val), toError(err)
+	}
+	return 0, toError(C.CL_INVALID_SAMPLER)
+}
+
+func (s *Sampler) GetContext() (*Context, error) {
+	if s.clSampler != nil {
+		var val C.cl_context
+		err := C.clGetSamplerInfo(s.clSampler, C.CL_SAMPLER_CONTEXT, C.size_t(unsafe.Sizeof(val)), unsafe.Pointer(&val), nil)
+		return &Context{clContext: val, devices: nil}, toError(err)
+	}
+	return nil, toError(C.CL_INVALID_SAMPLER)
+}
+
+func (s *Sampler) NormalizedCoords() (bool, error) {
+	if s.clSampler != nil {
+		var val C.cl_bool
+		err := C.clGetSamplerInfo(s.clSampler, C.CL_SAMPLER_NORMALIZED_COORDS, C.size_t(unsafe.Sizeof(val)), unsafe.Pointer(&val), nil)
+		return val == C.CL_TRUE, toError(err)
+	}
+	return false, toError(C.CL_INVALID_SAMPLER)
+}
+
+func (s *Sampler) AddressingMode() (AddressingMode, error) {
+	if s.clSampler != nil {
+		var val C.cl_addressing_mode
+		err := C.clGetSamplerInfo(s.clSampler, C.CL_SAMPLER_ADDRESSING_MODE, C.size_t(unsafe.Sizeof(val)), unsafe.Pointer(&val), nil)
+		return AddressingMode(val), toError(err)
+	}
+	return -1, toError(C.CL_INVALID_SAMPLER)
+}
+
+func (s *Sampler) FilterMode() (FilterMode, error) {
+	if s.clSampler != nil {
+		var val C.cl_filter_mode
+		err := C.clGetSamplerInfo(s.clSampler, C.CL_SAMPLER_FILTER_MODE, C.size_t(unsafe.Sizeof(val)), unsafe.Pointer(&val), nil)
+		return FilterMode(val), toError(err)
+	}
+	return -1, toError(C.CL_INVALID_SAMPLER)
+}
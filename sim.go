@@ -0,0 +1,372 @@
+package go2opencl
+
+/*
+#include "./opencl.h"
+#include "stubs/lib/clsim.h"
+
+extern cl_int go_sim_dispatch(char *name, cl_uint work_dim, size_t *global_offset, size_t *global_size, size_t *local_size, cl_uint num_args, clsim_kernel_arg *args);
+
+static cl_int c_sim_dispatch(const char *name, cl_uint work_dim, const size_t *global_offset, const size_t *global_size, const size_t *local_size, cl_uint num_args, const clsim_kernel_arg *args) {
+	return go_sim_dispatch((char *)name, work_dim, (size_t *)global_offset, (size_t *)global_size, (size_t *)local_size, num_args, (clsim_kernel_arg *)args);
+}
+
+typedef void (*clsim_set_dispatcher_fn)(clsim_kernel_dispatcher);
+
+// Returns 0 if platform is not go2opencl-sim.
+static int CLSimInstallDispatcher(cl_platform_id platform) {
+	clsim_set_dispatcher_fn set = (clsim_set_dispatcher_fn)clGetExtensionFunctionAddressForPlatform(platform, "clSimSetKernelDispatcher");
+	if (set == NULL) {
+		return 0;
+	}
+	set(c_sim_dispatch);
+	return 1;
+}
+
+typedef cl_int (*clsim_inject_fault_fn)(const char *, cl_uint, cl_int);
+typedef cl_int (*clsim_inject_build_fault_fn)(const char *, const char *);
+typedef void (*clsim_set_device_lost_fn)(cl_int);
+typedef void (*clsim_clear_faults_fn)(void);
+
+static cl_int CLSimInjectFault(cl_platform_id platform, const char *function, cl_uint nth, cl_int error) {
+	clsim_inject_fault_fn inject = (clsim_inject_fault_fn)clGetExtensionFunctionAddressForPlatform(platform, "clSimInjectFault");
+	if (inject == NULL) {
+		return CL_INVALID_OPERATION;
+	}
+	return inject(function, nth, error);
+}
+
+static cl_int CLSimInjectBuildFault(cl_platform_id platform, const char *match, const char *build_log) {
+	clsim_inject_build_fault_fn inject = (clsim_inject_build_fault_fn)clGetExtensionFunctionAddressForPlatform(platform, "clSimInjectBuildFault");
+	if (inject == NULL) {
+		return CL_INVALID_OPERATION;
+	}
+	return inject(match, build_log);
+}
+
+static void CLSimSetDeviceLost(cl_platform_id platform, cl_int error) {
+	clsim_set_device_lost_fn set = (clsim_set_device_lost_fn)clGetExtensionFunctionAddressForPlatform(platform, "clSimSetDeviceLost");
+	if (set != NULL) {
+		set(error);
+	}
+}
+
+static void CLSimClearFaults(cl_platform_id platform) {
+	clsim_clear_faults_fn clear = (clsim_clear_faults_fn)clGetExtensionFunctionAddressForPlatform(platform, "clSimClearFaults");
+	if (clear != NULL) {
+		clear();
+	}
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// The go2opencl-sim platform is a software OpenCL implementation built from
+// stubs/lib/clsim.c (make -C stubs sim) in place of the libOpenCL stub. It
+// does not compile OpenCL C: launching a kernel calls the Go function
+// registered under the kernel's name. The library is chosen at link time,
+// so the same code runs on the simulator in tests and on real devices.
+//
+// Tests of error paths inject faults into the simulator: calls fail with a
+// chosen error, builds fail with a chosen log, or the device is lost. The
+// errors are returned by the OpenCL calls, so they reach the caller through
+// the usual wrappers as they would on a real device.
+
+// ////////////// Basic Types ////////////////
+const SimPlatformName = C.CLSIM_PLATFORM_NAME
+
+// A Go implementation of a kernel, called once per EnqueueNDRangeKernel with
+// the whole NDRange. It runs while the simulator is locked and must not call
+// OpenCL. Returning an error fails the kernel's command.
+type SimKernelFunc func(launch *SimLaunch) error
+
+// An NDRange launch of a simulated kernel. The slices have one entry per
+// dimension. LocalSize is nil if the work-group size was left to OpenCL.
+type SimLaunch struct {
+	Name         string
+	GlobalOffset []int
+	GlobalSize   []int
+	LocalSize    []int
+	Args         []SimArg
+}
+
+// An argument set with SetArg. Value holds its bytes, and Buffer the storage
+// of MemObject arguments, nil for other arguments. Both alias memory owned
+// by the simulator and are only valid during the call to the SimKernelFunc.
+type SimArg struct {
+	Value  []byte
+	Buffer []byte
+	// Size of __local arguments, which have no Value
+	LocalSize int
+}
+
+// ////////////// Abstract Types ////////////////
+type simKernelTable struct {
+	mu    sync.RWMutex
+	funcs map[string]SimKernelFunc
+}
+
+var simKernels = &simKernelTable{funcs: make(map[string]SimKernelFunc)}
+
+var (
+	simInstallOnce sync.Once
+	simInstalled   bool
+	simPlatformID  C.cl_platform_id
+)
+
+// ////////////// Basic Functions ////////////////
+
+//export go_sim_dispatch
+func go_sim_dispatch(name *C.char, workDim C.cl_uint, globalOffset, globalSize, localSize *C.size_t, numArgs C.cl_uint, args *C.clsim_kernel_arg) C.cl_int {
+	launch := &SimLaunch{Name: C.GoString(name)}
+	simKernels.mu.RLock()
+	fn := simKernels.funcs[launch.Name]
+	simKernels.mu.RUnlock()
+	if fn == nil {
+		return C.CL_INVALID_KERNEL_NAME
+	}
+
+	dims := int(workDim)
+	launch.GlobalOffset = sizesToInts(globalOffset, dims)
+	launch.GlobalSize = sizesToInts(globalSize, dims)
+	if localSize != nil {
+		launch.LocalSize = sizesToInts(localSize, dims)
+	}
+	if numArgs > 0 {
+		cArgs := (*[1 << 20]C.clsim_kernel_arg)(unsafe.Pointer(args))[:numArgs:numArgs]
+		launch.Args = make([]SimArg, numArgs)
+		for i, a := range cArgs {
+			if a.value == nil {
+				launch.Args[i].LocalSize = int(a.size)
+				continue
+			}
+			launch.Args[i].Value = C.GoBytes(a.value, C.int(a.size))
+			if a.mem != nil {
+				launch.Args[i].Buffer = (*[1 << 30]byte)(a.mem)[:a.mem_size:a.mem_size]
+			}
+		}
+	}
+
+	if err := fn(launch); err != nil {
+		return simErrorCode(err)
+	}
+	return C.CL_SUCCESS
+}
+
+func sizesToInts(sizes *C.size_t, n int) []int {
+	cSizes := (*[3]C.size_t)(unsafe.Pointer(sizes))[:n:n]
+	ints := make([]int, n)
+	for i, s := range cSizes {
+		ints[i] = int(s)
+	}
+	return ints
+}
+
+// Returns the OpenCL code of err, or CL_OUT_OF_RESOURCES for other errors.
+func simErrorCode(err error) C.cl_int {
+	if code, ok := ErrorCode(err); ok {
+		return C.cl_int(code)
+	}
+	return C.CL_OUT_OF_RESOURCES
+}
+
+// Installs the dispatcher of simulated kernels on the go2opencl-sim platform.
+// Returns false if the linked OpenCL library does not provide it.
+func simInstall() bool {
+	simInstallOnce.Do(func() {
+		platforms, err := GetPlatforms()
+		if err != nil {
+			return
+		}
+		for _, p := range platforms {
+			if C.CLSimInstallDispatcher(p.id) != 0 {
+				simInstalled = true
+				simPlatformID = p.id
+			}
+		}
+	})
+	return simInstalled
+}
+
+// ////////////// Abstract Functions ////////////////
+
+// Registers fn to run in place of the kernel function called name on the
+// go2opencl-sim platform, replacing any function registered before. Returns
+// ErrUnsupported if the linked OpenCL library is not the simulator.
+func RegisterSimKernel(name string, fn SimKernelFunc) error {
+	if !simInstall() {
+		return ErrUnsupported
+	}
+	simKernels.mu.Lock()
+	defer simKernels.mu.Unlock()
+	if fn == nil {
+		delete(simKernels.funcs, name)
+	} else {
+		simKernels.funcs[name] = fn
+	}
+	return nil
+}
+
+// Removes the function registered for the kernel function called name.
+func UnregisterSimKernel(name string) {
+	simKernels.mu.Lock()
+	defer simKernels.mu.Unlock()
+	delete(simKernels.funcs, name)
+}
+
+// Whether the linked OpenCL library is the go2opencl-sim platform.
+func SimAvailable() bool {
+	return simInstall()
+}
+
+// Makes the nth call to the OpenCL function called function fail with err,
+// counting from 1 from now on, or every call if nth is 0. Calls enqueueing
+// commands count and fail when the command runs, which also fails its event.
+// Supported functions create contexts, command queues, user events,
+// buffers, programs and kernels, build programs or enqueue commands.
+// Returns ErrInvalidValue for other functions, and ErrUnsupported if the
+// linked OpenCL library is not the simulator.
+func SimInjectFault(function string, nth int, err error) error {
+	if !simInstall() {
+		return ErrUnsupported
+	}
+	if nth < 0 || err == nil {
+		return ErrInvalidValue
+	}
+	cFunction := C.CString(function)
+	defer C.free(unsafe.Pointer(cFunction))
+	return toError(C.CLSimInjectFault(simPlatformID, cFunction, C.cl_uint(nth), simErrorCode(err)))
+}
+
+// Makes builds, compilations and links of programs whose code contains match
+// fail with ErrBuildProgramFailure (ErrCompileProgramFailure,
+// ErrLinkProgramFailure) and log as their build log, which BuildProgram
+// returns in a BuildError. Faults injected first take precedence.
+func SimInjectBuildFault(match, log string) error {
+	if !simInstall() {
+		return ErrUnsupported
+	}
+	cMatch := C.CString(match)
+	defer C.free(unsafe.Pointer(cMatch))
+	cLog := C.CString(log)
+	defer C.free(unsafe.Pointer(cLog))
+	return toError(C.CLSimInjectBuildFault(simPlatformID, cMatch, cLog))
+}
+
+// Loses the device of the simulator: commands that have not run yet and all
+// commands enqueued later fail with err, their contexts are notified and
+// Device.Available returns false. A nil err restores the device.
+func SimLoseDevice(err error) error {
+	if !simInstall() {
+		return ErrUnsupported
+	}
+	code := C.cl_int(C.CL_SUCCESS)
+	if err != nil {
+		code = simErrorCode(err)
+	}
+	C.CLSimSetDeviceLost(simPlatformID, code)
+	return nil
+}
+
+// Removes all injected faults and restores the device of the simulator.
+func SimClearFaults() {
+	if simInstall() {
+		C.CLSimClearFaults(simPlatformID)
+	}
+}
+
+// Calls fn with the global ID of every work-item of the launch.
+func (l *SimLaunch) ForEachGlobalID(fn func(id [3]int)) {
+	var lo, hi [3]int
+	for d := 0; d < 3; d++ {
+		lo[d], hi[d] = 0, 1
+		if d < len(l.GlobalSize) {
+			lo[d] = l.GlobalOffset[d]
+			hi[d] = lo[d] + l.GlobalSize[d]
+		}
+	}
+	for z := lo[2]; z < hi[2]; z++ {
+		for y := lo[1]; y < hi[1]; y++ {
+			for x := lo[0]; x < hi[0]; x++ {
+				fn([3]int{x, y, z})
+			}
+		}
+	}
+}
+
+// Returns a pointer to the value of a scalar argument of size bytes, read by
+// the method name. Panics if the argument is not that wide, rather than
+// reading past its value.
+func (a SimArg) scalar(name string, size int) unsafe.Pointer {
+	if a.Value == nil {
+		panic(fmt.Sprintf("cl: SimArg.%s of a __local argument", name))
+	}
+	if len(a.Value) != size {
+		panic(fmt.Sprintf("cl: SimArg.%s of a %d-byte argument, want %d bytes", name, len(a.Value), size))
+	}
+	return unsafe.Pointer(&a.Value[0])
+}
+
+func (a SimArg) Uint32() uint32 {
+	return *(*uint32)(a.scalar("Uint32", 4))
+}
+
+func (a SimArg) Int32() int32 {
+	return *(*int32)(a.scalar("Int32", 4))
+}
+
+func (a SimArg) Uint64() uint64 {
+	return *(*uint64)(a.scalar("Uint64", 8))
+}
+
+func (a SimArg) Int64() int64 {
+	return *(*int64)(a.scalar("Int64", 8))
+}
+
+func (a SimArg) Float32() float32 {
+	return *(*float32)(a.scalar("Float32", 4))
+}
+
+func (a SimArg) Float64() float64 {
+	return *(*float64)(a.scalar("Float64", 8))
+}
+
+// The storage of a buffer argument as float32 values.
+func (a SimArg) Float32s() []float32 {
+	if len(a.Buffer) < 4 {
+		return nil
+	}
+	n := len(a.Buffer) / 4
+	return (*[1 << 28]float32)(unsafe.Pointer(&a.Buffer[0]))[:n:n]
+}
+
+// The storage of a buffer argument as float64 values.
+func (a SimArg) Float64s() []float64 {
+	if len(a.Buffer) < 8 {
+		return nil
+	}
+	n := len(a.Buffer) / 8
+	return (*[1 << 27]float64)(unsafe.Pointer(&a.Buffer[0]))[:n:n]
+}
+
+// The storage of a buffer argument as int32 values.
+func (a SimArg) Int32s() []int32 {
+	if len(a.Buffer) < 4 {
+		return nil
+	}
+	n := len(a.Buffer) / 4
+	return (*[1 << 28]int32)(unsafe.Pointer(&a.Buffer[0]))[:n:n]
+}
+
+// The storage of a buffer argument as uint32 values.
+func (a SimArg) Uint32s() []uint32 {
+	if len(a.Buffer) < 4 {
+		return nil
+	}
+	n := len(a.Buffer) / 4
+	return (*[1 << 28]uint32)(unsafe.Pointer(&a.Buffer[0]))[:n:n]
+}
@@ -0,0 +1,3923 @@
+/*
+ * go2opencl-sim: an in-process software implementation of OpenCL 1.2.
+ *
+ * Built as libOpenCL.so in place of the empty stub library (make sim), it
+ * provides one platform with one CPU device supporting contexts, in-order
+ * command queues, buffers and sub-buffers, events, user events, markers,
+ * barriers, native kernels and profiling. Images and samplers are not
+ * supported, as reported by CL_DEVICE_IMAGE_SUPPORT.
+ *
+ * Programs are not compiled: building a program finds the __kernel functions
+ * and their parameters in the source, and an #error directive makes the
+ * build fail. Kernel launches call the dispatcher installed with the
+ * clSimSetKernelDispatcher extension (see clsim.h).
+ *
+ * Commands run on the thread that enqueues them, or that completes the user
+ * event they wait for. All calls are serialized by one lock, which is
+ * released before event, memory object and program callbacks are called.
+ * Kernels and native kernels run with the lock held and must not call
+ * OpenCL.
+ */
+
+#define CL_TARGET_OPENCL_VERSION 120
+#define CL_USE_DEPRECATED_OPENCL_1_1_APIS
+#include <ctype.h>
+#include <pthread.h>
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <time.h>
+#include "CL/cl.h"
+#include "CL/cl_ext.h"
+#include "clsim.h"
+
+#define SIM_VERSION            "OpenCL 1.2 go2opencl-sim"
+#define SIM_DEVICE_NAME        "go2opencl-sim CPU"
+#define SIM_VENDOR             "go2opencl"
+#define SIM_DRIVER_VERSION     "1.0"
+#define SIM_MAX_WORK_GROUP     1024
+#define SIM_MAX_ALLOC          ((cl_ulong)1 << 30)
+#define SIM_GLOBAL_MEM         ((cl_ulong)4 << 30)
+#define SIM_LOCAL_MEM          ((cl_ulong)32 << 10)
+#define SIM_BASE_ADDR_ALIGN    1024 /* bits */
+#define SIM_BINARY_HEADER      "go2opencl-sim binary 1\n"
+
+enum {
+    MAGIC_CONTEXT = 0x5c1c7e01,
+    MAGIC_QUEUE,
+    MAGIC_MEM,
+    MAGIC_EVENT,
+    MAGIC_PROGRAM,
+    MAGIC_KERNEL,
+};
+
+/* ------------------------------------------------------------------------ */
+/* Objects                                                                  */
+/* ------------------------------------------------------------------------ */
+
+/* Objects are freed when both the application's references (refs) and the
+ * simulator's own (holds) are gone. */
+
+struct _cl_platform_id {
+    int unused;
+};
+
+struct _cl_device_id {
+    int unused;
+};
+
+static struct _cl_platform_id sim_platform;
+static struct _cl_device_id sim_device;
+
+struct _cl_context {
+    cl_uint magic, refs, holds;
+    cl_context_properties props[3];
+    size_t props_size;
+    void (CL_CALLBACK *notify)(const char *, const void *, size_t, void *);
+    void *notify_data;
+    cl_command_queue queues;
+};
+
+struct command;
+
+struct _cl_command_queue {
+    cl_uint magic, refs, holds;
+    cl_context context;
+    cl_command_queue_properties props;
+    struct command *head, *tail;
+    cl_command_queue next;
+};
+
+struct mem_destructor {
+    struct mem_destructor *next;
+    void (CL_CALLBACK *fn)(cl_mem, void *);
+    void *user_data;
+};
+
+struct _cl_mem {
+    cl_uint magic, refs, holds;
+    cl_context context;
+    cl_mem_flags flags;
+    size_t size, offset;
+    char *data;
+    void *host_ptr;
+    cl_mem parent;
+    cl_uint map_count;
+    struct mem_destructor *destructors;
+    cl_mem next_live;
+};
+
+struct event_callback {
+    struct event_callback *next;
+    cl_int type;
+    void (CL_CALLBACK *fn)(cl_event, cl_int, void *);
+    void *user_data;
+};
+
+struct _cl_event {
+    cl_uint magic, refs, holds;
+    cl_context context;
+    cl_command_queue queue;
+    cl_command_type type;
+    cl_int status;
+    cl_ulong queued, submit, start, end;
+    struct event_callback *callbacks;
+};
+
+struct kernel_param {
+    char *name;
+    char *type_name;
+    size_t size; /* 0 if unknown */
+    cl_kernel_arg_address_qualifier address;
+    cl_kernel_arg_access_qualifier access;
+    cl_kernel_arg_type_qualifier type_qualifier;
+    int is_mem;
+};
+
+struct kernel_decl {
+    char *name;
+    cl_uint num_params;
+    struct kernel_param *params;
+};
+
+struct _cl_program {
+    cl_uint magic, refs, holds;
+    cl_context context;
+    char *source;  /* as given to clCreateProgramWithSource, NULL for binaries */
+    char *text;    /* what is built: the source, or the code in the binary */
+    char *options;
+    char *log;
+    cl_build_status status;
+    cl_program_binary_type binary_type;
+    int arg_info;
+    cl_uint num_kernels;
+    struct kernel_decl *kernels;
+};
+
+struct kernel_arg {
+    int set;
+    size_t size;
+    void *value;
+};
+
+struct _cl_kernel {
+    cl_uint magic, refs, holds;
+    cl_program program;
+    struct kernel_decl *decl;
+    struct kernel_arg *args;
+};
+
+struct command {
+    struct command *next;
+    cl_event event;
+    cl_uint num_waits;
+    cl_event *waits;
+    cl_int (*run)(struct command *);
+
+    /* Memory objects used by the command, held until it completes */
+    cl_uint num_mems;
+    cl_mem *mems;
+
+    /* Transfers. Rectangles use the origins and pitches, linear transfers
+     * only the offsets and size. A NULL memory object stands for ptr. */
+    cl_mem src, dst;
+    void *ptr;
+    size_t src_offset, dst_offset, size;
+    size_t src_origin[3], dst_origin[3], region[3];
+    size_t src_row_pitch, src_slice_pitch, dst_row_pitch, dst_slice_pitch;
+    char pattern[128];
+    size_t pattern_size;
+
+    /* Kernels */
+    cl_kernel kernel;
+    cl_uint work_dim;
+    size_t global_offset[3], global_size[3], local_size[3];
+    int has_local;
+    clsim_kernel_arg *args;
+    char **arg_values;
+
+    /* Native kernels */
+    void (CL_CALLBACK *native)(void *);
+    void *native_args;
+};
+
+/* ------------------------------------------------------------------------ */
+/* Lock and deferred callbacks                                              */
+/* ------------------------------------------------------------------------ */
+
+static pthread_mutex_t sim_mu = PTHREAD_MUTEX_INITIALIZER;
+static pthread_cond_t sim_cond = PTHREAD_COND_INITIALIZER;
+static cl_mem live_mems;
+static clsim_kernel_dispatcher sim_dispatcher;
+
+enum deferred_kind {
+    DEFER_EVENT,
+    DEFER_MEM,
+    DEFER_FREE_MEM,
+    DEFER_PROGRAM,
+    DEFER_CONTEXT,
+};
+
+struct deferred {
+    struct deferred *next;
+    enum deferred_kind kind;
+    void *obj;
+    cl_int status;
+    void *fn;
+    void *user_data;
+    char *message;
+};
+
+static struct deferred *deferred_head, *deferred_tail;
+
+static void event_unhold(cl_event e);
+static void program_unhold(cl_program p);
+
+static void sim_lock(void) {
+    pthread_mutex_lock(&sim_mu);
+}
+
+static void defer(enum deferred_kind kind, void *obj, cl_int status, void *fn, void *user_data, char *message) {
+    struct deferred *d = calloc(1, sizeof(*d));
+    if (d == NULL) {
+        free(message);
+        return;
+    }
+    d->kind = kind;
+    d->obj = obj;
+    d->status = status;
+    d->fn = fn;
+    d->user_data = user_data;
+    d->message = message;
+    if (deferred_tail != NULL) {
+        deferred_tail->next = d;
+    } else {
+        deferred_head = d;
+    }
+    deferred_tail = d;
+}
+
+/* Releases the lock, then calls the callbacks deferred while it was held. */
+static void sim_unlock(void) {
+    struct deferred *d = deferred_head, *next;
+    deferred_head = deferred_tail = NULL;
+    pthread_mutex_unlock(&sim_mu);
+
+    for (; d != NULL; d = next) {
+        next = d->next;
+        switch (d->kind) {
+        case DEFER_EVENT:
+            ((void (CL_CALLBACK *)(cl_event, cl_int, void *))d->fn)(d->obj, d->status, d->user_data);
+            sim_lock();
+            event_unhold(d->obj);
+            sim_unlock();
+            break;
+        case DEFER_MEM:
+            ((void (CL_CALLBACK *)(cl_mem, void *))d->fn)(d->obj, d->user_data);
+            break;
+        case DEFER_FREE_MEM: {
+            cl_mem m = d->obj;
+            if (m->parent == NULL && !(m->flags & CL_MEM_USE_HOST_PTR)) {
+                free(m->data);
+            }
+            free(m);
+            break;
+        }
+        case DEFER_PROGRAM:
+            ((void (CL_CALLBACK *)(cl_program, void *))d->fn)(d->obj, d->user_data);
+            sim_lock();
+            program_unhold(d->obj);
+            sim_unlock();
+            break;
+        case DEFER_CONTEXT:
+            ((void (CL_CALLBACK *)(const char *, const void *, size_t, void *))d->fn)(d->message, NULL, 0, d->user_data);
+            break;
+        }
+        free(d->message);
+        free(d);
+    }
+}
+
+/* Waits with the lock held for another thread to change the state of some
+ * command or event. Pending callbacks are run first, as they may be what
+ * the caller waits for. */
+static void sim_wait(void) {
+    if (deferred_head != NULL) {
+        sim_unlock();
+        sim_lock();
+        return;
+    }
+    pthread_cond_wait(&sim_cond, &sim_mu);
+}
+
+static cl_ulong sim_now(void) {
+    struct timespec ts;
+    clock_gettime(CLOCK_MONOTONIC, &ts);
+    return (cl_ulong)ts.tv_sec * 1000000000u + (cl_ulong)ts.tv_nsec;
+}
+
+static char *sim_strdup(const char *s) {
+    size_t n = strlen(s) + 1;
+    char *d = malloc(n);
+    if (d != NULL) {
+        memcpy(d, s, n);
+    }
+    return d;
+}
+
+#define SET_ERR(err) do { if (errcode_ret != NULL) *errcode_ret = (err); } while (0)
+
+/* ------------------------------------------------------------------------ */
+/* Fault injection                                                          */
+/* ------------------------------------------------------------------------ */
+
+struct fault {
+    struct fault *next;
+    char *function;
+    cl_uint nth; /* calls left until the failing one, 0 to fail every call */
+    cl_int error;
+};
+
+struct build_fault {
+    struct build_fault *next;
+    char *match;
+    char *log;
+};
+
+static struct fault *faults;
+static struct build_fault *build_faults;
+static cl_int device_lost = CL_SUCCESS;
+
+static const char *const fault_functions[] = {
+    "clCreateContext",
+    "clCreateContextFromType",
+    "clCreateCommandQueue",
+    "clCreateUserEvent",
+    "clCreateBuffer",
+    "clCreateSubBuffer",
+    "clCreateProgramWithSource",
+    "clCreateProgramWithBinary",
+    "clBuildProgram",
+    "clCompileProgram",
+    "clLinkProgram",
+    "clCreateKernel",
+    "clCreateKernelsInProgram",
+    "clEnqueueReadBuffer",
+    "clEnqueueWriteBuffer",
+    "clEnqueueCopyBuffer",
+    "clEnqueueReadBufferRect",
+    "clEnqueueWriteBufferRect",
+    "clEnqueueCopyBufferRect",
+    "clEnqueueFillBuffer",
+    "clEnqueueMapBuffer",
+    "clEnqueueUnmapMemObject",
+    "clEnqueueMigrateMemObjects",
+    "clEnqueueMarkerWithWaitList",
+    "clEnqueueBarrierWithWaitList",
+    "clEnqueueNDRangeKernel",
+    "clEnqueueTask",
+    "clEnqueueNativeKernel",
+};
+
+/* The function enqueueing commands of type, as named by clSimInjectFault. */
+static const char *command_function(cl_command_type type) {
+    switch (type) {
+    case CL_COMMAND_READ_BUFFER:         return "clEnqueueReadBuffer";
+    case CL_COMMAND_WRITE_BUFFER:        return "clEnqueueWriteBuffer";
+    case CL_COMMAND_COPY_BUFFER:         return "clEnqueueCopyBuffer";
+    case CL_COMMAND_READ_BUFFER_RECT:    return "clEnqueueReadBufferRect";
+    case CL_COMMAND_WRITE_BUFFER_RECT:   return "clEnqueueWriteBufferRect";
+    case CL_COMMAND_COPY_BUFFER_RECT:    return "clEnqueueCopyBufferRect";
+    case CL_COMMAND_FILL_BUFFER:         return "clEnqueueFillBuffer";
+    case CL_COMMAND_MAP_BUFFER:          return "clEnqueueMapBuffer";
+    case CL_COMMAND_UNMAP_MEM_OBJECT:    return "clEnqueueUnmapMemObject";
+    case CL_COMMAND_MIGRATE_MEM_OBJECTS: return "clEnqueueMigrateMemObjects";
+    case CL_COMMAND_MARKER:              return "clEnqueueMarkerWithWaitList";
+    case CL_COMMAND_BARRIER:             return "clEnqueueBarrierWithWaitList";
+    case CL_COMMAND_NDRANGE_KERNEL:      return "clEnqueueNDRangeKernel";
+    case CL_COMMAND_TASK:                return "clEnqueueTask";
+    case CL_COMMAND_NATIVE_KERNEL:       return "clEnqueueNativeKernel";
+    }
+    return NULL;
+}
+
+/* Counts a call to function with the lock held. Returns the error it must
+ * fail with, or CL_SUCCESS. */
+static cl_int sim_fault(const char *function) {
+    struct fault **link = &faults, *f;
+    cl_int err = CL_SUCCESS;
+
+    if (function == NULL) {
+        return CL_SUCCESS;
+    }
+    while ((f = *link) != NULL) {
+        if (strcmp(f->function, function) != 0) {
+            link = &f->next;
+        } else if (f->nth == 0) {
+            err = err != CL_SUCCESS ? err : f->error;
+            link = &f->next;
+        } else if (--f->nth == 0) {
+            err = err != CL_SUCCESS ? err : f->error;
+            *link = f->next;
+            free(f->function);
+            free(f);
+        } else {
+            link = &f->next;
+        }
+    }
+    return err;
+}
+
+/* Returns the build fault matching the code of a program, if any. */
+static struct build_fault *sim_build_fault(const char *text) {
+    struct build_fault *f;
+    for (f = build_faults; f != NULL; f = f->next) {
+        if (strstr(text, f->match) != NULL) {
+            return f;
+        }
+    }
+    return NULL;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clSimInjectFault(const char *function, cl_uint nth, cl_int error) {
+    struct fault *f;
+    size_t i;
+
+    if (function == NULL || error >= 0) {
+        return CL_INVALID_VALUE;
+    }
+    for (i = 0; i < sizeof(fault_functions) / sizeof(fault_functions[0]); i++) {
+        if (strcmp(fault_functions[i], function) == 0) {
+            break;
+        }
+    }
+    if (i == sizeof(fault_functions) / sizeof(fault_functions[0])) {
+        return CL_INVALID_VALUE;
+    }
+    if ((f = calloc(1, sizeof(*f))) == NULL || (f->function = sim_strdup(function)) == NULL) {
+        free(f);
+        return CL_OUT_OF_HOST_MEMORY;
+    }
+    f->nth = nth;
+    f->error = error;
+    sim_lock();
+    f->next = faults;
+    faults = f;
+    sim_unlock();
+    return CL_SUCCESS;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clSimInjectBuildFault(const char *match, const char *build_log) {
+    struct build_fault *f, **link;
+
+    if (match == NULL || build_log == NULL) {
+        return CL_INVALID_VALUE;
+    }
+    if ((f = calloc(1, sizeof(*f))) == NULL ||
+        (f->match = sim_strdup(match)) == NULL || (f->log = sim_strdup(build_log)) == NULL) {
+        if (f != NULL) {
+            free(f->match);
+        }
+        free(f);
+        return CL_OUT_OF_HOST_MEMORY;
+    }
+    sim_lock();
+    /* Faults injected first take precedence */
+    for (link = &build_faults; *link != NULL; link = &(*link)->next) {
+    }
+    *link = f;
+    sim_unlock();
+    return CL_SUCCESS;
+}
+
+CL_API_ENTRY void CL_API_CALL
+clSimSetDeviceLost(cl_int error) {
+    sim_lock();
+    device_lost = error < 0 ? error : CL_SUCCESS;
+    sim_unlock();
+}
+
+CL_API_ENTRY void CL_API_CALL
+clSimClearFaults(void) {
+    struct fault *f;
+    struct build_fault *b;
+
+    sim_lock();
+    while ((f = faults) != NULL) {
+        faults = f->next;
+        free(f->function);
+        free(f);
+    }
+    while ((b = build_faults) != NULL) {
+        build_faults = b->next;
+        free(b->match);
+        free(b->log);
+        free(b);
+    }
+    device_lost = CL_SUCCESS;
+    sim_unlock();
+}
+
+/* ------------------------------------------------------------------------ */
+/* Info queries                                                             */
+/* ------------------------------------------------------------------------ */
+
+static cl_int info(const void *src, size_t src_size, size_t size, void *value, size_t *size_ret) {
+    if (value != NULL) {
+        if (size < src_size) {
+            return CL_INVALID_VALUE;
+        }
+        memcpy(value, src, src_size);
+    }
+    if (size_ret != NULL) {
+        *size_ret = src_size;
+    }
+    return CL_SUCCESS;
+}
+
+#define INFO(T, v) do { T info_v_ = (v); return info(&info_v_, sizeof(info_v_), size, value, size_ret); } while (0)
+#define INFO_STR(s) return info((s), strlen(s) + 1, size, value, size_ret)
+
+/* ------------------------------------------------------------------------ */
+/* Platform and device                                                      */
+/* ------------------------------------------------------------------------ */
+
+CL_API_ENTRY void CL_API_CALL
+clSimSetKernelDispatcher(clsim_kernel_dispatcher dispatcher) {
+    sim_lock();
+    sim_dispatcher = dispatcher;
+    sim_unlock();
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clGetPlatformIDs(cl_uint          num_entries,
+                 cl_platform_id * platforms,
+                 cl_uint *        num_platforms) {
+    if ((num_entries == 0 && platforms != NULL) || (platforms == NULL && num_platforms == NULL)) {
+        return CL_INVALID_VALUE;
+    }
+    if (platforms != NULL) {
+        platforms[0] = &sim_platform;
+    }
+    if (num_platforms != NULL) {
+        *num_platforms = 1;
+    }
+    return CL_SUCCESS;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clGetPlatformInfo(cl_platform_id   platform,
+                  cl_platform_info param_name,
+                  size_t           size,
+                  void *           value,
+                  size_t *         size_ret) {
+    if (platform != NULL && platform != &sim_platform) {
+        return CL_INVALID_PLATFORM;
+    }
+    switch (param_name) {
+    case CL_PLATFORM_PROFILE:    INFO_STR("FULL_PROFILE");
+    case CL_PLATFORM_VERSION:    INFO_STR(SIM_VERSION);
+    case CL_PLATFORM_NAME:       INFO_STR(CLSIM_PLATFORM_NAME);
+    case CL_PLATFORM_VENDOR:     INFO_STR(SIM_VENDOR);
+    case CL_PLATFORM_EXTENSIONS: INFO_STR("");
+    }
+    return CL_INVALID_VALUE;
+}
+
+CL_API_ENTRY void * CL_API_CALL
+clGetExtensionFunctionAddressForPlatform(cl_platform_id platform,
+                                         const char *   func_name) {
+    if (platform != &sim_platform || func_name == NULL) {
+        return NULL;
+    }
+    if (strcmp(func_name, "clSimSetKernelDispatcher") == 0) {
+        return (void *)clSimSetKernelDispatcher;
+    }
+    if (strcmp(func_name, "clSimInjectFault") == 0) {
+        return (void *)clSimInjectFault;
+    }
+    if (strcmp(func_name, "clSimInjectBuildFault") == 0) {
+        return (void *)clSimInjectBuildFault;
+    }
+    if (strcmp(func_name, "clSimSetDeviceLost") == 0) {
+        return (void *)clSimSetDeviceLost;
+    }
+    if (strcmp(func_name, "clSimClearFaults") == 0) {
+        return (void *)clSimClearFaults;
+    }
+    return NULL;
+}
+
+CL_API_ENTRY void * CL_API_CALL
+clGetExtensionFunctionAddress(const char * func_name) {
+    return clGetExtensionFunctionAddressForPlatform(&sim_platform, func_name);
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clUnloadPlatformCompiler(cl_platform_id platform) {
+    return platform == &sim_platform ? CL_SUCCESS : CL_INVALID_PLATFORM;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clUnloadCompiler(void) {
+    return CL_SUCCESS;
+}
+
+static int device_type_matches(cl_device_type type) {
+    return (type & (CL_DEVICE_TYPE_CPU | CL_DEVICE_TYPE_DEFAULT)) != 0 || type == CL_DEVICE_TYPE_ALL;
+}
+
+static int device_type_valid(cl_device_type type) {
+    return type == CL_DEVICE_TYPE_ALL ||
+        (type & ~(cl_device_type)(CL_DEVICE_TYPE_DEFAULT | CL_DEVICE_TYPE_CPU | CL_DEVICE_TYPE_GPU |
+                                  CL_DEVICE_TYPE_ACCELERATOR | CL_DEVICE_TYPE_CUSTOM)) == 0;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clGetDeviceIDs(cl_platform_id   platform,
+               cl_device_type   device_type,
+               cl_uint          num_entries,
+               cl_device_id *   devices,
+               cl_uint *        num_devices) {
+    if (platform != NULL && platform != &sim_platform) {
+        return CL_INVALID_PLATFORM;
+    }
+    if (!device_type_valid(device_type)) {
+        return CL_INVALID_DEVICE_TYPE;
+    }
+    if ((num_entries == 0 && devices != NULL) || (devices == NULL && num_devices == NULL)) {
+        return CL_INVALID_VALUE;
+    }
+    if (!device_type_matches(device_type)) {
+        if (num_devices != NULL) {
+            *num_devices = 0;
+        }
+        return CL_DEVICE_NOT_FOUND;
+    }
+    if (devices != NULL) {
+        devices[0] = &sim_device;
+    }
+    if (num_devices != NULL) {
+        *num_devices = 1;
+    }
+    return CL_SUCCESS;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clGetDeviceInfo(cl_device_id    device,
+                cl_device_info  param_name,
+                size_t          size,
+                void *          value,
+                size_t *        size_ret) {
+    static const size_t max_work_item_sizes[3] = {SIM_MAX_WORK_GROUP, SIM_MAX_WORK_GROUP, SIM_MAX_WORK_GROUP};
+    const cl_device_fp_config fp_config = CL_FP_DENORM | CL_FP_INF_NAN | CL_FP_ROUND_TO_NEAREST |
+        CL_FP_ROUND_TO_ZERO | CL_FP_ROUND_TO_INF | CL_FP_FMA;
+
+    if (device != &sim_device) {
+        return CL_INVALID_DEVICE;
+    }
+    switch (param_name) {
+    case CL_DEVICE_TYPE:                          INFO(cl_device_type, CL_DEVICE_TYPE_CPU);
+    case CL_DEVICE_VENDOR_ID:                     INFO(cl_uint, 0);
+    case CL_DEVICE_MAX_COMPUTE_UNITS:             INFO(cl_uint, 1);
+    case CL_DEVICE_MAX_WORK_ITEM_DIMENSIONS:      INFO(cl_uint, 3);
+    case CL_DEVICE_MAX_WORK_GROUP_SIZE:           INFO(size_t, SIM_MAX_WORK_GROUP);
+    case CL_DEVICE_MAX_WORK_ITEM_SIZES:
+        return info(max_work_item_sizes, sizeof(max_work_item_sizes), size, value, size_ret);
+    case CL_DEVICE_PREFERRED_VECTOR_WIDTH_CHAR:   INFO(cl_uint, 16);
+    case CL_DEVICE_PREFERRED_VECTOR_WIDTH_SHORT:  INFO(cl_uint, 8);
+    case CL_DEVICE_PREFERRED_VECTOR_WIDTH_INT:    INFO(cl_uint, 4);
+    case CL_DEVICE_PREFERRED_VECTOR_WIDTH_LONG:   INFO(cl_uint, 2);
+    case CL_DEVICE_PREFERRED_VECTOR_WIDTH_FLOAT:  INFO(cl_uint, 4);
+    case CL_DEVICE_PREFERRED_VECTOR_WIDTH_DOUBLE: INFO(cl_uint, 2);
+    case CL_DEVICE_PREFERRED_VECTOR_WIDTH_HALF:   INFO(cl_uint, 8);
+    case CL_DEVICE_NATIVE_VECTOR_WIDTH_CHAR:      INFO(cl_uint, 16);
+    case CL_DEVICE_NATIVE_VECTOR_WIDTH_SHORT:     INFO(cl_uint, 8);
+    case CL_DEVICE_NATIVE_VECTOR_WIDTH_INT:       INFO(cl_uint, 4);
+    case CL_DEVICE_NATIVE_VECTOR_WIDTH_LONG:      INFO(cl_uint, 2);
+    case CL_DEVICE_NATIVE_VECTOR_WIDTH_FLOAT:     INFO(cl_uint, 4);
+    case CL_DEVICE_NATIVE_VECTOR_WIDTH_DOUBLE:    INFO(cl_uint, 2);
+    case CL_DEVICE_NATIVE_VECTOR_WIDTH_HALF:      INFO(cl_uint, 8);
+    case CL_DEVICE_MAX_CLOCK_FREQUENCY:           INFO(cl_uint, 1000);
+    case CL_DEVICE_ADDRESS_BITS:                  INFO(cl_uint, sizeof(void *) * 8);
+    case CL_DEVICE_MAX_READ_IMAGE_ARGS:           INFO(cl_uint, 0);
+    case CL_DEVICE_MAX_WRITE_IMAGE_ARGS:          INFO(cl_uint, 0);
+    case CL_DEVICE_MAX_MEM_ALLOC_SIZE:            INFO(cl_ulong, SIM_MAX_ALLOC);
+    case CL_DEVICE_IMAGE2D_MAX_WIDTH:             INFO(size_t, 0);
+    case CL_DEVICE_IMAGE2D_MAX_HEIGHT:            INFO(size_t, 0);
+    case CL_DEVICE_IMAGE3D_MAX_WIDTH:             INFO(size_t, 0);
+    case CL_DEVICE_IMAGE3D_MAX_HEIGHT:            INFO(size_t, 0);
+    case CL_DEVICE_IMAGE3D_MAX_DEPTH:             INFO(size_t, 0);
+    case CL_DEVICE_IMAGE_MAX_BUFFER_SIZE:         INFO(size_t, 0);
+    case CL_DEVICE_IMAGE_MAX_ARRAY_SIZE:          INFO(size_t, 0);
+    case CL_DEVICE_IMAGE_SUPPORT:                 INFO(cl_bool, CL_FALSE);
+    case CL_DEVICE_MAX_PARAMETER_SIZE:            INFO(size_t, 1024);
+    case CL_DEVICE_MAX_SAMPLERS:                  INFO(cl_uint, 0);
+    case CL_DEVICE_MEM_BASE_ADDR_ALIGN:           INFO(cl_uint, SIM_BASE_ADDR_ALIGN);
+    case CL_DEVICE_MIN_DATA_TYPE_ALIGN_SIZE:      INFO(cl_uint, 128);
+    case CL_DEVICE_SINGLE_FP_CONFIG:              INFO(cl_device_fp_config, fp_config);
+    case CL_DEVICE_DOUBLE_FP_CONFIG:              INFO(cl_device_fp_config, fp_config);
+    case CL_DEVICE_HALF_FP_CONFIG:                INFO(cl_device_fp_config, 0);
+    case CL_DEVICE_GLOBAL_MEM_CACHE_TYPE:         INFO(cl_device_mem_cache_type, CL_READ_WRITE_CACHE);
+    case CL_DEVICE_GLOBAL_MEM_CACHELINE_SIZE:     INFO(cl_uint, 64);
+    case CL_DEVICE_GLOBAL_MEM_CACHE_SIZE:         INFO(cl_ulong, 1 << 20);
+    case CL_DEVICE_GLOBAL_MEM_SIZE:               INFO(cl_ulong, SIM_GLOBAL_MEM);
+    case CL_DEVICE_MAX_CONSTANT_BUFFER_SIZE:      INFO(cl_ulong, 64 << 10);
+    case CL_DEVICE_MAX_CONSTANT_ARGS:             INFO(cl_uint, 8);
+    case CL_DEVICE_LOCAL_MEM_TYPE:                INFO(cl_device_local_mem_type, CL_GLOBAL);
+    case CL_DEVICE_LOCAL_MEM_SIZE:                INFO(cl_ulong, SIM_LOCAL_MEM);
+    case CL_DEVICE_ERROR_CORRECTION_SUPPORT:      INFO(cl_bool, CL_FALSE);
+    case CL_DEVICE_HOST_UNIFIED_MEMORY:           INFO(cl_bool, CL_TRUE);
+    case CL_DEVICE_PROFILING_TIMER_RESOLUTION:    INFO(size_t, 1);
+    case CL_DEVICE_ENDIAN_LITTLE:                 INFO(cl_bool, CL_TRUE);
+    case CL_DEVICE_AVAILABLE:                     INFO(cl_bool, device_lost == CL_SUCCESS);
+    case CL_DEVICE_COMPILER_AVAILABLE:            INFO(cl_bool, CL_TRUE);
+    case CL_DEVICE_LINKER_AVAILABLE:              INFO(cl_bool, CL_TRUE);
+    case CL_DEVICE_EXECUTION_CAPABILITIES:        INFO(cl_device_exec_capabilities, CL_EXEC_KERNEL | CL_EXEC_NATIVE_KERNEL);
+    case CL_DEVICE_QUEUE_PROPERTIES:
+        INFO(cl_command_queue_properties, CL_QUEUE_OUT_OF_ORDER_EXEC_MODE_ENABLE | CL_QUEUE_PROFILING_ENABLE);
+    case CL_DEVICE_BUILT_IN_KERNELS:              INFO_STR("");
+    case CL_DEVICE_PLATFORM:                      INFO(cl_platform_id, &sim_platform);
+    case CL_DEVICE_NAME:                          INFO_STR(SIM_DEVICE_NAME);
+    case CL_DEVICE_VENDOR:                        INFO_STR(SIM_VENDOR);
+    case CL_DRIVER_VERSION:                       INFO_STR(SIM_DRIVER_VERSION);
+    case CL_DEVICE_PROFILE:                       INFO_STR("FULL_PROFILE");
+    case CL_DEVICE_VERSION:                       INFO_STR(SIM_VERSION);
+    case CL_DEVICE_OPENCL_C_VERSION:              INFO_STR("OpenCL C 1.2 go2opencl-sim");
+    case CL_DEVICE_EXTENSIONS:                    INFO_STR("cl_khr_fp64 cl_khr_byte_addressable_store");
+    case CL_DEVICE_PRINTF_BUFFER_SIZE:            INFO(size_t, 1 << 20);
+    case CL_DEVICE_PREFERRED_INTEROP_USER_SYNC:   INFO(cl_bool, CL_TRUE);
+    case CL_DEVICE_PARENT_DEVICE:                 INFO(cl_device_id, NULL);
+    case CL_DEVICE_PARTITION_MAX_SUB_DEVICES:     INFO(cl_uint, 0);
+    case CL_DEVICE_PARTITION_PROPERTIES:          INFO(cl_device_partition_property, 0);
+    case CL_DEVICE_PARTITION_AFFINITY_DOMAIN:     INFO(cl_device_affinity_domain, 0);
+    case CL_DEVICE_PARTITION_TYPE:                INFO(cl_device_partition_property, 0);
+    case CL_DEVICE_REFERENCE_COUNT:               INFO(cl_uint, 1);
+    }
+    return CL_INVALID_VALUE;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clCreateSubDevices(cl_device_id                         in_device,
+                   const cl_device_partition_property * properties,
+                   cl_uint                              num_devices,
+                   cl_device_id *                       out_devices,
+                   cl_uint *                            num_devices_ret) {
+    if (in_device != &sim_device) {
+        return CL_INVALID_DEVICE;
+    }
+    return properties == NULL ? CL_INVALID_VALUE : CL_DEVICE_PARTITION_FAILED;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clRetainDevice(cl_device_id device) {
+    return device == &sim_device ? CL_SUCCESS : CL_INVALID_DEVICE;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clReleaseDevice(cl_device_id device) {
+    return device == &sim_device ? CL_SUCCESS : CL_INVALID_DEVICE;
+}
+
+static cl_int check_devices(cl_uint num_devices, const cl_device_id *devices) {
+    cl_uint i;
+    if ((num_devices == 0) != (devices == NULL)) {
+        return CL_INVALID_VALUE;
+    }
+    for (i = 0; i < num_devices; i++) {
+        if (devices[i] != &sim_device) {
+            return CL_INVALID_DEVICE;
+        }
+    }
+    return CL_SUCCESS;
+}
+
+/* ------------------------------------------------------------------------ */
+/* Context                                                                  */
+/* ------------------------------------------------------------------------ */
+
+static int is_context(cl_context c) {
+    return c != NULL && c->magic == MAGIC_CONTEXT;
+}
+
+static void context_maybe_free(cl_context c) {
+    if (c->refs == 0 && c->holds == 0) {
+        c->magic = 0;
+        free(c);
+    }
+}
+
+static void context_unhold(cl_context c) {
+    c->holds--;
+    context_maybe_free(c);
+}
+
+static cl_context context_new(const cl_context_properties *properties,
+                              void (CL_CALLBACK *pfn_notify)(const char *, const void *, size_t, void *),
+                              void *user_data, cl_int *errcode_ret) {
+    cl_context c;
+    size_t n = 0;
+
+    if (pfn_notify == NULL && user_data != NULL) {
+        SET_ERR(CL_INVALID_VALUE);
+        return NULL;
+    }
+    if (properties != NULL) {
+        for (; properties[n] != 0; n += 2) {
+            if (properties[n] != CL_CONTEXT_PLATFORM || n > 0) {
+                SET_ERR(CL_INVALID_PROPERTY);
+                return NULL;
+            }
+            if ((cl_platform_id)properties[n + 1] != &sim_platform) {
+                SET_ERR(CL_INVALID_PLATFORM);
+                return NULL;
+            }
+        }
+    }
+    c = calloc(1, sizeof(*c));
+    if (c == NULL) {
+        SET_ERR(CL_OUT_OF_HOST_MEMORY);
+        return NULL;
+    }
+    c->magic = MAGIC_CONTEXT;
+    c->refs = 1;
+    if (properties != NULL) {
+        memcpy(c->props, properties, (n + 1) * sizeof(properties[0]));
+        c->props_size = (n + 1) * sizeof(properties[0]);
+    }
+    c->notify = pfn_notify;
+    c->notify_data = user_data;
+    SET_ERR(CL_SUCCESS);
+    return c;
+}
+
+CL_API_ENTRY cl_context CL_API_CALL
+clCreateContext(const cl_context_properties * properties,
+                cl_uint                       num_devices,
+                const cl_device_id *          devices,
+                void (CL_CALLBACK * pfn_notify)(const char * errinfo,
+                                                const void * private_info,
+                                                size_t       cb,
+                                                void *       user_data),
+                void *                        user_data,
+                cl_int *                      errcode_ret) {
+    cl_int err;
+    cl_context c;
+
+    if (num_devices == 0 || devices == NULL) {
+        SET_ERR(CL_INVALID_VALUE);
+        return NULL;
+    }
+    if ((err = check_devices(num_devices, devices)) != CL_SUCCESS) {
+        SET_ERR(err);
+        return NULL;
+    }
+    sim_lock();
+    if ((err = sim_fault("clCreateContext")) != CL_SUCCESS) {
+        SET_ERR(err);
+        c = NULL;
+    } else {
+        c = context_new(properties, pfn_notify, user_data, errcode_ret);
+    }
+    sim_unlock();
+    return c;
+}
+
+CL_API_ENTRY cl_context CL_API_CALL
+clCreateContextFromType(const cl_context_properties * properties,
+                        cl_device_type                device_type,
+                        void (CL_CALLBACK * pfn_notify)(const char * errinfo,
+                                                        const void * private_info,
+                                                        size_t       cb,
+                                                        void *       user_data),
+                        void *                        user_data,
+                        cl_int *                      errcode_ret) {
+    cl_int err;
+    cl_context c;
+
+    if (!device_type_valid(device_type)) {
+        SET_ERR(CL_INVALID_DEVICE_TYPE);
+        return NULL;
+    }
+    if (!device_type_matches(device_type)) {
+        SET_ERR(CL_DEVICE_NOT_FOUND);
+        return NULL;
+    }
+    sim_lock();
+    if ((err = sim_fault("clCreateContextFromType")) != CL_SUCCESS) {
+        SET_ERR(err);
+        c = NULL;
+    } else {
+        c = context_new(properties, pfn_notify, user_data, errcode_ret);
+    }
+    sim_unlock();
+    return c;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clRetainContext(cl_context context) {
+    cl_int err = CL_INVALID_CONTEXT;
+    sim_lock();
+    if (is_context(context)) {
+        context->refs++;
+        err = CL_SUCCESS;
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clReleaseContext(cl_context context) {
+    cl_int err = CL_INVALID_CONTEXT;
+    sim_lock();
+    if (is_context(context) && context->refs > 0) {
+        context->refs--;
+        context_maybe_free(context);
+        err = CL_SUCCESS;
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clGetContextInfo(cl_context         context,
+                 cl_context_info    param_name,
+                 size_t             size,
+                 void *             value,
+                 size_t *           size_ret) {
+    if (!is_context(context)) {
+        return CL_INVALID_CONTEXT;
+    }
+    switch (param_name) {
+    case CL_CONTEXT_REFERENCE_COUNT: INFO(cl_uint, context->refs);
+    case CL_CONTEXT_NUM_DEVICES:     INFO(cl_uint, 1);
+    case CL_CONTEXT_DEVICES:         INFO(cl_device_id, &sim_device);
+    case CL_CONTEXT_PROPERTIES:
+        return info(context->props, context->props_size, size, value, size_ret);
+    }
+    return CL_INVALID_VALUE;
+}
+
+/* Reports an error to the notification function of the context, if any. */
+static void context_notify(cl_context c, const char *message) {
+    if (c->notify != NULL) {
+        defer(DEFER_CONTEXT, c, 0, (void *)c->notify, c->notify_data, sim_strdup(message));
+    }
+}
+
+/* ------------------------------------------------------------------------ */
+/* Events                                                                   */
+/* ------------------------------------------------------------------------ */
+
+static int is_event(cl_event e) {
+    return e != NULL && e->magic == MAGIC_EVENT;
+}
+
+static void queue_unhold(cl_command_queue q);
+
+static void event_maybe_free(cl_event e) {
+    struct event_callback *cb, *next;
+    if (e->refs != 0 || e->holds != 0) {
+        return;
+    }
+    for (cb = e->callbacks; cb != NULL; cb = next) {
+        next = cb->next;
+        free(cb);
+    }
+    e->magic = 0;
+    if (e->queue != NULL) {
+        queue_unhold(e->queue);
+    }
+    context_unhold(e->context);
+    free(e);
+}
+
+static void event_unhold(cl_event e) {
+    e->holds--;
+    event_maybe_free(e);
+}
+
+static cl_event event_new(cl_context c, cl_command_queue q, cl_command_type type) {
+    cl_event e = calloc(1, sizeof(*e));
+    if (e == NULL) {
+        return NULL;
+    }
+    e->magic = MAGIC_EVENT;
+    e->context = c;
+    c->holds++;
+    e->queue = q;
+    if (q != NULL) {
+        q->holds++;
+    }
+    e->type = type;
+    e->status = type == CL_COMMAND_USER ? CL_SUBMITTED : CL_QUEUED;
+    e->queued = sim_now();
+    return e;
+}
+
+/* Calls the callbacks registered for the new status. */
+static void event_notify(cl_event e) {
+    struct event_callback **link = &e->callbacks, *cb;
+    while ((cb = *link) != NULL) {
+        if (e->status <= cb->type) {
+            *link = cb->next;
+            e->holds++;
+            defer(DEFER_EVENT, e, e->status < 0 ? e->status : cb->type, (void *)cb->fn, cb->user_data, NULL);
+            free(cb);
+        } else {
+            link = &cb->next;
+        }
+    }
+}
+
+static void event_set_status(cl_event e, cl_int status) {
+    cl_ulong now = sim_now();
+    switch (status) {
+    case CL_SUBMITTED:
+        e->submit = now;
+        break;
+    case CL_RUNNING:
+        e->start = now;
+        break;
+    default:
+        e->end = now;
+        break;
+    }
+    e->status = status;
+    event_notify(e);
+    pthread_cond_broadcast(&sim_cond);
+}
+
+CL_API_ENTRY cl_event CL_API_CALL
+clCreateUserEvent(cl_context context,
+                  cl_int *   errcode_ret) {
+    cl_event e = NULL;
+    cl_int err;
+    sim_lock();
+    if (!is_context(context)) {
+        SET_ERR(CL_INVALID_CONTEXT);
+    } else if ((err = sim_fault("clCreateUserEvent")) != CL_SUCCESS) {
+        SET_ERR(err);
+    } else if ((e = event_new(context, NULL, CL_COMMAND_USER)) == NULL) {
+        SET_ERR(CL_OUT_OF_HOST_MEMORY);
+    } else {
+        e->refs = 1;
+        e->submit = e->queued;
+        SET_ERR(CL_SUCCESS);
+    }
+    sim_unlock();
+    return e;
+}
+
+static void schedule(cl_context c);
+
+CL_API_ENTRY cl_int CL_API_CALL
+clSetUserEventStatus(cl_event event,
+                     cl_int   execution_status) {
+    cl_int err = CL_SUCCESS;
+    sim_lock();
+    if (!is_event(event) || event->type != CL_COMMAND_USER) {
+        err = CL_INVALID_EVENT;
+    } else if (execution_status > CL_COMPLETE) {
+        err = CL_INVALID_VALUE;
+    } else if (event->status <= CL_COMPLETE) {
+        err = CL_INVALID_OPERATION;
+    } else {
+        event->start = sim_now();
+        event_set_status(event, execution_status);
+        schedule(event->context);
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clRetainEvent(cl_event event) {
+    cl_int err = CL_INVALID_EVENT;
+    sim_lock();
+    if (is_event(event)) {
+        event->refs++;
+        err = CL_SUCCESS;
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clReleaseEvent(cl_event event) {
+    cl_int err = CL_INVALID_EVENT;
+    sim_lock();
+    if (is_event(event) && event->refs > 0) {
+        event->refs--;
+        event_maybe_free(event);
+        err = CL_SUCCESS;
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clGetEventInfo(cl_event         event,
+               cl_event_info    param_name,
+               size_t           size,
+               void *           value,
+               size_t *         size_ret) {
+    cl_int err = CL_INVALID_VALUE;
+    sim_lock();
+    if (!is_event(event)) {
+        err = CL_INVALID_EVENT;
+    } else {
+        switch (param_name) {
+        case CL_EVENT_COMMAND_QUEUE:
+            err = info(&event->queue, sizeof(event->queue), size, value, size_ret);
+            break;
+        case CL_EVENT_CONTEXT:
+            err = info(&event->context, sizeof(event->context), size, value, size_ret);
+            break;
+        case CL_EVENT_COMMAND_TYPE:
+            err = info(&event->type, sizeof(event->type), size, value, size_ret);
+            break;
+        case CL_EVENT_COMMAND_EXECUTION_STATUS:
+            err = info(&event->status, sizeof(event->status), size, value, size_ret);
+            break;
+        case CL_EVENT_REFERENCE_COUNT:
+            err = info(&event->refs, sizeof(event->refs), size, value, size_ret);
+            break;
+        }
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clGetEventProfilingInfo(cl_event            event,
+                        cl_profiling_info   param_name,
+                        size_t              size,
+                        void *              value,
+                        size_t *            size_ret) {
+    cl_int err = CL_INVALID_VALUE;
+    sim_lock();
+    if (!is_event(event)) {
+        err = CL_INVALID_EVENT;
+    } else if (event->queue == NULL || !(event->queue->props & CL_QUEUE_PROFILING_ENABLE) ||
+               event->status != CL_COMPLETE) {
+        err = CL_PROFILING_INFO_NOT_AVAILABLE;
+    } else {
+        switch (param_name) {
+        case CL_PROFILING_COMMAND_QUEUED:
+            err = info(&event->queued, sizeof(cl_ulong), size, value, size_ret);
+            break;
+        case CL_PROFILING_COMMAND_SUBMIT:
+            err = info(&event->submit, sizeof(cl_ulong), size, value, size_ret);
+            break;
+        case CL_PROFILING_COMMAND_START:
+            err = info(&event->start, sizeof(cl_ulong), size, value, size_ret);
+            break;
+        case CL_PROFILING_COMMAND_END:
+            err = info(&event->end, sizeof(cl_ulong), size, value, size_ret);
+            break;
+        }
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clSetEventCallback(cl_event    event,
+                   cl_int      command_exec_callback_type,
+                   void (CL_CALLBACK * pfn_notify)(cl_event event,
+                                                   cl_int   event_command_status,
+                                                   void *   user_data),
+                   void *      user_data) {
+    cl_int err = CL_SUCCESS;
+    struct event_callback *cb, **link;
+
+    if (pfn_notify == NULL || (command_exec_callback_type != CL_COMPLETE &&
+                               command_exec_callback_type != CL_RUNNING &&
+                               command_exec_callback_type != CL_SUBMITTED)) {
+        return CL_INVALID_VALUE;
+    }
+    sim_lock();
+    if (!is_event(event)) {
+        err = CL_INVALID_EVENT;
+    } else if ((cb = calloc(1, sizeof(*cb))) == NULL) {
+        err = CL_OUT_OF_HOST_MEMORY;
+    } else {
+        cb->type = command_exec_callback_type;
+        cb->fn = pfn_notify;
+        cb->user_data = user_data;
+        for (link = &event->callbacks; *link != NULL; link = &(*link)->next) {
+        }
+        *link = cb;
+        event_notify(event);
+    }
+    sim_unlock();
+    return err;
+}
+
+static cl_int check_wait_list(cl_context c, cl_uint num_events, const cl_event *events) {
+    cl_uint i;
+    if ((num_events == 0) != (events == NULL)) {
+        return CL_INVALID_EVENT_WAIT_LIST;
+    }
+    for (i = 0; i < num_events; i++) {
+        if (!is_event(events[i])) {
+            return CL_INVALID_EVENT_WAIT_LIST;
+        }
+        if (c != NULL && events[i]->context != c) {
+            return CL_INVALID_CONTEXT;
+        }
+    }
+    return CL_SUCCESS;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clWaitForEvents(cl_uint          num_events,
+                const cl_event * event_list) {
+    cl_int err;
+    cl_uint i;
+
+    if (num_events == 0 || event_list == NULL) {
+        return CL_INVALID_VALUE;
+    }
+    sim_lock();
+    err = check_wait_list(NULL, num_events, event_list);
+    if (err == CL_INVALID_EVENT_WAIT_LIST) {
+        err = CL_INVALID_EVENT;
+    }
+    for (i = 1; err == CL_SUCCESS && i < num_events; i++) {
+        if (event_list[i]->context != event_list[0]->context) {
+            err = CL_INVALID_CONTEXT;
+        }
+    }
+    if (err == CL_SUCCESS) {
+        for (i = 0; i < num_events; i++) {
+            event_list[i]->holds++;
+        }
+        schedule(event_list[0]->context);
+        for (i = 0; i < num_events; i++) {
+            while (event_list[i]->status > CL_COMPLETE) {
+                sim_wait();
+            }
+            if (event_list[i]->status < 0) {
+                err = CL_EXEC_STATUS_ERROR_FOR_EVENTS_IN_WAIT_LIST;
+            }
+        }
+        for (i = 0; i < num_events; i++) {
+            event_unhold(event_list[i]);
+        }
+    }
+    sim_unlock();
+    return err;
+}
+
+/* ------------------------------------------------------------------------ */
+/* Command queues and scheduling                                            */
+/* ------------------------------------------------------------------------ */
+
+static int is_queue(cl_command_queue q) {
+    return q != NULL && q->magic == MAGIC_QUEUE;
+}
+
+static void queue_maybe_free(cl_command_queue q) {
+    cl_command_queue *link;
+    if (q->refs != 0 || q->holds != 0 || q->head != NULL) {
+        return;
+    }
+    for (link = &q->context->queues; *link != NULL; link = &(*link)->next) {
+        if (*link == q) {
+            *link = q->next;
+            break;
+        }
+    }
+    q->magic = 0;
+    context_unhold(q->context);
+    free(q);
+}
+
+static void queue_unhold(cl_command_queue q) {
+    q->holds--;
+    queue_maybe_free(q);
+}
+
+static void mem_unhold(cl_mem m);
+static void kernel_maybe_free(cl_kernel k);
+
+static void command_free(struct command *c) {
+    cl_uint i;
+    for (i = 0; i < c->num_waits; i++) {
+        event_unhold(c->waits[i]);
+    }
+    for (i = 0; i < c->num_mems; i++) {
+        mem_unhold(c->mems[i]);
+    }
+    if (c->arg_values != NULL) {
+        for (i = 0; i < c->kernel->decl->num_params; i++) {
+            free(c->arg_values[i]);
+        }
+    }
+    free(c->arg_values);
+    if (c->kernel != NULL) {
+        c->kernel->holds--;
+        kernel_maybe_free(c->kernel);
+    }
+    free(c->args);
+    free(c->waits);
+    free(c->mems);
+    free(c->native_args);
+    if (c->event != NULL) {
+        event_unhold(c->event);
+    }
+    free(c);
+}
+
+/* Keeps m alive until the command completes. */
+static cl_int command_hold(struct command *c, cl_mem m) {
+    cl_mem *mems = realloc(c->mems, (c->num_mems + 1) * sizeof(*mems));
+    if (mems == NULL) {
+        return CL_OUT_OF_HOST_MEMORY;
+    }
+    c->mems = mems;
+    c->mems[c->num_mems++] = m;
+    m->holds++;
+    return CL_SUCCESS;
+}
+
+/* Returns the error a command must fail with when the device is lost or
+ * a fault was injected, and notifies the context. */
+static cl_int command_fault(cl_command_queue q, struct command *c) {
+    char message[256];
+    cl_int err = device_lost;
+
+    if (err != CL_SUCCESS) {
+        snprintf(message, sizeof(message), CLSIM_PLATFORM_NAME ": device lost (error %d)", err);
+    } else if ((err = sim_fault(command_function(c->event->type))) != CL_SUCCESS) {
+        snprintf(message, sizeof(message), CLSIM_PLATFORM_NAME ": %s failed with error %d",
+                 command_function(c->event->type), err);
+    } else {
+        return CL_SUCCESS;
+    }
+    context_notify(q->context, message);
+    return err;
+}
+
+/* Runs the commands of q whose wait lists are complete, in order.
+ * Returns whether any command ran. */
+static int queue_process(cl_command_queue q) {
+    struct command *c;
+    cl_uint i;
+    int progress = 0;
+
+    while ((c = q->head) != NULL) {
+        cl_int err = CL_SUCCESS;
+        for (i = 0; i < c->num_waits; i++) {
+            if (c->waits[i]->status > CL_COMPLETE) {
+                return progress;
+            }
+            if (c->waits[i]->status < 0) {
+                err = CL_EXEC_STATUS_ERROR_FOR_EVENTS_IN_WAIT_LIST;
+            }
+        }
+        q->head = c->next;
+        if (q->head == NULL) {
+            q->tail = NULL;
+        }
+        progress = 1;
+
+        event_set_status(c->event, CL_SUBMITTED);
+        if (err == CL_SUCCESS) {
+            event_set_status(c->event, CL_RUNNING);
+            err = command_fault(q, c);
+            if (err == CL_SUCCESS && c->run != NULL) {
+                err = c->run(c);
+            }
+        }
+        event_set_status(c->event, err == CL_SUCCESS ? CL_COMPLETE : err);
+        command_free(c);
+    }
+    return progress;
+}
+
+/* Runs every command of the context that can run. */
+static void schedule(cl_context c) {
+    cl_command_queue q, next;
+    int progress;
+    do {
+        progress = 0;
+        for (q = c->queues; q != NULL; q = next) {
+            next = q->next;
+            q->holds++;
+            progress |= queue_process(q);
+            next = q->next;
+            queue_unhold(q);
+        }
+    } while (progress);
+}
+
+/* Appends c to q and runs what can run. Takes ownership of c. If blocking,
+ * waits for c to complete. */
+static cl_int enqueue(cl_command_queue q, cl_command_type type, struct command *c,
+                      cl_uint num_waits, const cl_event *waits, cl_event *event, cl_bool blocking) {
+    cl_int err;
+    cl_event e;
+    cl_uint i;
+
+    if ((err = check_wait_list(q->context, num_waits, waits)) != CL_SUCCESS) {
+        command_free(c);
+        return err;
+    }
+    if ((e = event_new(q->context, q, type)) == NULL) {
+        command_free(c);
+        return CL_OUT_OF_HOST_MEMORY;
+    }
+    e->holds = 2; /* by the command, and by this call */
+    c->event = e;
+    if (num_waits > 0) {
+        if ((c->waits = malloc(num_waits * sizeof(*c->waits))) == NULL) {
+            command_free(c);
+            event_unhold(e);
+            return CL_OUT_OF_HOST_MEMORY;
+        }
+        for (i = 0; i < num_waits; i++) {
+            c->waits[i] = waits[i];
+            waits[i]->holds++;
+        }
+        c->num_waits = num_waits;
+    }
+    if (q->tail != NULL) {
+        q->tail->next = c;
+    } else {
+        q->head = c;
+    }
+    q->tail = c;
+    schedule(q->context);
+
+    if (blocking) {
+        while (e->status > CL_COMPLETE) {
+            sim_wait();
+        }
+    }
+    /* Commands that ran within this call and failed report their error
+     * here. Blocking calls also fail when their wait list did. */
+    if (e->status < 0 && (blocking || e->status != CL_EXEC_STATUS_ERROR_FOR_EVENTS_IN_WAIT_LIST)) {
+        err = e->status;
+        event_unhold(e);
+        return err;
+    }
+    if (event != NULL) {
+        e->refs++;
+        *event = e;
+    }
+    event_unhold(e);
+    return CL_SUCCESS;
+}
+
+static struct command *command_new(cl_int (*run)(struct command *)) {
+    struct command *c = calloc(1, sizeof(*c));
+    if (c != NULL) {
+        c->run = run;
+    }
+    return c;
+}
+
+CL_API_ENTRY cl_command_queue CL_API_CALL
+clCreateCommandQueue(cl_context                     context,
+                     cl_device_id                   device,
+                     cl_command_queue_properties    properties,
+                     cl_int *                       errcode_ret) {
+    cl_command_queue q = NULL;
+    cl_int err;
+    sim_lock();
+    if (!is_context(context)) {
+        SET_ERR(CL_INVALID_CONTEXT);
+    } else if (device != &sim_device) {
+        SET_ERR(CL_INVALID_DEVICE);
+    } else if (properties & ~(cl_command_queue_properties)(CL_QUEUE_OUT_OF_ORDER_EXEC_MODE_ENABLE | CL_QUEUE_PROFILING_ENABLE)) {
+        SET_ERR(CL_INVALID_VALUE);
+    } else if ((err = sim_fault("clCreateCommandQueue")) != CL_SUCCESS) {
+        SET_ERR(err);
+    } else if ((q = calloc(1, sizeof(*q))) == NULL) {
+        SET_ERR(CL_OUT_OF_HOST_MEMORY);
+    } else {
+        q->magic = MAGIC_QUEUE;
+        q->refs = 1;
+        q->context = context;
+        context->holds++;
+        q->props = properties;
+        q->next = context->queues;
+        context->queues = q;
+        SET_ERR(CL_SUCCESS);
+    }
+    sim_unlock();
+    return q;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clRetainCommandQueue(cl_command_queue command_queue) {
+    cl_int err = CL_INVALID_COMMAND_QUEUE;
+    sim_lock();
+    if (is_queue(command_queue)) {
+        command_queue->refs++;
+        err = CL_SUCCESS;
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clReleaseCommandQueue(cl_command_queue command_queue) {
+    cl_int err = CL_INVALID_COMMAND_QUEUE;
+    sim_lock();
+    if (is_queue(command_queue) && command_queue->refs > 0) {
+        command_queue->refs--;
+        queue_maybe_free(command_queue);
+        err = CL_SUCCESS;
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clGetCommandQueueInfo(cl_command_queue      command_queue,
+                      cl_command_queue_info param_name,
+                      size_t                size,
+                      void *                value,
+                      size_t *              size_ret) {
+    if (!is_queue(command_queue)) {
+        return CL_INVALID_COMMAND_QUEUE;
+    }
+    switch (param_name) {
+    case CL_QUEUE_CONTEXT:         INFO(cl_context, command_queue->context);
+    case CL_QUEUE_DEVICE:          INFO(cl_device_id, &sim_device);
+    case CL_QUEUE_REFERENCE_COUNT: INFO(cl_uint, command_queue->refs);
+    case CL_QUEUE_PROPERTIES:      INFO(cl_command_queue_properties, command_queue->props);
+    }
+    return CL_INVALID_VALUE;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clFlush(cl_command_queue command_queue) {
+    cl_int err = CL_INVALID_COMMAND_QUEUE;
+    sim_lock();
+    if (is_queue(command_queue)) {
+        schedule(command_queue->context);
+        err = CL_SUCCESS;
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clFinish(cl_command_queue command_queue) {
+    cl_int err = CL_INVALID_COMMAND_QUEUE;
+    sim_lock();
+    if (is_queue(command_queue)) {
+        command_queue->holds++;
+        schedule(command_queue->context);
+        while (command_queue->head != NULL) {
+            sim_wait();
+        }
+        queue_unhold(command_queue);
+        err = CL_SUCCESS;
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clEnqueueMarkerWithWaitList(cl_command_queue command_queue,
+                            cl_uint          num_events_in_wait_list,
+                            const cl_event * event_wait_list,
+                            cl_event *       event) {
+    cl_int err = CL_INVALID_COMMAND_QUEUE;
+    struct command *c;
+    sim_lock();
+    if (!is_queue(command_queue)) {
+        err = CL_INVALID_COMMAND_QUEUE;
+    } else if ((c = command_new(NULL)) == NULL) {
+        err = CL_OUT_OF_HOST_MEMORY;
+    } else {
+        err = enqueue(command_queue, CL_COMMAND_MARKER, c, num_events_in_wait_list, event_wait_list, event, CL_FALSE);
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clEnqueueBarrierWithWaitList(cl_command_queue command_queue,
+                             cl_uint          num_events_in_wait_list,
+                             const cl_event * event_wait_list,
+                             cl_event *       event) {
+    cl_int err;
+    struct command *c;
+    sim_lock();
+    if (!is_queue(command_queue)) {
+        err = CL_INVALID_COMMAND_QUEUE;
+    } else if ((c = command_new(NULL)) == NULL) {
+        err = CL_OUT_OF_HOST_MEMORY;
+    } else {
+        err = enqueue(command_queue, CL_COMMAND_BARRIER, c, num_events_in_wait_list, event_wait_list, event, CL_FALSE);
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clEnqueueMarker(cl_command_queue command_queue,
+                cl_event *       event) {
+    if (event == NULL) {
+        return CL_INVALID_VALUE;
+    }
+    return clEnqueueMarkerWithWaitList(command_queue, 0, NULL, event);
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clEnqueueWaitForEvents(cl_command_queue command_queue,
+                       cl_uint          num_events,
+                       const cl_event * event_list) {
+    if (num_events == 0 || event_list == NULL) {
+        return CL_INVALID_VALUE;
+    }
+    return clEnqueueBarrierWithWaitList(command_queue, num_events, event_list, NULL);
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clEnqueueBarrier(cl_command_queue command_queue) {
+    return clEnqueueBarrierWithWaitList(command_queue, 0, NULL, NULL);
+}
+
+/* ------------------------------------------------------------------------ */
+/* Memory objects                                                           */
+/* ------------------------------------------------------------------------ */
+
+static int is_mem(cl_mem m) {
+    return m != NULL && m->magic == MAGIC_MEM;
+}
+
+/* Whether m is a memory object that has not been released, for pointers
+ * that may be anything, like kernel arguments. */
+static int is_live_mem(cl_mem m) {
+    cl_mem l;
+    for (l = live_mems; l != NULL; l = l->next_live) {
+        if (l == m) {
+            return 1;
+        }
+    }
+    return 0;
+}
+
+static void mem_maybe_free(cl_mem m) {
+    cl_mem *link;
+    struct mem_destructor *d, *next;
+
+    if (m->refs != 0 || m->holds != 0) {
+        return;
+    }
+    for (link = &live_mems; *link != NULL; link = &(*link)->next_live) {
+        if (*link == m) {
+            *link = m->next_live;
+            break;
+        }
+    }
+    m->magic = 0;
+    /* Destructors were pushed in front, so they are called in reverse order of registration */
+    for (d = m->destructors; d != NULL; d = next) {
+        next = d->next;
+        defer(DEFER_MEM, m, 0, (void *)d->fn, d->user_data, NULL);
+        free(d);
+    }
+    defer(DEFER_FREE_MEM, m, 0, NULL, NULL, NULL);
+    if (m->parent != NULL) {
+        mem_unhold(m->parent);
+    }
+    context_unhold(m->context);
+}
+
+static void mem_unhold(cl_mem m) {
+    m->holds--;
+    mem_maybe_free(m);
+}
+
+static cl_mem mem_new(cl_context c, cl_mem_flags flags, size_t size) {
+    cl_mem m = calloc(1, sizeof(*m));
+    if (m == NULL) {
+        return NULL;
+    }
+    m->magic = MAGIC_MEM;
+    m->refs = 1;
+    m->context = c;
+    c->holds++;
+    m->flags = flags;
+    m->size = size;
+    m->next_live = live_mems;
+    live_mems = m;
+    return m;
+}
+
+static int mem_flags_valid(cl_mem_flags flags) {
+    cl_mem_flags access = flags & (CL_MEM_READ_WRITE | CL_MEM_WRITE_ONLY | CL_MEM_READ_ONLY);
+    cl_mem_flags host = flags & (CL_MEM_HOST_WRITE_ONLY | CL_MEM_HOST_READ_ONLY | CL_MEM_HOST_NO_ACCESS);
+    if (flags & ~(cl_mem_flags)(CL_MEM_READ_WRITE | CL_MEM_WRITE_ONLY | CL_MEM_READ_ONLY | CL_MEM_USE_HOST_PTR |
+                                CL_MEM_ALLOC_HOST_PTR | CL_MEM_COPY_HOST_PTR | CL_MEM_HOST_WRITE_ONLY |
+                                CL_MEM_HOST_READ_ONLY | CL_MEM_HOST_NO_ACCESS)) {
+        return 0;
+    }
+    if ((access & (access - 1)) != 0 || (host & (host - 1)) != 0) {
+        return 0;
+    }
+    if ((flags & CL_MEM_USE_HOST_PTR) && (flags & (CL_MEM_ALLOC_HOST_PTR | CL_MEM_COPY_HOST_PTR))) {
+        return 0;
+    }
+    return 1;
+}
+
+CL_API_ENTRY cl_mem CL_API_CALL
+clCreateBuffer(cl_context   context,
+               cl_mem_flags flags,
+               size_t       size,
+               void *       host_ptr,
+               cl_int *     errcode_ret) {
+    cl_mem m = NULL;
+    cl_int err;
+    int with_ptr = (flags & (CL_MEM_USE_HOST_PTR | CL_MEM_COPY_HOST_PTR)) != 0;
+
+    if (flags == 0) {
+        flags = CL_MEM_READ_WRITE;
+    }
+    sim_lock();
+    if (!is_context(context)) {
+        SET_ERR(CL_INVALID_CONTEXT);
+    } else if (!mem_flags_valid(flags)) {
+        SET_ERR(CL_INVALID_VALUE);
+    } else if (size == 0 || size > SIM_MAX_ALLOC) {
+        SET_ERR(CL_INVALID_BUFFER_SIZE);
+    } else if ((host_ptr != NULL) != with_ptr) {
+        SET_ERR(CL_INVALID_HOST_PTR);
+    } else if ((err = sim_fault("clCreateBuffer")) != CL_SUCCESS) {
+        SET_ERR(err);
+    } else if ((m = mem_new(context, flags, size)) == NULL) {
+        SET_ERR(CL_OUT_OF_HOST_MEMORY);
+    } else {
+        if (flags & CL_MEM_USE_HOST_PTR) {
+            m->data = host_ptr;
+            m->host_ptr = host_ptr;
+        } else {
+            m->data = calloc(1, size);
+        }
+        if (m->data == NULL) {
+            m->refs = 0;
+            mem_maybe_free(m);
+            m = NULL;
+            SET_ERR(CL_MEM_OBJECT_ALLOCATION_FAILURE);
+        } else {
+            if (flags & CL_MEM_COPY_HOST_PTR) {
+                memcpy(m->data, host_ptr, size);
+            }
+            SET_ERR(CL_SUCCESS);
+        }
+    }
+    sim_unlock();
+    return m;
+}
+
+CL_API_ENTRY cl_mem CL_API_CALL
+clCreateSubBuffer(cl_mem                   buffer,
+                  cl_mem_flags             flags,
+                  cl_buffer_create_type    buffer_create_type,
+                  const void *             buffer_create_info,
+                  cl_int *                 errcode_ret) {
+    cl_mem m = NULL;
+    cl_int err;
+    const cl_buffer_region *region = buffer_create_info;
+    const cl_mem_flags inherited = CL_MEM_READ_WRITE | CL_MEM_WRITE_ONLY | CL_MEM_READ_ONLY;
+    const cl_mem_flags host_inherited = CL_MEM_HOST_WRITE_ONLY | CL_MEM_HOST_READ_ONLY | CL_MEM_HOST_NO_ACCESS;
+
+    sim_lock();
+    if (!is_mem(buffer) || buffer->parent != NULL) {
+        SET_ERR(CL_INVALID_MEM_OBJECT);
+    } else if (buffer_create_type != CL_BUFFER_CREATE_TYPE_REGION || region == NULL ||
+               (flags & ~(inherited | host_inherited)) != 0 || !mem_flags_valid(flags)) {
+        SET_ERR(CL_INVALID_VALUE);
+    } else if (region->size == 0) {
+        SET_ERR(CL_INVALID_BUFFER_SIZE);
+    } else if (region->origin > buffer->size || region->size > buffer->size - region->origin) {
+        SET_ERR(CL_INVALID_VALUE);
+    } else if (region->origin % (SIM_BASE_ADDR_ALIGN / 8) != 0) {
+        SET_ERR(CL_MISALIGNED_SUB_BUFFER_OFFSET);
+    } else if ((err = sim_fault("clCreateSubBuffer")) != CL_SUCCESS) {
+        SET_ERR(err);
+    } else {
+        if ((flags & inherited) == 0) {
+            flags |= buffer->flags & inherited;
+        }
+        if ((flags & host_inherited) == 0) {
+            flags |= buffer->flags & host_inherited;
+        }
+        flags |= buffer->flags & (CL_MEM_USE_HOST_PTR | CL_MEM_ALLOC_HOST_PTR | CL_MEM_COPY_HOST_PTR);
+        if ((m = mem_new(buffer->context, flags, region->size)) == NULL) {
+            SET_ERR(CL_OUT_OF_HOST_MEMORY);
+        } else {
+            m->parent = buffer;
+            buffer->holds++;
+            m->offset = region->origin;
+            m->data = buffer->data + region->origin;
+            if (buffer->host_ptr != NULL) {
+                m->host_ptr = (char *)buffer->host_ptr + region->origin;
+            }
+            SET_ERR(CL_SUCCESS);
+        }
+    }
+    sim_unlock();
+    return m;
+}
+
+CL_API_ENTRY cl_mem CL_API_CALL
+clCreateImage(cl_context              context,
+              cl_mem_flags            flags,
+              const cl_image_format * image_format,
+              const cl_image_desc *   image_desc,
+              void *                  host_ptr,
+              cl_int *                errcode_ret) {
+    SET_ERR(is_context(context) ? CL_INVALID_OPERATION : CL_INVALID_CONTEXT);
+    return NULL;
+}
+
+CL_API_ENTRY cl_mem CL_API_CALL
+clCreateImage2D(cl_context              context,
+                cl_mem_flags            flags,
+                const cl_image_format * image_format,
+                size_t                  image_width,
+                size_t                  image_height,
+                size_t                  image_row_pitch,
+                void *                  host_ptr,
+                cl_int *                errcode_ret) {
+    return clCreateImage(context, flags, image_format, NULL, host_ptr, errcode_ret);
+}
+
+CL_API_ENTRY cl_mem CL_API_CALL
+clCreateImage3D(cl_context              context,
+                cl_mem_flags            flags,
+                const cl_image_format * image_format,
+                size_t                  image_width,
+                size_t                  image_height,
+                size_t                  image_depth,
+                size_t                  image_row_pitch,
+                size_t                  image_slice_pitch,
+                void *                  host_ptr,
+                cl_int *                errcode_ret) {
+    return clCreateImage(context, flags, image_format, NULL, host_ptr, errcode_ret);
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clGetSupportedImageFormats(cl_context           context,
+                           cl_mem_flags         flags,
+                           cl_mem_object_type   image_type,
+                           cl_uint              num_entries,
+                           cl_image_format *    image_formats,
+                           cl_uint *            num_image_formats) {
+    if (!is_context(context)) {
+        return CL_INVALID_CONTEXT;
+    }
+    if (num_entries == 0 && image_formats != NULL) {
+        return CL_INVALID_VALUE;
+    }
+    if (num_image_formats != NULL) {
+        *num_image_formats = 0;
+    }
+    return CL_SUCCESS;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clGetImageInfo(cl_mem           image,
+               cl_image_info    param_name,
+               size_t           size,
+               void *           value,
+               size_t *         size_ret) {
+    return CL_INVALID_MEM_OBJECT;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clRetainMemObject(cl_mem memobj) {
+    cl_int err = CL_INVALID_MEM_OBJECT;
+    sim_lock();
+    if (is_mem(memobj)) {
+        memobj->refs++;
+        err = CL_SUCCESS;
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clReleaseMemObject(cl_mem memobj) {
+    cl_int err = CL_INVALID_MEM_OBJECT;
+    sim_lock();
+    if (is_mem(memobj) && memobj->refs > 0) {
+        memobj->refs--;
+        mem_maybe_free(memobj);
+        err = CL_SUCCESS;
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clSetMemObjectDestructorCallback(cl_mem memobj,
+                                 void (CL_CALLBACK * pfn_notify)(cl_mem memobj,
+                                                                 void * user_data),
+                                 void * user_data) {
+    cl_int err = CL_SUCCESS;
+    struct mem_destructor *d;
+
+    if (pfn_notify == NULL) {
+        return CL_INVALID_VALUE;
+    }
+    sim_lock();
+    if (!is_mem(memobj)) {
+        err = CL_INVALID_MEM_OBJECT;
+    } else if ((d = calloc(1, sizeof(*d))) == NULL) {
+        err = CL_OUT_OF_HOST_MEMORY;
+    } else {
+        d->fn = pfn_notify;
+        d->user_data = user_data;
+        d->next = memobj->destructors;
+        memobj->destructors = d;
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clGetMemObjectInfo(cl_mem           memobj,
+                   cl_mem_info      param_name,
+                   size_t           size,
+                   void *           value,
+                   size_t *         size_ret) {
+    if (!is_mem(memobj)) {
+        return CL_INVALID_MEM_OBJECT;
+    }
+    switch (param_name) {
+    case CL_MEM_TYPE:                 INFO(cl_mem_object_type, CL_MEM_OBJECT_BUFFER);
+    case CL_MEM_FLAGS:                INFO(cl_mem_flags, memobj->flags);
+    case CL_MEM_SIZE:                 INFO(size_t, memobj->size);
+    case CL_MEM_HOST_PTR:             INFO(void *, memobj->host_ptr);
+    case CL_MEM_MAP_COUNT:            INFO(cl_uint, memobj->map_count);
+    case CL_MEM_REFERENCE_COUNT:      INFO(cl_uint, memobj->refs);
+    case CL_MEM_CONTEXT:              INFO(cl_context, memobj->context);
+    case CL_MEM_ASSOCIATED_MEMOBJECT: INFO(cl_mem, memobj->parent);
+    case CL_MEM_OFFSET:               INFO(size_t, memobj->offset);
+    }
+    return CL_INVALID_VALUE;
+}
+
+/* ------------------------------------------------------------------------ */
+/* Buffer commands                                                          */
+/* ------------------------------------------------------------------------ */
+
+/* Checks the queue and a buffer used by one of its commands. */
+static cl_int check_buffer(cl_command_queue q, cl_mem m) {
+    if (!is_queue(q)) {
+        return CL_INVALID_COMMAND_QUEUE;
+    }
+    if (!is_mem(m)) {
+        return CL_INVALID_MEM_OBJECT;
+    }
+    if (m->context != q->context) {
+        return CL_INVALID_CONTEXT;
+    }
+    return CL_SUCCESS;
+}
+
+static char *command_base(cl_mem m, void *ptr) {
+    return m != NULL ? m->data : ptr;
+}
+
+static cl_int run_copy(struct command *c) {
+    memmove(command_base(c->dst, c->ptr) + c->dst_offset, command_base(c->src, c->ptr) + c->src_offset, c->size);
+    return CL_SUCCESS;
+}
+
+static cl_int run_copy_rect(struct command *c) {
+    char *dst = command_base(c->dst, c->ptr);
+    const char *src = command_base(c->src, c->ptr);
+    size_t y, z;
+    for (z = 0; z < c->region[2]; z++) {
+        for (y = 0; y < c->region[1]; y++) {
+            memmove(dst + c->dst_origin[0] + (c->dst_origin[1] + y) * c->dst_row_pitch + (c->dst_origin[2] + z) * c->dst_slice_pitch,
+                    src + c->src_origin[0] + (c->src_origin[1] + y) * c->src_row_pitch + (c->src_origin[2] + z) * c->src_slice_pitch,
+                    c->region[0]);
+        }
+    }
+    return CL_SUCCESS;
+}
+
+static cl_int run_fill(struct command *c) {
+    size_t i;
+    for (i = 0; i < c->size; i += c->pattern_size) {
+        memcpy(c->dst->data + c->dst_offset + i, c->pattern, c->pattern_size);
+    }
+    return CL_SUCCESS;
+}
+
+static cl_int enqueue_copy(cl_command_queue q, cl_command_type type, cl_bool blocking,
+                           cl_mem src, size_t src_offset, cl_mem dst, size_t dst_offset, void *ptr, size_t size,
+                           cl_uint num_waits, const cl_event *waits, cl_event *event) {
+    struct command *c = command_new(run_copy);
+    if (c == NULL) {
+        return CL_OUT_OF_HOST_MEMORY;
+    }
+    c->src = src;
+    c->src_offset = src_offset;
+    c->dst = dst;
+    c->dst_offset = dst_offset;
+    c->ptr = ptr;
+    c->size = size;
+    if ((src != NULL && command_hold(c, src) != CL_SUCCESS) || (dst != NULL && command_hold(c, dst) != CL_SUCCESS)) {
+        command_free(c);
+        return CL_OUT_OF_HOST_MEMORY;
+    }
+    return enqueue(q, type, c, num_waits, waits, event, blocking);
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clEnqueueReadBuffer(cl_command_queue    command_queue,
+                    cl_mem              buffer,
+                    cl_bool             blocking_read,
+                    size_t              offset,
+                    size_t              size,
+                    void *              ptr,
+                    cl_uint             num_events_in_wait_list,
+                    const cl_event *    event_wait_list,
+                    cl_event *          event) {
+    cl_int err;
+    sim_lock();
+    if ((err = check_buffer(command_queue, buffer)) != CL_SUCCESS) {
+    } else if (ptr == NULL || size == 0 || offset > buffer->size || size > buffer->size - offset) {
+        err = CL_INVALID_VALUE;
+    } else {
+        err = enqueue_copy(command_queue, CL_COMMAND_READ_BUFFER, blocking_read, buffer, offset, NULL, 0, ptr, size,
+                           num_events_in_wait_list, event_wait_list, event);
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clEnqueueWriteBuffer(cl_command_queue   command_queue,
+                     cl_mem             buffer,
+                     cl_bool            blocking_write,
+                     size_t             offset,
+                     size_t             size,
+                     const void *       ptr,
+                     cl_uint            num_events_in_wait_list,
+                     const cl_event *   event_wait_list,
+                     cl_event *         event) {
+    cl_int err;
+    sim_lock();
+    if ((err = check_buffer(command_queue, buffer)) != CL_SUCCESS) {
+    } else if (ptr == NULL || size == 0 || offset > buffer->size || size > buffer->size - offset) {
+        err = CL_INVALID_VALUE;
+    } else {
+        err = enqueue_copy(command_queue, CL_COMMAND_WRITE_BUFFER, blocking_write, NULL, 0, buffer, offset, (void *)ptr, size,
+                           num_events_in_wait_list, event_wait_list, event);
+    }
+    sim_unlock();
+    return err;
+}
+
+/* Whether two ranges of buffers overlap in memory. */
+static int mem_overlap(cl_mem a, size_t a_offset, cl_mem b, size_t b_offset, size_t size) {
+    const char *pa = a->data + a_offset, *pb = b->data + b_offset;
+    return pa < pb + size && pb < pa + size;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clEnqueueCopyBuffer(cl_command_queue    command_queue,
+                    cl_mem              src_buffer,
+                    cl_mem              dst_buffer,
+                    size_t              src_offset,
+                    size_t              dst_offset,
+                    size_t              size,
+                    cl_uint             num_events_in_wait_list,
+                    const cl_event *    event_wait_list,
+                    cl_event *          event) {
+    cl_int err;
+    sim_lock();
+    if ((err = check_buffer(command_queue, src_buffer)) != CL_SUCCESS ||
+        (err = check_buffer(command_queue, dst_buffer)) != CL_SUCCESS) {
+    } else if (size == 0 || src_offset > src_buffer->size || size > src_buffer->size - src_offset ||
+               dst_offset > dst_buffer->size || size > dst_buffer->size - dst_offset) {
+        err = CL_INVALID_VALUE;
+    } else if (mem_overlap(src_buffer, src_offset, dst_buffer, dst_offset, size)) {
+        err = CL_MEM_COPY_OVERLAP;
+    } else {
+        err = enqueue_copy(command_queue, CL_COMMAND_COPY_BUFFER, CL_FALSE, src_buffer, src_offset, dst_buffer, dst_offset, NULL, size,
+                           num_events_in_wait_list, event_wait_list, event);
+    }
+    sim_unlock();
+    return err;
+}
+
+/* Fills in the default pitches of a rectangle and checks that it fits in
+ * limit bytes, unless limit is 0. */
+static cl_int check_rect(const size_t *origin, const size_t *region, size_t *row_pitch, size_t *slice_pitch, size_t limit) {
+    if (origin == NULL || region == NULL || region[0] == 0 || region[1] == 0 || region[2] == 0) {
+        return CL_INVALID_VALUE;
+    }
+    if (*row_pitch == 0) {
+        *row_pitch = region[0];
+    }
+    if (*slice_pitch == 0) {
+        *slice_pitch = region[1] * *row_pitch;
+    }
+    if (*row_pitch < region[0] || *slice_pitch < region[1] * *row_pitch || *slice_pitch % *row_pitch != 0) {
+        return CL_INVALID_VALUE;
+    }
+    if (limit != 0 && origin[0] + region[0] + (origin[1] + region[1] - 1) * *row_pitch +
+                      (origin[2] + region[2] - 1) * *slice_pitch > limit) {
+        return CL_INVALID_VALUE;
+    }
+    return CL_SUCCESS;
+}
+
+static cl_int enqueue_copy_rect(cl_command_queue q, cl_command_type type, cl_bool blocking,
+                                cl_mem src, const size_t *src_origin, size_t src_row_pitch, size_t src_slice_pitch,
+                                cl_mem dst, const size_t *dst_origin, size_t dst_row_pitch, size_t dst_slice_pitch,
+                                void *ptr, const size_t *region,
+                                cl_uint num_waits, const cl_event *waits, cl_event *event) {
+    cl_int err;
+    struct command *c;
+
+    if ((err = check_rect(src_origin, region, &src_row_pitch, &src_slice_pitch, src != NULL ? src->size : 0)) != CL_SUCCESS ||
+        (err = check_rect(dst_origin, region, &dst_row_pitch, &dst_slice_pitch, dst != NULL ? dst->size : 0)) != CL_SUCCESS) {
+        return err;
+    }
+    if ((src == NULL || dst == NULL) && ptr == NULL) {
+        return CL_INVALID_VALUE;
+    }
+    if ((c = command_new(run_copy_rect)) == NULL) {
+        return CL_OUT_OF_HOST_MEMORY;
+    }
+    c->src = src;
+    c->dst = dst;
+    c->ptr = ptr;
+    memcpy(c->src_origin, src_origin, sizeof(c->src_origin));
+    memcpy(c->dst_origin, dst_origin, sizeof(c->dst_origin));
+    memcpy(c->region, region, sizeof(c->region));
+    c->src_row_pitch = src_row_pitch;
+    c->src_slice_pitch = src_slice_pitch;
+    c->dst_row_pitch = dst_row_pitch;
+    c->dst_slice_pitch = dst_slice_pitch;
+    if ((src != NULL && command_hold(c, src) != CL_SUCCESS) || (dst != NULL && command_hold(c, dst) != CL_SUCCESS)) {
+        command_free(c);
+        return CL_OUT_OF_HOST_MEMORY;
+    }
+    return enqueue(q, type, c, num_waits, waits, event, blocking);
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clEnqueueReadBufferRect(cl_command_queue    command_queue,
+                        cl_mem              buffer,
+                        cl_bool             blocking_read,
+                        const size_t *      buffer_origin,
+                        const size_t *      host_origin,
+                        const size_t *      region,
+                        size_t              buffer_row_pitch,
+                        size_t              buffer_slice_pitch,
+                        size_t              host_row_pitch,
+                        size_t              host_slice_pitch,
+                        void *              ptr,
+                        cl_uint             num_events_in_wait_list,
+                        const cl_event *    event_wait_list,
+                        cl_event *          event) {
+    cl_int err;
+    sim_lock();
+    if ((err = check_buffer(command_queue, buffer)) == CL_SUCCESS) {
+        err = enqueue_copy_rect(command_queue, CL_COMMAND_READ_BUFFER_RECT, blocking_read,
+                                buffer, buffer_origin, buffer_row_pitch, buffer_slice_pitch,
+                                NULL, host_origin, host_row_pitch, host_slice_pitch,
+                                ptr, region, num_events_in_wait_list, event_wait_list, event);
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clEnqueueWriteBufferRect(cl_command_queue    command_queue,
+                         cl_mem              buffer,
+                         cl_bool             blocking_write,
+                         const size_t *      buffer_origin,
+                         const size_t *      host_origin,
+                         const size_t *      region,
+                         size_t              buffer_row_pitch,
+                         size_t              buffer_slice_pitch,
+                         size_t              host_row_pitch,
+                         size_t              host_slice_pitch,
+                         const void *        ptr,
+                         cl_uint             num_events_in_wait_list,
+                         const cl_event *    event_wait_list,
+                         cl_event *          event) {
+    cl_int err;
+    sim_lock();
+    if ((err = check_buffer(command_queue, buffer)) == CL_SUCCESS) {
+        err = enqueue_copy_rect(command_queue, CL_COMMAND_WRITE_BUFFER_RECT, blocking_write,
+                                NULL, host_origin, host_row_pitch, host_slice_pitch,
+                                buffer, buffer_origin, buffer_row_pitch, buffer_slice_pitch,
+                                (void *)ptr, region, num_events_in_wait_list, event_wait_list, event);
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clEnqueueCopyBufferRect(cl_command_queue    command_queue,
+                        cl_mem              src_buffer,
+                        cl_mem              dst_buffer,
+                        const size_t *      src_origin,
+                        const size_t *      dst_origin,
+                        const size_t *      region,
+                        size_t              src_row_pitch,
+                        size_t              src_slice_pitch,
+                        size_t              dst_row_pitch,
+                        size_t              dst_slice_pitch,
+                        cl_uint             num_events_in_wait_list,
+                        const cl_event *    event_wait_list,
+                        cl_event *          event) {
+    cl_int err;
+    sim_lock();
+    if ((err = check_buffer(command_queue, src_buffer)) == CL_SUCCESS &&
+        (err = check_buffer(command_queue, dst_buffer)) == CL_SUCCESS) {
+        err = enqueue_copy_rect(command_queue, CL_COMMAND_COPY_BUFFER_RECT, CL_FALSE,
+                                src_buffer, src_origin, src_row_pitch, src_slice_pitch,
+                                dst_buffer, dst_origin, dst_row_pitch, dst_slice_pitch,
+                                NULL, region, num_events_in_wait_list, event_wait_list, event);
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clEnqueueFillBuffer(cl_command_queue   command_queue,
+                    cl_mem             buffer,
+                    const void *       pattern,
+                    size_t             pattern_size,
+                    size_t             offset,
+                    size_t             size,
+                    cl_uint            num_events_in_wait_list,
+                    const cl_event *   event_wait_list,
+                    cl_event *         event) {
+    cl_int err;
+    struct command *c;
+    sim_lock();
+    if ((err = check_buffer(command_queue, buffer)) != CL_SUCCESS) {
+    } else if (pattern == NULL || pattern_size == 0 || pattern_size > sizeof(c->pattern) ||
+               (pattern_size & (pattern_size - 1)) != 0 || offset % pattern_size != 0 || size % pattern_size != 0 ||
+               offset > buffer->size || size > buffer->size - offset) {
+        err = CL_INVALID_VALUE;
+    } else if ((c = command_new(run_fill)) == NULL) {
+        err = CL_OUT_OF_HOST_MEMORY;
+    } else {
+        c->dst = buffer;
+        c->dst_offset = offset;
+        c->size = size;
+        memcpy(c->pattern, pattern, pattern_size);
+        c->pattern_size = pattern_size;
+        if (command_hold(c, buffer) != CL_SUCCESS) {
+            command_free(c);
+            err = CL_OUT_OF_HOST_MEMORY;
+        } else {
+            err = enqueue(command_queue, CL_COMMAND_FILL_BUFFER, c, num_events_in_wait_list, event_wait_list, event, CL_FALSE);
+        }
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY void * CL_API_CALL
+clEnqueueMapBuffer(cl_command_queue command_queue,
+                   cl_mem           buffer,
+                   cl_bool          blocking_map,
+                   cl_map_flags     map_flags,
+                   size_t           offset,
+                   size_t           size,
+                   cl_uint          num_events_in_wait_list,
+                   const cl_event * event_wait_list,
+                   cl_event *       event,
+                   cl_int *         errcode_ret) {
+    cl_int err;
+    struct command *c;
+    void *ptr = NULL;
+    sim_lock();
+    if ((err = check_buffer(command_queue, buffer)) != CL_SUCCESS) {
+    } else if (size == 0 || offset > buffer->size || size > buffer->size - offset ||
+               (map_flags & ~(cl_map_flags)(CL_MAP_READ | CL_MAP_WRITE | CL_MAP_WRITE_INVALIDATE_REGION)) != 0) {
+        err = CL_INVALID_VALUE;
+    } else if ((c = command_new(NULL)) == NULL) {
+        err = CL_OUT_OF_HOST_MEMORY;
+    } else {
+        /* The storage of the buffer is host memory and is mapped as is */
+        err = enqueue(command_queue, CL_COMMAND_MAP_BUFFER, c, num_events_in_wait_list, event_wait_list, event, blocking_map);
+        if (err == CL_SUCCESS) {
+            buffer->map_count++;
+            ptr = buffer->data + offset;
+        }
+    }
+    sim_unlock();
+    SET_ERR(err);
+    return ptr;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clEnqueueUnmapMemObject(cl_command_queue command_queue,
+                        cl_mem           memobj,
+                        void *           mapped_ptr,
+                        cl_uint          num_events_in_wait_list,
+                        const cl_event * event_wait_list,
+                        cl_event *       event) {
+    cl_int err;
+    struct command *c;
+    sim_lock();
+    if ((err = check_buffer(command_queue, memobj)) != CL_SUCCESS) {
+    } else if (memobj->map_count == 0 || (char *)mapped_ptr < memobj->data ||
+               (char *)mapped_ptr >= memobj->data + memobj->size) {
+        err = CL_INVALID_VALUE;
+    } else if ((c = command_new(NULL)) == NULL) {
+        err = CL_OUT_OF_HOST_MEMORY;
+    } else {
+        err = enqueue(command_queue, CL_COMMAND_UNMAP_MEM_OBJECT, c, num_events_in_wait_list, event_wait_list, event, CL_FALSE);
+        if (err == CL_SUCCESS) {
+            memobj->map_count--;
+        }
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clEnqueueMigrateMemObjects(cl_command_queue       command_queue,
+                           cl_uint                num_mem_objects,
+                           const cl_mem *         mem_objects,
+                           cl_mem_migration_flags flags,
+                           cl_uint                num_events_in_wait_list,
+                           const cl_event *       event_wait_list,
+                           cl_event *             event) {
+    cl_int err = CL_SUCCESS;
+    cl_uint i;
+    struct command *c;
+    sim_lock();
+    if (!is_queue(command_queue)) {
+        err = CL_INVALID_COMMAND_QUEUE;
+    } else if (num_mem_objects == 0 || mem_objects == NULL ||
+               (flags & ~(cl_mem_migration_flags)(CL_MIGRATE_MEM_OBJECT_HOST | CL_MIGRATE_MEM_OBJECT_CONTENT_UNDEFINED)) != 0) {
+        err = CL_INVALID_VALUE;
+    } else {
+        for (i = 0; i < num_mem_objects && err == CL_SUCCESS; i++) {
+            err = check_buffer(command_queue, mem_objects[i]);
+        }
+        if (err != CL_SUCCESS) {
+        } else if ((c = command_new(NULL)) == NULL) {
+            err = CL_OUT_OF_HOST_MEMORY;
+        } else {
+            err = enqueue(command_queue, CL_COMMAND_MIGRATE_MEM_OBJECTS, c, num_events_in_wait_list, event_wait_list, event, CL_FALSE);
+        }
+    }
+    sim_unlock();
+    return err;
+}
+
+/* Images cannot be created, so image commands have no valid image to use. */
+static cl_int image_command(cl_command_queue q) {
+    return is_queue(q) ? CL_INVALID_MEM_OBJECT : CL_INVALID_COMMAND_QUEUE;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clEnqueueReadImage(cl_command_queue     command_queue,
+                   cl_mem               image,
+                   cl_bool              blocking_read,
+                   const size_t *       origin,
+                   const size_t *       region,
+                   size_t               row_pitch,
+                   size_t               slice_pitch,
+                   void *               ptr,
+                   cl_uint              num_events_in_wait_list,
+                   const cl_event *     event_wait_list,
+                   cl_event *           event) {
+    return image_command(command_queue);
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clEnqueueWriteImage(cl_command_queue    command_queue,
+                    cl_mem              image,
+                    cl_bool             blocking_write,
+                    const size_t *      origin,
+                    const size_t *      region,
+                    size_t              input_row_pitch,
+                    size_t              input_slice_pitch,
+                    const void *        ptr,
+                    cl_uint             num_events_in_wait_list,
+                    const cl_event *    event_wait_list,
+                    cl_event *          event) {
+    return image_command(command_queue);
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clEnqueueFillImage(cl_command_queue   command_queue,
+                   cl_mem             image,
+                   const void *       fill_color,
+                   const size_t *     origin,
+                   const size_t *     region,
+                   cl_uint            num_events_in_wait_list,
+                   const cl_event *   event_wait_list,
+                   cl_event *         event) {
+    return image_command(command_queue);
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clEnqueueCopyImage(cl_command_queue     command_queue,
+                   cl_mem               src_image,
+                   cl_mem               dst_image,
+                   const size_t *       src_origin,
+                   const size_t *       dst_origin,
+                   const size_t *       region,
+                   cl_uint              num_events_in_wait_list,
+                   const cl_event *     event_wait_list,
+                   cl_event *           event) {
+    return image_command(command_queue);
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clEnqueueCopyImageToBuffer(cl_command_queue command_queue,
+                           cl_mem           src_image,
+                           cl_mem           dst_buffer,
+                           const size_t *   src_origin,
+                           const size_t *   region,
+                           size_t           dst_offset,
+                           cl_uint          num_events_in_wait_list,
+                           const cl_event * event_wait_list,
+                           cl_event *       event) {
+    return image_command(command_queue);
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clEnqueueCopyBufferToImage(cl_command_queue command_queue,
+                           cl_mem           src_buffer,
+                           cl_mem           dst_image,
+                           size_t           src_offset,
+                           const size_t *   dst_origin,
+                           const size_t *   region,
+                           cl_uint          num_events_in_wait_list,
+                           const cl_event * event_wait_list,
+                           cl_event *       event) {
+    return image_command(command_queue);
+}
+
+CL_API_ENTRY void * CL_API_CALL
+clEnqueueMapImage(cl_command_queue  command_queue,
+                  cl_mem            image,
+                  cl_bool           blocking_map,
+                  cl_map_flags      map_flags,
+                  const size_t *    origin,
+                  const size_t *    region,
+                  size_t *          image_row_pitch,
+                  size_t *          image_slice_pitch,
+                  cl_uint           num_events_in_wait_list,
+                  const cl_event *  event_wait_list,
+                  cl_event *        event,
+                  cl_int *          errcode_ret) {
+    SET_ERR(image_command(command_queue));
+    return NULL;
+}
+
+/* ------------------------------------------------------------------------ */
+/* Samplers                                                                 */
+/* ------------------------------------------------------------------------ */
+
+CL_API_ENTRY cl_sampler CL_API_CALL
+clCreateSampler(cl_context          context,
+                cl_bool             normalized_coords,
+                cl_addressing_mode  addressing_mode,
+                cl_filter_mode      filter_mode,
+                cl_int *            errcode_ret) {
+    SET_ERR(is_context(context) ? CL_INVALID_OPERATION : CL_INVALID_CONTEXT);
+    return NULL;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clRetainSampler(cl_sampler sampler) {
+    return CL_INVALID_SAMPLER;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clReleaseSampler(cl_sampler sampler) {
+    return CL_INVALID_SAMPLER;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clGetSamplerInfo(cl_sampler         sampler,
+                 cl_sampler_info    param_name,
+                 size_t             size,
+                 void *             value,
+                 size_t *           size_ret) {
+    return CL_INVALID_SAMPLER;
+}
+
+/* ------------------------------------------------------------------------ */
+/* Program parsing                                                          */
+/* ------------------------------------------------------------------------ */
+
+struct token {
+    const char *s;
+    size_t n;
+    int line, column;
+};
+
+struct parser {
+    struct token *tokens;
+    size_t num_tokens, cap_tokens;
+    char *log;
+    size_t log_len;
+    int errors;
+};
+
+static void parser_append(struct parser *p, const char *text, size_t len) {
+    char *log = realloc(p->log, p->log_len + len + 1);
+    if (log == NULL) {
+        return;
+    }
+    p->log = log;
+    memcpy(p->log + p->log_len, text, len);
+    p->log_len += len;
+    p->log[p->log_len] = '\0';
+}
+
+static void parser_error(struct parser *p, int line, int column, const char *msg, size_t msg_len) {
+    char head[64];
+    int n = snprintf(head, sizeof(head), "<kernel>:%d:%d: error: ", line, column);
+    parser_append(p, head, (size_t)n);
+    parser_append(p, msg, msg_len);
+    parser_append(p, "\n", 1);
+    p->errors++;
+}
+
+static int parser_push(struct parser *p, const char *s, size_t n, int line, int column) {
+    if (p->num_tokens == p->cap_tokens) {
+        size_t cap = p->cap_tokens ? p->cap_tokens * 2 : 256;
+        struct token *t = realloc(p->tokens, cap * sizeof(*t));
+        if (t == NULL) {
+            return 0;
+        }
+        p->tokens = t;
+        p->cap_tokens = cap;
+    }
+    p->tokens[p->num_tokens].s = s;
+    p->tokens[p->num_tokens].n = n;
+    p->tokens[p->num_tokens].line = line;
+    p->tokens[p->num_tokens].column = column;
+    p->num_tokens++;
+    return 1;
+}
+
+static int is_ident_start(char c) {
+    return isalpha((unsigned char)c) || c == '_';
+}
+
+static int is_ident_char(char c) {
+    return isalnum((unsigned char)c) || c == '_';
+}
+
+/* Splits text into tokens, skipping comments and preprocessor directives.
+ * #error directives are reported in the log in the format of Clang. */
+static int tokenize(struct parser *p, const char *text) {
+    const char *s = text, *line_start = text;
+    int line = 1, at_line_start = 1;
+
+    while (*s != '\0') {
+        if (*s == '\n') {
+            s++;
+            line++;
+            line_start = s;
+            at_line_start = 1;
+        } else if (isspace((unsigned char)*s)) {
+            s++;
+        } else if (s[0] == '/' && s[1] == '/') {
+            while (*s != '\0' && *s != '\n') {
+                s++;
+            }
+        } else if (s[0] == '/' && s[1] == '*') {
+            for (s += 2; *s != '\0' && !(s[0] == '*' && s[1] == '/'); s++) {
+                if (*s == '\n') {
+                    line++;
+                    line_start = s + 1;
+                }
+            }
+            if (*s != '\0') {
+                s += 2;
+            }
+        } else if (*s == '#' && at_line_start) {
+            const char *name, *msg, *end;
+            for (s++; *s == ' ' || *s == '\t'; s++) {
+            }
+            name = s;
+            while (is_ident_char(*s)) {
+                s++;
+            }
+            for (msg = s; *msg == ' ' || *msg == '\t'; msg++) {
+            }
+            /* The directive ends at the first newline not preceded by a backslash */
+            for (end = s; *end != '\0' && !(*end == '\n' && end[-1] != '\\'); end++) {
+            }
+            if (s - name == 5 && strncmp(name, "error", 5) == 0) {
+                parser_error(p, line, (int)(name - line_start) + 1, msg, (size_t)(end - msg));
+            }
+            for (; s < end; s++) {
+                if (*s == '\n') {
+                    line++;
+                    line_start = s + 1;
+                }
+            }
+        } else {
+            const char *start = s;
+            at_line_start = 0;
+            if (is_ident_char(*s)) {
+                while (is_ident_char(*s) || *s == '.') {
+                    s++;
+                }
+            } else if (*s == '"' || *s == '\'') {
+                char quote = *s++;
+                while (*s != '\0' && *s != quote && *s != '\n') {
+                    s += (s[0] == '\\' && s[1] != '\0') ? 2 : 1;
+                }
+                if (*s == quote) {
+                    s++;
+                }
+            } else {
+                s++;
+            }
+            if (!parser_push(p, start, (size_t)(s - start), line, (int)(start - line_start) + 1)) {
+                return 0;
+            }
+        }
+    }
+    return 1;
+}
+
+static int tok_is(const struct token *t, const char *s) {
+    return t->n == strlen(s) && strncmp(t->s, s, t->n) == 0;
+}
+
+static int tok_is_ident(const struct token *t) {
+    return is_ident_start(t->s[0]);
+}
+
+/* Returns the index of the token after the parenthesized group starting at i. */
+static size_t skip_group(const struct parser *p, size_t i) {
+    int depth = 0;
+    for (; i < p->num_tokens; i++) {
+        if (tok_is(&p->tokens[i], "(")) {
+            depth++;
+        } else if (tok_is(&p->tokens[i], ")") && --depth == 0) {
+            return i + 1;
+        }
+    }
+    return i;
+}
+
+static size_t skip_attributes(const struct parser *p, size_t i) {
+    while (i < p->num_tokens && tok_is(&p->tokens[i], "__attribute__")) {
+        i = skip_group(p, i + 1);
+    }
+    return i;
+}
+
+static size_t scalar_size(const char *type) {
+    static const struct {
+        const char *name;
+        size_t size;
+    } scalars[] = {
+        {"char", 1}, {"uchar", 1}, {"bool", 1}, {"short", 2}, {"ushort", 2}, {"half", 2},
+        {"int", 4}, {"uint", 4}, {"float", 4}, {"long", 8}, {"ulong", 8}, {"double", 8},
+        {"size_t", sizeof(size_t)}, {"ptrdiff_t", sizeof(size_t)}, {"intptr_t", sizeof(size_t)},
+        {"uintptr_t", sizeof(size_t)},
+    };
+    size_t i, n, width = 1;
+    const char *digits = type + strlen(type);
+
+    /* Vector types: the scalar name followed by 2, 3, 4, 8 or 16 */
+    while (digits > type && isdigit((unsigned char)digits[-1])) {
+        digits--;
+    }
+    n = (size_t)(digits - type);
+    if (*digits != '\0') {
+        width = (size_t)atoi(digits);
+        if (width == 3) {
+            width = 4;
+        }
+    }
+    for (i = 0; i < sizeof(scalars) / sizeof(scalars[0]); i++) {
+        if (strlen(scalars[i].name) == n && strncmp(scalars[i].name, type, n) == 0) {
+            return scalars[i].size * width;
+        }
+    }
+    return 0;
+}
+
+static void free_decls(struct kernel_decl *decls, cl_uint num) {
+    cl_uint i, j;
+    for (i = 0; i < num; i++) {
+        for (j = 0; j < decls[i].num_params; j++) {
+            free(decls[i].params[j].name);
+            free(decls[i].params[j].type_name);
+        }
+        free(decls[i].params);
+        free(decls[i].name);
+    }
+    free(decls);
+}
+
+static char *tok_dup(const struct token *t) {
+    char *s = malloc(t->n + 1);
+    if (s != NULL) {
+        memcpy(s, t->s, t->n);
+        s[t->n] = '\0';
+    }
+    return s;
+}
+
+/* Parses the parameter made of tokens [begin, end). */
+static int parse_param(const struct parser *p, size_t begin, size_t end, struct kernel_param *param) {
+    char type[256] = "";
+    const struct token *name = NULL;
+    int pointers = 0, is_unsigned = 0;
+    size_t i;
+
+    param->address = CL_KERNEL_ARG_ADDRESS_PRIVATE;
+    param->access = CL_KERNEL_ARG_ACCESS_NONE;
+    param->type_qualifier = CL_KERNEL_ARG_TYPE_NONE;
+
+    for (i = begin; i < end; i++) {
+        const struct token *t = &p->tokens[i];
+        if (tok_is(t, "__global") || tok_is(t, "global")) {
+            param->address = CL_KERNEL_ARG_ADDRESS_GLOBAL;
+        } else if (tok_is(t, "__local") || tok_is(t, "local")) {
+            param->address = CL_KERNEL_ARG_ADDRESS_LOCAL;
+        } else if (tok_is(t, "__constant") || tok_is(t, "constant")) {
+            param->address = CL_KERNEL_ARG_ADDRESS_CONSTANT;
+        } else if (tok_is(t, "__private") || tok_is(t, "private")) {
+            param->address = CL_KERNEL_ARG_ADDRESS_PRIVATE;
+        } else if (tok_is(t, "__read_only") || tok_is(t, "read_only")) {
+            param->access = CL_KERNEL_ARG_ACCESS_READ_ONLY;
+        } else if (tok_is(t, "__write_only") || tok_is(t, "write_only")) {
+            param->access = CL_KERNEL_ARG_ACCESS_WRITE_ONLY;
+        } else if (tok_is(t, "__read_write") || tok_is(t, "read_write")) {
+            param->access = CL_KERNEL_ARG_ACCESS_READ_WRITE;
+        } else if (tok_is(t, "const")) {
+            param->type_qualifier |= CL_KERNEL_ARG_TYPE_CONST;
+        } else if (tok_is(t, "volatile")) {
+            param->type_qualifier |= CL_KERNEL_ARG_TYPE_VOLATILE;
+        } else if (tok_is(t, "restrict") || tok_is(t, "__restrict")) {
+            param->type_qualifier |= CL_KERNEL_ARG_TYPE_RESTRICT;
+        } else if (tok_is(t, "unsigned")) {
+            is_unsigned = 1;
+        } else if (tok_is(t, "signed") || tok_is(t, "struct")) {
+        } else if (tok_is(t, "*")) {
+            pointers++;
+        } else if (tok_is(t, "__attribute__")) {
+            i = skip_group(p, i + 1) - 1;
+        } else if (tok_is_ident(t)) {
+            if (name != NULL) {
+                if (strlen(type) + name->n + 2 > sizeof(type)) {
+                    return 0;
+                }
+                if (type[0] != '\0') {
+                    strcat(type, " ");
+                }
+                strncat(type, name->s, name->n);
+            }
+            name = t;
+        } else {
+            return 0;
+        }
+    }
+    if (name == NULL) {
+        return 0;
+    }
+    if (type[0] == '\0') {
+        /* unsigned x */
+        strcpy(type, "int");
+    }
+    if (is_unsigned) {
+        memmove(type + 1, type, strlen(type) + 1);
+        type[0] = 'u';
+    }
+    param->size = pointers ? 0 : scalar_size(type);
+    if (strncmp(type, "image", 5) == 0) {
+        param->address = CL_KERNEL_ARG_ADDRESS_GLOBAL;
+        if (param->access == CL_KERNEL_ARG_ACCESS_NONE) {
+            param->access = CL_KERNEL_ARG_ACCESS_READ_ONLY;
+        }
+        param->is_mem = 1;
+    } else {
+        param->access = CL_KERNEL_ARG_ACCESS_NONE;
+    }
+    if (pointers) {
+        if (param->address == CL_KERNEL_ARG_ADDRESS_CONSTANT) {
+            param->type_qualifier |= CL_KERNEL_ARG_TYPE_CONST;
+        }
+        param->is_mem = param->address == CL_KERNEL_ARG_ADDRESS_GLOBAL || param->address == CL_KERNEL_ARG_ADDRESS_CONSTANT;
+        for (; pointers > 0 && strlen(type) + 2 <= sizeof(type); pointers--) {
+            strcat(type, "*");
+        }
+    } else {
+        param->type_qualifier = CL_KERNEL_ARG_TYPE_NONE;
+    }
+    param->name = tok_dup(name);
+    param->type_name = sim_strdup(type);
+    return param->name != NULL && param->type_name != NULL;
+}
+
+/* Finds the definitions of kernel functions in the tokens. */
+static cl_int parse_kernels(struct parser *p, struct kernel_decl **decls_ret, cl_uint *num_ret) {
+    struct kernel_decl *decls = NULL;
+    cl_uint num = 0, k;
+    size_t i;
+
+    for (i = 0; i < p->num_tokens; i++) {
+        size_t j, close, begin, depth;
+        const struct token *name;
+        struct kernel_decl *d;
+        int duplicate = 0;
+
+        if (!tok_is(&p->tokens[i], "__kernel") && !tok_is(&p->tokens[i], "kernel")) {
+            continue;
+        }
+        j = skip_attributes(p, i + 1);
+        if (j >= p->num_tokens || !tok_is(&p->tokens[j], "void")) {
+            continue;
+        }
+        j = skip_attributes(p, j + 1);
+        if (j + 1 >= p->num_tokens || !tok_is_ident(&p->tokens[j]) || !tok_is(&p->tokens[j + 1], "(")) {
+            continue;
+        }
+        name = &p->tokens[j];
+        close = skip_group(p, j + 1) - 1;
+        if (skip_attributes(p, close + 1) >= p->num_tokens || !tok_is(&p->tokens[skip_attributes(p, close + 1)], "{")) {
+            /* A declaration without a body */
+            continue;
+        }
+        for (k = 0; k < num; k++) {
+            if (strlen(decls[k].name) == name->n && strncmp(decls[k].name, name->s, name->n) == 0) {
+                duplicate = 1;
+            }
+        }
+        if (duplicate) {
+            continue;
+        }
+
+        d = realloc(decls, (num + 1) * sizeof(*d));
+        if (d == NULL) {
+            free_decls(decls, num);
+            return CL_OUT_OF_HOST_MEMORY;
+        }
+        decls = d;
+        d = &decls[num++];
+        memset(d, 0, sizeof(*d));
+        d->name = tok_dup(name);
+
+        begin = j + 2;
+        if (close == begin + 1 && tok_is(&p->tokens[begin], "void")) {
+            begin = close;
+        }
+        depth = 0;
+        for (j = begin; begin < close && j <= close; j++) {
+            const struct token *t = &p->tokens[j];
+            if (tok_is(t, "(")) {
+                depth++;
+            } else if (tok_is(t, ")") && j < close) {
+                depth--;
+            } else if ((tok_is(t, ",") && depth == 0) || j == close) {
+                struct kernel_param *params = realloc(d->params, (d->num_params + 1) * sizeof(*params));
+                if (params == NULL) {
+                    free_decls(decls, num);
+                    return CL_OUT_OF_HOST_MEMORY;
+                }
+                d->params = params;
+                memset(&params[d->num_params], 0, sizeof(*params));
+                if (!parse_param(p, begin, j, &params[d->num_params++])) {
+                    const char msg[] = "unsupported kernel parameter declaration";
+                    parser_error(p, p->tokens[begin].line, p->tokens[begin].column, msg, sizeof(msg) - 1);
+                    free_decls(decls, num);
+                    return CL_BUILD_PROGRAM_FAILURE;
+                }
+                begin = j + 1;
+            }
+        }
+    }
+    *decls_ret = decls;
+    *num_ret = num;
+    return CL_SUCCESS;
+}
+
+/* ------------------------------------------------------------------------ */
+/* Programs                                                                 */
+/* ------------------------------------------------------------------------ */
+
+static int is_program(cl_program p) {
+    return p != NULL && p->magic == MAGIC_PROGRAM;
+}
+
+static void program_reset(cl_program p) {
+    free_decls(p->kernels, p->num_kernels);
+    p->kernels = NULL;
+    p->num_kernels = 0;
+    free(p->options);
+    p->options = NULL;
+    free(p->log);
+    p->log = NULL;
+}
+
+static void program_maybe_free(cl_program p) {
+    if (p->refs != 0 || p->holds != 0) {
+        return;
+    }
+    program_reset(p);
+    p->magic = 0;
+    context_unhold(p->context);
+    free(p->source);
+    free(p->text);
+    free(p);
+}
+
+static void program_unhold(cl_program p) {
+    p->holds--;
+    program_maybe_free(p);
+}
+
+static cl_program program_new(cl_context c, char *text) {
+    cl_program p = calloc(1, sizeof(*p));
+    if (p == NULL) {
+        return NULL;
+    }
+    p->magic = MAGIC_PROGRAM;
+    p->refs = 1;
+    p->context = c;
+    c->holds++;
+    p->text = text;
+    p->status = CL_BUILD_NONE;
+    p->binary_type = CL_PROGRAM_BINARY_TYPE_NONE;
+    return p;
+}
+
+CL_API_ENTRY cl_program CL_API_CALL
+clCreateProgramWithSource(cl_context        context,
+                          cl_uint           count,
+                          const char **     strings,
+                          const size_t *    lengths,
+                          cl_int *          errcode_ret) {
+    cl_program p = NULL;
+    size_t total = 0, n;
+    cl_uint i;
+    cl_int err;
+    char *text;
+
+    if (count == 0 || strings == NULL) {
+        SET_ERR(CL_INVALID_VALUE);
+        return NULL;
+    }
+    for (i = 0; i < count; i++) {
+        if (strings[i] == NULL) {
+            SET_ERR(CL_INVALID_VALUE);
+            return NULL;
+        }
+        total += (lengths != NULL && lengths[i] != 0) ? lengths[i] : strlen(strings[i]);
+    }
+    sim_lock();
+    if (!is_context(context)) {
+        SET_ERR(CL_INVALID_CONTEXT);
+    } else if ((err = sim_fault("clCreateProgramWithSource")) != CL_SUCCESS) {
+        SET_ERR(err);
+    } else if ((text = malloc(total + 1)) == NULL) {
+        SET_ERR(CL_OUT_OF_HOST_MEMORY);
+    } else {
+        for (total = 0, i = 0; i < count; i++) {
+            n = (lengths != NULL && lengths[i] != 0) ? lengths[i] : strlen(strings[i]);
+            memcpy(text + total, strings[i], n);
+            total += n;
+        }
+        text[total] = '\0';
+        if ((p = program_new(context, text)) == NULL || (p->source = sim_strdup(text)) == NULL) {
+            if (p != NULL) {
+                p->refs = 0;
+                program_maybe_free(p);
+                p = NULL;
+            } else {
+                free(text);
+            }
+            SET_ERR(CL_OUT_OF_HOST_MEMORY);
+        } else {
+            SET_ERR(CL_SUCCESS);
+        }
+    }
+    sim_unlock();
+    return p;
+}
+
+/* Binaries are the program text after a header. */
+CL_API_ENTRY cl_program CL_API_CALL
+clCreateProgramWithBinary(cl_context                     context,
+                          cl_uint                        num_devices,
+                          const cl_device_id *           device_list,
+                          const size_t *                 lengths,
+                          const unsigned char **         binaries,
+                          cl_int *                       binary_status,
+                          cl_int *                       errcode_ret) {
+    const size_t header = strlen(SIM_BINARY_HEADER);
+    cl_program p = NULL;
+    cl_int err;
+    char *text;
+
+    if (device_list == NULL || num_devices == 0 || lengths == NULL || binaries == NULL) {
+        SET_ERR(CL_INVALID_VALUE);
+        return NULL;
+    }
+    if ((err = check_devices(num_devices, device_list)) != CL_SUCCESS) {
+        SET_ERR(err);
+        return NULL;
+    }
+    if (num_devices != 1) {
+        SET_ERR(CL_INVALID_DEVICE);
+        return NULL;
+    }
+    if (binaries[0] == NULL || lengths[0] == 0) {
+        if (binary_status != NULL) {
+            binary_status[0] = CL_INVALID_VALUE;
+        }
+        SET_ERR(CL_INVALID_VALUE);
+        return NULL;
+    }
+    if (lengths[0] < header || memcmp(binaries[0], SIM_BINARY_HEADER, header) != 0) {
+        if (binary_status != NULL) {
+            binary_status[0] = CL_INVALID_BINARY;
+        }
+        SET_ERR(CL_INVALID_BINARY);
+        return NULL;
+    }
+    sim_lock();
+    if (!is_context(context)) {
+        SET_ERR(CL_INVALID_CONTEXT);
+    } else if ((err = sim_fault("clCreateProgramWithBinary")) != CL_SUCCESS) {
+        SET_ERR(err);
+    } else if ((text = malloc(lengths[0] - header + 1)) == NULL) {
+        SET_ERR(CL_OUT_OF_HOST_MEMORY);
+    } else {
+        memcpy(text, binaries[0] + header, lengths[0] - header);
+        text[lengths[0] - header] = '\0';
+        if ((p = program_new(context, text)) == NULL) {
+            free(text);
+            SET_ERR(CL_OUT_OF_HOST_MEMORY);
+        } else {
+            p->binary_type = CL_PROGRAM_BINARY_TYPE_EXECUTABLE;
+            if (binary_status != NULL) {
+                binary_status[0] = CL_SUCCESS;
+            }
+            SET_ERR(CL_SUCCESS);
+        }
+    }
+    sim_unlock();
+    return p;
+}
+
+CL_API_ENTRY cl_program CL_API_CALL
+clCreateProgramWithBuiltInKernels(cl_context            context,
+                                  cl_uint               num_devices,
+                                  const cl_device_id *  device_list,
+                                  const char *          kernel_names,
+                                  cl_int *              errcode_ret) {
+    /* The device has no built-in kernels */
+    SET_ERR(is_context(context) ? CL_INVALID_VALUE : CL_INVALID_CONTEXT);
+    return NULL;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clRetainProgram(cl_program program) {
+    cl_int err = CL_INVALID_PROGRAM;
+    sim_lock();
+    if (is_program(program)) {
+        program->refs++;
+        err = CL_SUCCESS;
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clReleaseProgram(cl_program program) {
+    cl_int err = CL_INVALID_PROGRAM;
+    sim_lock();
+    if (is_program(program) && program->refs > 0) {
+        program->refs--;
+        program_maybe_free(program);
+        err = CL_SUCCESS;
+    }
+    sim_unlock();
+    return err;
+}
+
+/* Builds or compiles p with the lock held, and queues the notification. */
+static cl_int program_build(cl_program p, const char *options, cl_program_binary_type type,
+                            void (CL_CALLBACK *pfn_notify)(cl_program, void *), void *user_data) {
+    struct parser parser;
+    struct build_fault *fault;
+    cl_int err;
+
+    if (p->holds != 0) {
+        /* Kernels are attached to the program */
+        return CL_INVALID_OPERATION;
+    }
+    program_reset(p);
+    p->options = sim_strdup(options != NULL ? options : "");
+    memset(&parser, 0, sizeof(parser));
+    if (!tokenize(&parser, p->text)) {
+        err = CL_OUT_OF_HOST_MEMORY;
+    } else if ((fault = sim_build_fault(p->text)) != NULL) {
+        /* The injected log replaces the diagnostics */
+        free(parser.log);
+        parser.log = NULL;
+        parser.log_len = 0;
+        parser.errors = 0;
+        parser_append(&parser, fault->log, strlen(fault->log));
+        err = CL_BUILD_PROGRAM_FAILURE;
+    } else if (parser.errors == 0) {
+        err = parse_kernels(&parser, &p->kernels, &p->num_kernels);
+    } else {
+        err = CL_BUILD_PROGRAM_FAILURE;
+    }
+    if (parser.errors > 0) {
+        char summary[64];
+        int n = snprintf(summary, sizeof(summary), "%d error%s generated.\n", parser.errors, parser.errors > 1 ? "s" : "");
+        parser_append(&parser, summary, (size_t)n);
+    }
+    free(parser.tokens);
+    p->log = parser.log != NULL ? parser.log : sim_strdup("");
+
+    if (err == CL_SUCCESS) {
+        p->status = CL_BUILD_SUCCESS;
+        p->binary_type = type;
+        p->arg_info = p->source != NULL && strstr(p->options, "-cl-kernel-arg-info") != NULL;
+    } else {
+        p->status = CL_BUILD_ERROR;
+        p->binary_type = CL_PROGRAM_BINARY_TYPE_NONE;
+        if (type == CL_PROGRAM_BINARY_TYPE_COMPILED_OBJECT && err == CL_BUILD_PROGRAM_FAILURE) {
+            err = CL_COMPILE_PROGRAM_FAILURE;
+        }
+    }
+    if (pfn_notify != NULL) {
+        p->holds++;
+        defer(DEFER_PROGRAM, p, 0, (void *)pfn_notify, user_data, NULL);
+    }
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clBuildProgram(cl_program           program,
+               cl_uint              num_devices,
+               const cl_device_id * device_list,
+               const char *         options,
+               void (CL_CALLBACK *  pfn_notify)(cl_program program,
+                                                void * user_data),
+               void *               user_data) {
+    cl_int err;
+    if (pfn_notify == NULL && user_data != NULL) {
+        return CL_INVALID_VALUE;
+    }
+    if ((err = check_devices(num_devices, device_list)) != CL_SUCCESS) {
+        return err;
+    }
+    sim_lock();
+    if (!is_program(program)) {
+        err = CL_INVALID_PROGRAM;
+    } else if (program->source == NULL && program->binary_type == CL_PROGRAM_BINARY_TYPE_NONE) {
+        err = CL_INVALID_BINARY;
+    } else if ((err = sim_fault("clBuildProgram")) == CL_SUCCESS) {
+        err = program_build(program, options, CL_PROGRAM_BINARY_TYPE_EXECUTABLE, pfn_notify, user_data);
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clCompileProgram(cl_program           program,
+                 cl_uint              num_devices,
+                 const cl_device_id * device_list,
+                 const char *         options,
+                 cl_uint              num_input_headers,
+                 const cl_program *   input_headers,
+                 const char **        header_include_names,
+                 void (CL_CALLBACK *  pfn_notify)(cl_program program,
+                                                  void * user_data),
+                 void *               user_data) {
+    cl_int err;
+    cl_uint i;
+    if (pfn_notify == NULL && user_data != NULL) {
+        return CL_INVALID_VALUE;
+    }
+    if ((num_input_headers == 0) != (input_headers == NULL) || (num_input_headers == 0) != (header_include_names == NULL)) {
+        return CL_INVALID_VALUE;
+    }
+    if ((err = check_devices(num_devices, device_list)) != CL_SUCCESS) {
+        return err;
+    }
+    sim_lock();
+    if (!is_program(program) || program->source == NULL) {
+        err = CL_INVALID_PROGRAM;
+    } else {
+        for (i = 0; i < num_input_headers; i++) {
+            if (!is_program(input_headers[i])) {
+                err = CL_INVALID_PROGRAM;
+            }
+        }
+        if (err == CL_SUCCESS && (err = sim_fault("clCompileProgram")) == CL_SUCCESS) {
+            err = program_build(program, options, CL_PROGRAM_BINARY_TYPE_COMPILED_OBJECT, pfn_notify, user_data);
+        }
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_program CL_API_CALL
+clLinkProgram(cl_context           context,
+              cl_uint              num_devices,
+              const cl_device_id * device_list,
+              const char *         options,
+              cl_uint              num_input_programs,
+              const cl_program *   input_programs,
+              void (CL_CALLBACK *  pfn_notify)(cl_program program,
+                                               void * user_data),
+              void *               user_data,
+              cl_int *             errcode_ret) {
+    cl_program p = NULL;
+    cl_int err;
+    cl_uint i;
+    size_t total = 0;
+    int arg_info = 1;
+    char *text;
+
+    if ((pfn_notify == NULL && user_data != NULL) || num_input_programs == 0 || input_programs == NULL) {
+        SET_ERR(CL_INVALID_VALUE);
+        return NULL;
+    }
+    if ((err = check_devices(num_devices, device_list)) != CL_SUCCESS) {
+        SET_ERR(err);
+        return NULL;
+    }
+    sim_lock();
+    if (!is_context(context)) {
+        err = CL_INVALID_CONTEXT;
+    } else {
+        err = sim_fault("clLinkProgram");
+    }
+    for (i = 0; err == CL_SUCCESS && i < num_input_programs; i++) {
+        if (!is_program(input_programs[i])) {
+            err = CL_INVALID_PROGRAM;
+        } else if (input_programs[i]->binary_type != CL_PROGRAM_BINARY_TYPE_COMPILED_OBJECT &&
+                   input_programs[i]->binary_type != CL_PROGRAM_BINARY_TYPE_LIBRARY) {
+            err = CL_INVALID_OPERATION;
+        } else {
+            total += strlen(input_programs[i]->text) + 1;
+            arg_info = arg_info && input_programs[i]->arg_info;
+        }
+    }
+    if (err == CL_SUCCESS && (text = malloc(total + 1)) == NULL) {
+        err = CL_OUT_OF_HOST_MEMORY;
+    }
+    if (err == CL_SUCCESS) {
+        for (total = 0, i = 0; i < num_input_programs; i++) {
+            size_t n = strlen(input_programs[i]->text);
+            memcpy(text + total, input_programs[i]->text, n);
+            text[total + n] = '\n';
+            total += n + 1;
+        }
+        text[total] = '\0';
+        if ((p = program_new(context, text)) == NULL) {
+            free(text);
+            err = CL_OUT_OF_HOST_MEMORY;
+        } else {
+            int library = options != NULL && strstr(options, "-create-library") != NULL;
+            err = program_build(p, options, library ? CL_PROGRAM_BINARY_TYPE_LIBRARY : CL_PROGRAM_BINARY_TYPE_EXECUTABLE,
+                                pfn_notify, user_data);
+            p->arg_info = arg_info;
+            if (err == CL_BUILD_PROGRAM_FAILURE) {
+                err = CL_LINK_PROGRAM_FAILURE;
+            }
+        }
+    }
+    sim_unlock();
+    SET_ERR(err);
+    return p;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clGetProgramInfo(cl_program         program,
+                 cl_program_info    param_name,
+                 size_t             size,
+                 void *             value,
+                 size_t *           size_ret) {
+    const size_t header = strlen(SIM_BINARY_HEADER);
+    size_t binary_size;
+    cl_int err = CL_INVALID_VALUE;
+    cl_uint i;
+
+    sim_lock();
+    if (!is_program(program)) {
+        sim_unlock();
+        return CL_INVALID_PROGRAM;
+    }
+    binary_size = program->binary_type == CL_PROGRAM_BINARY_TYPE_NONE ? 0 : header + strlen(program->text);
+    switch (param_name) {
+    case CL_PROGRAM_REFERENCE_COUNT:
+        err = info(&program->refs, sizeof(cl_uint), size, value, size_ret);
+        break;
+    case CL_PROGRAM_CONTEXT:
+        err = info(&program->context, sizeof(cl_context), size, value, size_ret);
+        break;
+    case CL_PROGRAM_NUM_DEVICES: {
+        cl_uint n = 1;
+        err = info(&n, sizeof(n), size, value, size_ret);
+        break;
+    }
+    case CL_PROGRAM_DEVICES: {
+        cl_device_id d = &sim_device;
+        err = info(&d, sizeof(d), size, value, size_ret);
+        break;
+    }
+    case CL_PROGRAM_SOURCE:
+        err = info(program->source != NULL ? program->source : "",
+                   program->source != NULL ? strlen(program->source) + 1 : 1, size, value, size_ret);
+        break;
+    case CL_PROGRAM_BINARY_SIZES:
+        err = info(&binary_size, sizeof(binary_size), size, value, size_ret);
+        break;
+    case CL_PROGRAM_BINARIES:
+        err = CL_SUCCESS;
+        if (value != NULL) {
+            unsigned char *dst;
+            if (size < sizeof(dst)) {
+                err = CL_INVALID_VALUE;
+                break;
+            }
+            dst = ((unsigned char **)value)[0];
+            if (dst != NULL && binary_size > 0) {
+                memcpy(dst, SIM_BINARY_HEADER, header);
+                memcpy(dst + header, program->text, binary_size - header);
+            }
+        }
+        if (size_ret != NULL) {
+            *size_ret = sizeof(unsigned char *);
+        }
+        break;
+    case CL_PROGRAM_NUM_KERNELS:
+        if (program->status != CL_BUILD_SUCCESS || program->binary_type != CL_PROGRAM_BINARY_TYPE_EXECUTABLE) {
+            err = CL_INVALID_PROGRAM_EXECUTABLE;
+        } else {
+            size_t n = program->num_kernels;
+            err = info(&n, sizeof(n), size, value, size_ret);
+        }
+        break;
+    case CL_PROGRAM_KERNEL_NAMES: {
+        size_t n = 1;
+        char *names;
+        if (program->status != CL_BUILD_SUCCESS || program->binary_type != CL_PROGRAM_BINARY_TYPE_EXECUTABLE) {
+            err = CL_INVALID_PROGRAM_EXECUTABLE;
+            break;
+        }
+        for (i = 0; i < program->num_kernels; i++) {
+            n += strlen(program->kernels[i].name) + 1;
+        }
+        if ((names = calloc(1, n)) == NULL) {
+            err = CL_OUT_OF_HOST_MEMORY;
+            break;
+        }
+        for (i = 0; i < program->num_kernels; i++) {
+            if (i > 0) {
+                strcat(names, ";");
+            }
+            strcat(names, program->kernels[i].name);
+        }
+        err = info(names, strlen(names) + 1, size, value, size_ret);
+        free(names);
+        break;
+    }
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clGetProgramBuildInfo(cl_program            program,
+                      cl_device_id          device,
+                      cl_program_build_info param_name,
+                      size_t                size,
+                      void *                value,
+                      size_t *              size_ret) {
+    cl_int err = CL_INVALID_VALUE;
+    sim_lock();
+    if (!is_program(program)) {
+        err = CL_INVALID_PROGRAM;
+    } else if (device != &sim_device) {
+        err = CL_INVALID_DEVICE;
+    } else {
+        const char *options = program->options != NULL ? program->options : "";
+        const char *log = program->log != NULL ? program->log : "";
+        switch (param_name) {
+        case CL_PROGRAM_BUILD_STATUS:
+            err = info(&program->status, sizeof(program->status), size, value, size_ret);
+            break;
+        case CL_PROGRAM_BUILD_OPTIONS:
+            err = info(options, strlen(options) + 1, size, value, size_ret);
+            break;
+        case CL_PROGRAM_BUILD_LOG:
+            err = info(log, strlen(log) + 1, size, value, size_ret);
+            break;
+        case CL_PROGRAM_BINARY_TYPE:
+            err = info(&program->binary_type, sizeof(program->binary_type), size, value, size_ret);
+            break;
+        }
+    }
+    sim_unlock();
+    return err;
+}
+
+/* ------------------------------------------------------------------------ */
+/* Kernels                                                                  */
+/* ------------------------------------------------------------------------ */
+
+static int is_kernel(cl_kernel k) {
+    return k != NULL && k->magic == MAGIC_KERNEL;
+}
+
+static int program_executable(cl_program p) {
+    return p->status == CL_BUILD_SUCCESS && p->binary_type == CL_PROGRAM_BINARY_TYPE_EXECUTABLE;
+}
+
+static cl_kernel kernel_new(cl_program p, struct kernel_decl *decl) {
+    cl_kernel k = calloc(1, sizeof(*k));
+    if (k == NULL) {
+        return NULL;
+    }
+    if (decl->num_params > 0 && (k->args = calloc(decl->num_params, sizeof(*k->args))) == NULL) {
+        free(k);
+        return NULL;
+    }
+    k->magic = MAGIC_KERNEL;
+    k->refs = 1;
+    k->program = p;
+    p->holds++;
+    k->decl = decl;
+    return k;
+}
+
+static void kernel_maybe_free(cl_kernel k) {
+    cl_uint i;
+    if (k->refs != 0 || k->holds != 0) {
+        return;
+    }
+    for (i = 0; i < k->decl->num_params; i++) {
+        free(k->args[i].value);
+    }
+    free(k->args);
+    k->magic = 0;
+    program_unhold(k->program);
+    free(k);
+}
+
+CL_API_ENTRY cl_kernel CL_API_CALL
+clCreateKernel(cl_program      program,
+               const char *    kernel_name,
+               cl_int *        errcode_ret) {
+    cl_kernel k = NULL;
+    cl_uint i;
+    cl_int err;
+    sim_lock();
+    if (!is_program(program)) {
+        SET_ERR(CL_INVALID_PROGRAM);
+    } else if (!program_executable(program)) {
+        SET_ERR(CL_INVALID_PROGRAM_EXECUTABLE);
+    } else if (kernel_name == NULL) {
+        SET_ERR(CL_INVALID_VALUE);
+    } else if ((err = sim_fault("clCreateKernel")) != CL_SUCCESS) {
+        SET_ERR(err);
+    } else {
+        SET_ERR(CL_INVALID_KERNEL_NAME);
+        for (i = 0; i < program->num_kernels; i++) {
+            if (strcmp(program->kernels[i].name, kernel_name) == 0) {
+                k = kernel_new(program, &program->kernels[i]);
+                SET_ERR(k != NULL ? CL_SUCCESS : CL_OUT_OF_HOST_MEMORY);
+                break;
+            }
+        }
+    }
+    sim_unlock();
+    return k;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clCreateKernelsInProgram(cl_program     program,
+                         cl_uint        num_kernels,
+                         cl_kernel *    kernels,
+                         cl_uint *      num_kernels_ret) {
+    cl_int err = CL_SUCCESS;
+    cl_uint i;
+    sim_lock();
+    if (!is_program(program)) {
+        err = CL_INVALID_PROGRAM;
+    } else if (!program_executable(program)) {
+        err = CL_INVALID_PROGRAM_EXECUTABLE;
+    } else if (kernels != NULL && num_kernels < program->num_kernels) {
+        err = CL_INVALID_VALUE;
+    } else if ((err = sim_fault("clCreateKernelsInProgram")) == CL_SUCCESS) {
+        for (i = 0; kernels != NULL && i < program->num_kernels; i++) {
+            if ((kernels[i] = kernel_new(program, &program->kernels[i])) == NULL) {
+                while (i-- > 0) {
+                    kernels[i]->refs = 0;
+                    kernel_maybe_free(kernels[i]);
+                }
+                err = CL_OUT_OF_HOST_MEMORY;
+                break;
+            }
+        }
+        if (err == CL_SUCCESS && num_kernels_ret != NULL) {
+            *num_kernels_ret = program->num_kernels;
+        }
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clRetainKernel(cl_kernel kernel) {
+    cl_int err = CL_INVALID_KERNEL;
+    sim_lock();
+    if (is_kernel(kernel)) {
+        kernel->refs++;
+        err = CL_SUCCESS;
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clReleaseKernel(cl_kernel kernel) {
+    cl_int err = CL_INVALID_KERNEL;
+    sim_lock();
+    if (is_kernel(kernel) && kernel->refs > 0) {
+        kernel->refs--;
+        kernel_maybe_free(kernel);
+        err = CL_SUCCESS;
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clSetKernelArg(cl_kernel    kernel,
+               cl_uint      arg_index,
+               size_t       arg_size,
+               const void * arg_value) {
+    cl_int err = CL_SUCCESS;
+    const struct kernel_param *param;
+    struct kernel_arg *arg;
+    void *copy = NULL;
+
+    sim_lock();
+    if (!is_kernel(kernel)) {
+        err = CL_INVALID_KERNEL;
+    } else if (arg_index >= kernel->decl->num_params) {
+        err = CL_INVALID_ARG_INDEX;
+    } else {
+        param = &kernel->decl->params[arg_index];
+        if (param->address == CL_KERNEL_ARG_ADDRESS_LOCAL) {
+            if (arg_value != NULL) {
+                err = CL_INVALID_ARG_VALUE;
+            } else if (arg_size == 0 || arg_size > SIM_LOCAL_MEM) {
+                err = CL_INVALID_ARG_SIZE;
+            }
+        } else if (param->is_mem) {
+            if (arg_size != sizeof(cl_mem)) {
+                err = CL_INVALID_ARG_SIZE;
+            } else if (arg_value != NULL && *(const cl_mem *)arg_value != NULL &&
+                       !is_live_mem(*(const cl_mem *)arg_value)) {
+                err = CL_INVALID_MEM_OBJECT;
+            } else if ((arg_value == NULL || *(const cl_mem *)arg_value == NULL) &&
+                       strncmp(param->type_name, "image", 5) == 0) {
+                err = CL_INVALID_MEM_OBJECT;
+            }
+        } else if (arg_value == NULL) {
+            err = CL_INVALID_ARG_VALUE;
+        } else if (strcmp(param->type_name, "sampler_t") == 0) {
+            err = CL_INVALID_SAMPLER;
+        } else if (arg_size == 0 || (param->size != 0 && arg_size != param->size)) {
+            err = CL_INVALID_ARG_SIZE;
+        }
+        if (err == CL_SUCCESS && arg_value != NULL) {
+            if ((copy = malloc(arg_size)) == NULL) {
+                err = CL_OUT_OF_HOST_MEMORY;
+            } else {
+                memcpy(copy, arg_value, arg_size);
+            }
+        }
+        if (err == CL_SUCCESS) {
+            arg = &kernel->args[arg_index];
+            free(arg->value);
+            arg->set = 1;
+            arg->size = arg_size;
+            arg->value = copy;
+        }
+    }
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clGetKernelInfo(cl_kernel       kernel,
+                cl_kernel_info  param_name,
+                size_t          size,
+                void *          value,
+                size_t *        size_ret) {
+    if (!is_kernel(kernel)) {
+        return CL_INVALID_KERNEL;
+    }
+    switch (param_name) {
+    case CL_KERNEL_FUNCTION_NAME:   INFO_STR(kernel->decl->name);
+    case CL_KERNEL_NUM_ARGS:        INFO(cl_uint, kernel->decl->num_params);
+    case CL_KERNEL_REFERENCE_COUNT: INFO(cl_uint, kernel->refs);
+    case CL_KERNEL_CONTEXT:         INFO(cl_context, kernel->program->context);
+    case CL_KERNEL_PROGRAM:         INFO(cl_program, kernel->program);
+    case CL_KERNEL_ATTRIBUTES:      INFO_STR("");
+    }
+    return CL_INVALID_VALUE;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clGetKernelArgInfo(cl_kernel          kernel,
+                   cl_uint            arg_indx,
+                   cl_kernel_arg_info param_name,
+                   size_t             size,
+                   void *             value,
+                   size_t *           size_ret) {
+    const struct kernel_param *param;
+    if (!is_kernel(kernel)) {
+        return CL_INVALID_KERNEL;
+    }
+    if (arg_indx >= kernel->decl->num_params) {
+        return CL_INVALID_ARG_INDEX;
+    }
+    if (!kernel->program->arg_info) {
+        return CL_KERNEL_ARG_INFO_NOT_AVAILABLE;
+    }
+    param = &kernel->decl->params[arg_indx];
+    switch (param_name) {
+    case CL_KERNEL_ARG_ADDRESS_QUALIFIER: INFO(cl_kernel_arg_address_qualifier, param->address);
+    case CL_KERNEL_ARG_ACCESS_QUALIFIER:  INFO(cl_kernel_arg_access_qualifier, param->access);
+    case CL_KERNEL_ARG_TYPE_NAME:         INFO_STR(param->type_name);
+    case CL_KERNEL_ARG_TYPE_QUALIFIER:    INFO(cl_kernel_arg_type_qualifier, param->type_qualifier);
+    case CL_KERNEL_ARG_NAME:              INFO_STR(param->name);
+    }
+    return CL_INVALID_VALUE;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clGetKernelWorkGroupInfo(cl_kernel                  kernel,
+                         cl_device_id               device,
+                         cl_kernel_work_group_info  param_name,
+                         size_t                     size,
+                         void *                     value,
+                         size_t *                   size_ret) {
+    static const size_t compile_work_group_size[3] = {0, 0, 0};
+    if (!is_kernel(kernel)) {
+        return CL_INVALID_KERNEL;
+    }
+    if (device != NULL && device != &sim_device) {
+        return CL_INVALID_DEVICE;
+    }
+    switch (param_name) {
+    case CL_KERNEL_WORK_GROUP_SIZE:                    INFO(size_t, SIM_MAX_WORK_GROUP);
+    case CL_KERNEL_COMPILE_WORK_GROUP_SIZE:
+        return info(compile_work_group_size, sizeof(compile_work_group_size), size, value, size_ret);
+    case CL_KERNEL_LOCAL_MEM_SIZE:                     INFO(cl_ulong, 0);
+    case CL_KERNEL_PREFERRED_WORK_GROUP_SIZE_MULTIPLE: INFO(size_t, 1);
+    case CL_KERNEL_PRIVATE_MEM_SIZE:                   INFO(cl_ulong, 0);
+    }
+    return CL_INVALID_VALUE;
+}
+
+static cl_int run_kernel(struct command *c) {
+    cl_int err;
+    char message[256];
+
+    if (sim_dispatcher == NULL) {
+        err = CL_INVALID_KERNEL;
+    } else {
+        err = sim_dispatcher(c->kernel->decl->name, c->work_dim, c->global_offset, c->global_size,
+                             c->has_local ? c->local_size : NULL, c->kernel->decl->num_params, c->args);
+    }
+    if (err != CL_SUCCESS) {
+        snprintf(message, sizeof(message), CLSIM_PLATFORM_NAME ": kernel %s failed with error %d",
+                 c->kernel->decl->name, err);
+        context_notify(c->kernel->program->context, message);
+    }
+    return err;
+}
+
+/* Copies the arguments of the kernel into the command, as later calls to
+ * clSetKernelArg must not change them. */
+static cl_int command_set_args(struct command *c, cl_kernel k) {
+    cl_uint i, n = k->decl->num_params;
+
+    c->kernel = k;
+    k->holds++;
+    if (n == 0) {
+        return CL_SUCCESS;
+    }
+    if ((c->args = calloc(n, sizeof(*c->args))) == NULL || (c->arg_values = calloc(n, sizeof(*c->arg_values))) == NULL) {
+        return CL_OUT_OF_HOST_MEMORY;
+    }
+    for (i = 0; i < n; i++) {
+        const struct kernel_arg *arg = &k->args[i];
+        if (!arg->set) {
+            return CL_INVALID_KERNEL_ARGS;
+        }
+        c->args[i].size = arg->size;
+        if (arg->value == NULL) {
+            continue;
+        }
+        if ((c->arg_values[i] = malloc(arg->size)) == NULL) {
+            return CL_OUT_OF_HOST_MEMORY;
+        }
+        memcpy(c->arg_values[i], arg->value, arg->size);
+        c->args[i].value = c->arg_values[i];
+        if (k->decl->params[i].is_mem) {
+            cl_mem m = *(cl_mem *)arg->value;
+            if (m == NULL) {
+                continue;
+            }
+            if (!is_live_mem(m)) {
+                return CL_INVALID_MEM_OBJECT;
+            }
+            if (command_hold(c, m) != CL_SUCCESS) {
+                return CL_OUT_OF_HOST_MEMORY;
+            }
+            c->args[i].mem = m->data;
+            c->args[i].mem_size = m->size;
+        }
+    }
+    return CL_SUCCESS;
+}
+
+static cl_int enqueue_kernel(cl_command_queue q, cl_kernel k, cl_command_type type, cl_uint work_dim,
+                             const size_t *global_offset, const size_t *global_size, const size_t *local_size,
+                             cl_uint num_waits, const cl_event *waits, cl_event *event) {
+    struct command *c;
+    size_t group = 1;
+    cl_uint i;
+    cl_int err;
+
+    if (!is_queue(q)) {
+        return CL_INVALID_COMMAND_QUEUE;
+    }
+    if (!is_kernel(k)) {
+        return CL_INVALID_KERNEL;
+    }
+    if (k->program->context != q->context) {
+        return CL_INVALID_CONTEXT;
+    }
+    if (work_dim < 1 || work_dim > 3) {
+        return CL_INVALID_WORK_DIMENSION;
+    }
+    if (global_size == NULL) {
+        return CL_INVALID_GLOBAL_WORK_SIZE;
+    }
+    for (i = 0; i < work_dim; i++) {
+        if (global_size[i] == 0) {
+            return CL_INVALID_GLOBAL_WORK_SIZE;
+        }
+        if (global_offset != NULL && global_offset[i] > SIZE_MAX - global_size[i]) {
+            return CL_INVALID_GLOBAL_OFFSET;
+        }
+        if (local_size != NULL) {
+            if (local_size[i] == 0 || local_size[i] > SIM_MAX_WORK_GROUP) {
+                return CL_INVALID_WORK_ITEM_SIZE;
+            }
+            if (global_size[i] % local_size[i] != 0) {
+                return CL_INVALID_WORK_GROUP_SIZE;
+            }
+            group *= local_size[i];
+        }
+    }
+    if (group > SIM_MAX_WORK_GROUP) {
+        return CL_INVALID_WORK_GROUP_SIZE;
+    }
+    if ((c = command_new(run_kernel)) == NULL) {
+        return CL_OUT_OF_HOST_MEMORY;
+    }
+    c->work_dim = work_dim;
+    for (i = 0; i < 3; i++) {
+        c->global_offset[i] = (i < work_dim && global_offset != NULL) ? global_offset[i] : 0;
+        c->global_size[i] = i < work_dim ? global_size[i] : 1;
+        c->local_size[i] = (i < work_dim && local_size != NULL) ? local_size[i] : 1;
+    }
+    c->has_local = local_size != NULL;
+    if ((err = command_set_args(c, k)) != CL_SUCCESS) {
+        command_free(c);
+        return err;
+    }
+    return enqueue(q, type, c, num_waits, waits, event, CL_FALSE);
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clEnqueueNDRangeKernel(cl_command_queue command_queue,
+                       cl_kernel        kernel,
+                       cl_uint          work_dim,
+                       const size_t *   global_work_offset,
+                       const size_t *   global_work_size,
+                       const size_t *   local_work_size,
+                       cl_uint          num_events_in_wait_list,
+                       const cl_event * event_wait_list,
+                       cl_event *       event) {
+    cl_int err;
+    sim_lock();
+    err = enqueue_kernel(command_queue, kernel, CL_COMMAND_NDRANGE_KERNEL, work_dim, global_work_offset,
+                         global_work_size, local_work_size, num_events_in_wait_list, event_wait_list, event);
+    sim_unlock();
+    return err;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clEnqueueTask(cl_command_queue  command_queue,
+              cl_kernel         kernel,
+              cl_uint           num_events_in_wait_list,
+              const cl_event *  event_wait_list,
+              cl_event *        event) {
+    static const size_t one = 1;
+    cl_int err;
+    sim_lock();
+    err = enqueue_kernel(command_queue, kernel, CL_COMMAND_TASK, 1, NULL, &one, &one,
+                         num_events_in_wait_list, event_wait_list, event);
+    sim_unlock();
+    return err;
+}
+
+static cl_int run_native(struct command *c) {
+    c->native(c->native_args);
+    return CL_SUCCESS;
+}
+
+CL_API_ENTRY cl_int CL_API_CALL
+clEnqueueNativeKernel(cl_command_queue  command_queue,
+                      void (CL_CALLBACK * user_func)(void *),
+                      void *            args,
+                      size_t            cb_args,
+                      cl_uint           num_mem_objects,
+                      const cl_mem *    mem_list,
+                      const void **     args_mem_loc,
+                      cl_uint           num_events_in_wait_list,
+                      const cl_event *  event_wait_list,
+                      cl_event *        event) {
+    cl_int err = CL_SUCCESS;
+    struct command *c = NULL;
+    cl_uint i;
+
+    sim_lock();
+    if (!is_queue(command_queue)) {
+        err = CL_INVALID_COMMAND_QUEUE;
+    } else if (user_func == NULL || (args == NULL && (cb_args > 0 || num_mem_objects > 0)) ||
+               (args != NULL && cb_args == 0) || (num_mem_objects > 0) != (mem_list != NULL) ||
+               (num_mem_objects > 0) != (args_mem_loc != NULL)) {
+        err = CL_INVALID_VALUE;
+    } else if ((c = command_new(run_native)) == NULL || (cb_args > 0 && (c->native_args = malloc(cb_args)) == NULL)) {
+        err = CL_OUT_OF_HOST_MEMORY;
+    } else {
+        c->native = user_func;
+        if (cb_args > 0) {
+            memcpy(c->native_args, args, cb_args);
+        }
+        /* The copy of args gets the storage of the memory objects in place of their handles */
+        for (i = 0; i < num_mem_objects && err == CL_SUCCESS; i++) {
+            size_t loc = (size_t)((const char *)args_mem_loc[i] - (const char *)args);
+            if ((const char *)args_mem_loc[i] < (const char *)args || loc + sizeof(void *) > cb_args) {
+                err = CL_INVALID_VALUE;
+            } else if ((err = check_buffer(command_queue, mem_list[i])) == CL_SUCCESS &&
+                       (err = command_hold(c, mem_list[i])) == CL_SUCCESS) {
+                memcpy((char *)c->native_args + loc, &mem_list[i]->data, sizeof(void *));
+            }
+        }
+    }
+    if (err == CL_SUCCESS) {
+        err = enqueue(command_queue, CL_COMMAND_NATIVE_KERNEL, c, num_events_in_wait_list, event_wait_list, event, CL_FALSE);
+    } else if (c != NULL) {
+        command_free(c);
+    }
+    sim_unlock();
+    return err;
+}
@@ -0,0 +1,78 @@
+/*
+ * Extension API of the go2opencl-sim software OpenCL platform (clsim.c).
+ *
+ * The simulator does not compile OpenCL C. Kernels are launched by calling
+ * the dispatcher installed with clSimSetKernelDispatcher, once per
+ * clEnqueueNDRangeKernel, with the kernel name, the NDRange and the
+ * arguments set with clSetKernelArg.
+ *
+ * The clSimInject functions make calls fail as real drivers do, to test
+ * error paths. They are found with clGetExtensionFunctionAddressForPlatform
+ * like the dispatcher.
+ */
+#ifndef CLSIM_H
+#define CLSIM_H
+
+#ifdef __APPLE__
+#include <OpenCL/cl.h>
+#else
+#include "CL/cl.h"
+#endif
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+#define CLSIM_PLATFORM_NAME "go2opencl-sim"
+
+typedef struct {
+    size_t      size;     /* arg_size passed to clSetKernelArg */
+    const void *value;    /* arg_value passed to clSetKernelArg, NULL for __local arguments */
+    void       *mem;      /* storage of cl_mem arguments, NULL for other arguments */
+    size_t      mem_size; /* size in bytes of the storage of cl_mem arguments */
+} clsim_kernel_arg;
+
+/* Runs kernel name over the NDRange. local_size is NULL if the application
+ * did not give one. Returns CL_SUCCESS, or an error that becomes the
+ * execution status of the kernel's event. */
+typedef cl_int (*clsim_kernel_dispatcher)(const char *             name,
+                                          cl_uint                  work_dim,
+                                          const size_t *           global_offset,
+                                          const size_t *           global_size,
+                                          const size_t *           local_size,
+                                          cl_uint                  num_args,
+                                          const clsim_kernel_arg * args);
+
+/* Installs the function running all kernels. NULL removes it, and kernel
+ * launches then fail with CL_INVALID_KERNEL. */
+extern CL_API_ENTRY void CL_API_CALL
+clSimSetKernelDispatcher(clsim_kernel_dispatcher dispatcher);
+
+/* Makes the nth call to function from now on fail with error, counting
+ * from 1, or every call if nth is 0. Calls that enqueue commands count and
+ * fail when the command runs, setting its event's status to error. Returns
+ * CL_INVALID_VALUE if error is not negative or function cannot fail this
+ * way. */
+extern CL_API_ENTRY cl_int CL_API_CALL
+clSimInjectFault(const char *function, cl_uint nth, cl_int error);
+
+/* Makes builds, compilations and links of programs whose code contains
+ * match fail with build_log as the build log. */
+extern CL_API_ENTRY cl_int CL_API_CALL
+clSimInjectBuildFault(const char *match, const char *build_log);
+
+/* Loses the device: commands that have not run yet and all later commands
+ * fail with error, the contexts they belong to are notified, and
+ * CL_DEVICE_AVAILABLE becomes CL_FALSE. CL_SUCCESS restores the device. */
+extern CL_API_ENTRY void CL_API_CALL
+clSimSetDeviceLost(cl_int error);
+
+/* Removes all injected faults and restores the device. */
+extern CL_API_ENTRY void CL_API_CALL
+clSimClearFaults(void);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif /* CLSIM_H */
@@ -0,0 +1,119 @@
+package go2opencl
+
+/*
+#include "./opencl.h"
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Export of recorded commands in the Chrome Trace Event format, which can be
+// loaded in chrome://tracing or https://ui.perfetto.dev. Every device is shown
+// as a process and every command queue as a thread of its device. Timestamps
+// are the profiling counters of the device, relative to the earliest recorded
+// command.
+
+// ////////////// Basic Types ////////////////
+type traceEvent struct {
+	Name string                 `json:"name"`
+	Cat  string                 `json:"cat,omitempty"`
+	Ph   string                 `json:"ph"`
+	Ts   float64                `json:"ts"`
+	Dur  float64                `json:"dur,omitempty"`
+	Pid  int                    `json:"pid"`
+	Tid  int                    `json:"tid"`
+	Args map[string]interface{} `json:"args,omitempty"`
+}
+
+type traceFile struct {
+	TraceEvents     []traceEvent `json:"traceEvents"`
+	DisplayTimeUnit string       `json:"displayTimeUnit"`
+}
+
+// ////////////// Basic Functions ////////////////
+func traceCategory(cmd CommandType) string {
+	switch cmd {
+	case CommandNDRangeKernel, CommandTask, CommandNativeKernel:
+		return "kernel"
+	case CommandMarker, CommandBarrier, CommandUser:
+		return "sync"
+	}
+	return "transfer"
+}
+
+// ////////////// Abstract Functions ////////////////
+
+// Waits for all recorded commands to complete and writes them to w as Chrome
+// Trace Event JSON, with one track per command queue grouped by device.
+func (r *Recorder) WriteChromeTrace(w io.Writer) error {
+	records, err := r.completedRecords()
+	if err != nil {
+		return err
+	}
+	profiles := make([]EventProfile, len(records))
+	var origin int64
+	for i := range records {
+		if profiles[i], err = records[i].Profile(); err != nil {
+			return err
+		}
+		if i == 0 || profiles[i].Start < origin {
+			origin = profiles[i].Start
+		}
+	}
+
+	trace := traceFile{TraceEvents: []traceEvent{}, DisplayTimeUnit: "ns"}
+	devices := make(map[C.cl_device_id]int)
+	queues := make(map[C.cl_command_queue]int)
+	for i := range records {
+		rec := &records[i]
+		device := rec.Queue.device
+		if device == nil {
+			if device, err = rec.Queue.GetQueueDevice(); err != nil {
+				return err
+			}
+		}
+		pid, ok := devices[device.id]
+		if !ok {
+			pid = len(devices) + 1
+			devices[device.id] = pid
+			trace.TraceEvents = append(trace.TraceEvents, traceEvent{
+				Name: "process_name", Ph: "M", Pid: pid,
+				Args: map[string]interface{}{"name": fmt.Sprintf("%s (device %d)", device.Name(), pid)},
+			})
+		}
+		tid, ok := queues[rec.Queue.clQueue]
+		if !ok {
+			tid = len(queues) + 1
+			queues[rec.Queue.clQueue] = tid
+			trace.TraceEvents = append(trace.TraceEvents, traceEvent{
+				Name: "thread_name", Ph: "M", Pid: pid, Tid: tid,
+				Args: map[string]interface{}{"name": fmt.Sprintf("Queue %d", tid)},
+			})
+		}
+
+		p := profiles[i]
+		args := map[string]interface{}{
+			"command":       rec.Type.String(),
+			"queueLatency":  p.QueueLatency().String(),
+			"submitLatency": p.SubmitLatency().String(),
+		}
+		if rec.Bytes > 0 {
+			args["bytes"] = rec.Bytes
+		}
+		trace.TraceEvents = append(trace.TraceEvents, traceEvent{
+			Name: rec.Name,
+			Cat:  traceCategory(rec.Type),
+			Ph:   "X",
+			Ts:   float64(p.Start-origin) / 1e3,
+			Dur:  float64(p.End-p.Start) / 1e3,
+			Pid:  pid,
+			Tid:  tid,
+			Args: args,
+		})
+	}
+	return json.NewEncoder(w).Encode(&trace)
+}
@@ -10,6 +10,7 @@ import "C"
 import (
 	"errors"
 	"fmt"
+	"strings"
 	//        "unsafe"
 )
 
@@ -214,6 +215,82 @@ var errorMapVkFFT = map[C.VkFFTResult]error{
 	C.VKFFT_ERROR_FAILED_TO_SUBMIT_BARRIER:                      ErrVkFFTFailSubmitBarrier,
 }
 
+// A failed VkFFT call, together with the plan it was made for. When VkFFT
+// failed because of an OpenCL call, CLErr holds the *Error of that call, and
+// BuildLog the build log if the call was clBuildProgram. errors.Is matches
+// both Err and CLErr, and ErrorCode returns the OpenCL code.
+type VkFFTError struct {
+	Result    int    // The VkFFTResult code.
+	Err       error  // The error of Result, such as ErrVkFFTFailCompileProgram.
+	Size      [3]int // The sizes of the plan.
+	Dim       int    // The dimensionality of the plan.
+	Precision string // "half", "single" or "double".
+	R2C       bool   // Whether the plan is a R2C/C2R transform.
+	CLErr     error
+	BuildLog  string
+}
+
+func (e *VkFFTError) Error() string {
+	kind := "C2C"
+	if e.R2C {
+		kind = "R2C"
+	}
+	msg := fmt.Sprintf("%v (%dD %s %s plan of size %v)", e.Err, e.Dim, e.Precision, kind, e.Size[:e.Dim])
+	if e.CLErr != nil {
+		msg += ": " + e.CLErr.Error()
+	}
+	if e.BuildLog != "" {
+		msg += "\n" + strings.TrimRight(e.BuildLog, "\n")
+	}
+	return msg
+}
+
+func (e *VkFFTError) Unwrap() error {
+	if e.CLErr != nil {
+		return e.CLErr
+	}
+	return e.Err
+}
+
+func (e *VkFFTError) Is(target error) bool {
+	return target == e.Err
+}
+
+// Returns nil if res is VKFFT_SUCCESS, else a *VkFFTError describing the plan
+// and the OpenCL call that failed during its last bake or transform.
+func (p *VkfftPlan) fftError(res C.VkFFTResult) error {
+	if res == C.VKFFT_SUCCESS {
+		return nil
+	}
+	plan := p.vkfftPlanStruct
+	err := &VkFFTError{
+		Result:    int(res),
+		Err:       toError(res),
+		Dim:       int(plan.config.FFTdim),
+		Precision: "single",
+		R2C:       plan.config.performR2C != 0,
+	}
+	for i := range err.Size {
+		err.Size[i] = int(plan.config.size[i])
+	}
+	if err.Dim < 1 || err.Dim > 3 {
+		err.Dim = 3
+	}
+	switch {
+	case plan.dataType < 0:
+		err.Precision = "half"
+	case plan.dataType > 0:
+		err.Precision = "double"
+	}
+	if plan.clFunction != nil {
+		err.CLErr = newError(C.GoString(plan.clFunction), plan.clError)
+	}
+	if plan.buildLog != nil {
+		err.BuildLog = C.GoString(plan.buildLog)
+	}
+	return err
+}
+
 type VkfftDirection int
 
 const (
@@ -222,24 +299,32 @@ const (
 )
 
 type VkfftPlan struct {
-	vkfftPlanStruct C.interfaceFFTPlan
+	vkfftPlanStruct *C.interfaceFFTPlan // Allocated by C, so that cgo may be passed it
+	recorder        *Recorder
+}
+
+// Turns on or off the build log and code VkFFT prints to the standard output
+// when a kernel fails to build. The build log is also in the BuildLog of the
+// returned VkFFTError. It is on by default.
+func SetVkFFTPrintBuildErrors(print bool) {
+	C.vkfftSetPrintBuildErrors(C.bool(print))
 }
 
 func (vPlan *VkfftPlan) GetPlanPointer() *C.interfaceFFTPlan {
-	return &vPlan.vkfftPlanStruct
+	return vPlan.vkfftPlanStruct
 }
 
 func NewVkFFTPlan(ctx *Context) *VkfftPlan {
 	var outPlan *C.interfaceFFTPlan
 	outPlan = C.vkfftCreateR2CFFTPlan(ctx.clContext)
-	return &VkfftPlan{*outPlan}
+	return &VkfftPlan{vkfftPlanStruct: outPlan}
 }
 
 func NewVkFFTPlanDouble(ctx *Context) *VkfftPlan {
 	var outPlan *C.interfaceFFTPlan
 	outPlan = C.vkfftCreateR2CFFTPlan(ctx.clContext)
 	C.vkfftSetFFTPlanDataType(outPlan, 1)
-	return &VkfftPlan{*outPlan}
+	return &VkfftPlan{vkfftPlanStruct: outPlan}
 }
 
 func (p *VkfftPlan) VkFFTSetFFTPlanSize(lengths []int) {
@@ -261,7 +346,43 @@ func (p *VkfftPlan) VkFFTSetFFTPlanSize(lengths []int) {
 }
 
 func (p *VkfftPlan) VkFFTEnqueueTransformUnsafe(dir VkfftDirection, input []*MemObject, output []*MemObject) error {
-	return toError(C.vkfftEnqueueTransform(p.GetPlanPointer(), (C.vkfft_transform_dir)(dir), &(input[0].clMem), &(output[0].clMem)))
+	if p.recorder == nil {
+		return p.fftError(C.vkfftEnqueueTransform(p.GetPlanPointer(), (C.vkfft_transform_dir)(dir), &(input[0].clMem), &(output[0].clMem)))
+	}
+	// A transform may launch several kernels, so it is recorded between two markers
+	queue := &CommandQueue{clQueue: p.vkfftPlanStruct.commandQueue, device: &Device{id: p.vkfftPlanStruct.device}}
+	start, err := queue.EnqueueMarkerWithWaitList(nil)
+	if err != nil {
+		return err
+	}
+	if err := p.fftError(C.vkfftEnqueueTransform(p.GetPlanPointer(), (C.vkfft_transform_dir)(dir), &(input[0].clMem), &(output[0].clMem))); err != nil {
+		start.Release()
+		return err
+	}
+	end, err := queue.EnqueueMarkerWithWaitList(nil)
+	if err != nil {
+		start.Release()
+		return err
+	}
+	name := "VkFFT Forward"
+	if dir == VkfftBackwardDirection {
+		name = "VkFFT Backward"
+	}
+	p.recorder.add(queue, end, start, CommandNDRangeKernel, name, 0)
+	return nil
+}
+
+// Records the transforms of the plan on r. The plan runs on its own command
+// queue, which is replaced by one with profiling enabled the first time a
+// Recorder is set, after its commands finish. A nil Recorder stops recording.
+func (p *VkfftPlan) SetRecorder(r *Recorder) error {
+	if r != nil {
+		if err := toError(C.vkfftEnablePlanProfiling(p.GetPlanPointer())); err != nil {
+			return err
+		}
+	}
+	p.recorder = r
+	return nil
 }
 
 func (p *VkfftPlan) EnqueueForwardTransform(input []*MemObject, output []*MemObject) error {